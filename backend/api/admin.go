@@ -26,9 +26,18 @@ func AdminMiddleware() gin.HandlerFunc {
 
 // ListUsers 管理员获取用户列表
 func ListUsers(c *gin.Context) {
-	var users []model.User
-	model.DB.Find(&users)
-	c.JSON(http.StatusOK, gin.H{"data": users})
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	users, page, err := service.ListUsers(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": users, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
 }
 
 // UpdateUserQuota 更新用户配额
@@ -92,26 +101,19 @@ func DeleteUser(c *gin.Context) {
 
 // ListAllShares 管理员获取所有分享列表
 func ListAllShares(c *gin.Context) {
-	var shares []struct {
-		model.Share
-		FileName string `json:"fileName"`
-		Username string `json:"username"`
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	err := model.DB.Table("shares").
-		Select("shares.*, files.name as file_name, users.username").
-		Joins("left join files on files.id = shares.file_id").
-		Joins("left join users on users.id = shares.user_id").
-		Where("shares.deleted_at IS NULL").
-		Order("shares.created_at desc").
-		Find(&shares).Error
-
+	shares, page, err := service.ListAllShares(q)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": shares})
+	c.JSON(http.StatusOK, gin.H{"data": shares, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
 }
 
 // DeleteShareAdmin 管理员强制删除分享
@@ -138,28 +140,48 @@ func CleanRecycleBinAdmin(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "清理完成", "count": count})
 }
 
+// RebuildSearchIndexAdmin 重建搜索索引，指定 userId 时只重建该用户的部分
+func RebuildSearchIndexAdmin(c *gin.Context) {
+	var req struct {
+		UserID uint `json:"userId"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	count, err := service.RebuildSearchIndex(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交重建任务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已开始重建索引", "count": count})
+}
+
+// GetSearchIndexHealth 获取索引健康报告，可按 userId 查看单个用户
+func GetSearchIndexHealth(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Query("userId"), 10, 32)
+	health, err := service.GetIndexHealth(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取索引状态失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": health})
+}
+
 // ListAllInvitationCodes 管理员获取所有邀请码
 func ListAllInvitationCodes(c *gin.Context) {
-	var codes []struct {
-		model.InvitationCode
-		CreatorName string `json:"creatorName"`
-		UsedByName  string `json:"usedByName"`
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	err := model.DB.Table("invitation_codes").
-		Select("invitation_codes.*, creators.username as creator_name, users.username as used_by_name").
-		Joins("left join users as creators on creators.id = invitation_codes.creator_id").
-		Joins("left join users on users.id = invitation_codes.used_by_id").
-		Where("invitation_codes.deleted_at IS NULL").
-		Order("invitation_codes.created_at desc").
-		Find(&codes).Error
-
+	codes, page, err := service.ListAllInvitationCodes(q)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": codes})
+	c.JSON(http.StatusOK, gin.H{"data": codes, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
 }
 
 // DeleteInvitationCodeAdmin 管理员删除邀请码
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/service"
+	"github.com/stfreya/stfreyanetdisk/utils"
+)
+
+// archiveErrorStatus 压缩包相关错误对应的状态码
+func archiveErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrFileNotFound), errors.Is(err, service.ErrMemberNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, utils.ErrNotArchive):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ListArchive 浏览压缩包内容 (dir: 压缩包内的目录)
+func ListArchive(c *gin.Context) {
+	userID := c.GetUint("userID")
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := service.ListArchive(userID, fileID, c.Query("dir"))
+	if err != nil {
+		c.JSON(archiveErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": entries})
+}
+
+// GetArchiveMember 预览或下载压缩包中的单个文件 (name: 成员路径，download=1 时作为附件下载)
+func GetArchiveMember(c *gin.Context) {
+	userID := c.GetUint("userID")
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, reader, err := service.OpenArchiveMember(userID, fileID, c.Query("name"))
+	if err != nil {
+		c.JSON(archiveErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	headers := map[string]string{"X-Content-Type-Options": "nosniff"}
+	if c.Query("download") == "1" {
+		headers["Content-Disposition"] = "attachment; filename*=UTF-8''" + url.PathEscape(entry.Name)
+	} else {
+		// 用户上传的 HTML/SVG 等内容禁止在本站源下执行脚本
+		headers["Content-Security-Policy"] = "sandbox"
+	}
+	c.DataFromReader(http.StatusOK, entry.Size, utils.MimeTypeOfExt(filepath.Ext(entry.Name)), reader, headers)
+}
+
+// ExtractArchive 提交解压任务
+func ExtractArchive(c *gin.Context) {
+	userID := c.GetUint("userID")
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		ParentID   uint   `json:"parentId"`
+		ParentPath string `json:"parentPath"`
+		Conflict   string `json:"conflict"` // rename / skip / overwrite
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	parentID, err := parentIDFromRequest(userID, req.ParentID, req.ParentPath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	task, err := service.ExtractArchive(userID, fileID, parentID, req.Conflict)
+	if err != nil {
+		status := archiveErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "解压任务已提交", "data": task})
+}
+
+// CompressFiles 提交压缩任务，将所选文件打包保存到网盘
+func CompressFiles(c *gin.Context) {
+	userID := c.GetUint("userID")
+	var req struct {
+		IDs        []uint   `json:"ids"`
+		Paths      []string `json:"paths"`
+		ParentID   uint     `json:"parentId"`
+		ParentPath string   `json:"parentPath"`
+		Name       string   `json:"name"`
+		Format     string   `json:"format"`   // zip / tar.gz
+		Conflict   string   `json:"conflict"` // rename / overwrite
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	ids, err := fileIDsFromRequest(userID, req.IDs, req.Paths)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	parentID, err := parentIDFromRequest(userID, req.ParentID, req.ParentPath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	task, err := service.CompressFiles(userID, ids, parentID, req.Name, req.Format, req.Conflict)
+	if err != nil {
+		status := archiveErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "压缩任务已提交", "data": task})
+}
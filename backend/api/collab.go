@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stfreya/stfreyanetdisk/service"
+)
+
+const (
+	collabWriteWait   = 10 * time.Second
+	collabPongWait    = 60 * time.Second
+	collabPingPeriod  = 50 * time.Second
+	collabMaxMessage  = 4 * 1024 * 1024
+	collabCloseReason = "session closed"
+)
+
+// 令牌通过 token 查询参数传递，不依赖 Cookie，允许跨域连接
+var collabUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// CollabEdit 建立文件的协同编辑 WebSocket 连接
+// 消息为 JSON：客户端发送 op (基于 revision 的 ot.js 格式操作)、cursor、save，
+// 服务端推送 init、ack、op、cursor、join、leave、saved、error，见 service/collab.go
+func CollabEdit(c *gin.Context) {
+	userID := c.GetUint("userID")
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, err := service.JoinCollab(userID, fileID)
+	if err != nil {
+		status := contentErrorStatus(err)
+		if errors.Is(err, service.ErrCollabFull) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := collabUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		client.Leave()
+		return
+	}
+	conn.SetReadLimit(collabMaxMessage)
+
+	go collabWritePump(conn, client)
+	defer client.Leave()
+	_ = conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		client.Handle(data)
+	}
+}
+
+// collabWritePump 将会话消息写入连接并定时发送心跳，会话关闭发送通道后断开连接
+func collabWritePump(conn *websocket.Conn, client *service.CollabClient) {
+	ticker := time.NewTicker(collabPingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+	for {
+		select {
+		case data, ok := <-client.Send():
+			_ = conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if !ok {
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, collabCloseReason))
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stfreya/stfreyanetdisk/driver"
@@ -11,20 +15,135 @@ import (
 	"github.com/stfreya/stfreyanetdisk/utils"
 )
 
+// fileIDFromRequest 获取请求中的文件 ID，路由未携带 ID 时按 path 参数解析路径
+func fileIDFromRequest(c *gin.Context, userID uint) (uint, error) {
+	if idStr := c.Param("id"); idStr != "" {
+		id, _ := strconv.ParseUint(idStr, 10, 32)
+		return uint(id), nil
+	}
+	file, err := service.ResolvePath(userID, c.Query("path"))
+	if err != nil {
+		return 0, err
+	}
+	if file == nil {
+		return 0, errors.New("文件不存在")
+	}
+	return file.ID, nil
+}
+
+// parentIDFromRequest 获取目标目录 ID，提供了目录路径时以路径为准
+func parentIDFromRequest(userID uint, parentID uint, parentPath string) (uint, error) {
+	if parentPath == "" {
+		return parentID, nil
+	}
+	return service.ResolveFolderPath(userID, parentPath)
+}
+
+// fileIDsFromRequest 合并请求中的文件 ID 列表与路径列表
+func fileIDsFromRequest(userID uint, ids []uint, paths []string) ([]uint, error) {
+	for _, p := range paths {
+		file, err := service.ResolvePath(userID, p)
+		if err != nil {
+			return nil, err
+		}
+		if file == nil {
+			return nil, errors.New("文件不存在")
+		}
+		ids = append(ids, file.ID)
+	}
+	return ids, nil
+}
+
+// fileErrorStatus 文件操作错误对应的状态码，无权操作共享给自己的文件时返回 403，其余错误使用 def
+func fileErrorStatus(err error, def int) int {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrFileNotFound):
+		return http.StatusNotFound
+	}
+	return def
+}
+
 // ListFiles 获取文件列表
 func ListFiles(c *gin.Context) {
 	userID := c.GetUint("userID")
 	parentIDStr := c.DefaultQuery("parentId", "0")
 	parentID, _ := strconv.ParseUint(parentIDStr, 10, 32)
 
-	files, err := service.ListFiles(userID, uint(parentID))
+	folderID, err := parentIDFromRequest(userID, uint(parentID), c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	breadcrumbs, err := service.GetBreadcrumbs(userID, folderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	files, page, err := service.ListFiles(userID, folderID, q)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"data": files,
+		"data":        files,
+		"nextCursor":  page.NextCursor,
+		"hasMore":     page.HasMore,
+		"parentId":    folderID,
+		"breadcrumbs": breadcrumbs,
+	})
+}
+
+// ResolvePath 将斜杠分隔的路径解析为文件
+func ResolvePath(c *gin.Context) {
+	userID := c.GetUint("userID")
+	file, err := service.ResolvePath(userID, c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var fileID uint
+	if file != nil {
+		fileID = file.ID
+	}
+	p, breadcrumbs, err := service.GetFilePath(userID, fileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        file,
+		"path":        p,
+		"breadcrumbs": breadcrumbs,
+	})
+}
+
+// GetFilePath 获取文件的完整路径
+func GetFilePath(c *gin.Context) {
+	userID := c.GetUint("userID")
+	fileID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	p, breadcrumbs, err := service.GetFilePath(userID, uint(fileID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"path":        p,
+		"breadcrumbs": breadcrumbs,
 	})
 }
 
@@ -32,8 +151,9 @@ func ListFiles(c *gin.Context) {
 func CreateFolder(c *gin.Context) {
 	userID := c.GetUint("userID")
 	var req struct {
-		ParentID uint   `json:"parentId"`
-		Name     string `json:"name" binding:"required"`
+		ParentID   uint   `json:"parentId"`
+		ParentPath string `json:"parentPath"`
+		Name       string `json:"name" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -41,8 +161,14 @@ func CreateFolder(c *gin.Context) {
 		return
 	}
 
-	if err := service.CreateFolder(userID, req.ParentID, req.Name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+	parentID, err := parentIDFromRequest(userID, req.ParentID, req.ParentPath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.CreateFolder(userID, parentID, req.Name); err != nil {
+		c.JSON(fileErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -56,6 +182,12 @@ func UploadFile(c *gin.Context) {
 	parentID, _ := strconv.ParseUint(parentIDStr, 10, 32)
 	hash := c.PostForm("hash") // 接收前端传来的哈希，支持秒传
 
+	folderID, err := parentIDFromRequest(userID, uint(parentID), c.PostForm("parentPath"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
 	file, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择文件"})
@@ -69,8 +201,8 @@ func UploadFile(c *gin.Context) {
 	}
 	defer src.Close()
 
-	if err := service.UploadFile(userID, uint(parentID), file.Filename, file.Size, src, hash); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := service.UploadFile(userID, folderID, file.Filename, file.Size, src, hash); err != nil {
+		c.JSON(fileErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -80,7 +212,11 @@ func UploadFile(c *gin.Context) {
 // ToggleFavorite 切换收藏状态
 func ToggleFavorite(c *gin.Context) {
 	userID := c.GetUint("userID")
-	fileID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 
 	var file model.File
 	if err := model.DB.Where("id = ? AND user_id = ?", fileID, userID).First(&file).Error; err != nil {
@@ -92,6 +228,7 @@ func ToggleFavorite(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
 		return
 	}
+	service.ReindexAttributes(file.ID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "操作成功", "isFavorite": !file.IsFavorite})
 }
@@ -99,22 +236,31 @@ func ToggleFavorite(c *gin.Context) {
 // ListFavorites 获取收藏列表
 func ListFavorites(c *gin.Context) {
 	userID := c.GetUint("userID")
-	var files []model.File
-	if err := model.DB.Where("user_id = ? AND is_favorite = ? AND deleted_at IS NULL", userID, true).Find(&files).Error; err != nil {
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	files, page, err := service.ListFavorites(userID, q)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": files})
+	c.JSON(http.StatusOK, gin.H{"data": files, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
 }
 
 // DeleteFile 删除文件/文件夹 (进入回收站)
 func DeleteFile(c *gin.Context) {
 	userID := c.GetUint("userID")
-	fileIDStr := c.Param("id")
-	fileID, _ := strconv.ParseUint(fileIDStr, 10, 32)
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := service.DeleteFile(userID, uint(fileID)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := service.DeleteFile(userID, fileID); err != nil {
+		c.JSON(fileErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -124,14 +270,19 @@ func DeleteFile(c *gin.Context) {
 // PreviewFile 预览文件
 func PreviewFile(c *gin.Context) {
 	userID := c.GetUint("userID")
-	fileIDStr := c.Param("id")
-	fileID, _ := strconv.ParseUint(fileIDStr, 10, 32)
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 
-	var file model.File
-	if err := model.DB.Where("id = ? AND user_id = ?", fileID, userID).First(&file).Error; err != nil {
+	// 共享给自己的文件同样可以预览
+	access, err := service.AuthorizeFile(userID, fileID, model.PermissionRead)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
 		return
 	}
+	file := access.File
 
 	// 获取存储策略
 	var policy model.StoragePolicy
@@ -155,31 +306,105 @@ func PreviewFile(c *gin.Context) {
 	}
 	defer reader.Close()
 
-	// 根据扩展名设置 Content-Type
-	contentType := "application/octet-stream"
-	switch file.Ext {
-	case ".jpg", ".jpeg":
-		contentType = "image/jpeg"
-	case ".png":
-		contentType = "image/png"
-	case ".gif":
-		contentType = "image/gif"
-	case ".txt":
-		contentType = "text/plain; charset=utf-8"
-	case ".pdf":
-		contentType = "application/pdf"
-	case ".mp4":
-		contentType = "video/mp4"
-	}
-
-	c.DataFromReader(http.StatusOK, file.Size, contentType, reader, nil)
+	// 使用上传时识别并保存的 MIME 类型
+	contentType := file.MimeType
+	if contentType == "" {
+		contentType = utils.MimeTypeOfExt(file.Ext)
+	}
+
+	// 用户上传的 HTML/SVG 等内容禁止在本站源下执行脚本
+	c.DataFromReader(http.StatusOK, file.Size, contentType, reader, map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "sandbox",
+	})
+}
+
+// GetThumbnail 获取图片缩略图 (size: small/medium/large，format: jpeg/webp)
+func GetThumbnail(c *gin.Context) {
+	userID := c.GetUint("userID")
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	size := c.DefaultQuery("size", "medium")
+	format := c.DefaultQuery("format", utils.ThumbJPEG)
+	if _, ok := utils.ThumbSizes[size]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的缩略图尺寸"})
+		return
+	}
+	if format != utils.ThumbJPEG && format != utils.ThumbWebP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的缩略图格式"})
+		return
+	}
+
+	thumb, err := service.GetThumbnail(userID, fileID, size, format)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrThumbUnsupported) || errors.Is(err, service.ErrFileNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 内容变化时缩略图会重新生成，以记录 ID 与生成时间作为 ETag
+	etag := fmt.Sprintf(`"%d-%d"`, thumb.ID, thumb.CreatedAt.Unix())
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", thumb.CreatedAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "private, max-age=0, must-revalidate")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	reader, err := service.OpenThumbnail(thumb)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "缩略图获取失败"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, thumb.Bytes, utils.ThumbContentType(thumb.Format), reader, nil)
+}
+
+// ListCategoryFiles 跨目录按类别列出文件
+func ListCategoryFiles(c *gin.Context) {
+	userID := c.GetUint("userID")
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	files, page, err := service.ListCategory(userID, c.Param("category"), q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": files, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
+}
+
+// GetCategoryStats 获取各类别文件统计
+func GetCategoryStats(c *gin.Context) {
+	userID := c.GetUint("userID")
+	stats, err := service.GetCategoryStats(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": stats})
 }
 
 // RenameFile 重命名文件
 func RenameFile(c *gin.Context) {
 	userID := c.GetUint("userID")
-	fileIDStr := c.Param("id")
-	fileID, _ := strconv.ParseUint(fileIDStr, 10, 32)
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 
 	var req struct {
 		Name string `json:"name" binding:"required"`
@@ -189,8 +414,8 @@ func RenameFile(c *gin.Context) {
 		return
 	}
 
-	if err := service.RenameFile(userID, uint(fileID), req.Name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := service.RenameFile(userID, fileID, req.Name); err != nil {
+		c.JSON(fileErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -200,19 +425,29 @@ func RenameFile(c *gin.Context) {
 // MoveFile 移动文件
 func MoveFile(c *gin.Context) {
 	userID := c.GetUint("userID")
-	fileIDStr := c.Param("id")
-	fileID, _ := strconv.ParseUint(fileIDStr, 10, 32)
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 
 	var req struct {
-		ParentID uint `json:"parentId"`
+		ParentID   uint   `json:"parentId"`
+		ParentPath string `json:"parentPath"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
 		return
 	}
 
-	if err := service.MoveFile(userID, uint(fileID), req.ParentID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	parentID, err := parentIDFromRequest(userID, req.ParentID, req.ParentPath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.MoveFile(userID, fileID, parentID); err != nil {
+		c.JSON(fileErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -222,34 +457,114 @@ func MoveFile(c *gin.Context) {
 // ListRecycleBin 获取回收站列表
 func ListRecycleBin(c *gin.Context) {
 	userID := c.GetUint("userID")
-	files, err := service.ListRecycleBin(userID)
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	files, page, err := service.ListRecycleBin(userID, q)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取回收站列表失败"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": files})
+	c.JSON(http.StatusOK, gin.H{"data": files, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
+}
+
+// contentETag 在线编辑内容的 ETag 即内容版本
+func contentETag(version string) string {
+	return `"` + version + `"`
+}
+
+// contentErrorStatus 在线编辑相关错误对应的状态码
+func contentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrFileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrContentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrVersionRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, service.ErrVersionConflict):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// GetFileContent 读取文本文件用于在线编辑，返回内容、编码与版本 (同时作为 ETag)
+func GetFileContent(c *gin.Context) {
+	userID := c.GetUint("userID")
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	content, err := service.GetFileContent(userID, fileID)
+	if err != nil {
+		c.JSON(contentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("ETag", contentETag(content.Version))
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, gin.H{"data": content})
 }
 
 // SaveFileContent 保存文件内容 (仅限文本文件)
+// 请求须携带编辑开始时的版本 (baseVersion 或 If-Match 头)，未携带时返回 428，版本已变化时返回 409 及当前版本
+// 除 JSON 外也接受 text/plain 请求体，此时编码通过 encoding、bom 查询参数指定
 func SaveFileContent(c *gin.Context) {
 	userID := c.GetUint("userID")
-	fileIDStr := c.Param("id")
-	fileID, _ := strconv.ParseUint(fileIDStr, 10, 32)
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 
+	// UTF-8 文本经 JSON 转义后最多膨胀数倍，按上限留出余量
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.EditMaxFileSize()*6+1024*1024)
 	var req struct {
-		Content string `json:"content" binding:"required"`
+		Content     *string `json:"content"`
+		Encoding    string  `json:"encoding"`
+		BOM         bool    `json:"bom"`
+		BaseVersion string  `json:"baseVersion"`
+	}
+	if c.ContentType() == "application/json" {
+		if err := c.ShouldBindJSON(&req); err != nil || req.Content == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+	} else {
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrContentTooLarge.Error()})
+			return
+		}
+		text := string(data)
+		req.Content = &text
+		req.Encoding = c.Query("encoding")
+		req.BOM = c.Query("bom") == "1" || c.Query("bom") == "true"
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
-		return
+	if req.BaseVersion == "" {
+		req.BaseVersion = strings.Trim(strings.TrimPrefix(c.GetHeader("If-Match"), "W/"), `"`)
 	}
 
-	if err := service.SaveFileContent(userID, uint(fileID), req.Content); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	te := utils.TextEncoding{Name: req.Encoding, BOM: req.BOM}
+	saved, err := service.SaveFileContent(userID, fileID, *req.Content, te, req.BaseVersion)
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) && saved != nil {
+			c.Header("ETag", contentETag(saved.Version))
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "data": saved})
+			return
+		}
+		c.JSON(contentErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "保存成功"})
+	c.Header("ETag", contentETag(saved.Version))
+	c.JSON(http.StatusOK, gin.H{"message": "保存成功", "data": saved})
 }
 
 // RestoreFile 还原文件
@@ -281,12 +596,15 @@ func PermanentDeleteFile(c *gin.Context) {
 // ListFileVersions 获取文件版本列表
 func ListFileVersions(c *gin.Context) {
 	userID := c.GetUint("userID")
-	fileIDStr := c.Param("id")
-	fileID, _ := strconv.ParseUint(fileIDStr, 10, 32)
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 
-	versions, err := service.ListFileVersions(userID, uint(fileID))
+	versions, err := service.ListFileVersions(userID, fileID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(fileErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"data": versions})
@@ -299,7 +617,7 @@ func RestoreFileVersion(c *gin.Context) {
 	versionID, _ := strconv.ParseUint(versionIDStr, 10, 32)
 
 	if err := service.RestoreFileVersion(userID, uint(versionID)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(fileErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "版本还原成功"})
@@ -309,23 +627,39 @@ func RestoreFileVersion(c *gin.Context) {
 func BatchDownloadFiles(c *gin.Context) {
 	userID := c.GetUint("userID")
 	var req struct {
-		IDs []uint `json:"ids" binding:"required"`
+		IDs   []uint   `json:"ids"`
+		Paths []string `json:"paths"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
 		return
 	}
 
+	ids, err := fileIDsFromRequest(userID, req.IDs, req.Paths)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
 	c.Header("Content-Disposition", "attachment; filename=batch_download.zip")
 	c.Header("Content-Type", "application/zip")
 
-	if err := service.BatchDownloadFiles(userID, req.IDs, c.Writer); err != nil {
+	if err := service.BatchDownloadFiles(userID, ids, c.Writer); err != nil {
 		// 注意：如果已经开始写入响应头，报错可能无法正常返回JSON
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.Header("Content-Type", "")
+			c.JSON(fileErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		}
 		return
 	}
 }
 
-// SearchFiles 搜索文件
+// SearchFiles 搜索文件，keyword 支持高级搜索语法 (name:、ext:、size:、in: 等)
 func SearchFiles(c *gin.Context) {
 	userID := c.GetUint("userID")
 	keyword := c.Query("keyword")
@@ -334,51 +668,45 @@ func SearchFiles(c *gin.Context) {
 		return
 	}
 
-	// 1. 调用全文检索索引
-	fileIDs, err := utils.SearchFiles(userID, keyword)
+	q, err := listQueryFromRequest(c)
 	if err != nil {
-		// 如果索引搜索失败，降级到数据库模糊搜索
-		files, _ := service.SearchFiles(userID, keyword)
-		c.JSON(http.StatusOK, gin.H{"data": files})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	parentID, _ := strconv.ParseUint(c.DefaultQuery("parentId", "0"), 10, 32)
 
-	// 2. 根据索引返回的 ID 查询文件详情
-	var files []model.File
-	if len(fileIDs) > 0 {
-		model.DB.Where("id IN ? AND user_id = ?", fileIDs, userID).Find(&files)
-	}
-
-	// 3. 如果全文检索结果较少，可以补充数据库模糊搜索的结果
-	if len(files) < 10 {
-		dbFiles, _ := service.SearchFiles(userID, keyword)
-		// 合并结果并去重
-		idMap := make(map[uint]bool)
-		for _, f := range files {
-			idMap[f.ID] = true
-		}
-		for _, f := range dbFiles {
-			if !idMap[f.ID] {
-				files = append(files, f)
-			}
-		}
+	result, err := service.Search(userID, keyword, uint(parentID), q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": files})
+	c.JSON(http.StatusOK, result)
 }
 
 // BatchDeleteFiles 批量删除文件
 func BatchDeleteFiles(c *gin.Context) {
 	userID := c.GetUint("userID")
 	var req struct {
-		IDs []uint `json:"ids" binding:"required"`
+		IDs   []uint   `json:"ids"`
+		Paths []string `json:"paths"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
 		return
 	}
 
-	if err := service.BatchDeleteFiles(userID, req.IDs); err != nil {
+	ids, err := fileIDsFromRequest(userID, req.IDs, req.Paths)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	if err := service.BatchDeleteFiles(userID, ids); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermanentDeleteVersions(t *testing.T) {
+	env := setupTestEnv(t, 1)
+	r := gin.New()
+	file := r.Group("/file", func(c *gin.Context) { c.Set("userID", uint(1)) })
+	file.DELETE("/permanent/:id", PermanentDeleteFile)
+
+	doc := env.put(t, 1, 0, "doc.txt", "current")
+	other := env.put(t, 1, 0, "other.txt", "shared")
+	old := env.put(t, 1, 0, "old.txt", "first draft")
+	require.NoError(t, model.DB.Unscoped().Delete(&model.File{}, old.ID).Error)
+
+	// 一个版本独占存储，另一个与其他文件共用同一份数据
+	own := model.FileVersion{FileID: doc.ID, Size: old.Size, Path: old.Path, Hash: "v1", PolicyID: env.policy.ID}
+	shared := model.FileVersion{FileID: doc.ID, Size: other.Size, Path: other.Path, Hash: "v2", PolicyID: env.policy.ID}
+	require.NoError(t, model.DB.Create(&own).Error)
+	require.NoError(t, model.DB.Create(&shared).Error)
+
+	w := doRequest(r, "DELETE", fmt.Sprintf("/file/permanent/%d", doc.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var count int64
+	model.DB.Unscoped().Model(&model.FileVersion{}).Where("file_id = ?", doc.ID).Count(&count)
+	assert.Zero(t, count)
+	assert.NoFileExists(t, filepath.Join(env.root, doc.Path))
+	assert.NoFileExists(t, filepath.Join(env.root, own.Path))
+	data, err := os.ReadFile(filepath.Join(env.root, other.Path))
+	require.NoError(t, err)
+	assert.Equal(t, "shared", string(data))
+}
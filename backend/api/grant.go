@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/service"
+)
+
+// GrantFolder 将文件夹共享给站内用户或用户组
+func GrantFolder(c *gin.Context) {
+	userID := c.GetUint("userID")
+	var req struct {
+		FileID     uint   `json:"fileId"`
+		Path       string `json:"path"`
+		UserID     uint   `json:"userId"`
+		Username   string `json:"username"`
+		GroupID    uint   `json:"groupId"`
+		Permission string `json:"permission"` // read / write
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	fileID := req.FileID
+	if req.Path != "" {
+		file, err := service.ResolvePath(userID, req.Path)
+		if err != nil || file == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件夹不存在"})
+			return
+		}
+		fileID = file.ID
+	}
+
+	grant, err := service.GrantFolder(userID, service.GrantRequest{
+		FileID:     fileID,
+		UserID:     req.UserID,
+		Username:   req.Username,
+		GroupID:    req.GroupID,
+		Permission: req.Permission,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "共享成功", "data": grant})
+}
+
+// ListFolderGrants 获取文件夹的站内共享记录
+func ListFolderGrants(c *gin.Context) {
+	userID := c.GetUint("userID")
+	fileID, err := fileIDFromRequest(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	grants, err := service.ListFolderGrants(userID, fileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": grants})
+}
+
+// RevokeGrant 取消站内共享
+func RevokeGrant(c *gin.Context) {
+	userID := c.GetUint("userID")
+	grantID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := service.RevokeGrant(userID, uint(grantID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已取消共享"})
+}
+
+// ListSharedWithMe 与我共享的文件夹，文件夹内容通过 /file/list?parentId= 浏览
+func ListSharedWithMe(c *gin.Context) {
+	userID := c.GetUint("userID")
+	folders, err := service.ListSharedWithMe(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": folders})
+}
@@ -0,0 +1,340 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// grantFixture 所有者 (1) 的目录树：
+//
+//	/proj (共享给读者 2 只读、用户组 team 读写)
+//	  sub/x.txt
+//	/private/y.txt
+//
+// 用户 3 为 team 成员，用户 4 未获授权
+type grantFixture struct {
+	router            *gin.Engine
+	proj, sub, secret *model.File
+	x, y              *model.File
+	team              model.UserGroup
+}
+
+const (
+	grantOwner    = 1
+	grantReader   = 2
+	grantWriter   = 3
+	grantOutsider = 4
+)
+
+func setupGrantTest(t *testing.T) *grantFixture {
+	env := setupTestEnv(t, grantOwner, grantReader, grantWriter, grantOutsider)
+	fx := &grantFixture{}
+	fx.proj = env.mkdir(t, grantOwner, 0, 0, "proj")
+	fx.sub = env.mkdir(t, grantOwner, 0, fx.proj.ID, "sub")
+	fx.x = env.put(t, grantOwner, fx.sub.ID, "x.txt", "project notes")
+	fx.secret = env.mkdir(t, grantOwner, 0, 0, "private")
+	fx.y = env.put(t, grantOwner, fx.secret.ID, "y.txt", "private notes")
+
+	fx.team = model.UserGroup{Name: "team"}
+	require.NoError(t, model.DB.Create(&fx.team).Error)
+	for _, id := range []uint{grantOwner, grantWriter} {
+		require.NoError(t, model.DB.Create(&model.UserGroupMember{GroupID: fx.team.ID, UserID: id}).Error)
+	}
+
+	r := gin.New()
+	file := r.Group("/file", func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-User"), 10, 32)
+		c.Set("userID", uint(id))
+	})
+	file.GET("/list", ListFiles)
+	file.POST("/folder", CreateFolder)
+	file.PUT("/rename/:id", RenameFile)
+	file.DELETE("/:id", DeleteFile)
+	file.GET("/preview/:id", PreviewFile)
+	file.GET("/content/:id", GetFileContent)
+	file.POST("/save/:id", SaveFileContent)
+	file.GET("/shared", ListSharedWithMe)
+	file.POST("/grant", GrantFolder)
+	file.GET("/grants/:id", ListFolderGrants)
+	file.DELETE("/grant/:id", RevokeGrant)
+	file.PUT("/move/:id", MoveFile)
+	file.GET("/versions/:id", ListFileVersions)
+	file.POST("/version/restore/:id", RestoreFileVersion)
+	file.POST("/batch/download", BatchDownloadFiles)
+	file.POST("/tags", AddTags)
+	file.POST("/compress", CompressFiles)
+	fx.router = r
+	return fx
+}
+
+func (fx *grantFixture) do(userID uint, method string, url string, body interface{}) *httptest.ResponseRecorder {
+	return doRequest(fx.router, method, url, body, "X-User", strconv.Itoa(int(userID)))
+}
+
+func (fx *grantFixture) grant(t *testing.T, body gin.H) uint {
+	w := fx.do(grantOwner, "POST", "/file/grant", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data model.FileGrant `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Data.ID
+}
+
+func TestFolderGrants(t *testing.T) {
+	fx := setupGrantTest(t)
+
+	t.Run("Grant Validation", func(t *testing.T) {
+		for name, body := range map[string]gin.H{
+			"file instead of folder": {"fileId": fx.x.ID, "username": "user2"},
+			"share with self":        {"fileId": fx.proj.ID, "userId": grantOwner},
+			"unknown user":           {"fileId": fx.proj.ID, "username": "nobody"},
+			"unknown permission":     {"fileId": fx.proj.ID, "username": "user2", "permission": "admin"},
+			"missing target":         {"fileId": fx.proj.ID},
+		} {
+			assert.Equal(t, http.StatusBadRequest, fx.do(grantOwner, "POST", "/file/grant", body).Code, name)
+		}
+		// 不是组成员时不能共享给该组
+		w := fx.do(grantReader, "POST", "/file/grant", gin.H{"fileId": fx.proj.ID, "groupId": fx.team.ID})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	readerGrant := fx.grant(t, gin.H{"path": "/proj", "username": "user2"})
+	fx.grant(t, gin.H{"fileId": fx.proj.ID, "groupId": fx.team.ID, "permission": "write"})
+
+	t.Run("Shared With Me", func(t *testing.T) {
+		for _, id := range []uint{grantReader, grantWriter} {
+			w := fx.do(id, "GET", "/file/shared", nil)
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"Name":"proj"`)
+			assert.Contains(t, w.Body.String(), `"ownerName":"user1"`)
+			assert.NotContains(t, w.Body.String(), "private")
+		}
+		assert.Contains(t, fx.do(grantWriter, "GET", "/file/shared", nil).Body.String(), `"permission":"write"`)
+		assert.Contains(t, fx.do(grantOutsider, "GET", "/file/shared", nil).Body.String(), `"data":[]`)
+
+		w := fx.do(grantOwner, "GET", fmt.Sprintf("/file/grants/%d", fx.proj.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"targetName":"user2"`)
+		assert.Contains(t, w.Body.String(), `"targetName":"team"`)
+		assert.Equal(t, http.StatusNotFound, fx.do(grantReader, "GET", fmt.Sprintf("/file/grants/%d", fx.proj.ID), nil).Code)
+	})
+
+	t.Run("Read Access", func(t *testing.T) {
+		w := fx.do(grantReader, "GET", fmt.Sprintf("/file/list?parentId=%d", fx.sub.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "x.txt")
+		// 面包屑由授权的文件夹开始
+		assert.Contains(t, w.Body.String(), `"breadcrumbs":[{"id":`+strconv.Itoa(int(fx.proj.ID)))
+
+		w = fx.do(grantReader, "GET", fmt.Sprintf("/file/preview/%d", fx.x.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "project notes", w.Body.String())
+		w = fx.do(grantReader, "GET", fmt.Sprintf("/file/content/%d", fx.x.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "project notes")
+	})
+
+	t.Run("Read Only Cannot Write", func(t *testing.T) {
+		w := fx.do(grantReader, "POST", "/file/folder", gin.H{"parentId": fx.proj.ID, "name": "new"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = fx.do(grantReader, "PUT", fmt.Sprintf("/file/rename/%d", fx.sub.ID), gin.H{"name": "renamed"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, http.StatusForbidden, fx.do(grantReader, "DELETE", fmt.Sprintf("/file/%d", fx.x.ID), nil).Code)
+	})
+
+	t.Run("Write Access Via Group", func(t *testing.T) {
+		w := fx.do(grantWriter, "POST", "/file/folder", gin.H{"parentId": fx.proj.ID, "name": "drafts"})
+		require.Equal(t, http.StatusOK, w.Code)
+		// 新建的文件夹归属所有者
+		var created model.File
+		require.NoError(t, model.DB.Where("name = ?", "drafts").First(&created).Error)
+		assert.EqualValues(t, grantOwner, created.UserID)
+		assert.Equal(t, fx.proj.ID, created.ParentID)
+
+		w = fx.do(grantWriter, "PUT", fmt.Sprintf("/file/rename/%d", created.ID), gin.H{"name": "drafts-2"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		// 不能重命名或删除授权的文件夹本身
+		w = fx.do(grantWriter, "PUT", fmt.Sprintf("/file/rename/%d", fx.proj.ID), gin.H{"name": "mine"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, http.StatusForbidden, fx.do(grantWriter, "DELETE", fmt.Sprintf("/file/%d", fx.proj.ID), nil).Code)
+	})
+
+	t.Run("Outside Grant", func(t *testing.T) {
+		for _, id := range []uint{grantReader, grantWriter, grantOutsider} {
+			w := fx.do(id, "GET", fmt.Sprintf("/file/list?parentId=%d", fx.secret.ID), nil)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Equal(t, http.StatusNotFound, fx.do(id, "GET", fmt.Sprintf("/file/preview/%d", fx.y.ID), nil).Code)
+			w = fx.do(id, "POST", "/file/folder", gin.H{"parentId": fx.secret.ID, "name": "x"})
+			assert.NotEqual(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), "目标文件夹不存在")
+		}
+		assert.Equal(t, http.StatusNotFound, fx.do(grantOutsider, "GET", fmt.Sprintf("/file/list?parentId=%d", fx.proj.ID), nil).Code)
+	})
+
+	t.Run("Deleted Folder In Chain", func(t *testing.T) {
+		require.NoError(t, model.DB.Delete(&model.File{}, fx.sub.ID).Error)
+		defer model.DB.Unscoped().Model(&model.File{}).Where("id = ?", fx.sub.ID).Update("deleted_at", nil)
+		assert.Equal(t, http.StatusNotFound, fx.do(grantReader, "GET", fmt.Sprintf("/file/preview/%d", fx.x.ID), nil).Code)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, fx.do(grantReader, "DELETE", fmt.Sprintf("/file/grant/%d", readerGrant), nil).Code)
+		require.Equal(t, http.StatusOK, fx.do(grantOwner, "DELETE", fmt.Sprintf("/file/grant/%d", readerGrant), nil).Code)
+		assert.Equal(t, http.StatusNotFound, fx.do(grantReader, "GET", fmt.Sprintf("/file/list?parentId=%d", fx.proj.ID), nil).Code)
+		// 用户组成员不受影响
+		assert.Equal(t, http.StatusOK, fx.do(grantWriter, "GET", fmt.Sprintf("/file/list?parentId=%d", fx.proj.ID), nil).Code)
+	})
+}
+
+func TestGrantedFileOperations(t *testing.T) {
+	fx := setupGrantTest(t)
+	fx.grant(t, gin.H{"fileId": fx.proj.ID, "username": "user2"})
+	fx.grant(t, gin.H{"fileId": fx.proj.ID, "groupId": fx.team.ID, "permission": "write"})
+
+	t.Run("Move Within Grant", func(t *testing.T) {
+		move := func(userID uint, fileID uint, parentID uint) *httptest.ResponseRecorder {
+			return fx.do(userID, "PUT", fmt.Sprintf("/file/move/%d", fileID), gin.H{"parentId": parentID})
+		}
+		assert.Equal(t, http.StatusForbidden, move(grantReader, fx.x.ID, fx.proj.ID).Code)
+		assert.Equal(t, http.StatusNotFound, move(grantOutsider, fx.x.ID, fx.proj.ID).Code)
+		// 授权的文件夹本身不能移动
+		assert.Equal(t, http.StatusForbidden, move(grantWriter, fx.proj.ID, 0).Code)
+		// 不能移出到授权范围之外或自己的空间
+		w := move(grantWriter, fx.x.ID, fx.secret.ID)
+		assert.NotEqual(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "目标文件夹不存在")
+		w = move(grantWriter, fx.x.ID, 0)
+		assert.NotEqual(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "不能在不同用户的文件夹之间移动")
+
+		w = move(grantWriter, fx.x.ID, fx.proj.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var moved model.File
+		require.NoError(t, model.DB.First(&moved, fx.x.ID).Error)
+		assert.Equal(t, fx.proj.ID, moved.ParentID)
+		assert.Equal(t, model.BuildTreePath(fx.proj.TreePath, moved.ID), moved.TreePath)
+		assert.EqualValues(t, grantOwner, moved.UserID)
+		require.Equal(t, http.StatusOK, move(grantWriter, fx.x.ID, fx.sub.ID).Code)
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		// 历史版本引用 y.txt 的数据，大小与当前版本不同以便核对空间占用
+		version := model.FileVersion{FileID: fx.x.ID, Size: 100, Path: fx.y.Path, Hash: "old", PolicyID: fx.y.PolicyID}
+		require.NoError(t, model.DB.Create(&version).Error)
+
+		w := fx.do(grantReader, "GET", fmt.Sprintf("/file/versions/%d", fx.x.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"Hash":"old"`)
+		assert.Equal(t, http.StatusNotFound, fx.do(grantOutsider, "GET", fmt.Sprintf("/file/versions/%d", fx.x.ID), nil).Code)
+
+		restore := func(userID uint) int {
+			return fx.do(userID, "POST", fmt.Sprintf("/file/version/restore/%d", version.ID), nil).Code
+		}
+		assert.Equal(t, http.StatusForbidden, restore(grantReader))
+		assert.Equal(t, http.StatusNotFound, restore(grantOutsider))
+
+		require.Equal(t, http.StatusOK, restore(grantWriter))
+		var restored model.File
+		require.NoError(t, model.DB.First(&restored, fx.x.ID).Error)
+		assert.Equal(t, "old", restored.Hash)
+		// 空间变化计入所有者而非操作者
+		var owner, writer model.User
+		require.NoError(t, model.DB.First(&owner, grantOwner).Error)
+		require.NoError(t, model.DB.First(&writer, grantWriter).Error)
+		assert.EqualValues(t, 100-fx.x.Size, owner.UsedSize)
+		assert.Zero(t, writer.UsedSize)
+	})
+
+	t.Run("Batch Download", func(t *testing.T) {
+		w := fx.do(grantReader, "POST", "/file/batch/download", gin.H{"ids": []uint{fx.sub.ID, fx.y.ID}})
+		require.Equal(t, http.StatusOK, w.Code)
+		zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		require.NoError(t, err)
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		assert.Contains(t, names, "sub/x.txt")
+		assert.NotContains(t, names, "y.txt")
+		// 无权访问的文件记入失败清单
+		assert.Contains(t, names, "打包失败的文件.txt")
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		w := fx.do(grantReader, "POST", "/file/tags", gin.H{"ids": []uint{fx.x.ID}, "tags": []string{"draft"}})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = fx.do(grantWriter, "POST", "/file/tags", gin.H{"ids": []uint{fx.x.ID}, "tags": []string{"draft"}})
+		require.Equal(t, http.StatusOK, w.Code)
+		var tag model.FileTag
+		require.NoError(t, model.DB.Where("file_id = ? AND name = ?", fx.x.ID, "draft").First(&tag).Error)
+		assert.EqualValues(t, grantOwner, tag.UserID)
+		w = fx.do(grantWriter, "POST", "/file/tags", gin.H{"ids": []uint{fx.y.ID}, "tags": []string{"draft"}})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Compress", func(t *testing.T) {
+		compress := func(userID uint, parentID uint) *httptest.ResponseRecorder {
+			return fx.do(userID, "POST", "/file/compress", gin.H{"ids": []uint{fx.sub.ID}, "parentId": parentID})
+		}
+		// 只读授权可以把共享的文件压缩到自己的空间，但不能写入共享的文件夹
+		assert.Equal(t, http.StatusOK, compress(grantReader, 0).Code)
+		assert.Equal(t, http.StatusForbidden, compress(grantReader, fx.proj.ID).Code)
+		assert.Equal(t, http.StatusOK, compress(grantWriter, fx.proj.ID).Code)
+		assert.Equal(t, http.StatusNotFound, compress(grantOutsider, 0).Code)
+	})
+
+	t.Run("Save Content", func(t *testing.T) {
+		// 还原历史版本后 x.txt 记录的哈希与实际内容不一致，读取不会改写记录的版本
+		w := fx.do(grantReader, "GET", fmt.Sprintf("/file/content/%d", fx.x.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"version":"old"`)
+		var current model.File
+		require.NoError(t, model.DB.First(&current, fx.x.ID).Error)
+		assert.Equal(t, "old", current.Hash)
+
+		save := func(userID uint, body gin.H, headers ...string) *httptest.ResponseRecorder {
+			headers = append(headers, "X-User", strconv.Itoa(int(userID)))
+			return doRequest(fx.router, "POST", fmt.Sprintf("/file/save/%d", fx.x.ID), body, headers...)
+		}
+		assert.Equal(t, http.StatusPreconditionRequired, save(grantWriter, gin.H{"content": "v2"}).Code)
+		assert.Equal(t, http.StatusForbidden, save(grantReader, gin.H{"content": "v2", "baseVersion": "old"}).Code)
+
+		w = save(grantWriter, gin.H{"content": "v2", "baseVersion": "old"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Data struct {
+				Version string `json:"version"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		version := resp.Data.Version
+		assert.NotEqual(t, "old", version)
+
+		// 另一个标签页基于旧版本保存时返回冲突及当前版本
+		w = save(grantWriter, gin.H{"content": "v3", "baseVersion": "old"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), version)
+		w = save(grantWriter, gin.H{"content": "v3"}, "If-Match", `"`+version+`"`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// 尚未记录哈希的历史文件可以不携带版本，保存后补全
+		require.NoError(t, model.DB.Model(&model.File{}).Where("id = ?", fx.y.ID).UpdateColumn("hash", "").Error)
+		w = doRequest(fx.router, "POST", fmt.Sprintf("/file/save/%d", fx.y.ID), gin.H{"content": "notes"}, "X-User", strconv.Itoa(grantOwner))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var legacy model.File
+		require.NoError(t, model.DB.First(&legacy, fx.y.ID).Error)
+		assert.NotEmpty(t, legacy.Hash)
+	})
+}
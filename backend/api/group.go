@@ -0,0 +1,118 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/service"
+)
+
+// ListGroups 管理员获取用户组列表
+func ListGroups(c *gin.Context) {
+	groups, err := service.ListGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": groups})
+}
+
+// CreateGroup 管理员创建用户组
+func CreateGroup(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	group, err := service.CreateGroup(req.Name, req.Description)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "创建成功", "data": group})
+}
+
+// UpdateGroup 管理员修改用户组
+func UpdateGroup(c *gin.Context) {
+	groupID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	if err := service.UpdateGroup(uint(groupID), req.Name, req.Description); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+// DeleteGroup 管理员删除用户组
+func DeleteGroup(c *gin.Context) {
+	groupID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := service.DeleteGroup(uint(groupID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// ListGroupMembers 管理员获取用户组成员
+func ListGroupMembers(c *gin.Context) {
+	groupID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	members, err := service.ListGroupMembers(uint(groupID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": members})
+}
+
+// AddGroupMembers 管理员向用户组添加成员
+func AddGroupMembers(c *gin.Context) {
+	groupID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req struct {
+		UserIDs []uint `json:"userIds" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	if err := service.AddGroupMembers(uint(groupID), req.UserIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "添加成功"})
+}
+
+// RemoveGroupMember 管理员将用户移出用户组
+func RemoveGroupMember(c *gin.Context) {
+	groupID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	userID, _ := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err := service.RemoveGroupMember(uint(groupID), uint(userID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "移除成功"})
+}
+
+// ListMyGroups 获取当前用户所在的用户组
+func ListMyGroups(c *gin.Context) {
+	userID := c.GetUint("userID")
+	groups, err := service.ListUserGroups(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": groups})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/service"
+)
+
+// parseQueryTime 解析日期参数，支持 2006-01-02 与 RFC3339 格式
+func parseQueryTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, errors.New("日期格式错误")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Millisecond)
+	}
+	return &t, nil
+}
+
+// listQueryFromRequest 从请求参数中解析分页、排序与筛选条件
+func listQueryFromRequest(c *gin.Context) (service.ListQuery, error) {
+	q := service.ListQuery{
+		Cursor:   c.Query("cursor"),
+		SortBy:   c.Query("sortBy"),
+		Order:    c.Query("order"),
+		Category: c.Query("category"),
+		Tag:      c.Query("tag"),
+		Keyword:  c.Query("keyword"),
+		Role:     c.Query("role"),
+	}
+	q.Limit, _ = strconv.Atoi(c.Query("limit"))
+
+	if status := c.Query("status"); status != "" {
+		v, err := strconv.Atoi(status)
+		if err != nil {
+			return q, errors.New("状态参数错误")
+		}
+		q.Status = &v
+	}
+	if userID := c.Query("userId"); userID != "" {
+		v, _ := strconv.ParseUint(userID, 10, 32)
+		q.UserID = uint(v)
+	}
+
+	var err error
+	if q.From, err = parseQueryTime(c.Query("from"), false); err != nil {
+		return q, err
+	}
+	if q.To, err = parseQueryTime(c.Query("to"), true); err != nil {
+		return q, err
+	}
+	return q, nil
+}
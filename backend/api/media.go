@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/service"
+)
+
+// GetPhotoTimeline 按拍摄日期分组的照片时间线 (group: day/month)
+func GetPhotoTimeline(c *gin.Context) {
+	userID := c.GetUint("userID")
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groups, page, err := service.PhotoTimeline(userID, c.Query("group"), q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": groups, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
+}
+
+// GetTimelineSummary 时间线各日期的照片数量
+func GetTimelineSummary(c *gin.Context) {
+	userID := c.GetUint("userID")
+	counts, err := service.TimelineSummary(userID, c.Query("group"), c.Query("category"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": counts})
+}
+
+// ListPlaceAlbums 按拍摄地点聚合的相册 (radius: 聚合半径，单位千米)
+func ListPlaceAlbums(c *gin.Context) {
+	userID := c.GetUint("userID")
+	radius, _ := strconv.ParseFloat(c.Query("radius"), 64)
+
+	albums, err := service.ListPlaceAlbums(userID, radius)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取相册失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": albums})
+}
+
+// ListPlaceFiles 列出指定经纬度范围内拍摄的照片
+func ListPlaceFiles(c *gin.Context) {
+	userID := c.GetUint("userID")
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var bounds service.GeoBounds
+	for name, dst := range map[string]*float64{
+		"minLat": &bounds.MinLat, "maxLat": &bounds.MaxLat,
+		"minLng": &bounds.MinLng, "maxLng": &bounds.MaxLng,
+	} {
+		if *dst, err = strconv.ParseFloat(c.Query(name), 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "坐标参数错误"})
+			return
+		}
+	}
+
+	files, page, err := service.ListPlaceFiles(userID, bounds, q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": files, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/middleware"
+)
+
+// RegisterRoutes 注册全部接口路由，服务启动与接口测试共用
+func RegisterRoutes(r *gin.Engine) {
+	// 路由组
+	v1 := r.Group("/api/v1")
+	{
+
+		// 公开接口 (认证相关)
+		auth := v1.Group("/auth")
+		{
+			auth.GET("/captcha", GetCaptcha)
+			auth.GET("/config", GetPublicConfigs)
+			auth.POST("/register", Register)
+			auth.POST("/login", Login)
+		}
+
+		// 分享相关接口 (公开)
+		share := v1.Group("/share")
+		{
+			share.GET("/info/:token", GetShare)
+			share.GET("/list/:token", GetShareFolderList)
+			share.POST("/verify/:token", VerifySharePassword)
+			share.GET("/download/:token", DownloadShare)
+			share.GET("/preview/:token", PreviewShare)
+			share.POST("/upload/:token", UploadToShare)
+			share.GET("/public", ListPublicShares)
+			share.GET("/cover/:token", GetShareCover)
+			share.GET("/qrcode/:token", GetShareQRCode)
+			share.POST("/save/:token", middleware.AuthMiddleware(), SaveShare)
+		}
+
+		// 文件管理接口 (需要认证)
+		file := v1.Group("/file")
+		file.Use(middleware.AuthMiddleware())
+		{
+			file.GET("/list", ListFiles)
+			file.GET("/resolve", ResolvePath)
+			file.GET("/path/:id", GetFilePath)
+			file.GET("/favorites", ListFavorites)
+			file.GET("/categories", GetCategoryStats)
+			file.GET("/category/:category", ListCategoryFiles)
+			file.GET("/timeline", GetPhotoTimeline)
+			file.GET("/timeline/summary", GetTimelineSummary)
+			file.GET("/places", ListPlaceAlbums)
+			file.GET("/places/files", ListPlaceFiles)
+			file.GET("/tags", ListTags)
+			file.GET("/tag/:name", ListTaggedFiles)
+			file.POST("/tags", AddTags)
+			file.POST("/tags/remove", RemoveTags)
+			file.POST("/meta", SetFileMeta)
+			file.POST("/meta/remove", RemoveFileMeta)
+			file.POST("/folder", CreateFolder)
+			file.POST("/upload", UploadFile)
+			file.POST("/share", CreateShare)
+			file.GET("/shared", ListSharedWithMe)
+			file.POST("/grant", GrantFolder)
+			file.GET("/grants/:id", ListFolderGrants)
+			file.DELETE("/grant/:id", RevokeGrant)
+			file.POST("/favorite/:id", ToggleFavorite)
+			file.DELETE("/:id", DeleteFile)
+			file.GET("/preview/:id", PreviewFile)
+			file.GET("/thumb/:id", GetThumbnail)
+			file.GET("/archive/:id", ListArchive)
+			file.GET("/archive/:id/member", GetArchiveMember)
+			file.POST("/archive/:id/extract", ExtractArchive)
+			file.GET("/content/:id", GetFileContent)
+			file.GET("/collab/:id", CollabEdit)
+			file.POST("/save/:id", SaveFileContent)
+			file.PUT("/rename/:id", RenameFile)
+			file.PUT("/move/:id", MoveFile)
+			file.POST("/batch/download", BatchDownloadFiles)
+			file.POST("/compress", CompressFiles)
+			file.POST("/batch/delete", BatchDeleteFiles)
+			file.GET("/search", SearchFiles)
+			file.GET("/recycle", ListRecycleBin)
+			file.POST("/restore/:id", RestoreFile)
+			file.DELETE("/permanent/:id", PermanentDeleteFile)
+			file.GET("/versions/:id", ListFileVersions)
+			file.POST("/version/restore/:id", RestoreFileVersion)
+
+			// 按路径寻址 (通过 ?path= 指定文件)
+			file.POST("/favorite", ToggleFavorite)
+			file.DELETE("", DeleteFile)
+			file.GET("/preview", PreviewFile)
+			file.GET("/thumb", GetThumbnail)
+			file.GET("/archive", ListArchive)
+			file.GET("/archive/member", GetArchiveMember)
+			file.POST("/archive/extract", ExtractArchive)
+			file.GET("/content", GetFileContent)
+			file.GET("/collab", CollabEdit)
+			file.POST("/save", SaveFileContent)
+			file.PUT("/rename", RenameFile)
+			file.PUT("/move", MoveFile)
+			file.GET("/versions", ListFileVersions)
+			file.GET("/grants", ListFolderGrants)
+		}
+
+		// 后台任务接口
+		task := v1.Group("/task")
+		task.Use(middleware.AuthMiddleware())
+		{
+			task.GET("/list", ListTasks)
+			task.GET("/:id", GetTask)
+			task.POST("/:id/cancel", CancelTask)
+			task.DELETE("/:id", DeleteTask)
+		}
+
+		// 管理员接口
+		admin := v1.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), AdminMiddleware())
+		{
+			admin.GET("/users", ListUsers)
+			admin.POST("/user/quota", UpdateUserQuota)
+			admin.PUT("/user/update", UpdateUserAdmin)
+			admin.DELETE("/user/:id", DeleteUser)
+			admin.GET("/policies", ListPolicies)
+			admin.POST("/policy", CreatePolicy)
+			admin.PUT("/policy/:id", UpdatePolicy)
+			admin.DELETE("/policy/:id", DeletePolicy)
+			admin.POST("/policy/test", TestStorageConnection)
+			admin.GET("/policy/templates", GetStorageTemplates)
+			admin.GET("/stats", GetSystemStats)
+			admin.GET("/configs", ListConfigs)
+			admin.POST("/configs", UpdateConfigs)
+			admin.POST("/recycle/clean", CleanRecycleBinAdmin)
+			admin.POST("/search/rebuild", RebuildSearchIndexAdmin)
+			admin.GET("/search/health", GetSearchIndexHealth)
+			admin.GET("/shares", ListAllShares)
+			admin.DELETE("/share/:id", DeleteShareAdmin)
+			admin.GET("/shares/review", ListShareReviews)
+			admin.POST("/share/:id/review", ReviewShare)
+			admin.GET("/groups", ListGroups)
+			admin.POST("/group", CreateGroup)
+			admin.PUT("/group/:id", UpdateGroup)
+			admin.DELETE("/group/:id", DeleteGroup)
+			admin.GET("/group/:id/members", ListGroupMembers)
+			admin.POST("/group/:id/members", AddGroupMembers)
+			admin.DELETE("/group/:id/member/:userId", RemoveGroupMember)
+			admin.GET("/invites", ListAllInvitationCodes)
+			admin.POST("/invite/generate", BatchGenerateInvitationCodesAdmin)
+			admin.DELETE("/invite/:id", DeleteInvitationCodeAdmin)
+		}
+
+		// 用户接口 (积分、邀请、消息等)
+		user := v1.Group("/user")
+		user.Use(middleware.AuthMiddleware())
+		{
+			user.GET("/info", GetUserInfo)
+			user.PUT("/profile", UpdateProfile)
+			user.POST("/signin", UserSignIn)
+			user.POST("/exchange/quota", ExchangeQuota)
+			user.POST("/invite/generate", GenerateInvitationCode)
+			user.GET("/invite/list", ListUserInvitationCodes)
+			user.GET("/shares", ListUserShares)
+			user.GET("/groups", ListMyGroups)
+			user.DELETE("/share/:id", DeleteUserShare)
+			user.PUT("/share/:id", UpdateUserShare)
+			user.POST("/share/:id/renew", RenewUserShare)
+			user.POST("/shares/revoke", RevokeUserShares)
+			user.GET("/share/:id/stats", GetShareStats)
+			user.GET("/share/:id/files", GetShareTopFiles)
+			user.GET("/share/:id/logs", ListShareAccessLogs)
+			user.POST("/share/:id/publish", PublishShare)
+			user.DELETE("/share/:id/publish", UnpublishShare)
+			user.PUT("/share/:id/alias", SetShareAlias)
+			user.GET("/transactions", GetUserTransactions)
+
+			// 消息通知
+			user.GET("/messages", ListMessages)
+			user.GET("/messages/unread/count", GetUnreadCount)
+			user.POST("/messages/read/:id", MarkMessageRead)
+			user.POST("/messages/read/all", MarkAllMessagesRead)
+			user.DELETE("/messages/:id", DeleteMessage)
+
+			user.GET("/ping", func(c *gin.Context) {
+				c.JSON(200, gin.H{"message": "auth success"})
+			})
+		}
+	}
+
+	// WebDAV 接口
+	r.Any("/webdav/*any", WebDAVHandler())
+
+	// 基础健康检查
+	r.GET("/ping", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"message": "pong",
+			"status":  "StfreyaNetdisk 后端运行中",
+		})
+	})
+}
@@ -1,23 +1,38 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stfreya/stfreyanetdisk/driver"
 	"github.com/stfreya/stfreyanetdisk/model"
 	"github.com/stfreya/stfreyanetdisk/service"
+	"github.com/stfreya/stfreyanetdisk/utils"
 )
 
 // CreateShare 创建分享接口
 func CreateShare(c *gin.Context) {
 	userID := c.GetUint("userID")
 	var req struct {
-		FileID     uint   `json:"fileId" binding:"required"`
-		Password   string `json:"password"`
-		ExpireDays int    `json:"expireDays"`
+		FileID         uint   `json:"fileId"`
+		Path           string `json:"path"`
+		Password       string `json:"password"`
+		ExpireDays     int    `json:"expireDays"`
+		Mode           string `json:"mode"`           // 空:普通, preview:仅预览, upload:收集文件
+		MaxViews       int    `json:"maxViews"`       // 访问次数上限，0 不限
+		MaxDownloads   int    `json:"maxDownloads"`   // 下载次数上限，0 不限
+		UploadMaxSize  int64  `json:"uploadMaxSize"`  // 收集文件的单个文件大小上限 (字节)
+		UploadExts     string `json:"uploadExts"`     // 收集文件允许的扩展名，如 "pdf,docx"
+		ArchiveMaxSize int64  `json:"archiveMaxSize"` // 打包下载文件夹的大小上限 (字节)，0 使用系统配置
+		Alias          string `json:"alias"`          // 自定义短链接
+		ShortAlias     bool   `json:"shortAlias"`     // 随机生成短链接
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -25,9 +40,38 @@ func CreateShare(c *gin.Context) {
 		return
 	}
 
-	token, err := service.CreateShare(userID, req.FileID, req.Password, req.ExpireDays)
+	fileID := req.FileID
+	if req.Path != "" {
+		file, err := service.ResolvePath(userID, req.Path)
+		if err != nil || file == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+			return
+		}
+		fileID = file.ID
+	}
+	if fileID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	share, err := service.CreateShare(userID, fileID, service.ShareOptions{
+		Password:       req.Password,
+		ExpireDays:     req.ExpireDays,
+		Mode:           req.Mode,
+		MaxViews:       req.MaxViews,
+		MaxDownloads:   req.MaxDownloads,
+		UploadMaxSize:  req.UploadMaxSize,
+		UploadExts:     req.UploadExts,
+		ArchiveMaxSize: req.ArchiveMaxSize,
+		Alias:          req.Alias,
+		ShortAlias:     req.ShortAlias,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrShareAliasTaken) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -42,99 +86,161 @@ func CreateShare(c *gin.Context) {
 	}()
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+		"token": share.Token,
+		"alias": share.Alias,
+		"url":   service.ShareURL(share, siteURL(c)),
 	})
 }
 
-// GetShare 获取分享接口
+// shareErrorStatus 分享相关错误对应的 HTTP 状态码
+func shareErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrShareExhausted):
+		return http.StatusGone
+	case errors.Is(err, service.ErrSharePreviewOnly), errors.Is(err, service.ErrShareUploadOnly),
+		errors.Is(err, service.ErrShareUploadDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrShareUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrShareUploadType):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusNotFound
+}
+
+// recordShareAccess 记录分享访问日志
+func recordShareAccess(c *gin.Context, share *model.Share, action string, fileID uint) {
+	service.RecordShareAccess(share.ID, action, fileID, service.ShareVisitor{
+		UserID:    c.GetUint("userID"),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+}
+
+// GetShare 获取分享接口，打开分享页面时计入一次访问
 func GetShare(c *gin.Context) {
 	token := c.Param("token")
 	share, file, err := service.GetShare(token)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(shareErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
+	recordShareAccess(c, share, model.ShareActionView, file.ID)
+
+	info := gin.H{
+		"id":           share.ID,
+		"hasPassword":  share.Password != "",
+		"expireTime":   share.ExpireTime,
+		"views":        share.Views,
+		"mode":         share.Mode,
+		"maxViews":     share.MaxViews,
+		"maxDownloads": share.MaxDownloads,
+		"downloads":    share.Downloads,
+	}
+	if share.Mode == model.ShareModeUpload {
+		info["uploadMaxSize"] = service.ShareUploadLimit(share)
+		info["uploadExts"] = share.UploadExts
+	} else if share.Mode == model.ShareModeNormal && file.IsFolder {
+		info["archiveMaxSize"] = service.ShareArchiveLimit(share)
+	}
+	if share.Password == "" {
+		info["title"] = share.Title
+		info["description"] = share.Description
+		info["hasCover"] = share.CoverFileID != 0
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"share": gin.H{
-			"id":          share.ID,
-			"hasPassword": share.Password != "",
-			"expireTime":  share.ExpireTime,
-			"views":       share.Views,
-		},
+		"share": info,
 		"file": gin.H{
-			"name": file.Name,
-			"size": file.Size,
-			"ext":  file.Ext,
+			"name":     file.Name,
+			"size":     file.Size,
+			"ext":      file.Ext,
+			"isFolder": file.IsFolder,
 		},
+		"og": service.ShareOpenGraph(share, file, siteURL(c)),
 	})
 }
 
-// VerifySharePassword 校验分享提取码
+// shareAccessCookie 分享访问令牌的 Cookie 名称，以分享令牌命名，通过短链接或令牌打开时共用
+func shareAccessCookie(share *model.Share) string {
+	return "share_access_" + share.Token
+}
+
+// shareAccessToken 读取请求携带的分享访问令牌：X-Share-Token 头或 Cookie
+// 令牌不接受查询参数，避免出现在链接、服务器日志与浏览记录中；浏览器直接下载时由 Cookie 携带
+func shareAccessToken(c *gin.Context, share *model.Share) string {
+	if t := c.GetHeader("X-Share-Token"); t != "" {
+		return t
+	}
+	if t, err := c.Cookie(shareAccessCookie(share)); err == nil && t != "" {
+		return t
+	}
+	return ""
+}
+
+// requireShareAccess 校验分享访问权限，失败时写入响应
+func requireShareAccess(c *gin.Context, share *model.Share) bool {
+	if err := service.CheckShareAccess(share, shareAccessToken(c, share)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// VerifySharePassword 校验分享提取码，成功后签发短期有效的访问令牌，同时写入 Cookie
 func VerifySharePassword(c *gin.Context) {
 	token := c.Param("token")
 	var req struct {
-		Password string `json:"password" binding:"required"`
+		Password string `json:"password"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
 		return
 	}
 
-	share, _, err := service.GetShare(token)
+	share, access, err := service.VerifySharePassword(token, req.Password, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		var limited *service.RateLimitError
+		switch {
+		case errors.As(err, &limited):
+			c.Header("Retry-After", strconv.Itoa(int(limited.RetryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrSharePassword):
+			recordShareAccess(c, share, model.ShareActionVerifyFailed, 0)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(shareErrorStatus(err), gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	if share.Password != "" && share.Password != req.Password {
-		c.JSON(http.StatusForbidden, gin.H{"error": "提取码错误"})
-		return
-	}
+	recordShareAccess(c, share, model.ShareActionVerify, 0)
 
-	c.JSON(http.StatusOK, gin.H{"message": "校验成功"})
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(shareAccessCookie(share), access.AccessToken, int(time.Until(access.ExpiresAt).Seconds()), "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{"message": "校验成功", "data": access})
 }
 
 // GetShareFolderList 获取分享文件夹中的文件列表
 func GetShareFolderList(c *gin.Context) {
 	token := c.Param("token")
-	password := c.Query("password")
 	parentIDStr := c.DefaultQuery("parentId", "0")
 	parentID, _ := strconv.ParseUint(parentIDStr, 10, 32)
 
-	share, rootFile, err := service.GetShare(token)
+	share, rootFile, err := service.FindShare(token)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	if share.Password != "" && share.Password != password {
-		c.JSON(http.StatusForbidden, gin.H{"error": "提取码错误"})
+	if !requireShareAccess(c, share) {
 		return
 	}
 
-	// 检查请求的 parentID 是否在分享的文件夹范围内
-	actualParentID := uint(parentID)
-	if actualParentID == 0 {
-		actualParentID = share.FileID
-	} else {
-		// 这里简单校验：请求的文件夹必须属于原分享文件夹的子目录
-		// 实际生产中应递归校验或检查路径前缀
-		var targetFolder model.File
-		if err := model.DB.First(&targetFolder, actualParentID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "目录不存在"})
-			return
-		}
-		// 简单的安全校验：该文件夹的 UserID 必须与分享者一致
-		if targetFolder.UserID != share.UserID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
-			return
-		}
-	}
-
-	var files []model.File
-	if err := model.DB.Where("parent_id = ? AND user_id = ?", actualParentID, share.UserID).Find(&files).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+	// 只能浏览分享根及其后代目录
+	files, err := service.ListShareFolder(share, rootFile, uint(parentID))
+	if err != nil {
+		c.JSON(shareErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -147,40 +253,50 @@ func GetShareFolderList(c *gin.Context) {
 // DownloadShare 下载分享文件
 func DownloadShare(c *gin.Context) {
 	token := c.Param("token")
-	password := c.Query("password")
 	fileIDStr := c.Query("fileId")
 
-	share, rootFile, err := service.GetShare(token)
+	share, rootFile, err := service.FindShare(token)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	if share.Password != "" && share.Password != password {
-		c.JSON(http.StatusForbidden, gin.H{"error": "提取码错误"})
+	if !requireShareAccess(c, share) {
 		return
 	}
 
-	targetFile := rootFile
-	if fileIDStr != "" {
-		fileID, _ := strconv.ParseUint(fileIDStr, 10, 32)
-		var f model.File
-		if e := model.DB.First(&f, uint(fileID)).Error; e != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
-			return
+	// fileIds 为逗号分隔的多个文件，与文件夹一样打包下载
+	if ids := c.Query("fileIds"); ids != "" {
+		var fileIDs []uint
+		for _, s := range strings.Split(ids, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+				return
+			}
+			fileIDs = append(fileIDs, uint(id))
 		}
-		// 校验文件是否属于分享者
-		if f.UserID != share.UserID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
-			return
-		}
-		targetFile = &f
+		downloadShareArchive(c, share, rootFile, fileIDs)
+		return
+	}
+
+	fileID, _ := strconv.ParseUint(fileIDStr, 10, 32)
+	targetFile, err := service.ResolveShareFile(share, rootFile, uint(fileID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
 	}
 
 	if targetFile.IsFolder {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无法直接下载文件夹"})
+		downloadShareArchive(c, share, rootFile, []uint{targetFile.ID})
+		return
+	}
+
+	if err := service.ConsumeShareDownload(share); err != nil {
+		c.JSON(shareErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
+	recordShareAccess(c, share, model.ShareActionDownload, targetFile.ID)
 
 	// 获取存储策略
 	var policy model.StoragePolicy
@@ -204,57 +320,198 @@ func DownloadShare(c *gin.Context) {
 	}
 	defer reader.Close()
 
+	contentType := targetFile.MimeType
+	if contentType == "" {
+		contentType = utils.MimeTypeOfExt(targetFile.Ext)
+	}
+
 	c.Header("Content-Disposition", "attachment; filename="+targetFile.Name)
-	c.DataFromReader(http.StatusOK, targetFile.Size, "application/octet-stream", reader, nil)
+	c.DataFromReader(http.StatusOK, targetFile.Size, contentType, reader, map[string]string{
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// downloadShareArchive 将分享中的文件夹或多个文件打包成 zip 流式下载，整个压缩包计入一次下载
+func downloadShareArchive(c *gin.Context, share *model.Share, root *model.File, fileIDs []uint) {
+	archive, err := service.PrepareShareArchive(share, root, fileIDs)
+	if err != nil {
+		status := shareErrorStatus(err)
+		if errors.Is(err, service.ErrShareArchiveTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.ConsumeShareDownload(share); err != nil {
+		c.JSON(shareErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	for _, f := range archive.Files {
+		recordShareAccess(c, share, model.ShareActionDownload, f.ID)
+	}
+
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(archive.Name))
+	c.Header("Content-Type", "application/zip")
+	c.Header("X-Content-Type-Options", "nosniff")
+	if err := archive.Write(c.Writer); err != nil {
+		// 响应已开始写入，无法再返回错误信息
+		log.Printf("[Share] 分享 %d 打包下载失败: %v", share.ID, err)
+	}
+}
+
+// PreviewShare 在线预览分享中的文件，仅预览的分享也可使用
+func PreviewShare(c *gin.Context) {
+	token := c.Param("token")
+	share, rootFile, err := service.FindShare(token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !requireShareAccess(c, share) {
+		return
+	}
+
+	fileID, _ := strconv.ParseUint(c.Query("fileId"), 10, 32)
+	targetFile, err := service.ResolveShareFile(share, rootFile, uint(fileID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if targetFile.IsFolder {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无法预览文件夹"})
+		return
+	}
+	if err := service.CheckSharePreview(share, targetFile); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	recordShareAccess(c, share, model.ShareActionPreview, targetFile.ID)
+
+	var policy model.StoragePolicy
+	if err = model.DB.First(&policy, targetFile.PolicyID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "存储策略获取失败"})
+		return
+	}
+	d, err := driver.GetDriver(&policy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	reader, err := d.Get(targetFile.Path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "文件获取失败"})
+		return
+	}
+	defer reader.Close()
+
+	contentType := targetFile.MimeType
+	if contentType == "" {
+		contentType = utils.MimeTypeOfExt(targetFile.Ext)
+	}
+
+	c.Header("Content-Disposition", "inline")
+	c.DataFromReader(http.StatusOK, targetFile.Size, contentType, reader, map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "sandbox",
+		"Cache-Control":           "private, no-store",
+	})
+}
+
+// UploadToShare 访客向收集文件的分享上传文件，无需登录，占用分享者的空间
+func UploadToShare(c *gin.Context) {
+	token := c.Param("token")
+	share, rootFile, err := service.FindShare(token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !requireShareAccess(c, share) {
+		return
+	}
+	if share.Mode != model.ShareModeUpload {
+		c.JSON(http.StatusForbidden, gin.H{"error": service.ErrShareUploadDisabled.Error()})
+		return
+	}
+
+	// 请求体超过上限时直接中断，避免先将整个文件缓存到磁盘
+	limit := service.ShareUploadLimit(share)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+1<<20)
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrShareUploadTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择文件"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "打开文件失败"})
+		return
+	}
+	defer src.Close()
+
+	stored, err := service.UploadToShare(share, rootFile, file.Filename, file.Size, src)
+	if err != nil {
+		status := shareErrorStatus(err)
+		if status == http.StatusNotFound {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	recordShareAccess(c, share, model.ShareActionUpload, stored.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "上传成功", "data": gin.H{"name": stored.Name, "size": stored.Size}})
 }
 
-// SaveShare 保存分享内容到自己的网盘
+// SaveShare 提交转存任务，将分享内容保存到自己的网盘 (conflict: rename/skip/overwrite)
 func SaveShare(c *gin.Context) {
 	userID := c.GetUint("userID")
 	token := c.Param("token")
 	var req struct {
-		Password string `json:"password"`
 		ParentID uint   `json:"parentId"` // 保存到的目标目录
 		FileID   uint   `json:"fileId"`   // 可选，如果分享的是文件夹，可以选择其中一个子文件/文件夹保存
+		Conflict string `json:"conflict"` // 目标目录中存在同名项时的处理方式，默认重命名
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
 		return
 	}
 
-	share, rootFile, err := service.GetShare(token)
+	share, rootFile, err := service.FindShare(token)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	if share.Password != "" && share.Password != req.Password {
-		c.JSON(http.StatusForbidden, gin.H{"error": "提取码错误"})
+	if !requireShareAccess(c, share) {
 		return
 	}
 
-	targetFile := rootFile
-	if req.FileID != 0 {
-		var f model.File
-		if err := model.DB.First(&f, req.FileID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
-			return
-		}
-		// 校验文件是否属于分享者 (简单的安全校验)
-		if f.UserID != share.UserID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问"})
-			return
-		}
-		targetFile = &f
+	targetFile, err := service.ResolveShareFile(share, rootFile, req.FileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
 	}
 
-	// 执行保存逻辑 (递归复制文件记录)
-	if err := service.CopyFile(targetFile, userID, req.ParentID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	task, err := service.SaveShareFiles(userID, share, targetFile, req.ParentID, req.Conflict)
+	if err != nil {
+		status := shareErrorStatus(err)
+		if status == http.StatusNotFound {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	recordShareAccess(c, share, model.ShareActionSave, targetFile.ID)
 
-	c.JSON(http.StatusOK, gin.H{"message": "保存成功"})
+	c.JSON(http.StatusOK, gin.H{"message": "转存任务已提交", "data": task})
 }
 
 // ListUserShares 获取当前用户的分享列表
@@ -262,12 +519,13 @@ func ListUserShares(c *gin.Context) {
 	userID := c.GetUint("userID")
 	var shares []struct {
 		model.Share
-		FileName string `json:"fileName"`
-		FileSize int64  `json:"fileSize"`
+		FileName    string `json:"fileName"`
+		FileSize    int64  `json:"fileSize"`
+		HasPassword bool   `json:"hasPassword"`
 	}
 
 	err := model.DB.Table("shares").
-		Select("shares.*, files.name as file_name, files.size as file_size").
+		Select("shares.*, files.name as file_name, files.size as file_size, shares.password <> '' as has_password").
 		Joins("left join files on files.id = shares.file_id").
 		Where("shares.user_id = ? AND shares.deleted_at IS NULL", userID).
 		Order("shares.created_at desc").
@@ -293,3 +551,150 @@ func DeleteUserShare(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
+
+// UpdateUserShare 修改分享的提取码、有效期与其他设置，未提供的字段保持不变
+func UpdateUserShare(c *gin.Context) {
+	userID := c.GetUint("userID")
+	shareID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req struct {
+		Password       *string `json:"password"`   // 空字符串表示取消提取码
+		ExpireDays     *int    `json:"expireDays"` // 自现在起的有效天数，0 表示永久有效
+		Mode           *string `json:"mode"`
+		MaxViews       *int    `json:"maxViews"`
+		MaxDownloads   *int    `json:"maxDownloads"`
+		UploadMaxSize  *int64  `json:"uploadMaxSize"`
+		UploadExts     *string `json:"uploadExts"`
+		ArchiveMaxSize *int64  `json:"archiveMaxSize"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	share, err := service.UpdateShare(userID, uint(shareID), service.ShareUpdate{
+		Password:       req.Password,
+		ExpireDays:     req.ExpireDays,
+		Mode:           req.Mode,
+		MaxViews:       req.MaxViews,
+		MaxDownloads:   req.MaxDownloads,
+		UploadMaxSize:  req.UploadMaxSize,
+		UploadExts:     req.UploadExts,
+		ArchiveMaxSize: req.ArchiveMaxSize,
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrShareNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "修改成功", "data": share})
+}
+
+// RenewUserShare 延长分享的有效期
+func RenewUserShare(c *gin.Context) {
+	userID := c.GetUint("userID")
+	shareID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req struct {
+		Days int `json:"days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	share, err := service.RenewShare(userID, uint(shareID), req.Days)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrShareNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "续期成功", "expireTime": share.ExpireTime})
+}
+
+// RevokeUserShares 批量取消分享：按文件 (含文件夹中的文件)、按创建时间，或 all 为 true 时取消全部分享
+func RevokeUserShares(c *gin.Context) {
+	userID := c.GetUint("userID")
+	var req struct {
+		FileID        uint `json:"fileId"`
+		OlderThanDays int  `json:"olderThanDays"`
+		All           bool `json:"all"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	count, err := service.RevokeShares(userID, service.RevokeFilter{FileID: req.FileID, OlderThanDays: req.OlderThanDays, All: req.All})
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrFileNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("已取消 %d 个分享", count), "count": count})
+}
+
+// GetShareStats 分享的访问统计 (group: day/month，from/to 为时间范围)
+func GetShareStats(c *gin.Context) {
+	userID := c.GetUint("userID")
+	shareID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stats, err := service.GetShareStats(userID, uint(shareID), c.Query("group"), q.From, q.To)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrShareNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": stats})
+}
+
+// GetShareTopFiles 分享中访问最多的文件
+func GetShareTopFiles(c *gin.Context) {
+	userID := c.GetUint("userID")
+	shareID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	files, err := service.TopShareFiles(userID, uint(shareID), q.Limit, q.From, q.To)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": files})
+}
+
+// ListShareAccessLogs 分享的访问日志 (action 筛选操作类型)
+func ListShareAccessLogs(c *gin.Context) {
+	userID := c.GetUint("userID")
+	shareID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logs, page, err := service.ListShareAccessLogs(userID, uint(shareID), c.Query("action"), q)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": logs, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
+}
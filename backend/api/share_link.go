@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"github.com/stfreya/stfreyanetdisk/service"
+)
+
+const (
+	defaultQRCodeSize = 256
+	minQRCodeSize     = 128
+	maxQRCodeSize     = 1024
+)
+
+// SetShareAlias 设置、更换或清除分享的短链接 (alias 为空且 random 为 false 时清除)
+func SetShareAlias(c *gin.Context) {
+	userID := c.GetUint("userID")
+	shareID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req struct {
+		Alias  string `json:"alias"`
+		Random bool   `json:"random"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	share, err := service.SetShareAlias(userID, uint(shareID), req.Alias, req.Random)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, service.ErrShareNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, service.ErrShareAliasTaken):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alias": share.Alias, "url": service.ShareURL(share, siteURL(c))})
+}
+
+// GetShareQRCode 生成分享链接的二维码 PNG 图片 (size: 128-1024 像素)，令牌与短链接均可使用
+func GetShareQRCode(c *gin.Context) {
+	size := defaultQRCodeSize
+	if s := c.Query("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < minQRCodeSize || n > maxQRCodeSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的二维码尺寸"})
+			return
+		}
+		size = n
+	}
+
+	share, _, err := service.FindShare(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	png, err := qrcode.Encode(service.ShareURL(share, siteURL(c)), qrcode.Medium, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "二维码生成失败"})
+		return
+	}
+	// 更换短链接后二维码内容会变化，只做短时间缓存
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "image/png", png)
+}
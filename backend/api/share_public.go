@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/service"
+	"github.com/stfreya/stfreyanetdisk/utils"
+)
+
+// siteURL 站点地址，优先使用配置的 site_url，未配置时由请求推断
+func siteURL(c *gin.Context) string {
+	if u := strings.TrimRight(model.GetConfig("site_url", ""), "/"); u != "" {
+		return u
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// ListPublicShares 公开分享目录，无需登录 (keyword 搜索标题、简介与文件名，sortBy: views/downloads)
+func ListPublicShares(c *gin.Context) {
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shares, page, err := service.ListPublicShares(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": shares, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
+}
+
+// GetShareCover 获取分享封面的缩略图
+func GetShareCover(c *gin.Context) {
+	thumb, err := service.ShareCover(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	etag := fmt.Sprintf(`"%d-%d"`, thumb.ID, thumb.CreatedAt.Unix())
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=3600")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	reader, err := service.OpenThumbnail(thumb)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "封面获取失败"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, thumb.Bytes, utils.ThumbContentType(thumb.Format), reader, nil)
+}
+
+// PublishShare 将分享发布到公开目录
+func PublishShare(c *gin.Context) {
+	userID := c.GetUint("userID")
+	shareID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		CoverFileID uint   `json:"coverFileId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	share, err := service.PublishShare(userID, uint(shareID), service.PublishOptions{
+		Title:       req.Title,
+		Description: req.Description,
+		CoverFileID: req.CoverFileID,
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrShareNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "已发布到公开目录"
+	if share.ReviewStatus == model.ReviewPending {
+		message = "已提交审核，通过后将出现在公开目录"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "reviewStatus": share.ReviewStatus})
+}
+
+// UnpublishShare 将分享移出公开目录
+func UnpublishShare(c *gin.Context) {
+	userID := c.GetUint("userID")
+	shareID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := service.UnpublishShare(userID, uint(shareID)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrShareNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已移出公开目录"})
+}
+
+// ListShareReviews 管理员查看公开分享的审核列表 (status: pending/approved/rejected，默认 pending)
+func ListShareReviews(c *gin.Context) {
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shares, page, err := service.ListShareReviews(c.Query("status"), q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": shares, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
+}
+
+// ReviewShare 管理员审核公开分享
+func ReviewShare(c *gin.Context) {
+	shareID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req struct {
+		Approve bool   `json:"approve"`
+		Note    string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	if err := service.ReviewShare(uint(shareID), req.Approve, req.Note); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrShareNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "审核完成"})
+}
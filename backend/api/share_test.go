@@ -0,0 +1,923 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/service"
+	"github.com/stfreya/stfreyanetdisk/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// shareFixture 分享者的目录树：
+//
+//	/docs (ID 5，被分享)
+//	  sub/a.txt
+//	  trash/b.txt (trash 已被删除)
+//	/secret/key.txt
+//	/55/c.txt (ID 前缀与分享根相同)
+//
+// 以及另一个用户的 other.txt
+type shareFixture struct {
+	router                     *gin.Engine
+	auth                       map[uint]string // 用户 ID 对应的 Authorization 头
+	token                      string
+	sub, trash, secret, prefix *model.File
+	a, b, key, c, other        *model.File
+}
+
+const (
+	sharerID     = 1
+	visitorID    = 2
+	shareAdminID = 3
+)
+
+// shareAPI 接口路由前缀
+const shareAPI = "/api/v1"
+
+func setupShareTest(t *testing.T) *shareFixture {
+	env := setupTestEnv(t, sharerID, visitorID)
+	fx := &shareFixture{}
+	docs := env.mkdir(t, sharerID, 5, 0, "docs")
+	fx.sub = env.mkdir(t, sharerID, 0, docs.ID, "sub")
+	fx.a = env.put(t, sharerID, fx.sub.ID, "a.txt", "shared content")
+	fx.trash = env.mkdir(t, sharerID, 0, docs.ID, "trash")
+	fx.b = env.put(t, sharerID, fx.trash.ID, "b.txt", "deleted content")
+	require.NoError(t, model.DB.Delete(&model.File{}, fx.trash.ID).Error)
+	fx.secret = env.mkdir(t, sharerID, 0, 0, "secret")
+	fx.key = env.put(t, sharerID, fx.secret.ID, "key.txt", "top secret")
+	fx.prefix = env.mkdir(t, sharerID, 55, 0, "prefix")
+	fx.c = env.put(t, sharerID, fx.prefix.ID, "c.txt", "prefix content")
+	fx.other = env.put(t, visitorID, 0, "other.txt", "someone else")
+
+	fx.token = "share-token"
+	require.NoError(t, model.DB.Create(&model.Share{FileID: docs.ID, UserID: sharerID, Token: fx.token}).Error)
+
+	require.NoError(t, model.DB.Create(&model.User{Model: gorm.Model{ID: shareAdminID}, Username: "admin", Password: "x",
+		Email: "admin@example.com", Role: "admin"}).Error)
+	fx.auth = make(map[uint]string)
+	for _, id := range []uint{sharerID, visitorID, shareAdminID} {
+		token, err := utils.GenerateToken(id, "")
+		require.NoError(t, err)
+		fx.auth[id] = "Bearer " + token
+	}
+
+	// 使用与服务启动相同的路由，接口路径与中间件均与线上一致
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies(nil))
+	RegisterRoutes(r)
+	fx.router = r
+	return fx
+}
+
+// do 以分享者身份调用接口，公开接口会忽略登录信息
+func (fx *shareFixture) do(method string, url string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	return fx.doAs(sharerID, method, url, body, headers...)
+}
+
+// doAs 以指定用户身份调用接口
+func (fx *shareFixture) doAs(userID uint, method string, url string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	headers = append([]string{"Authorization", fx.auth[userID]}, headers...)
+	return doRequest(fx.router, method, shareAPI+url, body, headers...)
+}
+
+func TestShareFolderListScope(t *testing.T) {
+	fx := setupShareTest(t)
+
+	t.Run("Root And Descendant", func(t *testing.T) {
+		w := fx.do("GET", "/share/list/"+fx.token, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"sub"`)
+		assert.NotContains(t, w.Body.String(), `"trash"`)
+
+		w = fx.do("GET", fmt.Sprintf("/share/list/%s?parentId=%d", fx.token, fx.sub.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "a.txt")
+	})
+
+	t.Run("Traversal Outside Share", func(t *testing.T) {
+		for name, id := range map[string]uint{
+			"sibling folder":     fx.secret.ID,
+			"id prefix folder":   fx.prefix.ID,
+			"deleted folder":     fx.trash.ID,
+			"file as parent":     fx.a.ID,
+			"other user's file":  fx.other.ID,
+			"nonexistent folder": 9999,
+		} {
+			w := fx.do("GET", fmt.Sprintf("/share/list/%s?parentId=%d", fx.token, id), nil)
+			assert.Equal(t, http.StatusNotFound, w.Code, name)
+			assert.NotContains(t, w.Body.String(), "key.txt", name)
+		}
+	})
+}
+
+func TestShareDownloadScope(t *testing.T) {
+	fx := setupShareTest(t)
+
+	w := fx.do("GET", fmt.Sprintf("/share/download/%s?fileId=%d", fx.token, fx.a.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "shared content", w.Body.String())
+
+	for name, file := range map[string]*model.File{
+		"sibling file":         fx.key,
+		"id prefix file":       fx.c,
+		"under deleted folder": fx.b,
+		"other user's file":    fx.other,
+	} {
+		w := fx.do("GET", fmt.Sprintf("/share/download/%s?fileId=%d", fx.token, file.ID), nil)
+		assert.Equal(t, http.StatusNotFound, w.Code, name)
+		assert.NotContains(t, w.Body.String(), "content", name)
+		assert.NotContains(t, w.Body.String(), "secret", name)
+	}
+}
+
+func TestShareArchiveDownload(t *testing.T) {
+	fx := setupShareTest(t)
+	entries := func(w *httptest.ResponseRecorder) map[string]string {
+		zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		require.NoError(t, err)
+		files := map[string]string{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			_, _ = buf.ReadFrom(rc)
+			rc.Close()
+			files[f.Name] = buf.String()
+		}
+		return files
+	}
+
+	t.Run("Whole Folder", func(t *testing.T) {
+		w := fx.do("GET", "/share/download/"+fx.token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "docs.zip")
+		files := entries(w)
+		assert.Equal(t, "shared content", files["docs/sub/a.txt"])
+		for name := range files {
+			assert.NotContains(t, name, "b.txt")
+			assert.NotContains(t, name, "key.txt")
+		}
+
+		var share model.Share
+		model.DB.Where("token = ?", fx.token).First(&share)
+		assert.Equal(t, 1, share.Downloads)
+	})
+
+	t.Run("Selected Files", func(t *testing.T) {
+		w := fx.do("GET", fmt.Sprintf("/share/download/%s?fileIds=%d,%d", fx.token, fx.a.ID, fx.sub.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		files := entries(w)
+		assert.Equal(t, "shared content", files["a.txt"])
+		assert.Equal(t, "shared content", files["sub/a.txt"])
+
+		for name, file := range map[string]*model.File{
+			"sibling file":         fx.key,
+			"id prefix folder":     fx.prefix,
+			"under deleted folder": fx.b,
+			"other user's file":    fx.other,
+		} {
+			w := fx.do("GET", fmt.Sprintf("/share/download/%s?fileIds=%d,%d", fx.token, fx.a.ID, file.ID), nil)
+			assert.Equal(t, http.StatusNotFound, w.Code, name)
+		}
+		assert.Equal(t, http.StatusBadRequest, fx.do("GET", "/share/download/"+fx.token+"?fileIds=1,x", nil).Code)
+	})
+
+	t.Run("Size Limit", func(t *testing.T) {
+		limited := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "limited", ArchiveMaxSize: 4}
+		require.NoError(t, model.DB.Create(&limited).Error)
+		w := fx.do("GET", "/share/download/limited", nil)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		model.DB.First(&limited, limited.ID)
+		assert.Equal(t, 0, limited.Downloads)
+	})
+
+	t.Run("Preview Only", func(t *testing.T) {
+		preview := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "preview-only", Mode: model.ShareModePreview}
+		require.NoError(t, model.DB.Create(&preview).Error)
+		assert.Equal(t, http.StatusForbidden, fx.do("GET", "/share/download/preview-only", nil).Code)
+	})
+}
+
+func TestShareSaveScope(t *testing.T) {
+	fx := setupShareTest(t)
+
+	// 保存由后台任务执行，这里只覆盖越权的请求
+
+	for name, file := range map[string]*model.File{
+		"sibling file":         fx.key,
+		"under deleted folder": fx.b,
+		"other user's file":    fx.other,
+	} {
+		w := fx.doAs(visitorID, "POST", "/share/save/"+fx.token, gin.H{"fileId": file.ID})
+		assert.Equal(t, http.StatusNotFound, w.Code, name)
+	}
+	var copied int64
+	model.DB.Model(&model.File{}).Where("user_id = ? AND name = ?", visitorID, "key.txt").Count(&copied)
+	assert.Zero(t, copied)
+}
+
+func TestShareSaveTask(t *testing.T) {
+	fx := setupShareTest(t)
+	save := func(body gin.H) *httptest.ResponseRecorder {
+		return fx.doAs(visitorID, "POST", "/share/save/"+fx.token, body)
+	}
+	downloads := func() int {
+		var share model.Share
+		model.DB.Where("token = ?", fx.token).First(&share)
+		return share.Downloads
+	}
+	type taskResp struct {
+		Data struct {
+			ID     uint   `json:"id"`
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	// 任务由后台工作协程执行，这里只覆盖提交时的校验与去重
+
+	t.Run("Destination Must Be Own Folder", func(t *testing.T) {
+		w := save(gin.H{"fileId": fx.sub.ID, "parentId": fx.secret.ID})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "目标文件夹不存在")
+		w = save(gin.H{"fileId": fx.sub.ID, "parentId": fx.other.ID})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "file as destination")
+		assert.Equal(t, http.StatusBadRequest, save(gin.H{"fileId": fx.sub.ID, "conflict": "bogus"}).Code)
+		assert.Zero(t, downloads())
+	})
+
+	t.Run("Enqueue And Dedup", func(t *testing.T) {
+		w := save(gin.H{"fileId": fx.sub.ID, "conflict": "skip"})
+		require.Equal(t, http.StatusOK, w.Code)
+		var first taskResp
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+		assert.Equal(t, "share_save", first.Data.Type)
+		assert.Equal(t, model.TaskPending, first.Data.Status)
+		assert.Equal(t, 1, downloads())
+
+		// 相同的转存任务进行中时不重复提交，也不重复计入下载次数
+		w = save(gin.H{"fileId": fx.sub.ID, "conflict": "skip"})
+		require.Equal(t, http.StatusOK, w.Code)
+		var again taskResp
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &again))
+		assert.Equal(t, first.Data.ID, again.Data.ID)
+		assert.Equal(t, 1, downloads())
+
+		w = save(gin.H{"fileId": fx.sub.ID})
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &again))
+		assert.NotEqual(t, first.Data.ID, again.Data.ID)
+
+		var task model.Task
+		require.NoError(t, model.DB.First(&task, again.Data.ID).Error)
+		assert.EqualValues(t, visitorID, task.UserID)
+		assert.JSONEq(t, fmt.Sprintf(`{"shareId":1,"fileId":%d,"parentId":0,"conflict":"rename"}`, fx.sub.ID), task.Payload)
+	})
+
+	t.Run("Quota", func(t *testing.T) {
+		model.DB.Model(&model.User{}).Where("id = ?", visitorID).UpdateColumn("total_size", 4)
+		w := save(gin.H{"fileId": fx.a.ID})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "存储空间不足")
+	})
+}
+
+func TestSharePasswordAccess(t *testing.T) {
+	fx := setupShareTest(t)
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("8a9b"), bcrypt.MinCost)
+	locked := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "locked", Password: string(hashed)}
+	require.NoError(t, model.DB.Create(&locked).Error)
+	legacy := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "legacy", Password: "plain"}
+	require.NoError(t, model.DB.Create(&legacy).Error)
+
+	verify := func(token string, password string, ip string) *httptest.ResponseRecorder {
+		return fx.do("POST", "/share/verify/"+token, gin.H{"password": password}, "X-Real-IP", ip, "X-Forwarded-For", ip)
+	}
+	accessToken := func(w *httptest.ResponseRecorder) string {
+		var resp struct {
+			Data struct {
+				AccessToken string `json:"accessToken"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Data.AccessToken
+	}
+
+	t.Run("Password No Longer Accepted In Query", func(t *testing.T) {
+		w := fx.do("GET", "/share/list/locked?password=8a9b", nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = fx.do("GET", fmt.Sprintf("/share/download/locked?password=8a9b&fileId=%d", fx.a.ID), nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Access Token Scoped To Share", func(t *testing.T) {
+		w := verify("locked", "8a9b", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		token := accessToken(w)
+		assert.NotEmpty(t, token)
+		assert.Contains(t, w.Header().Get("Set-Cookie"), "share_access_locked="+token)
+		assert.Contains(t, w.Header().Get("Set-Cookie"), "HttpOnly")
+
+		w = fx.do("GET", "/share/list/locked", nil, "X-Share-Token", token)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "a.txt")
+		w = fx.do("GET", "/share/list/locked", nil, "Cookie", "share_access_locked="+token)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = fx.do("GET", fmt.Sprintf("/share/download/locked?fileId=%d", fx.a.ID), nil, "Cookie", "share_access_locked="+token)
+		assert.Equal(t, http.StatusOK, w.Code)
+		// 令牌不能放在链接中
+		w = fx.do("GET", fmt.Sprintf("/share/download/locked?fileId=%d&access=%s", fx.a.ID, token), nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// 令牌不能用于其他分享
+		w = fx.do("GET", "/share/list/legacy", nil, "X-Share-Token", token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		// 修改提取码后令牌失效
+		rehashed, _ := bcrypt.GenerateFromPassword([]byte("new"), bcrypt.MinCost)
+		model.DB.Model(&locked).UpdateColumn("password", string(rehashed))
+		w = fx.do("GET", "/share/list/locked", nil, "X-Share-Token", token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		model.DB.Model(&locked).UpdateColumn("password", string(hashed))
+	})
+
+	t.Run("Legacy Plaintext Password", func(t *testing.T) {
+		w := verify("legacy", "plain", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEmpty(t, accessToken(w))
+	})
+
+	t.Run("Rate Limited Per Share", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, http.StatusForbidden, verify("legacy", "wrong", "").Code)
+		}
+		w := verify("legacy", "plain", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		// 未配置可信代理时转发头不能绕过限制
+		w = verify("legacy", "plain", "203.0.113.9")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		// 其他分享不受影响
+		assert.Equal(t, http.StatusOK, verify("locked", "8a9b", "").Code)
+	})
+}
+
+func (fx *shareFixture) upload(token string, name string, content string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", name)
+	_, _ = part.Write([]byte(content))
+	_ = mw.Close()
+	req := httptest.NewRequest("POST", shareAPI+"/share/upload/"+token, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	fx.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestShareLimits(t *testing.T) {
+	fx := setupShareTest(t)
+	newShare := func(share model.Share) model.Share {
+		share.FileID, share.UserID = fx.sub.ID, sharerID
+		require.NoError(t, model.DB.Create(&share).Error)
+		return share
+	}
+	download := func(token string) int {
+		return fx.do("GET", fmt.Sprintf("/share/download/%s?fileId=%d", token, fx.a.ID), nil).Code
+	}
+
+	t.Run("Max Downloads", func(t *testing.T) {
+		share := newShare(model.Share{Token: "limited-dl", MaxDownloads: 2})
+		assert.Equal(t, http.StatusOK, download(share.Token))
+		assert.Equal(t, http.StatusOK, download(share.Token))
+		// 次数用尽后分享过期，也不能再转存
+		assert.Equal(t, http.StatusNotFound, download(share.Token))
+		assert.Equal(t, http.StatusNotFound, fx.doAs(visitorID, "POST", "/share/save/"+share.Token, gin.H{"fileId": fx.a.ID}).Code)
+		var reloaded model.Share
+		model.DB.First(&reloaded, share.ID)
+		assert.Equal(t, 2, reloaded.Downloads)
+		require.NotNil(t, reloaded.ExpireTime)
+	})
+
+	t.Run("Max Views", func(t *testing.T) {
+		share := newShare(model.Share{Token: "limited-view", MaxViews: 2})
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/info/"+share.Token, nil).Code)
+		// 浏览目录与下载不计入访问次数
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/list/"+share.Token, nil).Code)
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/info/"+share.Token, nil).Code)
+		assert.Equal(t, http.StatusGone, fx.do("GET", "/share/info/"+share.Token, nil).Code)
+		// 最后一位访客仍可继续浏览
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/list/"+share.Token, nil).Code)
+		var reloaded model.Share
+		model.DB.First(&reloaded, share.ID)
+		assert.Equal(t, 2, reloaded.Views)
+		require.NotNil(t, reloaded.ExpireTime)
+		assert.True(t, reloaded.ExpireTime.After(time.Now()))
+	})
+
+	t.Run("Preview Only", func(t *testing.T) {
+		share := newShare(model.Share{Token: "preview-only", Mode: model.ShareModePreview})
+		model.DB.Model(fx.a).UpdateColumn("category", "document")
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/list/"+share.Token, nil).Code)
+		assert.Equal(t, http.StatusForbidden, download(share.Token))
+		w := fx.doAs(visitorID, "POST", "/share/save/"+share.Token, gin.H{"fileId": fx.a.ID})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = fx.do("GET", fmt.Sprintf("/share/preview/%s?fileId=%d", share.Token, fx.a.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "shared content", w.Body.String())
+		assert.Equal(t, "inline", w.Header().Get("Content-Disposition"))
+		assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"))
+		// 预览同样限定在分享范围内
+		w = fx.do("GET", fmt.Sprintf("/share/preview/%s?fileId=%d", share.Token, fx.key.ID), nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("File Request", func(t *testing.T) {
+		share := newShare(model.Share{Token: "drop", Mode: model.ShareModeUpload, UploadMaxSize: 8, UploadExts: "pdf,txt"})
+		info := fx.do("GET", "/share/info/"+share.Token, nil)
+		assert.Equal(t, http.StatusOK, info.Code)
+		assert.Contains(t, info.Body.String(), `"uploadMaxSize":8`)
+
+		// 访客不能浏览、下载或转存其中的文件
+		assert.Equal(t, http.StatusForbidden, fx.do("GET", "/share/list/"+share.Token, nil).Code)
+		assert.Equal(t, http.StatusForbidden, download(share.Token))
+		assert.Equal(t, http.StatusForbidden, fx.do("GET", fmt.Sprintf("/share/preview/%s?fileId=%d", share.Token, fx.a.ID), nil).Code)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, fx.upload(share.Token, "run.exe", "MZ").Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, fx.upload(share.Token, "big.txt", strings.Repeat("x", 9)).Code)
+		assert.Equal(t, http.StatusBadRequest, fx.upload(share.Token, "..", "x").Code)
+
+		var count int64
+		model.DB.Model(&model.File{}).Where("parent_id = ?", fx.sub.ID).Count(&count)
+		assert.EqualValues(t, 1, count)
+
+		// 普通分享不能上传
+		assert.Equal(t, http.StatusForbidden, fx.upload(fx.token, "note.txt", "x").Code)
+	})
+}
+
+func TestShareAccessLogs(t *testing.T) {
+	fx := setupShareTest(t)
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	share := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "logged", Password: string(hashed)}
+	require.NoError(t, model.DB.Create(&share).Error)
+	model.DB.Model(fx.a).UpdateColumn("category", "document")
+
+	get := func(url string, headers ...string) *httptest.ResponseRecorder {
+		return fx.do("GET", url, nil, append([]string{"User-Agent", "share-test"}, headers...)...)
+	}
+	require.Equal(t, http.StatusOK, get("/share/info/logged").Code)
+	require.Equal(t, http.StatusForbidden, fx.do("POST", "/share/verify/logged", gin.H{"password": "bad"}).Code)
+	w := fx.do("POST", "/share/verify/logged", gin.H{"password": "pw"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var verified struct {
+		Data struct {
+			AccessToken string `json:"accessToken"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &verified))
+	access := verified.Data.AccessToken
+	for i := 0; i < 2; i++ {
+		require.Equal(t, http.StatusOK, get(fmt.Sprintf("/share/download/logged?fileId=%d", fx.a.ID), "X-Share-Token", access).Code)
+	}
+	require.Equal(t, http.StatusOK, get(fmt.Sprintf("/share/preview/logged?fileId=%d", fx.a.ID), "X-Share-Token", access).Code)
+	// 被拒绝的访问不记录
+	require.Equal(t, http.StatusNotFound, get(fmt.Sprintf("/share/download/logged?fileId=%d", fx.key.ID), "X-Share-Token", access).Code)
+
+	t.Run("Counters", func(t *testing.T) {
+		var reloaded model.Share
+		model.DB.First(&reloaded, share.ID)
+		assert.Equal(t, 1, reloaded.Views)
+		assert.Equal(t, 2, reloaded.Downloads)
+	})
+
+	t.Run("Logs", func(t *testing.T) {
+		w := fx.do("GET", fmt.Sprintf("/user/share/%d/logs", share.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Data []model.ShareAccessLog `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		var actions []string
+		for _, l := range resp.Data {
+			actions = append(actions, l.Action)
+		}
+		// 按时间倒序
+		assert.Equal(t, []string{"preview", "download", "download", "verify", "verify_failed", "view"}, actions)
+		assert.Equal(t, fx.a.ID, resp.Data[0].FileID)
+		assert.Equal(t, "share-test", resp.Data[0].UserAgent)
+		assert.NotEmpty(t, resp.Data[0].IP)
+
+		w = fx.do("GET", fmt.Sprintf("/user/share/%d/logs?action=download&limit=1", share.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"hasMore":true`)
+	})
+
+	t.Run("Top Files", func(t *testing.T) {
+		w := fx.do("GET", fmt.Sprintf("/user/share/%d/files", share.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp.Data, 1)
+		assert.Equal(t, "a.txt", resp.Data[0]["name"])
+		assert.EqualValues(t, 2, resp.Data[0]["downloads"])
+		assert.EqualValues(t, 1, resp.Data[0]["previews"])
+		assert.EqualValues(t, 3, resp.Data[0]["total"])
+	})
+
+	t.Run("Owner Only", func(t *testing.T) {
+		other := model.Share{FileID: fx.other.ID, UserID: visitorID, Token: "visitor-share"}
+		require.NoError(t, model.DB.Create(&other).Error)
+		for _, suffix := range []string{"stats", "files", "logs"} {
+			w := fx.do("GET", fmt.Sprintf("/user/share/%d/%s", other.ID, suffix), nil)
+			assert.Equal(t, http.StatusNotFound, w.Code, suffix)
+		}
+	})
+}
+
+func TestSharePublicCatalogue(t *testing.T) {
+	fx := setupShareTest(t)
+	var share model.Share
+	require.NoError(t, model.DB.Where("token = ?", fx.token).First(&share).Error)
+	model.DB.Model(fx.a).UpdateColumn("category", "image")
+	catalogue := func(query string) string {
+		w := fx.do("GET", "/share/public"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	t.Run("Publish Validation", func(t *testing.T) {
+		hashed, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+		locked := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "locked", Password: string(hashed)}
+		require.NoError(t, model.DB.Create(&locked).Error)
+		w := fx.do("POST", fmt.Sprintf("/user/share/%d/publish", locked.ID), gin.H{"title": "locked"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// 封面须是分享范围内的图片
+		for _, cover := range []uint{fx.key.ID, fx.sub.ID} {
+			w = fx.do("POST", fmt.Sprintf("/user/share/%d/publish", share.ID), gin.H{"title": "Docs", "coverFileId": cover})
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		}
+		w = fx.do("POST", fmt.Sprintf("/user/share/%d/publish", share.ID), gin.H{"title": strings.Repeat("长", 101)})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		other := model.Share{FileID: fx.other.ID, UserID: visitorID, Token: "visitor-share"}
+		require.NoError(t, model.DB.Create(&other).Error)
+		w = fx.do("POST", fmt.Sprintf("/user/share/%d/publish", other.ID), gin.H{"title": "mine"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Review Before Listing", func(t *testing.T) {
+		w := fx.do("POST", fmt.Sprintf("/user/share/%d/publish", share.ID),
+			gin.H{"title": "Docs", "description": "team handbook", "coverFileId": fx.a.ID})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"reviewStatus":"pending"`)
+		assert.NotContains(t, catalogue(""), fx.token)
+
+		w = fx.doAs(shareAdminID, "GET", "/admin/shares/review", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), fx.token)
+
+		require.Equal(t, http.StatusOK, fx.doAs(shareAdminID, "POST", fmt.Sprintf("/admin/share/%d/review", share.ID), gin.H{"approve": true}).Code)
+		body := catalogue("")
+		assert.Contains(t, body, fx.token)
+		assert.Contains(t, body, `"hasCover":true`)
+		assert.Contains(t, body, `"username":"user1"`)
+
+		var msgs int64
+		model.DB.Model(&model.Message{}).Where("user_id = ?", sharerID).Count(&msgs)
+		assert.EqualValues(t, 1, msgs)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		assert.Contains(t, catalogue("?keyword=handbook"), fx.token)
+		assert.Contains(t, catalogue("?keyword=docs"), fx.token)
+		assert.NotContains(t, catalogue("?keyword=nothing"), fx.token)
+	})
+
+	t.Run("Hidden When Not Shareable", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		model.DB.Model(&share).UpdateColumn("expire_time", past)
+		assert.NotContains(t, catalogue(""), fx.token)
+		model.DB.Model(&share).UpdateColumn("expire_time", nil)
+
+		model.DB.Model(&share).UpdateColumn("password", "secret")
+		assert.NotContains(t, catalogue(""), fx.token)
+		model.DB.Model(&share).UpdateColumn("password", "")
+		assert.Contains(t, catalogue(""), fx.token)
+	})
+
+	t.Run("Open Graph", func(t *testing.T) {
+		w := fx.do("GET", "/share/info/"+fx.token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			OG struct {
+				Title       string `json:"title"`
+				Description string `json:"description"`
+				Image       string `json:"image"`
+				URL         string `json:"url"`
+			} `json:"og"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "Docs", resp.OG.Title)
+		assert.Equal(t, "team handbook", resp.OG.Description)
+		assert.Equal(t, "http://example.com/s/"+fx.token, resp.OG.URL)
+		assert.Equal(t, "http://example.com/api/v1/share/cover/"+fx.token, resp.OG.Image)
+
+		// 加密分享不暴露文件名与封面
+		model.DB.Model(&share).UpdateColumn("password", "secret")
+		w = fx.do("GET", "/share/info/"+fx.token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "team handbook")
+		assert.NotContains(t, w.Body.String(), "/share/cover/")
+		model.DB.Model(&share).UpdateColumn("password", "")
+	})
+
+	t.Run("Reject And Unpublish", func(t *testing.T) {
+		w := fx.doAs(shareAdminID, "POST", fmt.Sprintf("/admin/share/%d/review", share.ID), gin.H{"approve": false, "note": "spam"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, catalogue(""), fx.token)
+		var msg model.Message
+		require.NoError(t, model.DB.Where("user_id = ?", sharerID).Order("id DESC").First(&msg).Error)
+		assert.Contains(t, msg.Content, "spam")
+
+		require.Equal(t, http.StatusOK, fx.do("DELETE", fmt.Sprintf("/user/share/%d/publish", share.ID), nil).Code)
+		var reloaded model.Share
+		model.DB.First(&reloaded, share.ID)
+		assert.False(t, reloaded.IsPublic)
+		assert.Equal(t, http.StatusNotFound, fx.doAs(shareAdminID, "POST", fmt.Sprintf("/admin/share/%d/review", share.ID), gin.H{"approve": true}).Code)
+	})
+}
+
+func TestShareAlias(t *testing.T) {
+	fx := setupShareTest(t)
+	var share model.Share
+	require.NoError(t, model.DB.Where("token = ?", fx.token).First(&share).Error)
+	setAlias := func(id uint, body gin.H) *httptest.ResponseRecorder {
+		return fx.do("PUT", fmt.Sprintf("/user/share/%d/alias", id), body)
+	}
+
+	t.Run("Create With Alias", func(t *testing.T) {
+		w := fx.do("POST", "/file/share", gin.H{"fileId": fx.sub.ID, "alias": "Team-Notes"})
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Token string `json:"token"`
+			Alias string `json:"alias"`
+			URL   string `json:"url"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Len(t, resp.Token, 32)
+		assert.Equal(t, "team-notes", resp.Alias)
+		assert.Equal(t, "http://example.com/s/team-notes", resp.URL)
+
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/info/team-notes", nil).Code)
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/info/"+resp.Token, nil).Code)
+		assert.Equal(t, http.StatusConflict, fx.do("POST", "/file/share", gin.H{"fileId": fx.sub.ID, "alias": "team-notes"}).Code)
+
+		w = fx.do("POST", "/file/share", gin.H{"fileId": fx.sub.ID, "shortAlias": true})
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Len(t, resp.Alias, 10)
+		assert.NotEqual(t, resp.Token, resp.Alias)
+
+		// 未要求短链接时不生成，分享只能通过令牌访问
+		w = fx.do("POST", "/file/share", gin.H{"fileId": fx.sub.ID})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"alias":null`)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		for _, alias := range []string{"ab", "admin", "public", "-docs", "has space", "中文链接", strings.Repeat("a", 25)} {
+			w := setAlias(share.ID, gin.H{"alias": alias})
+			assert.Equal(t, http.StatusBadRequest, w.Code, alias)
+		}
+		// 已被其他分享使用的短链接
+		w := setAlias(share.ID, gin.H{"alias": "team-notes"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		other := model.Share{FileID: fx.other.ID, UserID: visitorID, Token: "visitor-share"}
+		require.NoError(t, model.DB.Create(&other).Error)
+		assert.Equal(t, http.StatusNotFound, setAlias(other.ID, gin.H{"alias": "stolen"}).Code)
+	})
+
+	t.Run("Change And Clear", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, setAlias(share.ID, gin.H{"alias": "docs_2024"}).Code)
+		w := fx.do("GET", "/share/info/docs_2024", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "http://example.com/s/docs_2024")
+
+		w = setAlias(share.ID, gin.H{"random": true})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusNotFound, fx.do("GET", "/share/info/docs_2024", nil).Code)
+
+		require.Equal(t, http.StatusOK, setAlias(share.ID, gin.H{}).Code)
+		var reloaded model.Share
+		model.DB.First(&reloaded, share.ID)
+		assert.Nil(t, reloaded.Alias)
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/info/"+fx.token, nil).Code)
+	})
+
+	t.Run("Access Cookie Shared By Alias And Token", func(t *testing.T) {
+		hashed, _ := bcrypt.GenerateFromPassword([]byte("7c3d"), bcrypt.MinCost)
+		alias := "locked-notes"
+		locked := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "locked-token", Alias: &alias, Password: string(hashed)}
+		require.NoError(t, model.DB.Create(&locked).Error)
+
+		// 通过短链接校验后，Cookie 以分享令牌命名，令牌与短链接地址均可使用
+		w := fx.do("POST", "/share/verify/"+alias, gin.H{"password": "7c3d"})
+		require.Equal(t, http.StatusOK, w.Code)
+		cookie := strings.SplitN(w.Header().Get("Set-Cookie"), ";", 2)[0]
+		assert.True(t, strings.HasPrefix(cookie, "share_access_locked-token="), cookie)
+
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/list/locked-token", nil, "Cookie", cookie).Code)
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/list/"+alias, nil, "Cookie", cookie).Code)
+		assert.Equal(t, http.StatusForbidden, fx.do("GET", "/share/list/"+alias, nil).Code)
+	})
+
+	t.Run("QR Code", func(t *testing.T) {
+		w := fx.do("GET", "/share/qrcode/"+fx.token+"?size=200", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("\x89PNG")))
+
+		assert.Equal(t, http.StatusBadRequest, fx.do("GET", "/share/qrcode/"+fx.token+"?size=10", nil).Code)
+		assert.Equal(t, http.StatusNotFound, fx.do("GET", "/share/qrcode/missing", nil).Code)
+	})
+}
+
+func TestShareLifecycle(t *testing.T) {
+	fx := setupShareTest(t)
+	var share model.Share
+	require.NoError(t, model.DB.Where("token = ?", fx.token).First(&share).Error)
+	update := func(body gin.H) *httptest.ResponseRecorder {
+		return fx.do("PUT", fmt.Sprintf("/user/share/%d", share.ID), body)
+	}
+	reload := func() model.Share {
+		var s model.Share
+		require.NoError(t, model.DB.Unscoped().First(&s, share.ID).Error)
+		return s
+	}
+	verify := func(password string) string {
+		w := fx.do("POST", "/share/verify/"+fx.token, gin.H{"password": password})
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Data struct {
+				AccessToken string `json:"accessToken"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data.AccessToken
+	}
+	list := func(access string) int {
+		return fx.do("GET", "/share/list/"+fx.token, nil, "X-Share-Token", access).Code
+	}
+
+	t.Run("Edit Password", func(t *testing.T) {
+		model.DB.Model(&share).Updates(map[string]interface{}{"is_public": true, "review_status": model.ReviewApproved})
+		require.Equal(t, http.StatusOK, update(gin.H{"password": "first"}).Code)
+		assert.False(t, reload().IsPublic)
+		assert.Equal(t, http.StatusForbidden, list(""))
+		old := verify("first")
+		assert.Equal(t, http.StatusOK, list(old))
+
+		// 修改提取码后旧的访问令牌失效
+		require.Equal(t, http.StatusOK, update(gin.H{"password": "second"}).Code)
+		assert.Equal(t, http.StatusForbidden, list(old))
+		assert.Equal(t, http.StatusOK, list(verify("second")))
+
+		require.Equal(t, http.StatusOK, update(gin.H{"password": ""}).Code)
+		assert.Equal(t, http.StatusOK, list(""))
+	})
+
+	t.Run("Edit Options", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, update(gin.H{"expireDays": 3, "maxDownloads": 5}).Code)
+		s := reload()
+		require.NotNil(t, s.ExpireTime)
+		assert.WithinDuration(t, time.Now().AddDate(0, 0, 3), *s.ExpireTime, time.Minute)
+		assert.Equal(t, 5, s.MaxDownloads)
+
+		// 未提供的字段保持不变
+		require.Equal(t, http.StatusOK, update(gin.H{"maxViews": 10}).Code)
+		s = reload()
+		assert.NotNil(t, s.ExpireTime)
+		assert.Equal(t, 5, s.MaxDownloads)
+
+		require.Equal(t, http.StatusOK, update(gin.H{"expireDays": 0}).Code)
+		assert.Nil(t, reload().ExpireTime)
+
+		for _, body := range []gin.H{{"maxViews": -1}, {"mode": "bogus"}, {"expireDays": -2}} {
+			assert.Equal(t, http.StatusBadRequest, update(body).Code, body)
+		}
+		fileShare := model.Share{FileID: fx.a.ID, UserID: sharerID, Token: "file-share"}
+		require.NoError(t, model.DB.Create(&fileShare).Error)
+		w := fx.do("PUT", fmt.Sprintf("/user/share/%d", fileShare.ID), gin.H{"mode": model.ShareModeUpload})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		other := model.Share{FileID: fx.other.ID, UserID: visitorID, Token: "visitor-share"}
+		require.NoError(t, model.DB.Create(&other).Error)
+		assert.Equal(t, http.StatusNotFound, fx.do("PUT", fmt.Sprintf("/user/share/%d", other.ID), gin.H{"maxViews": 1}).Code)
+	})
+
+	t.Run("Renew", func(t *testing.T) {
+		renew := func(days int) *httptest.ResponseRecorder {
+			return fx.do("POST", fmt.Sprintf("/user/share/%d/renew", share.ID), gin.H{"days": days})
+		}
+		assert.Equal(t, http.StatusBadRequest, renew(3).Code, "permanent share")
+
+		expired := time.Now().Add(-time.Hour)
+		model.DB.Model(&share).UpdateColumn("expire_time", expired)
+		assert.Equal(t, http.StatusNotFound, fx.do("GET", "/share/info/"+fx.token, nil).Code)
+		assert.Equal(t, http.StatusBadRequest, renew(0).Code)
+		require.Equal(t, http.StatusOK, renew(3).Code)
+		assert.WithinDuration(t, time.Now().AddDate(0, 0, 3), *reload().ExpireTime, time.Minute)
+		assert.Equal(t, http.StatusOK, fx.do("GET", "/share/info/"+fx.token, nil).Code)
+
+		// 未过期的分享在原有效期上延长
+		require.Equal(t, http.StatusOK, renew(2).Code)
+		assert.WithinDuration(t, time.Now().AddDate(0, 0, 5), *reload().ExpireTime, time.Minute)
+	})
+
+	t.Run("Expiry Notice And Cleanup", func(t *testing.T) {
+		soon := time.Now().Add(2 * time.Hour)
+		model.DB.Model(&share).Updates(map[string]interface{}{"expire_time": soon, "expire_notified": false})
+		exhausted := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "exhausted", ExpireTime: &soon, MaxViews: 1, Views: 1}
+		later := time.Now().AddDate(0, 0, 10)
+		distant := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "distant", ExpireTime: &later}
+		require.NoError(t, model.DB.Create(&exhausted).Error)
+		require.NoError(t, model.DB.Create(&distant).Error)
+
+		count, err := service.NotifyExpiringShares(24 * time.Hour)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, count)
+		var msg model.Message
+		require.NoError(t, model.DB.Where("user_id = ?", sharerID).Order("id DESC").First(&msg).Error)
+		assert.Contains(t, msg.Content, "docs")
+		count, err = service.NotifyExpiringShares(24 * time.Hour)
+		require.NoError(t, err)
+		assert.Zero(t, count, "notified only once")
+
+		longAgo := time.Now().AddDate(0, 0, -8)
+		recently := time.Now().Add(-time.Hour)
+		stale := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "stale", ExpireTime: &longAgo}
+		fresh := model.Share{FileID: fx.sub.ID, UserID: sharerID, Token: "fresh", ExpireTime: &recently}
+		require.NoError(t, model.DB.Create(&stale).Error)
+		require.NoError(t, model.DB.Create(&fresh).Error)
+		count, err = service.CleanExpiredShares(7 * 24 * time.Hour)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, count)
+		var remaining int64
+		model.DB.Model(&model.Share{}).Where("token IN ?", []string{"stale", "fresh"}).Count(&remaining)
+		assert.EqualValues(t, 1, remaining)
+	})
+
+	t.Run("Bulk Revoke", func(t *testing.T) {
+		revoke := func(body gin.H) *httptest.ResponseRecorder {
+			return fx.do("POST", "/user/shares/revoke", body)
+		}
+		count := func(token string) int64 {
+			var n int64
+			model.DB.Model(&model.Share{}).Where("token = ?", token).Count(&n)
+			return n
+		}
+		for token, fileID := range map[string]uint{"in-sub": fx.sub.ID, "in-sub-file": fx.a.ID, "elsewhere": fx.key.ID, "old": fx.c.ID} {
+			require.NoError(t, model.DB.Create(&model.Share{FileID: fileID, UserID: sharerID, Token: token}).Error)
+		}
+		model.DB.Model(&model.Share{}).Where("token = ?", "old").UpdateColumn("created_at", time.Now().AddDate(0, 0, -40))
+
+		assert.Equal(t, http.StatusBadRequest, revoke(gin.H{}).Code)
+		assert.Equal(t, http.StatusNotFound, revoke(gin.H{"fileId": fx.other.ID}).Code)
+
+		require.Equal(t, http.StatusOK, revoke(gin.H{"fileId": fx.sub.ID}).Code)
+		assert.Zero(t, count("in-sub"))
+		assert.Zero(t, count("in-sub-file"))
+		assert.EqualValues(t, 1, count("elsewhere"))
+
+		require.Equal(t, http.StatusOK, revoke(gin.H{"olderThanDays": 30}).Code)
+		assert.Zero(t, count("old"))
+		assert.EqualValues(t, 1, count("elsewhere"))
+
+		require.Equal(t, http.StatusOK, revoke(gin.H{"all": true}).Code)
+		var left int64
+		model.DB.Model(&model.Share{}).Where("user_id = ?", sharerID).Count(&left)
+		assert.Zero(t, left)
+		assert.EqualValues(t, 1, count("visitor-share"), "other users' shares untouched")
+	})
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/service"
+)
+
+// tagRequest 批量标签请求，文件可通过 ID 或路径指定
+type tagRequest struct {
+	IDs   []uint   `json:"ids"`
+	Paths []string `json:"paths"`
+	Tags  []string `json:"tags" binding:"required"`
+}
+
+// AddTags 为文件批量添加标签
+func AddTags(c *gin.Context) {
+	userID := c.GetUint("userID")
+	var req tagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	ids, err := fileIDsFromRequest(userID, req.IDs, req.Paths)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.AddTags(userID, ids, req.Tags); err != nil {
+		c.JSON(fileErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "标签添加成功"})
+}
+
+// RemoveTags 批量移除文件标签
+func RemoveTags(c *gin.Context) {
+	userID := c.GetUint("userID")
+	var req tagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	ids, err := fileIDsFromRequest(userID, req.IDs, req.Paths)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.RemoveTags(userID, ids, req.Tags); err != nil {
+		c.JSON(fileErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "标签移除成功"})
+}
+
+// ListTags 获取用户的全部标签
+func ListTags(c *gin.Context) {
+	userID := c.GetUint("userID")
+	tags, err := service.ListTags(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取标签失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": tags})
+}
+
+// ListTaggedFiles 跨目录列出带有指定标签的文件
+func ListTaggedFiles(c *gin.Context) {
+	userID := c.GetUint("userID")
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	files, page, err := service.ListTagged(userID, c.Param("name"), q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": files, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
+}
+
+// SetFileMeta 为文件批量设置自定义元数据
+func SetFileMeta(c *gin.Context) {
+	userID := c.GetUint("userID")
+	var req struct {
+		IDs   []uint            `json:"ids"`
+		Paths []string          `json:"paths"`
+		Meta  map[string]string `json:"meta" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	ids, err := fileIDsFromRequest(userID, req.IDs, req.Paths)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.SetMeta(userID, ids, req.Meta); err != nil {
+		c.JSON(fileErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "元数据保存成功"})
+}
+
+// RemoveFileMeta 批量移除文件的元数据键
+func RemoveFileMeta(c *gin.Context) {
+	userID := c.GetUint("userID")
+	var req struct {
+		IDs   []uint   `json:"ids"`
+		Paths []string `json:"paths"`
+		Keys  []string `json:"keys" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	ids, err := fileIDsFromRequest(userID, req.IDs, req.Paths)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.RemoveMeta(userID, ids, req.Keys); err != nil {
+		c.JSON(fileErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "元数据移除成功"})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stfreya/stfreyanetdisk/service"
+)
+
+// ListTasks 获取后台任务列表 (keyword: 按任务类型筛选)
+func ListTasks(c *gin.Context) {
+	userID := c.GetUint("userID")
+	q, err := listQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tasks, page, err := service.ListTasks(userID, q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": tasks, "nextCursor": page.NextCursor, "hasMore": page.HasMore})
+}
+
+// GetTask 获取任务详情与进度
+func GetTask(c *gin.Context) {
+	userID := c.GetUint("userID")
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	task, err := service.GetTask(userID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+// CancelTask 取消任务
+func CancelTask(c *gin.Context) {
+	userID := c.GetUint("userID")
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	if err := service.CancelTask(userID, uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "任务已取消"})
+}
+
+// DeleteTask 删除已结束的任务记录
+func DeleteTask(c *gin.Context) {
+	userID := c.GetUint("userID")
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	if err := service.DeleteTask(userID, uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "任务已删除"})
+}
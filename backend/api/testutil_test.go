@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stfreya/stfreyanetdisk/config"
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testEnv 接口测试的公共环境：每个测试独立的内存数据库、本地存储目录与默认存储策略
+type testEnv struct {
+	root   string
+	policy model.StoragePolicy
+}
+
+// setupTestEnv 初始化测试数据库与存储，并创建指定 ID 的用户 (空间 1 GB)
+func setupTestEnv(t *testing.T, userIDs ...uint) *testEnv {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, model.Migrate(db))
+	model.DB = db
+	config.GlobalConfig = &config.Config{JWTSecret: "test-secret"}
+
+	env := &testEnv{root: t.TempDir()}
+	cfg, _ := json.Marshal(map[string]string{"root": env.root})
+	env.policy = model.StoragePolicy{Name: "local", Type: "local", Config: string(cfg), IsDefault: true, Status: 1}
+	require.NoError(t, db.Create(&env.policy).Error)
+	for _, id := range userIDs {
+		require.NoError(t, db.Create(&model.User{Model: gorm.Model{ID: id}, Username: fmt.Sprintf("user%d", id), Password: "x",
+			Email: fmt.Sprintf("user%d@example.com", id), TotalSize: 1 << 30}).Error)
+	}
+	return env
+}
+
+// mkdir 创建文件夹，id 为 0 时自动分配
+func (env *testEnv) mkdir(t *testing.T, userID uint, id uint, parentID uint, name string) *model.File {
+	f := &model.File{Model: gorm.Model{ID: id}, Name: name, IsFolder: true, ParentID: parentID, UserID: userID}
+	require.NoError(t, model.DB.Create(f).Error)
+	return f
+}
+
+// put 在存储中写入文本文件并创建对应的文件记录
+func (env *testEnv) put(t *testing.T, userID uint, parentID uint, name string, content string) *model.File {
+	storage := fmt.Sprintf("uploads/%d/%s", userID, name)
+	require.NoError(t, os.MkdirAll(filepath.Join(env.root, filepath.Dir(storage)), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(env.root, storage), []byte(content), 0644))
+	f := &model.File{Name: name, Size: int64(len(content)), Path: storage, MimeType: "text/plain", Ext: filepath.Ext(name),
+		Category: "document", ParentID: parentID, UserID: userID, PolicyID: env.policy.ID}
+	require.NoError(t, model.DB.Create(f).Error)
+	return f
+}
+
+// doRequest 以 JSON 请求体调用路由，headers 为成对的请求头名称与值
+func doRequest(router *gin.Engine, method string, url string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, url, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
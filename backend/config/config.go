@@ -18,6 +18,9 @@ type Config struct {
 	RedisHost string
 	RedisPort string
 	RedisPass string
+	// TrustedProxies 受信任的反向代理 (逗号分隔的 IP 或 CIDR)，
+	// 只有来自这些地址的 X-Forwarded-For 才用于识别客户端 IP
+	TrustedProxies string
 }
 
 var GlobalConfig *Config
@@ -40,6 +43,8 @@ func InitConfig() {
 		RedisHost: getEnv("REDIS_HOST", "127.0.0.1"),
 		RedisPort: getEnv("REDIS_PORT", "6379"),
 		RedisPass: getEnv("REDIS_PASS", ""),
+
+		TrustedProxies: getEnv("TRUSTED_PROXIES", ""),
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	posixpath "path"
 	"path/filepath"
 	"time"
 
@@ -19,6 +20,11 @@ type SFTPDriver struct {
 	Root     string
 }
 
+// remotePath SFTP 服务器上的路径始终以 "/" 分隔，不能使用本机的 filepath
+func (d *SFTPDriver) remotePath(p string) string {
+	return posixpath.Join(d.Root, filepath.ToSlash(p))
+}
+
 func NewSFTPDriver(host string, port int, user, password, root string) (*SFTPDriver, error) {
 	return &SFTPDriver{
 		Host:     host,
@@ -62,9 +68,9 @@ func (d *SFTPDriver) Put(path string, reader io.Reader, size int64) error {
 	defer sshClient.Close()
 	defer sftpClient.Close()
 
-	fullPath := filepath.Join(d.Root, path)
+	fullPath := d.remotePath(path)
 	// 确保父目录存在
-	dir := filepath.Dir(fullPath)
+	dir := posixpath.Dir(fullPath)
 	if err = sftpClient.MkdirAll(dir); err != nil {
 		return err
 	}
@@ -85,7 +91,7 @@ func (d *SFTPDriver) Get(path string) (io.ReadCloser, error) {
 		return nil, err
 	}
 
-	fullPath := filepath.Join(d.Root, path)
+	fullPath := d.remotePath(path)
 	f, err := sftpClient.Open(fullPath)
 	if err != nil {
 		sshClient.Close()
@@ -128,7 +134,7 @@ func (d *SFTPDriver) Delete(path string) error {
 	defer sshClient.Close()
 	defer sftpClient.Close()
 
-	fullPath := filepath.Join(d.Root, path)
+	fullPath := d.remotePath(path)
 	return sftpClient.Remove(fullPath)
 }
 
@@ -140,7 +146,7 @@ func (d *SFTPDriver) Exists(path string) (bool, error) {
 	defer sshClient.Close()
 	defer sftpClient.Close()
 
-	fullPath := filepath.Join(d.Root, path)
+	fullPath := d.remotePath(path)
 	_, err = sftpClient.Stat(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
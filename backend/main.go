@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stfreya/stfreyanetdisk/api"
@@ -20,130 +21,40 @@ func main() {
 	// 初始化数据库
 	model.InitDB()
 
+	// 补全历史文件的类型信息
+	service.BackfillFileTypes()
+
 	// 初始化搜索索引
 	if err := utils.InitSearch("data/index.bleve"); err != nil {
 		log.Printf("初始化搜索索引失败: %v", err)
 	}
+	if utils.SearchIndexRebuilt() {
+		if _, err := service.RebuildSearchIndex(0); err != nil {
+			log.Printf("提交索引重建任务失败: %v", err)
+		}
+	}
 
 	// 启动后台任务
 	service.StartBackgroundTasks()
 
 	// 初始化 Gin 引擎
 	r := gin.Default()
-
-	// 注册全局中间件
-	r.Use(middleware.CorsMiddleware())
-
-	// 路由组
-	v1 := r.Group("/api/v1")
-	{
-
-		// 公开接口 (认证相关)
-		auth := v1.Group("/auth")
-		{
-			auth.GET("/captcha", api.GetCaptcha)
-			auth.GET("/config", api.GetPublicConfigs)
-			auth.POST("/register", api.Register)
-			auth.POST("/login", api.Login)
-		}
-
-		// 分享相关接口 (公开)
-		share := v1.Group("/share")
-		{
-			share.GET("/info/:token", api.GetShare)
-			share.GET("/list/:token", api.GetShareFolderList)
-			share.POST("/verify/:token", api.VerifySharePassword)
-			share.GET("/download/:token", api.DownloadShare)
-			share.POST("/save/:token", middleware.AuthMiddleware(), api.SaveShare)
-		}
-
-		// 文件管理接口 (需要认证)
-		file := v1.Group("/file")
-		file.Use(middleware.AuthMiddleware())
-		{
-			file.GET("/list", api.ListFiles)
-			file.GET("/favorites", api.ListFavorites)
-			file.POST("/folder", api.CreateFolder)
-			file.POST("/upload", api.UploadFile)
-			file.POST("/share", api.CreateShare)
-			file.POST("/favorite/:id", api.ToggleFavorite)
-			file.DELETE("/:id", api.DeleteFile)
-			file.GET("/preview/:id", api.PreviewFile)
-			file.POST("/save/:id", api.SaveFileContent)
-			file.PUT("/rename/:id", api.RenameFile)
-			file.PUT("/move/:id", api.MoveFile)
-			file.POST("/batch/download", api.BatchDownloadFiles)
-			file.POST("/batch/delete", api.BatchDeleteFiles)
-			file.GET("/search", api.SearchFiles)
-			file.GET("/recycle", api.ListRecycleBin)
-			file.POST("/restore/:id", api.RestoreFile)
-			file.DELETE("/permanent/:id", api.PermanentDeleteFile)
-			file.GET("/versions/:id", api.ListFileVersions)
-			file.POST("/version/restore/:id", api.RestoreFileVersion)
-		}
-
-		// 管理员接口
-		admin := v1.Group("/admin")
-		admin.Use(middleware.AuthMiddleware(), api.AdminMiddleware())
-		{
-			admin.GET("/users", api.ListUsers)
-			admin.POST("/user/quota", api.UpdateUserQuota)
-			admin.PUT("/user/update", api.UpdateUserAdmin)
-			admin.DELETE("/user/:id", api.DeleteUser)
-			admin.GET("/policies", api.ListPolicies)
-			admin.POST("/policy", api.CreatePolicy)
-			admin.PUT("/policy/:id", api.UpdatePolicy)
-			admin.DELETE("/policy/:id", api.DeletePolicy)
-			admin.POST("/policy/test", api.TestStorageConnection)
-			admin.GET("/policy/templates", api.GetStorageTemplates)
-			admin.GET("/stats", api.GetSystemStats)
-			admin.GET("/configs", api.ListConfigs)
-			admin.POST("/configs", api.UpdateConfigs)
-			admin.POST("/recycle/clean", api.CleanRecycleBinAdmin)
-			admin.GET("/shares", api.ListAllShares)
-			admin.DELETE("/share/:id", api.DeleteShareAdmin)
-			admin.GET("/invites", api.ListAllInvitationCodes)
-			admin.POST("/invite/generate", api.BatchGenerateInvitationCodesAdmin)
-			admin.DELETE("/invite/:id", api.DeleteInvitationCodeAdmin)
-		}
-
-		// 用户接口 (积分、邀请、消息等)
-		user := v1.Group("/user")
-		user.Use(middleware.AuthMiddleware())
-		{
-			user.GET("/info", api.GetUserInfo)
-			user.PUT("/profile", api.UpdateProfile)
-			user.POST("/signin", api.UserSignIn)
-			user.POST("/exchange/quota", api.ExchangeQuota)
-			user.POST("/invite/generate", api.GenerateInvitationCode)
-			user.GET("/invite/list", api.ListUserInvitationCodes)
-			user.GET("/shares", api.ListUserShares)
-			user.DELETE("/share/:id", api.DeleteUserShare)
-			user.GET("/transactions", api.GetUserTransactions)
-
-			// 消息通知
-			user.GET("/messages", api.ListMessages)
-			user.GET("/messages/unread/count", api.GetUnreadCount)
-			user.POST("/messages/read/:id", api.MarkMessageRead)
-			user.POST("/messages/read/all", api.MarkAllMessagesRead)
-			user.DELETE("/messages/:id", api.DeleteMessage)
-
-			user.GET("/ping", func(c *gin.Context) {
-				c.JSON(200, gin.H{"message": "auth success"})
-			})
+	// 未配置反向代理时不信任任何转发头，避免伪造客户端 IP 绕过访问频率限制
+	var proxies []string
+	for _, p := range strings.Split(config.GlobalConfig.TrustedProxies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
 		}
 	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("反向代理配置错误: %v", err)
+	}
 
-	// WebDAV 接口
-	r.Any("/webdav/*any", api.WebDAVHandler())
+	// 注册全局中间件
+	r.Use(middleware.CorsMiddleware())
 
-	// 基础健康检查
-	r.GET("/ping", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "pong",
-			"status":  "StfreyaNetdisk 后端运行中",
-		})
-	})
+	// 注册接口路由
+	api.RegisterRoutes(r)
 
 	port := config.GlobalConfig.Port
 	log.Printf("服务器启动在端口 %s", port)
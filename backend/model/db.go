@@ -12,6 +12,31 @@ import (
 
 var DB *gorm.DB
 
+// Migrate 迁移所有表结构
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&User{},
+		&UserTransaction{},
+		&File{},
+		&FileVersion{},
+		&FileTag{},
+		&FileMeta{},
+		&FileMedia{},
+		&IndexJob{},
+		&Task{},
+		&Thumbnail{},
+		&StoragePolicy{},
+		&Share{},
+		&ShareAccessLog{},
+		&FileGrant{},
+		&UserGroup{},
+		&UserGroupMember{},
+		&InvitationCode{},
+		&Config{},
+		&Message{},
+	)
+}
+
 func InitDB() {
 	cfg := config.GlobalConfig
 	// 拼接 MySQL DSN
@@ -26,23 +51,18 @@ func InitDB() {
 	}
 
 	// 自动迁移表结构
-	err = DB.AutoMigrate(
-		&User{},
-		&UserTransaction{},
-		&File{},
-		&FileVersion{},
-		&StoragePolicy{},
-		&Share{},
-		&InvitationCode{},
-		&Config{},
-		&Message{},
-	)
+	err = Migrate(DB)
 	if err != nil {
 		log.Fatalf("数据库迁移失败: %v", err)
 	}
 
 	log.Println("数据库连接已建立，表结构迁移完成")
 
+	// 补全历史数据的目录物化路径
+	if err := RebuildTreePaths(DB); err != nil {
+		log.Printf("补全目录物化路径失败: %v", err)
+	}
+
 	// 初始化默认系统配置
 	initDefaultConfigs()
 
@@ -90,6 +110,19 @@ func initDefaultConfigs() {
 		{Key: "upload_reward", Value: "1", Description: "文件上传奖励", Type: "int"},
 		{Key: "share_reward", Value: "2", Description: "创建分享奖励", Type: "int"},
 		{Key: "quota_exchange_cost", Value: "10", Description: "1GB 空间兑换成本(学园币)", Type: "int"},
+		{Key: "index_max_file_size", Value: "20", Description: "全文索引抽取正文的文件大小上限(MB)", Type: "int"},
+		{Key: "thumb_max_source_size", Value: "30", Description: "生成缩略图的原图大小上限(MB)", Type: "int"},
+		{Key: "media_max_file_size", Value: "512", Description: "解析媒体元数据时从远程存储缓存的文件大小上限(MB)", Type: "int"},
+		{Key: "thumb_policy_id", Value: "0", Description: "缩略图存储策略ID(0 表示与原文件相同)", Type: "int"},
+		{Key: "edit_max_file_size", Value: "5", Description: "在线编辑文本文件的大小上限(MB)", Type: "int"},
+		{Key: "archive_max_file_size", Value: "2048", Description: "在线浏览、解压与压缩的压缩包大小上限(MB)", Type: "int"},
+		{Key: "share_upload_max_file_size", Value: "100", Description: "收集文件分享中访客上传单个文件的大小上限(MB)", Type: "int"},
+		{Key: "share_archive_max_size", Value: "4096", Description: "分享中打包下载文件夹的大小上限(MB)", Type: "int"},
+		{Key: "share_expire_notice_hours", Value: "24", Description: "分享过期前多少小时提醒分享者(0 不提醒)", Type: "int"},
+		{Key: "share_expired_retention_days", Value: "7", Description: "过期的分享保留多少天后自动删除", Type: "int"},
+		{Key: "share_log_retention_days", Value: "180", Description: "分享访问日志的保留天数", Type: "int"},
+		{Key: "site_url", Value: "", Description: "站点访问地址(如 https://pan.example.com)，用于生成分享链接与 Open Graph 信息，留空时按请求地址推断", Type: "string"},
+		{Key: "share_public_review", Value: "true", Description: "公开分享是否需要管理员审核", Type: "bool"},
 	}
 
 	for _, cfg := range configs {
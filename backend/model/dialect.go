@@ -0,0 +1,30 @@
+package model
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 生产环境使用 MySQL，少数表达式在其他数据库 (如 SQLite) 中写法不同，统一在此处理
+
+// isSQLite 连接是否为 SQLite
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// concatExpr 拼接多个 SQL 表达式为字符串
+func concatExpr(db *gorm.DB, parts ...string) string {
+	if isSQLite(db) {
+		return "(" + strings.Join(parts, " || ") + ")"
+	}
+	return "CONCAT(" + strings.Join(parts, ", ") + ")"
+}
+
+// UpsertValue 冲突更新 (ON CONFLICT / ON DUPLICATE KEY) 时引用本次待插入的列值
+func UpsertValue(db *gorm.DB, column string) string {
+	if isSQLite(db) {
+		return "excluded." + column
+	}
+	return "VALUES(" + column + ")"
+}
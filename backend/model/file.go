@@ -1,6 +1,8 @@
 package model
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -12,11 +14,60 @@ type File struct {
 	Hash       string `gorm:"type:varchar(64);index;comment:文件哈希(SHA256)"`
 	Path       string `gorm:"type:varchar(512);comment:存储路径"`
 	Ext        string `gorm:"type:varchar(20);comment:扩展名"`
+	MimeType   string `gorm:"type:varchar(127);comment:MIME类型"`
+	Category   string `gorm:"type:varchar(20);index;comment:文件类别(image,video,audio,document,archive,other)"`
 	IsFolder   bool   `gorm:"default:false;comment:是否为文件夹"`
 	ParentID   uint   `gorm:"default:0;index;comment:父级目录ID"`
+	TreePath   string `gorm:"type:varchar(700);index;comment:物化路径(由根到自身的ID序列)"`
 	UserID     uint   `gorm:"index;comment:创建者ID"`
 	PolicyID   uint   `gorm:"comment:存储策略ID"`
 	IsFavorite bool   `gorm:"default:false;index;comment:是否收藏"`
+
+	Tags  []FileTag  `gorm:"foreignKey:FileID"`
+	Meta  []FileMeta `gorm:"foreignKey:FileID"`
+	Media *FileMedia `gorm:"foreignKey:FileID"`
+}
+
+// FileTag 文件标签
+type FileTag struct {
+	ID        uint   `gorm:"primaryKey"`
+	FileID    uint   `gorm:"uniqueIndex:idx_file_tag;comment:文件ID"`
+	UserID    uint   `gorm:"index;comment:用户ID"`
+	Name      string `gorm:"type:varchar(50);uniqueIndex:idx_file_tag;index;comment:标签名"`
+	CreatedAt time.Time
+}
+
+// FileMeta 文件自定义元数据 (键值对)
+type FileMeta struct {
+	ID        uint   `gorm:"primaryKey"`
+	FileID    uint   `gorm:"uniqueIndex:idx_file_meta;comment:文件ID"`
+	UserID    uint   `gorm:"index;comment:用户ID"`
+	Key       string `gorm:"type:varchar(50);uniqueIndex:idx_file_meta;comment:键"`
+	Value     string `gorm:"type:varchar(255);comment:值"`
+	UpdatedAt time.Time
+}
+
+// FileMedia 图片、音频与视频的技术元数据
+type FileMedia struct {
+	ID          uint       `gorm:"primaryKey"`
+	FileID      uint       `gorm:"uniqueIndex;comment:文件ID"`
+	UserID      uint       `gorm:"index:idx_media_user_captured;comment:用户ID"`
+	Width       int        `gorm:"comment:宽度(像素)"`
+	Height      int        `gorm:"comment:高度(像素)"`
+	Duration    float64    `gorm:"comment:时长(秒)"`
+	Codec       string     `gorm:"type:varchar(50);comment:编码"`
+	CapturedAt  *time.Time `gorm:"index:idx_media_user_captured;comment:拍摄时间"`
+	CameraMake  string     `gorm:"type:varchar(100);comment:相机厂商"`
+	CameraModel string     `gorm:"type:varchar(100);comment:相机型号"`
+	Latitude    *float64   `gorm:"comment:纬度"`
+	Longitude   *float64   `gorm:"comment:经度"`
+	Title       string     `gorm:"type:varchar(255);comment:标题"`
+	Artist      string     `gorm:"type:varchar(255);comment:艺术家"`
+	Album       string     `gorm:"type:varchar(255);comment:专辑"`
+	Genre       string     `gorm:"type:varchar(100);comment:流派"`
+	Year        int        `gorm:"comment:年份"`
+	Track       int        `gorm:"comment:音轨号"`
+	UpdatedAt   time.Time
 }
 
 // FileVersion 文件历史版本
@@ -28,3 +79,17 @@ type FileVersion struct {
 	Hash     string `gorm:"type:varchar(64);comment:版本哈希"`
 	PolicyID uint   `gorm:"comment:版本存储策略ID"`
 }
+
+// Thumbnail 图片缩略图缓存
+type Thumbnail struct {
+	ID        uint   `gorm:"primaryKey"`
+	FileID    uint   `gorm:"uniqueIndex:idx_thumb;comment:文件ID"`
+	Size      string `gorm:"type:varchar(20);uniqueIndex:idx_thumb;comment:尺寸(small,medium,large)"`
+	Format    string `gorm:"type:varchar(10);uniqueIndex:idx_thumb;comment:格式(jpeg,webp)"`
+	Path      string `gorm:"type:varchar(512);comment:存储路径"`
+	PolicyID  uint   `gorm:"comment:存储策略ID"`
+	Width     int    `gorm:"comment:宽度"`
+	Height    int    `gorm:"comment:高度"`
+	Bytes     int64  `gorm:"comment:大小(字节)"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,51 @@
+package model
+
+import "time"
+
+// 索引任务状态
+const (
+	IndexJobPending = "pending"
+	IndexJobFailed  = "failed"
+)
+
+// IndexJob 搜索索引同步任务
+// 每个文件最多一条待处理任务，重复提交会合并；Content 为 true 时需要重新抽取正文，
+// 否则只刷新名称、位置、标签等属性。文件已删除时任务会将其移出索引。
+type IndexJob struct {
+	ID        uint      `gorm:"primarykey"`
+	FileID    uint      `gorm:"uniqueIndex;not null;comment:文件ID"`
+	Content   bool      `gorm:"default:false;comment:是否重新抽取正文"`
+	Status    string    `gorm:"type:varchar(20);index:idx_index_job_run;default:'pending';comment:状态(pending, failed)"`
+	RunAt     time.Time `gorm:"index:idx_index_job_run;comment:下次执行时间"`
+	Attempts  int       `gorm:"default:0;comment:已尝试次数"`
+	Version   int       `gorm:"default:0;comment:合并次数，处理期间被重新提交时不删除任务"`
+	Error     string    `gorm:"type:varchar(500);comment:最近一次错误"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// 后台任务状态
+const (
+	TaskPending   = "pending"
+	TaskRunning   = "running"
+	TaskSucceeded = "succeeded"
+	TaskFailed    = "failed"
+	TaskCanceled  = "canceled"
+)
+
+// Task 用户发起的后台任务 (解压、打包、转存等)
+// Payload 与 Result 为 JSON，结构由任务类型决定；Done / Total 为进度，单位由任务类型决定 (通常为字节)
+type Task struct {
+	ID         uint      `gorm:"primarykey"`
+	UserID     uint      `gorm:"index:idx_task_user;comment:用户ID"`
+	Type       string    `gorm:"type:varchar(30);comment:任务类型"`
+	Status     string    `gorm:"type:varchar(20);index;default:'pending';comment:状态(pending, running, succeeded, failed, canceled)"`
+	Payload    string    `gorm:"type:text;comment:任务参数(JSON)"`
+	Result     string    `gorm:"type:text;comment:任务结果(JSON)"`
+	Error      string    `gorm:"type:varchar(500);comment:失败原因"`
+	Done       int64     `gorm:"default:0;comment:已完成量"`
+	Total      int64     `gorm:"default:0;comment:总量"`
+	CreatedAt  time.Time `gorm:"index:idx_task_user"`
+	UpdatedAt  time.Time
+	FinishedAt *time.Time `gorm:"comment:结束时间"`
+}
@@ -11,14 +11,88 @@ type Share struct {
 	gorm.Model
 	FileID     uint      `gorm:"index;comment:分享的文件ID"`
 	UserID     uint      `gorm:"index;comment:分享者ID"`
-	Password   string    `gorm:"type:varchar(20);comment:提取码"`
+	Password   string    `gorm:"type:varchar(100);comment:提取码哈希(bcrypt)" json:"-"`
 	ExpireTime *time.Time `gorm:"comment:过期时间"`
 	Views      int       `gorm:"default:0;comment:访问次数"`
 	Downloads  int       `gorm:"default:0;comment:下载次数"`
 	IsPublic   bool      `gorm:"default:false;comment:是否公开"`
 	Token      string    `gorm:"type:varchar(64);uniqueIndex;comment:分享令牌"`
+	Alias      *string   `gorm:"type:varchar(32);uniqueIndex;comment:自定义或随机生成的短链接(为空表示未设置)"`
+
+	Mode           string `gorm:"type:varchar(20);default:'';comment:分享方式(空:普通, preview:仅预览, upload:收集文件)"`
+	MaxViews       int    `gorm:"default:0;comment:访问次数上限(0 不限)"`
+	MaxDownloads   int    `gorm:"default:0;comment:下载次数上限(0 不限)"`
+	UploadMaxSize  int64  `gorm:"default:0;comment:收集文件的单个文件大小上限(字节, 0 使用系统配置)"`
+	UploadExts     string `gorm:"type:varchar(255);comment:收集文件允许的扩展名(逗号分隔, 空表示不限)"`
+	ArchiveMaxSize int64  `gorm:"default:0;comment:打包下载文件夹的大小上限(字节, 0 使用系统配置)"`
+	ExpireNotified bool   `gorm:"default:false;comment:是否已发送即将过期提醒"`
+
+	Title        string     `gorm:"type:varchar(100);comment:公开展示的标题"`
+	Description  string     `gorm:"type:varchar(500);comment:公开展示的简介"`
+	CoverFileID  uint       `gorm:"default:0;comment:封面图片文件ID(须在分享范围内)"`
+	ReviewStatus string     `gorm:"type:varchar(20);index;default:'';comment:公开审核状态(空:未公开, pending, approved, rejected)"`
+	ReviewNote   string     `gorm:"type:varchar(255);comment:审核意见"`
+	PublishedAt  *time.Time `gorm:"comment:发布到公开目录的时间"`
+}
+
+// 公开分享的审核状态
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// 分享方式
+const (
+	ShareModeNormal  = ""        // 可浏览、下载与转存
+	ShareModePreview = "preview" // 仅可在线预览，禁止下载与转存
+	ShareModeUpload  = "upload"  // 收集文件：访客只能向分享的文件夹上传，不能浏览其中内容
+)
+
+// ShareAccessLog 分享访问日志
+type ShareAccessLog struct {
+	ID        uint      `gorm:"primaryKey"`
+	ShareID   uint      `gorm:"index:idx_share_access_time,priority:1;comment:分享ID"`
+	Action    string    `gorm:"type:varchar(20);comment:操作: view, verify, verify_failed, download, preview, save, upload"`
+	FileID    uint      `gorm:"index;comment:涉及的文件ID"`
+	UserID    uint      `gorm:"comment:登录访客的用户ID(0 为匿名)"`
+	IP        string    `gorm:"type:varchar(45);comment:访客IP"`
+	UserAgent string    `gorm:"type:varchar(255);comment:User-Agent"`
+	CreatedAt time.Time `gorm:"index:idx_share_access_time,priority:2;index"`
 }
 
+// 分享访问日志的操作类型
+const (
+	ShareActionView         = "view"
+	ShareActionVerify       = "verify"
+	ShareActionVerifyFailed = "verify_failed"
+	ShareActionDownload     = "download"
+	ShareActionPreview      = "preview"
+	ShareActionSave         = "save"
+	ShareActionUpload       = "upload"
+)
+
+// FileGrant 站内共享：将文件夹授权给指定用户或用户组
+type FileGrant struct {
+	ID         uint   `gorm:"primaryKey"`
+	FileID     uint   `gorm:"uniqueIndex:idx_file_grant_target;comment:共享的文件夹ID"`
+	OwnerID    uint   `gorm:"index;comment:文件夹所有者ID"`
+	TargetType string `gorm:"type:varchar(10);uniqueIndex:idx_file_grant_target;index:idx_file_grant_lookup,priority:1;comment:授权对象类型: user, group"`
+	TargetID   uint   `gorm:"uniqueIndex:idx_file_grant_target;index:idx_file_grant_lookup,priority:2;comment:用户ID或用户组ID"`
+	Permission string `gorm:"type:varchar(10);comment:权限: read, write"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// 站内共享的授权对象与权限
+const (
+	GrantTargetUser  = "user"
+	GrantTargetGroup = "group"
+
+	PermissionRead  = "read"  // 浏览、预览与读取内容
+	PermissionWrite = "write" // 另可上传、新建、重命名、删除与编辑
+)
+
 // InvitationCode 邀请码模型
 type InvitationCode struct {
 	gorm.Model
@@ -0,0 +1,264 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 目录层级采用物化路径 (Materialized Path) 存储:
+// 每条记录的 TreePath 为由根到自身的 ID 序列，形如 "/1/5/12/"。
+// 祖先查询只需解析路径，后代查询只需一次前缀匹配，无需逐层递归。
+
+// ErrTreePathMissing 记录尚未补全物化路径，无法按子树操作
+var ErrTreePathMissing = errors.New("文件层级路径缺失，请稍后重试")
+
+// BuildTreePath 根据父级路径和自身 ID 构造物化路径
+func BuildTreePath(parentPath string, id uint) string {
+	if parentPath == "" {
+		parentPath = "/"
+	}
+	return parentPath + strconv.FormatUint(uint64(id), 10) + "/"
+}
+
+// ParseTreePath 解析物化路径，返回由根到自身的 ID 序列
+func ParseTreePath(treePath string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(strings.Trim(treePath, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids
+}
+
+// IsInTree 判断 treePath 是否位于 rootPath 所表示的子树内 (包含根自身)
+func IsInTree(treePath string, rootPath string) bool {
+	if treePath == "" || rootPath == "" {
+		return false
+	}
+	return strings.HasPrefix(treePath, rootPath)
+}
+
+// AncestorIDs 返回所有祖先目录 ID (由根到父级，不含自身)
+func (f *File) AncestorIDs() []uint {
+	ids := ParseTreePath(f.TreePath)
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids[:len(ids)-1]
+}
+
+// Depth 返回文件所在层级 (根目录下的文件为 1)
+func (f *File) Depth() int {
+	return strings.Count(f.TreePath, "/") - 1
+}
+
+// AfterCreate 创建记录后根据父级补全物化路径
+func (f *File) AfterCreate(tx *gorm.DB) error {
+	parentPath := "/"
+	if f.ParentID != 0 {
+		var parent File
+		err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().
+			Select("id", "tree_path").Where("id = ?", f.ParentID).Take(&parent).Error
+		if err == nil && parent.TreePath != "" {
+			parentPath = parent.TreePath
+		}
+	}
+	f.TreePath = BuildTreePath(parentPath, f.ID)
+	return tx.Session(&gorm.Session{NewDB: true}).Model(&File{}).
+		Where("id = ?", f.ID).UpdateColumn("tree_path", f.TreePath).Error
+}
+
+// SubtreeScope 限定查询范围为以 root 为根的子树 (包含根自身)
+// root 缺失物化路径时不匹配任何记录，避免前缀退化为 "%" 波及全部文件
+func SubtreeScope(root *File) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if root.TreePath == "" {
+			return db.Where("1 = 0")
+		}
+		return db.Where("files.tree_path LIKE ?", root.TreePath+"%")
+	}
+}
+
+// DescendantScope 限定查询范围为 root 的所有后代 (不含根自身)，root 缺失物化路径时同样不匹配任何记录
+func DescendantScope(root *File) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if root.TreePath == "" {
+			return db.Where("1 = 0")
+		}
+		return db.Where("files.tree_path LIKE ? AND files.id <> ?", root.TreePath+"%", root.ID)
+	}
+}
+
+// GetAncestors 获取文件的所有祖先目录，按由根到父级排序
+func GetAncestors(db *gorm.DB, f *File) ([]File, error) {
+	ids := f.AncestorIDs()
+	if len(ids) == 0 {
+		return []File{}, nil
+	}
+
+	var rows []File
+	if err := db.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]File, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row
+	}
+
+	ancestors := make([]File, 0, len(ids))
+	for _, id := range ids {
+		if row, ok := byID[id]; ok {
+			ancestors = append(ancestors, row)
+		}
+	}
+	return ancestors, nil
+}
+
+// GetDescendants 获取文件夹的所有后代，按层级由浅到深排序
+func GetDescendants(db *gorm.DB, root *File) ([]File, error) {
+	var files []File
+	err := db.Scopes(DescendantScope(root)).
+		Order("LENGTH(files.tree_path) ASC, files.id ASC").
+		Find(&files).Error
+	return files, err
+}
+
+// GetBreadcrumbs 获取面包屑 (由根到自身)
+func GetBreadcrumbs(db *gorm.DB, f *File) ([]File, error) {
+	ancestors, err := GetAncestors(db, f)
+	if err != nil {
+		return nil, err
+	}
+	return append(ancestors, *f), nil
+}
+
+// MoveSubtree 将以 root 为根的子树挂到新的父级路径下，批量改写物化路径
+func MoveSubtree(tx *gorm.DB, root *File, newParentPath string) error {
+	oldPath := root.TreePath
+	newPath := BuildTreePath(newParentPath, root.ID)
+	if oldPath == newPath {
+		return nil
+	}
+	err := tx.Unscoped().Model(&File{}).
+		Where("tree_path LIKE ?", oldPath+"%").
+		UpdateColumn("tree_path", gorm.Expr(concatExpr(tx, "?", "SUBSTR(tree_path, ?)"), newPath, len(oldPath)+1)).Error
+	if err != nil {
+		return err
+	}
+	root.TreePath = newPath
+	return nil
+}
+
+// treeRebuildBatch 补全物化路径时每批处理的记录数
+const treeRebuildBatch = 500
+
+// RebuildTreePaths 为缺失物化路径的历史数据逐层补全
+func RebuildTreePaths(db *gorm.DB) error {
+	db = db.Unscoped().Session(&gorm.Session{})
+	if err := db.Model(&File{}).
+		Where("parent_id = 0 AND (tree_path IS NULL OR tree_path = '')").
+		UpdateColumn("tree_path", gorm.Expr(concatExpr(db, "'/'", "id", "'/'"))).Error; err != nil {
+		return err
+	}
+	if err := propagateTreePaths(db); err != nil {
+		return err
+	}
+
+	// 父级已不存在的孤儿记录挂到根目录下，其后代随后沿原有层级补全
+	var orphanIDs []uint
+	if err := db.Table("files AS c").Joins("LEFT JOIN files p ON p.id = c.parent_id").
+		Where("(c.tree_path IS NULL OR c.tree_path = '') AND p.id IS NULL").
+		Pluck("c.id", &orphanIDs).Error; err != nil {
+		return err
+	}
+	if err := moveToRoot(db, orphanIDs...); err != nil {
+		return err
+	}
+	if err := propagateTreePaths(db); err != nil {
+		return err
+	}
+
+	// 仍缺失路径的记录只可能处于循环引用中，逐个断开循环后继续补全
+	for {
+		var f File
+		err := db.Select("id", "parent_id").Where("tree_path IS NULL OR tree_path = ''").First(&f).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		seen := map[uint]bool{}
+		for !seen[f.ID] {
+			seen[f.ID] = true
+			var parent File
+			if err := db.Select("id", "parent_id").Where("id = ?", f.ParentID).Take(&parent).Error; err != nil {
+				return err
+			}
+			f = parent
+		}
+		if err := moveToRoot(db, f.ID); err != nil {
+			return err
+		}
+		if err := propagateTreePaths(db); err != nil {
+			return err
+		}
+	}
+}
+
+// propagateTreePaths 由已有路径的父级向下逐批补全子级路径
+func propagateTreePaths(db *gorm.DB) error {
+	for {
+		var rows []struct {
+			ID         uint
+			ParentPath string
+		}
+		if err := db.Table("files AS c").Select("c.id, p.tree_path AS parent_path").
+			Joins("JOIN files p ON p.id = c.parent_id").
+			Where("(c.tree_path IS NULL OR c.tree_path = '') AND p.tree_path <> ''").
+			Limit(treeRebuildBatch).Scan(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				if err := tx.Model(&File{}).Where("id = ?", row.ID).
+					UpdateColumn("tree_path", BuildTreePath(row.ParentPath, row.ID)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// moveToRoot 将记录挂到根目录下
+func moveToRoot(db *gorm.DB, ids ...uint) error {
+	for start := 0; start < len(ids); start += treeRebuildBatch {
+		end := start + treeRebuildBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := db.Model(&File{}).Where("id IN ?", ids[start:end]).Updates(map[string]interface{}{
+			"parent_id": 0,
+			"tree_path": gorm.Expr(concatExpr(db, "'/'", "id", "'/'")),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTreePath(t *testing.T) {
+	t.Run("Build and Parse", func(t *testing.T) {
+		root := BuildTreePath("", 1)
+		assert.Equal(t, "/1/", root)
+
+		child := BuildTreePath(root, 25)
+		assert.Equal(t, "/1/25/", child)
+		assert.Equal(t, []uint{1, 25}, ParseTreePath(child))
+
+		// 非法路径解析为空
+		assert.Nil(t, ParseTreePath("/1/abc/"))
+		assert.Nil(t, ParseTreePath(""))
+	})
+
+	t.Run("IsInTree", func(t *testing.T) {
+		assert.True(t, IsInTree("/1/5/12/", "/1/5/"))
+		assert.True(t, IsInTree("/1/5/", "/1/5/"))
+		assert.False(t, IsInTree("/1/5/", "/1/5/12/"))
+
+		// ID 前缀相同但并非祖先
+		assert.False(t, IsInTree("/1/55/", "/1/5/"))
+
+		// 缺失路径一律视为不在子树内
+		assert.False(t, IsInTree("", "/1/"))
+		assert.False(t, IsInTree("/1/", ""))
+	})
+
+	t.Run("Ancestors and Depth", func(t *testing.T) {
+		f := File{TreePath: "/3/7/9/"}
+		assert.Equal(t, []uint{3, 7}, f.AncestorIDs())
+		assert.Equal(t, 3, f.Depth())
+
+		top := File{TreePath: "/3/"}
+		assert.Empty(t, top.AncestorIDs())
+		assert.Equal(t, 1, top.Depth())
+	})
+}
+
+// openTreeDB 每个测试独立的内存数据库，只包含文件表
+func openTreeDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&File{}))
+	return db
+}
+
+func TestTreeScopes(t *testing.T) {
+	db := openTreeDB(t)
+
+	root := File{Name: "root", IsFolder: true, UserID: 1}
+	require.NoError(t, db.Create(&root).Error)
+	child := File{Name: "child", IsFolder: true, UserID: 1, ParentID: root.ID}
+	require.NoError(t, db.Create(&child).Error)
+	leaf := File{Name: "leaf.txt", UserID: 1, ParentID: child.ID}
+	require.NoError(t, db.Create(&leaf).Error)
+	other := File{Name: "other.txt", UserID: 1}
+	require.NoError(t, db.Create(&other).Error)
+
+	count := func(scope func(*gorm.DB) *gorm.DB) int64 {
+		var n int64
+		require.NoError(t, db.Model(&File{}).Scopes(scope).Count(&n).Error)
+		return n
+	}
+
+	t.Run("Subtree and Descendants", func(t *testing.T) {
+		require.NoError(t, db.First(&root, root.ID).Error)
+		assert.EqualValues(t, 3, count(SubtreeScope(&root)))
+		assert.EqualValues(t, 2, count(DescendantScope(&root)))
+
+		descendants, err := GetDescendants(db, &root)
+		require.NoError(t, err)
+		require.Len(t, descendants, 2)
+		assert.Equal(t, child.ID, descendants[0].ID)
+		assert.Equal(t, leaf.ID, descendants[1].ID)
+	})
+
+	t.Run("Missing TreePath Matches Nothing", func(t *testing.T) {
+		// 路径未补全的记录不能让前缀匹配退化为全部文件
+		broken := root
+		broken.TreePath = ""
+		assert.Zero(t, count(SubtreeScope(&broken)))
+		assert.Zero(t, count(DescendantScope(&broken)))
+
+		descendants, err := GetDescendants(db, &broken)
+		require.NoError(t, err)
+		assert.Empty(t, descendants)
+	})
+
+	t.Run("Move Subtree", func(t *testing.T) {
+		require.NoError(t, db.First(&child, child.ID).Error)
+		require.NoError(t, MoveSubtree(db, &child, other.TreePath))
+		assert.Equal(t, BuildTreePath(other.TreePath, child.ID), child.TreePath)
+
+		var moved File
+		require.NoError(t, db.First(&moved, leaf.ID).Error)
+		assert.Equal(t, BuildTreePath(child.TreePath, leaf.ID), moved.TreePath)
+		require.NoError(t, db.First(&root, root.ID).Error)
+		assert.EqualValues(t, 1, count(SubtreeScope(&root)))
+	})
+}
+
+func TestRebuildTreePaths(t *testing.T) {
+	db := openTreeDB(t)
+
+	// 历史数据: 99 号父级已被物理删除，20 与 21 互为父级
+	rows := []File{
+		{ParentID: 0, Name: "docs", IsFolder: true},
+		{ParentID: 1, Name: "a.txt"},
+		{ParentID: 99, Name: "orphan", IsFolder: true},
+		{ParentID: 3, Name: "sub", IsFolder: true},
+		{ParentID: 4, Name: "b.txt"},
+		{ParentID: 4, Name: "trashed.txt"},
+		{ParentID: 8, Name: "loop-a", IsFolder: true},
+		{ParentID: 7, Name: "loop-b", IsFolder: true},
+		{ParentID: 8, Name: "c.txt"},
+	}
+	for i := range rows {
+		rows[i].ID = uint(i + 1)
+	}
+	require.NoError(t, db.Session(&gorm.Session{SkipHooks: true}).Create(&rows).Error)
+	require.NoError(t, db.Delete(&File{}, 6).Error)
+
+	require.NoError(t, RebuildTreePaths(db))
+
+	paths := map[uint]string{}
+	parents := map[uint]uint{}
+	var files []File
+	require.NoError(t, db.Unscoped().Find(&files).Error)
+	for _, f := range files {
+		paths[f.ID] = f.TreePath
+		parents[f.ID] = f.ParentID
+	}
+
+	assert.Equal(t, "/1/", paths[1])
+	assert.Equal(t, "/1/2/", paths[2])
+
+	t.Run("Orphan Keeps Its Subtree", func(t *testing.T) {
+		assert.EqualValues(t, 0, parents[3])
+		assert.Equal(t, "/3/", paths[3])
+		assert.EqualValues(t, 3, parents[4])
+		assert.Equal(t, "/3/4/", paths[4])
+		assert.Equal(t, "/3/4/5/", paths[5])
+		assert.Equal(t, "/3/4/6/", paths[6])
+	})
+
+	t.Run("Cycle Is Broken Once", func(t *testing.T) {
+		assert.Equal(t, "/7/", paths[7])
+		assert.EqualValues(t, 0, parents[7])
+		assert.Equal(t, "/7/8/", paths[8])
+		assert.Equal(t, "/7/8/9/", paths[9])
+	})
+}
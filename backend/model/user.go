@@ -21,6 +21,23 @@ type User struct {
 	LastSignInAt *time.Time `gorm:"comment:最后签到时间"`
 }
 
+// UserGroup 用户组，由管理员维护，可作为站内共享的对象
+type UserGroup struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"type:varchar(50);uniqueIndex;not null;comment:组名"`
+	Description string `gorm:"type:varchar(255);comment:描述"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// UserGroupMember 用户组成员
+type UserGroupMember struct {
+	ID        uint `gorm:"primaryKey"`
+	GroupID   uint `gorm:"uniqueIndex:idx_group_member;comment:用户组ID"`
+	UserID    uint `gorm:"uniqueIndex:idx_group_member;index;comment:用户ID"`
+	CreatedAt time.Time
+}
+
 // UserTransaction 账户流水
 type UserTransaction struct {
 	ID        uint   `gorm:"primaryKey"`
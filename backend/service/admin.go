@@ -0,0 +1,122 @@
+package service
+
+import (
+	"github.com/stfreya/stfreyanetdisk/model"
+)
+
+// ShareListItem 管理员分享列表项
+type ShareListItem struct {
+	model.Share
+	FileName    string `json:"fileName"`
+	Username    string `json:"username"`
+	HasPassword bool   `json:"hasPassword"`
+}
+
+// InvitationListItem 管理员邀请码列表项
+type InvitationListItem struct {
+	model.InvitationCode
+	CreatorName string `json:"creatorName"`
+	UsedByName  string `json:"usedByName"`
+}
+
+// ListUsers 管理员获取用户列表
+func ListUsers(q ListQuery) ([]model.User, Page, error) {
+	db := model.DB.Model(&model.User{})
+	if q.Keyword != "" {
+		like := "%" + q.Keyword + "%"
+		db = db.Where("users.username LIKE ? OR users.email LIKE ?", like, like)
+	}
+	if q.Role != "" {
+		db = db.Where("users.role = ?", q.Role)
+	}
+	if q.Status != nil {
+		db = db.Where("users.status = ?", *q.Status)
+	}
+	if q.From != nil {
+		db = db.Where("users.created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("users.created_at <= ?", *q.To)
+	}
+
+	desc := q.descOr(false)
+	var fields []sortField[model.User]
+	switch q.SortBy {
+	case "username":
+		fields = append(fields, sortField[model.User]{Column: "users.username", Desc: desc, Value: func(u *model.User) interface{} { return u.Username }})
+	case "usedSize":
+		fields = append(fields, sortField[model.User]{Column: "users.used_size", Desc: desc, Value: func(u *model.User) interface{} { return u.UsedSize }})
+	case "coin":
+		fields = append(fields, sortField[model.User]{Column: "users.coin", Desc: desc, Value: func(u *model.User) interface{} { return u.Coin }})
+	case "time", "createdAt":
+		fields = append(fields, sortField[model.User]{Column: "users.created_at", Desc: desc, Value: func(u *model.User) interface{} { return cursorTime(u.CreatedAt) }})
+	}
+	fields = append(fields, sortField[model.User]{Column: "users.id", Desc: desc, Value: func(u *model.User) interface{} { return u.ID }})
+
+	return paginate(db, q, fields)
+}
+
+// ListAllShares 管理员获取所有分享列表
+func ListAllShares(q ListQuery) ([]ShareListItem, Page, error) {
+	db := model.DB.Table("shares").
+		Select("shares.*, files.name as file_name, users.username, shares.password <> '' as has_password").
+		Joins("left join files on files.id = shares.file_id").
+		Joins("left join users on users.id = shares.user_id").
+		Where("shares.deleted_at IS NULL")
+	if q.Keyword != "" {
+		like := "%" + q.Keyword + "%"
+		db = db.Where("files.name LIKE ? OR users.username LIKE ?", like, like)
+	}
+	if q.UserID != 0 {
+		db = db.Where("shares.user_id = ?", q.UserID)
+	}
+	if q.From != nil {
+		db = db.Where("shares.created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("shares.created_at <= ?", *q.To)
+	}
+
+	desc := q.descOr(true)
+	var fields []sortField[ShareListItem]
+	switch q.SortBy {
+	case "views":
+		fields = append(fields, sortField[ShareListItem]{Column: "shares.views", Desc: desc, Value: func(s *ShareListItem) interface{} { return s.Views }})
+	case "downloads":
+		fields = append(fields, sortField[ShareListItem]{Column: "shares.downloads", Desc: desc, Value: func(s *ShareListItem) interface{} { return s.Downloads }})
+	default:
+		fields = append(fields, sortField[ShareListItem]{Column: "shares.created_at", Desc: desc, Value: func(s *ShareListItem) interface{} { return cursorTime(s.CreatedAt) }})
+	}
+	fields = append(fields, sortField[ShareListItem]{Column: "shares.id", Desc: desc, Value: func(s *ShareListItem) interface{} { return s.ID }})
+
+	return paginate(db, q, fields)
+}
+
+// ListAllInvitationCodes 管理员获取所有邀请码
+func ListAllInvitationCodes(q ListQuery) ([]InvitationListItem, Page, error) {
+	db := model.DB.Table("invitation_codes").
+		Select("invitation_codes.*, creators.username as creator_name, users.username as used_by_name").
+		Joins("left join users as creators on creators.id = invitation_codes.creator_id").
+		Joins("left join users on users.id = invitation_codes.used_by_id").
+		Where("invitation_codes.deleted_at IS NULL")
+	if q.Keyword != "" {
+		db = db.Where("invitation_codes.code LIKE ?", "%"+q.Keyword+"%")
+	}
+	if q.Status != nil {
+		db = db.Where("invitation_codes.status = ?", *q.Status)
+	}
+	if q.From != nil {
+		db = db.Where("invitation_codes.created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("invitation_codes.created_at <= ?", *q.To)
+	}
+
+	desc := q.descOr(true)
+	fields := []sortField[InvitationListItem]{
+		{Column: "invitation_codes.created_at", Desc: desc, Value: func(i *InvitationListItem) interface{} { return cursorTime(i.CreatedAt) }},
+		{Column: "invitation_codes.id", Desc: desc, Value: func(i *InvitationListItem) interface{} { return i.ID }},
+	}
+
+	return paginate(db, q, fields)
+}
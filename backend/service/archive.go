@@ -0,0 +1,312 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+)
+
+const (
+	defaultArchiveMaxMB = 2048
+	taskExtract         = "extract"
+)
+
+// ErrMemberNotFound 压缩包中不存在指定成员
+var ErrMemberNotFound = errors.New("压缩包中不存在该文件")
+
+func init() {
+	registerTaskHandler(taskExtract, "解压", runExtractTask)
+}
+
+// ExtractPayload 解压任务参数
+type ExtractPayload struct {
+	FileID   uint   `json:"fileId"`
+	ParentID uint   `json:"parentId"`
+	Conflict string `json:"conflict"`
+}
+
+// ExtractResult 解压任务结果
+type ExtractResult struct {
+	Files   int      `json:"files"`   // 解压出的文件数
+	Folders int      `json:"folders"` // 新建的文件夹数
+	Skipped []string `json:"skipped"` // 因同名跳过的成员
+	Unsafe  []string `json:"unsafe"`  // 路径不安全而拒绝的成员
+}
+
+// archiveMaxFileSize 在线浏览与解压的压缩包大小上限
+func archiveMaxFileSize() int64 {
+	mb, err := strconv.ParseInt(model.GetConfig("archive_max_file_size", strconv.Itoa(defaultArchiveMaxMB)), 10, 64)
+	if err != nil || mb <= 0 {
+		mb = defaultArchiveMaxMB
+	}
+	return mb * 1024 * 1024
+}
+
+// openArchive 打开用户有权查看的压缩包，返回格式与可随机读取的数据源
+func openArchive(userID uint, fileID uint) (*model.File, string, seekableFile, func(), error) {
+	access, err := AuthorizeFile(userID, fileID, model.PermissionRead)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	file := *access.File
+	if file.IsFolder {
+		return nil, "", nil, nil, ErrFileNotFound
+	}
+	format := utils.ArchiveFormat(file.Name, file.MimeType)
+	if format == "" {
+		return nil, "", nil, nil, utils.ErrNotArchive
+	}
+	if file.Size > archiveMaxFileSize() {
+		return nil, "", nil, nil, errors.New("压缩包过大，不支持在线处理")
+	}
+	src, cleanup, err := openSeekable(&file, archiveMaxFileSize())
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	return &file, format, src, cleanup, nil
+}
+
+// ListArchive 列出压缩包中 dir 目录下的成员 (dir 为空时为根目录)
+func ListArchive(userID uint, fileID uint, dir string) ([]utils.ArchiveEntry, error) {
+	file, format, src, cleanup, err := openArchive(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var entries []utils.ArchiveEntry
+	err = utils.WalkArchive(format, src, file.Size, func(entry utils.ArchiveEntry, _ func() (io.ReadCloser, error)) error {
+		entries = append(entries, entry)
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return utils.ArchiveChildren(entries, dir), nil
+}
+
+// OpenArchiveMember 以流的方式读取压缩包中的单个文件，调用方负责关闭
+func OpenArchiveMember(userID uint, fileID uint, member string) (*utils.ArchiveEntry, io.ReadCloser, error) {
+	member, err := utils.SafeArchivePath(member)
+	if err != nil {
+		return nil, nil, ErrMemberNotFound
+	}
+	file, format, src, cleanup, err := openArchive(userID, fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 在独立协程中遍历，找到成员后通过管道输出，TAR 只需顺序读取一遍
+	pr, pw := io.Pipe()
+	found := make(chan *utils.ArchiveEntry, 1)
+	go func() {
+		defer cleanup()
+		matched := false
+		err := utils.WalkArchive(format, src, file.Size, func(entry utils.ArchiveEntry, open func() (io.ReadCloser, error)) error {
+			if entry.IsDir || entry.Path != member {
+				return nil
+			}
+			rc, err := open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			matched = true
+			found <- &entry
+			if _, err := io.Copy(pw, io.LimitReader(rc, entry.Size)); err != nil {
+				return err
+			}
+			return utils.ErrStopWalk
+		}, nil)
+		if !matched {
+			if err == nil {
+				err = ErrMemberNotFound
+			}
+			close(found)
+		}
+		pw.CloseWithError(err)
+	}()
+
+	entry, ok := <-found
+	if !ok {
+		_, err := pr.Read(make([]byte, 1))
+		return nil, nil, err
+	}
+	return entry, pr, nil
+}
+
+// ExtractArchive 提交解压任务，将压缩包解压到 parentID 目录
+// 压缩包与目标目录都可以位于共享给自己的文件夹中，解压出的文件归属并占用目标目录所有者的空间
+func ExtractArchive(userID uint, fileID uint, parentID uint, conflict string) (*TaskInfo, error) {
+	policy, err := parseConflictPolicy(conflict)
+	if err != nil {
+		return nil, err
+	}
+	access, err := AuthorizeFile(userID, fileID, model.PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	file := access.File
+	if file.IsFolder {
+		return nil, ErrFileNotFound
+	}
+	if utils.ArchiveFormat(file.Name, file.MimeType) == "" {
+		return nil, utils.ErrNotArchive
+	}
+	if file.Size > archiveMaxFileSize() {
+		return nil, errors.New("压缩包过大，不支持在线处理")
+	}
+	if _, err := writableFolderOwner(userID, parentID); err != nil {
+		return nil, err
+	}
+	return submitTask(userID, taskExtract, ExtractPayload{FileID: fileID, ParentID: parentID, Conflict: policy})
+}
+
+// runExtractTask 执行解压：先统计总大小校验容量，再逐个写入，进度以字节计
+func runExtractTask(tc *TaskContext) (interface{}, error) {
+	var p ExtractPayload
+	if err := tc.Bind(&p); err != nil {
+		return nil, err
+	}
+	userID := tc.Task.UserID
+	// 授权可能在任务排队期间被撤销，执行前重新校验
+	ownerID, err := writableFolderOwner(userID, p.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	file, format, src, cleanup, err := openArchive(userID, p.FileID)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	result := &ExtractResult{Skipped: []string{}, Unsafe: []string{}}
+	var total int64
+	err = utils.WalkArchive(format, src, file.Size, func(entry utils.ArchiveEntry, _ func() (io.ReadCloser, error)) error {
+		total += entry.Size
+		return tc.Err()
+	}, func(name string) {
+		result.Unsafe = append(result.Unsafe, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuota(ownerID, total); err != nil {
+		return nil, err
+	}
+	tc.SetTotal(total)
+
+	x := &extractor{tc: tc, userID: ownerID, conflict: p.Conflict, result: result,
+		folders: map[string]uint{"": p.ParentID}, skipped: map[string]bool{}}
+	err = utils.WalkArchive(format, src, file.Size, x.visit, nil)
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// extractor 解压过程中的目录映射与冲突处理状态
+type extractor struct {
+	tc       *TaskContext
+	userID   uint // 目标目录的所有者
+	conflict string
+	result   *ExtractResult
+	folders  map[string]uint // 压缩包内目录路径 -> 网盘目录 ID
+	skipped  map[string]bool // 因冲突跳过的目录，其下成员一并跳过
+}
+
+func (x *extractor) visit(entry utils.ArchiveEntry, open func() (io.ReadCloser, error)) error {
+	if err := x.tc.Err(); err != nil {
+		return err
+	}
+	if entry.IsDir {
+		_, err := x.folder(entry.Path)
+		return err
+	}
+
+	dir := path.Dir(entry.Path)
+	if dir == "." {
+		dir = ""
+	}
+	parentID, err := x.folder(dir)
+	if err != nil {
+		return err
+	}
+	if x.skipped[dir] {
+		x.result.Skipped = append(x.result.Skipped, entry.Path)
+		x.tc.Advance(entry.Size)
+		return nil
+	}
+
+	name, _, skip, err := resolveNameConflict(x.userID, parentID, entry.Name, false, x.conflict)
+	if err != nil {
+		return err
+	}
+	if skip {
+		x.result.Skipped = append(x.result.Skipped, entry.Path)
+		x.tc.Advance(entry.Size)
+		return nil
+	}
+
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if _, err := storeFile(x.userID, parentID, name, entry.Size, x.tc.Reader(rc)); err != nil {
+		return fmt.Errorf("%s: %w", entry.Path, err)
+	}
+	x.result.Files++
+	return nil
+}
+
+// folder 确保压缩包内的目录在网盘中存在，返回其 ID；父目录被跳过时子目录同样标记为跳过
+func (x *extractor) folder(dir string) (uint, error) {
+	if id, ok := x.folders[dir]; ok {
+		return id, nil
+	}
+	parent := path.Dir(dir)
+	if parent == "." {
+		parent = ""
+	}
+	parentID, err := x.folder(parent)
+	if err != nil {
+		return 0, err
+	}
+	if x.skipped[parent] {
+		x.skipped[dir] = true
+		x.folders[dir] = 0
+		return 0, nil
+	}
+
+	name, existing, skip, err := resolveNameConflict(x.userID, parentID, path.Base(dir), true, x.conflict)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case skip:
+		x.skipped[dir] = true
+		x.result.Skipped = append(x.result.Skipped, dir+"/")
+		x.folders[dir] = 0
+		return 0, nil
+	case existing != nil:
+		x.folders[dir] = existing.ID
+		return existing.ID, nil
+	}
+
+	created := model.File{Name: name, IsFolder: true, ParentID: parentID, UserID: x.userID}
+	if err := validateFileName(name); err != nil {
+		return 0, err
+	}
+	if err := model.DB.Create(&created).Error; err != nil {
+		return 0, err
+	}
+	x.result.Folders++
+	x.folders[dir] = created.ID
+	return created.ID, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+	"log"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+)
+
+// CategoryStat 文件类别统计
+type CategoryStat struct {
+	Category string `json:"category"`
+	Count    int64  `json:"count"`
+	Size     int64  `json:"size"`
+}
+
+// categoryOrder 类别展示顺序
+var categoryOrder = []string{
+	utils.CategoryImage,
+	utils.CategoryVideo,
+	utils.CategoryAudio,
+	utils.CategoryDocument,
+	utils.CategoryArchive,
+	utils.CategoryOther,
+}
+
+// ListCategory 跨目录列出指定类别的文件
+func ListCategory(userID uint, category string, q ListQuery) ([]model.File, Page, error) {
+	if !utils.IsValidCategory(category) {
+		return nil, Page{}, errors.New("不支持的文件类别")
+	}
+	q.Category = category
+	db := model.DB.Model(&model.File{}).Where("files.user_id = ?", userID)
+	return listFiles(db, q, "files.updated_at")
+}
+
+// GetCategoryStats 统计用户各类别的文件数量与大小
+func GetCategoryStats(userID uint) ([]CategoryStat, error) {
+	var rows []CategoryStat
+	err := model.DB.Model(&model.File{}).
+		Select("category, COUNT(*) AS count, COALESCE(SUM(size), 0) AS size").
+		Where("user_id = ? AND is_folder = ?", userID, false).
+		Group("category").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byCategory := make(map[string]CategoryStat, len(rows))
+	for _, row := range rows {
+		category := row.Category
+		if !utils.IsValidCategory(category) {
+			category = utils.CategoryOther
+		}
+		stat := byCategory[category]
+		stat.Count += row.Count
+		stat.Size += row.Size
+		byCategory[category] = stat
+	}
+
+	stats := make([]CategoryStat, 0, len(categoryOrder))
+	for _, category := range categoryOrder {
+		stat := byCategory[category]
+		stat.Category = category
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// BackfillFileTypes 为历史文件按扩展名补全 MIME 类型与类别
+func BackfillFileTypes() {
+	var exts []string
+	if err := model.DB.Unscoped().Model(&model.File{}).
+		Where("is_folder = ? AND (category IS NULL OR category = '')", false).
+		Distinct().Pluck("ext", &exts).Error; err != nil {
+		log.Printf("补全文件类型失败: %v", err)
+		return
+	}
+
+	for _, ext := range exts {
+		mimeType := utils.MimeTypeOfExt(ext)
+		if err := model.DB.Unscoped().Model(&model.File{}).
+			Where("is_folder = ? AND (category IS NULL OR category = '') AND ext = ?", false, ext).
+			Updates(map[string]interface{}{
+				"mime_type": mimeType,
+				"category":  utils.CategoryOf(mimeType, ext),
+			}).Error; err != nil {
+			log.Printf("补全文件类型失败 [%s]: %v", ext, err)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+)
+
+const (
+	collabCheckpointInterval = 30 * time.Second
+	collabMaxClients         = 20
+	collabHistoryLimit       = 1000 // 保留的历史操作数，落后更多的客户端需要重新加入
+	collabSendBuffer         = 256
+)
+
+// 协同编辑消息类型
+const (
+	collabMsgInit   = "init"   // 服务端 -> 新加入的客户端：文档内容、修订号与在线成员
+	collabMsgOp     = "op"     // 双向：编辑操作
+	collabMsgAck    = "ack"    // 服务端 -> 发送者：操作已应用
+	collabMsgCursor = "cursor" // 双向：光标与选区
+	collabMsgJoin   = "join"   // 服务端广播：成员加入
+	collabMsgLeave  = "leave"  // 服务端广播：成员离开
+	collabMsgSave   = "save"   // 客户端 -> 服务端：立即保存
+	collabMsgSaved  = "saved"  // 服务端广播：已保存为新版本
+	collabMsgError  = "error"  // 服务端 -> 客户端：错误，resync 为 true 时客户端应重新加入
+)
+
+var collabColors = []string{"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4", "#f032e6", "#9a6324"}
+
+// ErrCollabFull 会话人数已满
+var ErrCollabFull = errors.New("协同编辑人数已满")
+
+// CollabCursor 光标位置与选区结束位置 (按 Unicode 码点计)
+type CollabCursor struct {
+	Position     int `json:"position"`
+	SelectionEnd int `json:"selectionEnd"`
+}
+
+// CollabPeer 会话中的协作者
+type CollabPeer struct {
+	ClientID string        `json:"clientId"`
+	UserID   uint          `json:"userId"`
+	Username string        `json:"username"`
+	Avatar   string        `json:"avatar"`
+	Color    string        `json:"color"`
+	Cursor   *CollabCursor `json:"cursor"`
+}
+
+// collabMessage 协同编辑消息，各类型只使用其中部分字段
+type collabMessage struct {
+	Type      string               `json:"type"`
+	Revision  int                  `json:"revision"`
+	ClientID  string               `json:"clientId,omitempty"`
+	Operation *utils.TextOperation `json:"operation,omitempty"`
+	Cursor    *CollabCursor        `json:"cursor,omitempty"`
+	Content   *string              `json:"content,omitempty"`
+	Encoding  *utils.TextEncoding  `json:"encoding,omitempty"`
+	Version   string               `json:"version,omitempty"`
+	Peer      *CollabPeer          `json:"peer,omitempty"`
+	Peers     []CollabPeer         `json:"peers,omitempty"`
+	Error     string               `json:"error,omitempty"`
+	Resync    bool                 `json:"resync,omitempty"`
+}
+
+// collabSession 单个文件的协同编辑会话
+// 服务端保存权威文档，客户端的操作基于某个修订号提交，服务端将其与之后的历史操作做变换后应用并广播
+type collabSession struct {
+	fileID  uint
+	ownerID uint
+
+	mu       sync.Mutex
+	doc      []rune
+	encoding utils.TextEncoding
+	version  string // 最近一次保存的文件版本
+	revision int
+	history  []*utils.TextOperation // 最近的操作，最后一个对应 revision
+	clients  map[string]*CollabClient
+	joined   int
+	dirty    bool
+	closed   bool
+	stop     chan struct{}
+
+	saving sync.Mutex
+}
+
+// CollabClient 会话中的一个连接，由传输层 (WebSocket) 负责收发消息
+type CollabClient struct {
+	peer    CollabPeer
+	session *collabSession
+	send    chan []byte
+	closed  bool
+}
+
+var (
+	collabMu       sync.Mutex
+	collabSessions = make(map[uint]*collabSession)
+	collabSeq      atomic.Uint64
+)
+
+// JoinCollab 加入文件的协同编辑会话，会话不存在时以当前文件内容创建
+// 所有者与被授予写权限的用户可以加入，检查点以所有者身份保存
+func JoinCollab(userID uint, fileID uint) (*CollabClient, error) {
+	var user model.User
+	if err := model.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	access, err := AuthorizeFile(userID, fileID, model.PermissionWrite)
+	if err != nil {
+		return nil, err
+	}
+	file := access.File
+	if file.IsFolder {
+		return nil, ErrFileNotFound
+	}
+
+	collabMu.Lock()
+	defer collabMu.Unlock()
+	s, ok := collabSessions[fileID]
+	if !ok {
+		content, err := GetFileContent(file.UserID, file.ID)
+		if err != nil {
+			return nil, err
+		}
+		s = &collabSession{
+			fileID:   file.ID,
+			ownerID:  file.UserID,
+			doc:      []rune(content.Content),
+			encoding: content.TextEncoding,
+			version:  content.Version,
+			clients:  make(map[string]*CollabClient),
+			stop:     make(chan struct{}),
+		}
+		collabSessions[fileID] = s
+		go s.run()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) >= collabMaxClients {
+		return nil, ErrCollabFull
+	}
+	c := &CollabClient{
+		peer: CollabPeer{
+			ClientID: fmt.Sprintf("%d-%d", userID, collabSeq.Add(1)),
+			UserID:   user.ID,
+			Username: user.Username,
+			Avatar:   user.Avatar,
+			Color:    collabColors[s.joined%len(collabColors)],
+		},
+		session: s,
+		send:    make(chan []byte, collabSendBuffer),
+	}
+	s.joined++
+
+	content := string(s.doc)
+	encoding := s.encoding
+	init := collabMessage{Type: collabMsgInit, Revision: s.revision, ClientID: c.peer.ClientID,
+		Content: &content, Encoding: &encoding, Version: s.version, Peers: []CollabPeer{}}
+	for _, other := range s.clients {
+		init.Peers = append(init.Peers, other.peer)
+	}
+	s.broadcastLocked(collabMessage{Type: collabMsgJoin, Peer: &c.peer}, "")
+	s.clients[c.peer.ClientID] = c
+	c.sendLocked(init)
+	return c, nil
+}
+
+// Send 待发送给客户端的消息，通道关闭表示连接应当断开
+func (c *CollabClient) Send() <-chan []byte {
+	return c.send
+}
+
+// ClientID 连接的标识
+func (c *CollabClient) ClientID() string {
+	return c.peer.ClientID
+}
+
+// Handle 处理客户端发来的消息
+func (c *CollabClient) Handle(data []byte) {
+	var msg collabMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.session.reply(c, collabMessage{Type: collabMsgError, Error: "消息格式错误"})
+		return
+	}
+	switch msg.Type {
+	case collabMsgOp:
+		if msg.Operation == nil {
+			c.session.reply(c, collabMessage{Type: collabMsgError, Error: "缺少编辑操作"})
+			return
+		}
+		c.session.applyOperation(c, msg.Revision, msg.Operation)
+	case collabMsgCursor:
+		c.session.updateCursor(c, msg.Cursor)
+	case collabMsgSave:
+		go c.session.checkpoint()
+	default:
+		c.session.reply(c, collabMessage{Type: collabMsgError, Error: "不支持的消息类型"})
+	}
+}
+
+// Leave 离开会话；最后一个成员离开时保存文档并关闭会话
+func (c *CollabClient) Leave() {
+	s := c.session
+	s.mu.Lock()
+	if _, ok := s.clients[c.peer.ClientID]; !ok {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.clients, c.peer.ClientID)
+	c.closeLocked()
+	s.broadcastLocked(collabMessage{Type: collabMsgLeave, ClientID: c.peer.ClientID}, "")
+	empty := len(s.clients) == 0
+	s.mu.Unlock()
+
+	if empty {
+		s.checkpoint()
+		s.closeIfIdle()
+	}
+}
+
+// sendLocked 非阻塞发送，客户端消费过慢时断开连接，由其重新加入后同步
+func (c *CollabClient) sendLocked(msg collabMessage) {
+	if c.closed {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		c.closeLocked()
+	}
+}
+
+func (c *CollabClient) closeLocked() {
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+func (s *collabSession) reply(c *CollabClient, msg collabMessage) {
+	s.mu.Lock()
+	c.sendLocked(msg)
+	s.mu.Unlock()
+}
+
+// broadcastLocked 向除 except 外的所有成员发送消息
+func (s *collabSession) broadcastLocked(msg collabMessage, except string) {
+	for id, c := range s.clients {
+		if id != except {
+			c.sendLocked(msg)
+		}
+	}
+}
+
+// applyOperation 将基于 revision 的操作与之后的历史操作做变换后应用
+func (s *collabSession) applyOperation(c *CollabClient, revision int, op *utils.TextOperation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldest := s.revision - len(s.history)
+	if revision < oldest || revision > s.revision {
+		c.sendLocked(collabMessage{Type: collabMsgError, Error: "文档版本已过期，请重新加入", Resync: true})
+		return
+	}
+	for _, concurrent := range s.history[revision-oldest:] {
+		transformed, _, err := utils.TransformOperations(op, concurrent)
+		if err != nil {
+			c.sendLocked(collabMessage{Type: collabMsgError, Error: err.Error(), Resync: true})
+			return
+		}
+		op = transformed
+	}
+
+	doc, err := op.Apply(s.doc)
+	if err != nil {
+		c.sendLocked(collabMessage{Type: collabMsgError, Error: err.Error(), Resync: true})
+		return
+	}
+	if err := s.validateLocked(doc, op); err != nil {
+		// 操作被拒绝，客户端需要回滚本地修改
+		c.sendLocked(collabMessage{Type: collabMsgError, Error: err.Error(), Resync: true})
+		return
+	}
+
+	s.doc = doc
+	s.revision++
+	s.history = append(s.history, op)
+	if len(s.history) > collabHistoryLimit {
+		s.history = s.history[len(s.history)-collabHistoryLimit:]
+	}
+	s.dirty = true
+	for _, other := range s.clients {
+		if cur := other.peer.Cursor; cur != nil {
+			cur.Position = op.TransformIndex(cur.Position)
+			cur.SelectionEnd = op.TransformIndex(cur.SelectionEnd)
+		}
+	}
+
+	c.sendLocked(collabMessage{Type: collabMsgAck, Revision: s.revision})
+	s.broadcastLocked(collabMessage{Type: collabMsgOp, Revision: s.revision, ClientID: c.peer.ClientID, Operation: op}, c.peer.ClientID)
+}
+
+// validateLocked 校验操作后的文档：按原编码不超过在线编辑大小上限，插入的文字能以原编码保存
+func (s *collabSession) validateLocked(doc []rune, op *utils.TextOperation) error {
+	if s.encoding.Name != utils.EncodingUTF8 {
+		for _, text := range op.Inserts() {
+			if _, err := utils.EncodeText(text, utils.TextEncoding{Name: s.encoding.Name}); err != nil {
+				return err
+			}
+		}
+	}
+	// UTF-8 长度在上限以内时无需按原编码计算
+	text := string(doc)
+	if int64(len(text)) <= EditMaxFileSize() {
+		return nil
+	}
+	data, err := utils.EncodeText(text, s.encoding)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > EditMaxFileSize() {
+		return ErrContentTooLarge
+	}
+	return nil
+}
+
+// updateCursor 记录并广播成员的光标
+func (s *collabSession) updateCursor(c *CollabClient, cursor *CollabCursor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cursor != nil {
+		n := len(s.doc)
+		cursor.Position = min(max(cursor.Position, 0), n)
+		cursor.SelectionEnd = min(max(cursor.SelectionEnd, 0), n)
+	}
+	c.peer.Cursor = cursor
+	s.broadcastLocked(collabMessage{Type: collabMsgCursor, ClientID: c.peer.ClientID, Cursor: cursor}, c.peer.ClientID)
+}
+
+// run 定期保存检查点，会话关闭后退出
+func (s *collabSession) run() {
+	ticker := time.NewTicker(collabCheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.checkpoint()
+			s.closeIfIdle()
+		}
+	}
+}
+
+// checkpoint 通过在线编辑的保存流程将文档写回文件，旧内容成为历史版本 (FileVersion)
+// 会话外保存过的内容同样保留在历史版本中，文档以会话内容为准
+func (s *collabSession) checkpoint() {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+	content, encoding, base, revision := string(s.doc), s.encoding, s.version, s.revision
+	s.mu.Unlock()
+
+	saved, err := SaveFileContent(s.ownerID, s.fileID, content, encoding, base)
+	if errors.Is(err, ErrVersionConflict) && saved != nil {
+		saved, err = SaveFileContent(s.ownerID, s.fileID, content, encoding, saved.Version)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		log.Printf("[Collab] 文件 %d 保存失败: %v", s.fileID, err)
+		s.broadcastLocked(collabMessage{Type: collabMsgError, Error: "自动保存失败: " + err.Error()}, "")
+		return
+	}
+	s.version = saved.Version
+	if s.revision == revision {
+		s.dirty = false
+	}
+	s.broadcastLocked(collabMessage{Type: collabMsgSaved, Revision: revision, Version: saved.Version}, "")
+}
+
+// closeIfIdle 没有成员且已全部保存时关闭会话
+func (s *collabSession) closeIfIdle() {
+	collabMu.Lock()
+	defer collabMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.clients) > 0 || s.dirty {
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	if collabSessions[s.fileID] == s {
+		delete(collabSessions, s.fileID)
+	}
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stfreya/stfreyanetdisk/driver"
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	taskCompress = "compress"
+	// failureManifestName 打包时读取失败的成员清单
+	failureManifestName = "打包失败的文件.txt"
+)
+
+func init() {
+	registerTaskHandler(taskCompress, "压缩", runCompressTask)
+}
+
+// CompressPayload 压缩任务参数
+type CompressPayload struct {
+	IDs      []uint `json:"ids"`
+	ParentID uint   `json:"parentId"`
+	Name     string `json:"name"`
+	Format   string `json:"format"`
+	Conflict string `json:"conflict"`
+}
+
+// CompressResult 压缩任务结果
+type CompressResult struct {
+	FileID uint             `json:"fileId"`
+	Name   string           `json:"name"`
+	Size   int64            `json:"size"`
+	Files  int              `json:"files"`  // 成功打包的文件数
+	Failed []ArchiveFailure `json:"failed"` // 读取失败的成员
+}
+
+// ArchiveFailure 打包失败的成员
+type ArchiveFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// archiveItem 待打包的文件或文件夹，Path 为压缩包内以 "/" 分隔的路径
+type archiveItem struct {
+	File *model.File
+	Path string
+}
+
+// collectArchiveItems 展开所选文件与文件夹的整棵子树，父目录总是先于子项出现
+// scope 返回限定可访问范围的查询；顶层同名项自动重命名，不存在的文件记入 failed，total 为文件总大小
+func collectArchiveItems(scope func() *gorm.DB, fileIDs []uint) (items []archiveItem, failed []ArchiveFailure, total int64, err error) {
+	used := make(map[string]bool)
+	for _, id := range fileIDs {
+		var root model.File
+		if err := scope().Where("files.id = ?", id).First(&root).Error; err != nil {
+			failed = append(failed, ArchiveFailure{Path: fmt.Sprintf("#%d", id), Error: ErrFileNotFound.Error()})
+			continue
+		}
+		name := archiveEntryName(root.Name, used)
+		items = append(items, archiveItem{File: &root, Path: name})
+		total += root.Size
+		if !root.IsFolder {
+			continue
+		}
+
+		files, err := model.GetDescendants(scope(), &root)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if len(items)+len(files) > utils.MaxArchiveEntries {
+			return nil, nil, 0, errors.New("所选文件数量过多")
+		}
+		dirs := map[uint]string{root.ID: name}
+		for i := range files {
+			f := &files[i]
+			parent, ok := dirs[f.ParentID]
+			if !ok {
+				continue
+			}
+			p := path.Join(parent, f.Name)
+			if f.IsFolder {
+				dirs[f.ID] = p
+			} else {
+				total += f.Size
+			}
+			items = append(items, archiveItem{File: f, Path: p})
+		}
+	}
+	return items, failed, total, nil
+}
+
+// archiveEntryName 顶层成员重名时生成 "名称 (n).扩展名"
+func archiveEntryName(name string, used map[string]bool) string {
+	candidate := name
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base, ext = name, ""
+	}
+	for i := 1; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// sourceReader 记录源文件读取错误，以区分源文件损坏与压缩包写入失败
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// writeArchiveItems 将成员依次写入压缩包，读取失败的文件不中断打包，最后附加失败清单
+// wrap 用于包装源数据流 (进度统计与取消)，可为 nil；返回成功写入的文件数与失败的成员
+func writeArchiveItems(aw utils.ArchiveWriter, items []archiveItem, failed []ArchiveFailure, wrap func(io.Reader) io.Reader) (int, []ArchiveFailure, error) {
+	drivers := make(map[uint]driver.Driver)
+	written := 0
+	for _, item := range items {
+		f := item.File
+		if f.IsFolder {
+			if err := aw.AddDir(item.Path, f.UpdatedAt); err != nil {
+				return written, failed, err
+			}
+			continue
+		}
+
+		d, ok := drivers[f.PolicyID]
+		if !ok {
+			var err error
+			if d, err = getPolicyDriver(f.PolicyID); err != nil {
+				failed = append(failed, ArchiveFailure{Path: item.Path, Error: "存储策略不可用"})
+				continue
+			}
+			drivers[f.PolicyID] = d
+		}
+		rc, err := d.Get(f.Path)
+		if err != nil {
+			failed = append(failed, ArchiveFailure{Path: item.Path, Error: err.Error()})
+			continue
+		}
+		src := &sourceReader{r: rc}
+		var r io.Reader = src
+		if wrap != nil {
+			r = wrap(src)
+		}
+		err = aw.AddFile(item.Path, f.Size, f.UpdatedAt, r)
+		rc.Close()
+		switch {
+		case err == nil:
+			written++
+		case src.err != nil || errors.Is(err, io.ErrUnexpectedEOF):
+			failed = append(failed, ArchiveFailure{Path: item.Path, Error: "读取失败: " + err.Error()})
+		default:
+			return written, failed, err
+		}
+	}
+
+	if len(failed) > 0 {
+		var sb strings.Builder
+		sb.WriteString("以下文件未能打包:\r\n")
+		for _, f := range failed {
+			fmt.Fprintf(&sb, "%s\t%s\r\n", f.Path, f.Error)
+		}
+		manifest := sb.String()
+		if err := aw.AddFile(failureManifestName, int64(len(manifest)), time.Now(), strings.NewReader(manifest)); err != nil {
+			return written, failed, err
+		}
+	}
+	return written, failed, nil
+}
+
+// userFileScope 用户自己的文件
+func userFileScope(userID uint) func() *gorm.DB {
+	return func() *gorm.DB {
+		return model.DB.Model(&model.File{}).Where("files.user_id = ?", userID)
+	}
+}
+
+// CompressFiles 提交压缩任务，将所选文件与文件夹打包保存到 parentID 目录
+// format 为 zip (默认) 或 tar.gz；name 为空时根据所选文件生成
+// 所选文件与目标目录都可以位于共享给自己的文件夹中，压缩包归属并占用目标目录所有者的空间
+func CompressFiles(userID uint, fileIDs []uint, parentID uint, name string, format string, conflict string) (*TaskInfo, error) {
+	if len(fileIDs) == 0 {
+		return nil, errors.New("请选择要压缩的文件")
+	}
+	policy, err := parseConflictPolicy(conflict)
+	if err != nil {
+		return nil, err
+	}
+	if policy == ConflictSkip {
+		return nil, errors.New("压缩不支持跳过同名文件")
+	}
+	switch format {
+	case "":
+		format = utils.ArchiveZip
+	case utils.ArchiveZip, utils.ArchiveTarGz:
+	default:
+		return nil, utils.ErrNotArchive
+	}
+	if _, err := writableFolderOwner(userID, parentID); err != nil {
+		return nil, err
+	}
+
+	selected, missing, err := authorizeFiles(userID, fileIDs, model.PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, ErrFileNotFound
+	}
+	if _, err := selectionOwner(userID, selected); err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "压缩文件_" + time.Now().Format("20060102150405")
+		if len(selected) == 1 {
+			name = strings.TrimSuffix(selected[0].Name, filepath.Ext(selected[0].Name))
+			if selected[0].IsFolder || name == "" {
+				name = selected[0].Name
+			}
+		}
+	}
+	if utils.ArchiveFormat(name, "") != format {
+		name += "." + format
+	}
+	if err := validateFileName(name); err != nil {
+		return nil, err
+	}
+
+	return submitTask(userID, taskCompress, CompressPayload{IDs: fileIDs, ParentID: parentID, Name: name, Format: format, Conflict: policy})
+}
+
+// runCompressTask 执行压缩：先写入本地临时文件，完成后作为新文件保存，进度以源文件字节计
+func runCompressTask(tc *TaskContext) (interface{}, error) {
+	var p CompressPayload
+	if err := tc.Bind(&p); err != nil {
+		return nil, err
+	}
+	userID := tc.Task.UserID
+	// 授权可能在任务排队期间被撤销，执行前重新校验，失去权限的文件记入失败清单
+	ownerID, err := writableFolderOwner(userID, p.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	selected, missing, err := authorizeFiles(userID, p.IDs, model.PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	sourceOwner, err := selectionOwner(userID, selected)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(selected))
+	for _, f := range selected {
+		ids = append(ids, f.ID)
+	}
+
+	items, failed, total, err := collectArchiveItems(userFileScope(sourceOwner), ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range missing {
+		failed = append(failed, ArchiveFailure{Path: fmt.Sprintf("#%d", id), Error: ErrFileNotFound.Error()})
+	}
+	if total > archiveMaxFileSize() {
+		return nil, errors.New("所选文件过大，不支持在线压缩")
+	}
+	if err := checkQuota(ownerID, total); err != nil {
+		return nil, err
+	}
+	tc.SetTotal(total)
+
+	tmp, err := os.CreateTemp("", "netdisk-compress-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	aw, err := utils.NewArchiveWriter(p.Format, tmp)
+	if err != nil {
+		return nil, err
+	}
+	written, failed, err := writeArchiveItems(aw, items, failed, tc.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := tc.Err(); err != nil {
+		return nil, err
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	name, _, _, err := resolveNameConflict(ownerID, p.ParentID, p.Name, false, p.Conflict)
+	if err != nil {
+		return nil, err
+	}
+	file, err := storeFile(ownerID, p.ParentID, name, size, tmp)
+	if err != nil {
+		return nil, err
+	}
+	if failed == nil {
+		failed = []ArchiveFailure{}
+	}
+	return &CompressResult{FileID: file.ID, Name: file.Name, Size: file.Size, Files: written, Failed: failed}, nil
+}
@@ -1,16 +1,15 @@
 package service
 
 import (
-	"archive/zip"
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/stfreya/stfreyanetdisk/driver"
@@ -19,285 +18,396 @@ import (
 	"gorm.io/gorm"
 )
 
-// SaveFileContent 保存文件内容（在线编辑）
-func SaveFileContent(userID uint, fileID uint, content string) error {
-	var file model.File
-	if err := model.DB.Where("id = ? AND user_id = ?", fileID, userID).First(&file).Error; err != nil {
-		return errors.New("文件不存在")
+const defaultEditMaxMB = 5
+
+var (
+	// ErrVersionRequired 保存时未携带基础版本
+	ErrVersionRequired = errors.New("缺少文件的基础版本")
+	// ErrVersionConflict 文件在编辑期间已被修改
+	ErrVersionConflict = errors.New("文件已被修改，请刷新后重试")
+	// ErrContentTooLarge 文件超出在线编辑的大小上限
+	ErrContentTooLarge = errors.New("文件过大，不支持在线编辑")
+)
+
+// FileContent 在线编辑的文件内容，Version 为记录的内容哈希 (SHA256)，同时用作 ETag
+type FileContent struct {
+	FileID  uint   `json:"fileId"`
+	Content string `json:"content,omitempty"`
+	utils.TextEncoding
+	Version   string    `json:"version"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// EditMaxFileSize 在线编辑的文件大小上限 (按原编码计算)
+func EditMaxFileSize() int64 {
+	mb, err := strconv.ParseInt(model.GetConfig("edit_max_file_size", strconv.Itoa(defaultEditMaxMB)), 10, 64)
+	if err != nil || mb <= 0 {
+		mb = defaultEditMaxMB
 	}
+	return mb * 1024 * 1024
+}
 
-	// 1. 获取存储策略
-	var policy model.StoragePolicy
-	if err := model.DB.First(&policy, file.PolicyID).Error; err != nil {
-		return err
+func toFileContent(file *model.File) *FileContent {
+	return &FileContent{FileID: file.ID, Version: file.Hash, Size: file.Size, UpdatedAt: file.UpdatedAt}
+}
+
+// GetFileContent 读取文本文件用于在线编辑，返回解码后的内容、原编码与当前版本
+func GetFileContent(userID uint, fileID uint) (*FileContent, error) {
+	access, err := AuthorizeFile(userID, fileID, model.PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	file := *access.File
+	if file.IsFolder {
+		return nil, ErrFileNotFound
+	}
+	if file.Size > EditMaxFileSize() {
+		return nil, ErrContentTooLarge
 	}
 
-	// 2. 获取驱动
-	d, err := driver.GetDriver(&policy)
+	d, err := getPolicyDriver(file.PolicyID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	reader, err := d.Get(file.Path)
+	if err != nil {
+		return nil, errors.New("无法读取文件")
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, EditMaxFileSize()+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > EditMaxFileSize() {
+		return nil, ErrContentTooLarge
 	}
 
-	// 3. 记录旧版本
-	oldPath := file.Path
-	oldSize := file.Size
+	te := utils.DetectTextEncoding(data, file.MimeType)
+	if te.Name != utils.EncodingUTF16LE && te.Name != utils.EncodingUTF16BE && bytes.IndexByte(data, 0) >= 0 {
+		return nil, errors.New("不支持在线编辑二进制文件")
+	}
+	text, err := utils.DecodeTextAs(data, te)
+	if err != nil {
+		return nil, errors.New("无法识别文件编码")
+	}
 
-	// 为了简单起见，我们暂且把旧文件重命名作为版本
-	// 实际生产中可能需要更复杂的路径管理
-	versionPath := fmt.Sprintf("%s.v%d", oldPath, time.Now().Unix())
+	content := toFileContent(&file)
+	content.Content = text
+	content.TextEncoding = te
+	return content, nil
+}
 
-	// 这里我们需要先复制旧文件内容到新版本路径，或者通过驱动支持重命名
-	// 由于我们的驱动接口目前只有 Put/Get/Delete，我们可以先读出旧内容再写入
-	oldReader, err := d.Get(oldPath)
-	if err == nil {
-		defer oldReader.Close()
-		_ = d.Put(versionPath, oldReader, oldSize)
+// SaveFileContent 保存文件内容（在线编辑）
+// baseVersion 为编辑开始时读取到的版本，与当前版本不一致时返回 ErrVersionConflict 及当前版本信息；
+// 只有尚未记录哈希的历史文件可以不携带版本，保存后即补全哈希。内容按 te 指定的编码写回。新内容写入新的存储路径，旧内容原样保留为历史版本，
+// 版本校验与切换在同一条条件更新中完成，并发保存时只有一方成功
+func SaveFileContent(userID uint, fileID uint, content string, te utils.TextEncoding, baseVersion string) (*FileContent, error) {
+	access, err := AuthorizeFile(userID, fileID, model.PermissionWrite)
+	if err != nil {
+		return nil, err
+	}
+	file := *access.File
+	if file.IsFolder {
+		return nil, ErrFileNotFound
+	}
+	// 编辑共享给自己的文件时，新内容占用所有者的空间
+	ownerID := file.UserID
+	if baseVersion == "" && file.Hash != "" {
+		return nil, ErrVersionRequired
+	}
+	if file.Hash != baseVersion {
+		return toFileContent(&file), ErrVersionConflict
+	}
 
-		// 保存版本记录到数据库
-		model.DB.Create(&model.FileVersion{
-			FileID:   file.ID,
-			Size:     oldSize,
-			Path:     versionPath,
-			PolicyID: file.PolicyID,
-		})
+	if te.Name == "" {
+		te.Name = utils.EncodingUTF8
+	}
+	name, err := utils.NormalizeTextEncoding(te.Name)
+	if err != nil {
+		return nil, err
+	}
+	te.Name = name
+	data, err := utils.EncodeText(content, te)
+	if err != nil {
+		return nil, err
+	}
+	newSize := int64(len(data))
+	if newSize > EditMaxFileSize() {
+		return nil, ErrContentTooLarge
 	}
 
-	// 4. 上传新内容
-	newReader := strings.NewReader(content)
-	newSize := int64(len(content))
-	if err := d.Put(file.Path, newReader, newSize); err != nil {
-		return err
+	d, err := getPolicyDriver(file.PolicyID)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	newHash := hex.EncodeToString(sum[:])
+	if newHash == file.Hash {
+		return toFileContent(&file), nil
+	}
+	newPath := newStoragePath(ownerID, file.Ext)
+	if err := d.Put(newPath, bytes.NewReader(data), newSize); err != nil {
+		return nil, err
 	}
 
-	// 更新搜索索引
-	go func() {
-		_ = utils.IndexFile(file.ID, userID, file.Name, content)
-	}()
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		db := tx.Model(&model.File{}).Where("id = ?", file.ID)
+		if baseVersion == "" {
+			db = db.Where("hash IS NULL OR hash = ''")
+		} else {
+			db = db.Where("hash = ?", baseVersion)
+		}
+		result := db.Updates(map[string]interface{}{"path": newPath, "hash": newHash, "size": newSize})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
 
-	// 5. 更新文件信息和用户空间
-	return model.DB.Transaction(func(tx *gorm.DB) error {
-		// 计算空间差异
 		diff := newSize - file.Size
-
-		if diff > 0 {
-			var user model.User
-			if err := tx.First(&user, userID).Error; err != nil {
-				return err
-			}
-			if user.UsedSize+diff > user.TotalSize {
-				return errors.New("存储空间不足")
-			}
+		result = tx.Model(&model.User{}).Where("id = ? AND used_size + ? <= total_size", ownerID, max(diff, 0)).
+			UpdateColumn("used_size", gorm.Expr("used_size + ?", diff))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("存储空间不足")
 		}
 
-		// 更新文件大小
-		if err := tx.Model(&file).Update("size", newSize).Error; err != nil {
+		// 旧内容保留为历史版本
+		if err := tx.Create(&model.FileVersion{
+			FileID:   file.ID,
+			Size:     file.Size,
+			Path:     file.Path,
+			Hash:     file.Hash,
+			PolicyID: file.PolicyID,
+		}).Error; err != nil {
 			return err
 		}
 
-		// 更新用户已用空间
-		if err := tx.Model(&model.User{}).Where("id = ?", userID).UpdateColumn("used_size", gorm.Expr("used_size + ?", diff)).Error; err != nil {
+		// 旧内容的缩略图失效，随后由后台任务重新生成
+		if err := invalidateThumbnails(tx, []uint{file.ID}); err != nil {
 			return err
 		}
 
-		return nil
+		// 更新搜索索引
+		return enqueueIndex(tx, []uint{file.ID}, true)
 	})
+	if err != nil {
+		_ = d.Delete(newPath)
+		if errors.Is(err, ErrVersionConflict) {
+			var current model.File
+			if model.DB.First(&current, file.ID).Error == nil {
+				return toFileContent(&current), ErrVersionConflict
+			}
+		}
+		return nil, err
+	}
+
+	var saved model.File
+	if err := model.DB.First(&saved, file.ID).Error; err != nil {
+		return nil, err
+	}
+	result := toFileContent(&saved)
+	result.TextEncoding = te
+	return result, nil
 }
 
-// ListFileVersions 获取文件版本列表
+// ListFileVersions 获取文件版本列表，可以查看共享给自己的文件的版本
 func ListFileVersions(userID uint, fileID uint) ([]model.FileVersion, error) {
-	var file model.File
-	if err := model.DB.Where("id = ? AND user_id = ?", fileID, userID).First(&file).Error; err != nil {
-		return nil, errors.New("文件不存在")
+	access, err := AuthorizeFile(userID, fileID, model.PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	if access.File.IsFolder {
+		return nil, ErrFileNotFound
 	}
 
 	var versions []model.FileVersion
-	err := model.DB.Where("file_id = ?", fileID).Order("created_at desc").Find(&versions).Error
+	err = model.DB.Where("file_id = ?", fileID).Order("created_at desc").Find(&versions).Error
 	return versions, err
 }
 
 // RestoreFileVersion 还原文件到指定版本
+// 文件改为引用该版本的数据，当前内容另存为一个新的历史版本；还原共享给自己的文件时占用所有者的空间
 func RestoreFileVersion(userID uint, versionID uint) error {
 	var version model.FileVersion
 	if err := model.DB.First(&version, versionID).Error; err != nil {
 		return errors.New("版本不存在")
 	}
 
-	var file model.File
-	if err := model.DB.Where("id = ? AND user_id = ?", version.FileID, userID).First(&file).Error; err != nil {
-		return errors.New("文件不存在")
-	}
-
-	// 1. 获取存储策略
-	var policy model.StoragePolicy
-	if err := model.DB.First(&policy, file.PolicyID).Error; err != nil {
+	access, err := AuthorizeFile(userID, version.FileID, model.PermissionWrite)
+	if err != nil {
 		return err
 	}
+	file := *access.File
+	ownerID := file.UserID
 
-	// 2. 获取驱动
-	d, err := driver.GetDriver(&policy)
+	d, err := getPolicyDriver(version.PolicyID)
 	if err != nil {
 		return err
 	}
-
-	// 3. 将版本内容写回原文件路径
-	versionReader, err := d.Get(version.Path)
-	if err != nil {
+	if ok, err := d.Exists(version.Path); err != nil || !ok {
 		return errors.New("无法读取版本文件")
 	}
-	defer versionReader.Close()
-
-	if err := d.Put(file.Path, versionReader, version.Size); err != nil {
-		return err
-	}
 
-	// 4. 更新数据库
 	return model.DB.Transaction(func(tx *gorm.DB) error {
-		diff := version.Size - file.Size
-		if err := tx.Model(&file).Update("size", version.Size).Error; err != nil {
-			return err
+		result := tx.Model(&model.File{}).Where("id = ? AND hash = ?", file.ID, file.Hash).Updates(map[string]interface{}{
+			"path": version.Path, "hash": version.Hash, "size": version.Size, "policy_id": version.PolicyID,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
 		}
-		if err := tx.Model(&model.User{}).Where("id = ?", userID).UpdateColumn("used_size", gorm.Expr("used_size + ?", diff)).Error; err != nil {
+		if err := tx.Create(&model.FileVersion{
+			FileID:   file.ID,
+			Size:     file.Size,
+			Path:     file.Path,
+			Hash:     file.Hash,
+			PolicyID: file.PolicyID,
+		}).Error; err != nil {
 			return err
 		}
-		return nil
-	})
-}
-
-// ListFiles 获取文件列表
-func ListFiles(userID uint, parentID uint) ([]model.File, error) {
-	var files []model.File
-	err := model.DB.Where("user_id = ? AND parent_id = ?", userID, parentID).Find(&files).Error
-	return files, err
-}
 
-// BatchDownloadFiles 批量下载文件 (压缩成zip)
-func BatchDownloadFiles(userID uint, fileIDs []uint, w io.Writer) error {
-	zw := zip.NewWriter(w)
-	defer zw.Close()
-
-	for _, id := range fileIDs {
-		var file model.File
-		if err := model.DB.Where("id = ? AND user_id = ?", id, userID).First(&file).Error; err != nil {
-			continue
+		diff := version.Size - file.Size
+		result = tx.Model(&model.User{}).Where("id = ? AND used_size + ? <= total_size", ownerID, max(diff, 0)).
+			UpdateColumn("used_size", gorm.Expr("used_size + ?", diff))
+		if result.Error != nil {
+			return result.Error
 		}
-
-		if file.IsFolder {
-			// 如果是文件夹，递归添加内容
-			if err := addFolderToZip(zw, userID, file.ID, file.Name); err != nil {
-				return err
-			}
-		} else {
-			// 如果是文件，直接添加
-			if err := addFileToZip(zw, &file); err != nil {
-				return err
-			}
+		if result.RowsAffected == 0 {
+			return errors.New("存储空间不足")
 		}
-	}
-	return nil
+		if err := invalidateThumbnails(tx, []uint{file.ID}); err != nil {
+			return err
+		}
+		return enqueueIndex(tx, []uint{file.ID}, true)
+	})
 }
 
-// GetFolderSize 递归计算文件夹大小
-func GetFolderSize(userID uint, folderID uint) (int64, error) {
-	var size int64
-	var files []model.File
-	if err := model.DB.Where("user_id = ? AND parent_id = ?", userID, folderID).Find(&files).Error; err != nil {
-		return 0, err
-	}
-
-	for _, file := range files {
-		if file.IsFolder {
-			s, err := GetFolderSize(userID, file.ID)
-			if err != nil {
-				return 0, err
-			}
-			size += s
-		} else {
-			size += file.Size
+// ListFiles 获取文件列表，parentID 可以是共享给自己的文件夹
+func ListFiles(userID uint, parentID uint, q ListQuery) ([]model.File, Page, error) {
+	ownerID := userID
+	if parentID != 0 {
+		access, err := AuthorizeFile(userID, parentID, model.PermissionRead)
+		if err != nil || !access.File.IsFolder {
+			return nil, Page{}, errors.New("目录不存在")
 		}
+		ownerID = access.File.UserID
 	}
-	return size, nil
+	db := model.DB.Model(&model.File{}).Where("files.user_id = ? AND files.parent_id = ?", ownerID, parentID)
+	return listFiles(db, q, "files.updated_at")
 }
 
-// SearchFiles 搜索文件
-func SearchFiles(userID uint, keyword string) ([]model.File, error) {
-	var files []model.File
-	err := model.DB.Where("user_id = ? AND name LIKE ?", userID, "%"+keyword+"%").Find(&files).Error
-	return files, err
+// ListFavorites 获取收藏列表
+func ListFavorites(userID uint, q ListQuery) ([]model.File, Page, error) {
+	db := model.DB.Model(&model.File{}).Where("files.user_id = ? AND files.is_favorite = ?", userID, true)
+	return listFiles(db, q, "files.updated_at")
 }
 
-func addFileToZip(zw *zip.Writer, file *model.File) error {
-	var policy model.StoragePolicy
-	if err := model.DB.First(&policy, file.PolicyID).Error; err != nil {
+// BatchDownloadFiles 批量下载文件 (压缩成 zip 流式输出)，可以选择共享给自己的文件夹中的文件
+// 文件名以 UTF-8 编码写入；读取失败的文件不会中断下载，而是在压缩包中附加失败清单
+func BatchDownloadFiles(userID uint, fileIDs []uint, w io.Writer) error {
+	files, missing, err := authorizeFiles(userID, fileIDs, model.PermissionRead)
+	if err != nil {
 		return err
 	}
-	d, err := driver.GetDriver(&policy)
+	ownerID, err := selectionOwner(userID, files)
 	if err != nil {
 		return err
 	}
-	reader, err := d.Get(file.Path)
+	ids := make([]uint, 0, len(files))
+	for _, f := range files {
+		ids = append(ids, f.ID)
+	}
+	items, failed, _, err := collectArchiveItems(userFileScope(ownerID), ids)
 	if err != nil {
 		return err
 	}
-	defer reader.Close()
-
-	f, err := zw.Create(file.Name)
+	for _, id := range missing {
+		failed = append(failed, ArchiveFailure{Path: fmt.Sprintf("#%d", id), Error: ErrFileNotFound.Error()})
+	}
+	aw, err := utils.NewArchiveWriter(utils.ArchiveZip, w)
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(f, reader)
-	return err
+	if _, _, err := writeArchiveItems(aw, items, failed, nil); err != nil {
+		return err
+	}
+	return aw.Close()
 }
 
-func addFolderToZip(zw *zip.Writer, userID uint, folderID uint, baseDir string) error {
-	var files []model.File
-	if err := model.DB.Where("user_id = ? AND parent_id = ?", userID, folderID).Find(&files).Error; err != nil {
-		return err
+// GetFolderSize 计算文件夹大小 (基于物化路径一次聚合)
+func GetFolderSize(userID uint, folderID uint) (int64, error) {
+	var folder model.File
+	if err := model.DB.Where("id = ? AND user_id = ?", folderID, userID).First(&folder).Error; err != nil {
+		return 0, err
 	}
 
-	for _, file := range files {
-		relPath := filepath.Join(baseDir, file.Name)
-		if file.IsFolder {
-			if err := addFolderToZip(zw, userID, file.ID, relPath); err != nil {
-				return err
-			}
-		} else {
-			var policy model.StoragePolicy
-			if err := model.DB.First(&policy, file.PolicyID).Error; err != nil {
-				continue
-			}
-			d, err := driver.GetDriver(&policy)
-			if err != nil {
-				continue
-			}
-			reader, err := d.Get(file.Path)
-			if err != nil {
-				continue
-			}
-			f, err := zw.Create(relPath)
-			if err != nil {
-				reader.Close()
-				continue
-			}
-			io.Copy(f, reader)
-			reader.Close()
-		}
+	var size int64
+	err := model.DB.Model(&model.File{}).
+		Where("user_id = ? AND is_folder = ?", userID, false).
+		Scopes(model.DescendantScope(&folder)).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&size).Error
+	return size, err
+}
+
+// checkParentFolder 校验目标父目录属于该用户且是文件夹 (0 表示根目录)
+func checkParentFolder(userID uint, parentID uint) (*model.File, error) {
+	if parentID == 0 {
+		return nil, nil
 	}
-	return nil
+	var parent model.File
+	if err := model.DB.Where("id = ? AND user_id = ? AND is_folder = ?", parentID, userID, true).First(&parent).Error; err != nil {
+		return nil, errors.New("目标文件夹不存在")
+	}
+	return &parent, nil
+}
+
+// getPolicyDriver 根据存储策略 ID 获取驱动
+func getPolicyDriver(policyID uint) (driver.Driver, error) {
+	var policy model.StoragePolicy
+	if err := model.DB.First(&policy, policyID).Error; err != nil {
+		return nil, err
+	}
+	return driver.GetDriver(&policy)
 }
 
-// CreateFolder 创建文件夹
+// CreateFolder 创建文件夹，在共享给自己的文件夹中创建时归属文件夹所有者
 func CreateFolder(userID uint, parentID uint, name string) error {
+	if err := validateFileName(name); err != nil {
+		return err
+	}
+	ownerID, err := writableFolderOwner(userID, parentID)
+	if err != nil {
+		return err
+	}
 	folder := model.File{
 		Name:     name,
 		IsFolder: true,
 		ParentID: parentID,
-		UserID:   userID,
+		UserID:   ownerID,
 	}
 	return model.DB.Create(&folder).Error
 }
 
 // UploadFile 上传文件 (支持秒传)
+// 上传到共享给自己的文件夹时，文件归属并占用文件夹所有者的空间
 func UploadFile(userID uint, parentID uint, name string, size int64, reader io.Reader, hash string) error {
+	if err := validateFileName(name); err != nil {
+		return err
+	}
+	ownerID, err := writableFolderOwner(userID, parentID)
+	if err != nil {
+		return err
+	}
+	userID = ownerID
+
 	// 1. 获取用户信息，校验容量
 	var user model.User
 	if err := model.DB.First(&user, userID).Error; err != nil {
@@ -312,6 +422,10 @@ func UploadFile(userID uint, parentID uint, name string, size int64, reader io.R
 		var existingFile model.File
 		if err := model.DB.Where("hash = ? AND deleted_at IS NULL", hash).First(&existingFile).Error; err == nil {
 			// 发现相同哈希的文件，执行秒传
+			mimeType := existingFile.MimeType
+			if mimeType == "" {
+				mimeType = utils.MimeTypeOfExt(filepath.Ext(name))
+			}
 			return model.DB.Transaction(func(tx *gorm.DB) error {
 				fileRecord := model.File{
 					Name:     name,
@@ -319,6 +433,8 @@ func UploadFile(userID uint, parentID uint, name string, size int64, reader io.R
 					Hash:     hash,
 					Path:     existingFile.Path,
 					Ext:      filepath.Ext(name),
+					MimeType: mimeType,
+					Category: utils.CategoryOf(mimeType, filepath.Ext(name)),
 					IsFolder: false,
 					ParentID: parentID,
 					UserID:   userID,
@@ -333,32 +449,29 @@ func UploadFile(userID uint, parentID uint, name string, size int64, reader io.R
 					return err
 				}
 
-				return nil
+				return enqueueIndex(tx, []uint{fileRecord.ID}, true)
 			})
 		}
 	}
 
 	// 3. 获取用户默认存储策略
-	var policy model.StoragePolicy
-	if err := model.DB.Where("is_default = ?", true).First(&policy).Error; err != nil {
-		if err := model.DB.First(&policy).Error; err != nil {
-			return errors.New("未配置存储策略")
-		}
+	policy, err := defaultStoragePolicy()
+	if err != nil {
+		return err
 	}
 
 	// 4. 获取驱动
-	d, err := driver.GetDriver(&policy)
+	d, err := driver.GetDriver(policy)
 	if err != nil {
 		return err
 	}
 
 	// 5. 构造存储路径 (使用时间戳或随机名避免冲突)
 	ext := filepath.Ext(name)
-	storageName := fmt.Sprintf("%d_%d%s", userID, time.Now().UnixNano(), ext)
-	storagePath := filepath.Join("uploads", fmt.Sprintf("%d", userID), storageName)
+	storagePath := newStoragePath(userID, ext)
 
-	// 6. 调用驱动上传
-	var contentBuffer bytes.Buffer
+	// 6. 调用驱动上传，只保留文件头用于类型嗅探
+	var head []byte
 	var finalHash string
 
 	// 如果前端没给哈希，我们在上传过程中计算一个
@@ -372,20 +485,28 @@ func UploadFile(userID uint, parentID uint, name string, size int64, reader io.R
 		}
 		h.Write(data)
 		finalHash = hex.EncodeToString(h.Sum(nil))
-		contentBuffer.Write(data)
+		head = data
 
 		if err := d.Put(storagePath, bytes.NewReader(data), size); err != nil {
 			return err
 		}
 	} else {
 		finalHash = hash
-		teeReader := io.TeeReader(reader, &contentBuffer)
+		sniff := &headBuffer{limit: sniffSize}
+		teeReader := io.TeeReader(reader, sniff)
 		if err := d.Put(storagePath, teeReader, size); err != nil {
 			return err
 		}
+		head = sniff.Bytes()
 	}
 
-	// 7. 事务更新数据库
+	// 7. 根据文件头嗅探 MIME 类型
+	if len(head) > sniffSize {
+		head = head[:sniffSize]
+	}
+	mimeType := utils.DetectMimeType(name, head)
+
+	// 8. 事务更新数据库
 	return model.DB.Transaction(func(tx *gorm.DB) error {
 		fileRecord := model.File{
 			Name:     name,
@@ -393,6 +514,8 @@ func UploadFile(userID uint, parentID uint, name string, size int64, reader io.R
 			Hash:     finalHash,
 			Path:     storagePath,
 			Ext:      ext,
+			MimeType: mimeType,
+			Category: utils.CategoryOf(mimeType, ext),
 			IsFolder: false,
 			ParentID: parentID,
 			UserID:   userID,
@@ -407,13 +530,7 @@ func UploadFile(userID uint, parentID uint, name string, size int64, reader io.R
 			return err
 		}
 
-		// 异步建立搜索索引
-		fileContent := ""
-		if size < 1024*1024 {
-			fileContent = contentBuffer.String()
-		}
 		go func() {
-			_ = utils.IndexFile(fileRecord.ID, userID, name, fileContent)
 			// 增加上传奖励
 			rewardStr := model.GetConfig("upload_reward", "1")
 			reward, _ := strconv.Atoi(rewardStr)
@@ -423,104 +540,258 @@ func UploadFile(userID uint, parentID uint, name string, size int64, reader io.R
 			}
 		}()
 
-		return nil
+		// 异步抽取正文并建立搜索索引
+		return enqueueIndex(tx, []uint{fileRecord.ID}, true)
 	})
 }
 
-// DeleteFile 删除文件/文件夹 (进入回收站)
-func DeleteFile(userID uint, fileID uint) error {
-	return model.DB.Where("id = ? AND user_id = ?", fileID, userID).Delete(&model.File{}).Error
+// defaultStoragePolicy 获取默认存储策略，未设置默认时使用第一个
+func defaultStoragePolicy() (*model.StoragePolicy, error) {
+	var policy model.StoragePolicy
+	if err := model.DB.Where("is_default = ?", true).First(&policy).Error; err != nil {
+		if err := model.DB.First(&policy).Error; err != nil {
+			return nil, errors.New("未配置存储策略")
+		}
+	}
+	return &policy, nil
 }
 
-// RenameFile 重命名文件/文件夹
-func RenameFile(userID uint, fileID uint, newName string) error {
-	return model.DB.Model(&model.File{}).Where("id = ? AND user_id = ?", fileID, userID).Update("name", newName).Error
+// newStoragePath 构造新文件的存储路径 (使用时间戳避免冲突)
+func newStoragePath(userID uint, ext string) string {
+	storageName := fmt.Sprintf("%d_%d%s", userID, time.Now().UnixNano(), ext)
+	// 存储路径是驱动的对象键，统一使用 "/" 分隔，不随服务器操作系统变化
+	return path.Join("uploads", fmt.Sprintf("%d", userID), storageName)
 }
 
-// MoveFile 移动文件/文件夹
-func MoveFile(userID uint, fileID uint, newParentID uint) error {
-	// 防止将文件夹移动到自己及其子目录下 (简化版：只检查不能移动到自己)
-	if fileID == newParentID {
-		return errors.New("不能将文件夹移动到自身")
+// storeFile 将数据流写入默认存储策略并创建文件记录，用于服务端生成的文件 (解压、打包等)
+// 与 UploadFile 不同，不发放上传奖励；容量在事务内原子校验，失败时删除已写入的数据
+func storeFile(userID uint, parentID uint, name string, size int64, r io.Reader) (*model.File, error) {
+	if err := validateFileName(name); err != nil {
+		return nil, err
+	}
+	var user model.User
+	if err := model.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("用户不存在")
+	}
+	if user.UsedSize+size > user.TotalSize {
+		return nil, errors.New("存储空间不足")
 	}
-	return model.DB.Model(&model.File{}).Where("id = ? AND user_id = ?", fileID, userID).Update("parent_id", newParentID).Error
-}
 
-// ListRecycleBin 获取回收站文件列表
-func ListRecycleBin(userID uint) ([]model.File, error) {
-	var files []model.File
-	// Unscoped() 可以查询到被软删除的数据
-	err := model.DB.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).Find(&files).Error
-	return files, err
-}
+	policy, err := defaultStoragePolicy()
+	if err != nil {
+		return nil, err
+	}
+	d, err := driver.GetDriver(policy)
+	if err != nil {
+		return nil, err
+	}
 
-// CopyFile 递归复制文件或文件夹记录到新用户下
-func CopyFile(srcFile *model.File, targetUserID uint, targetParentID uint) error {
-	return model.DB.Transaction(func(tx *gorm.DB) error {
-		// 1. 校验容量
-		var user model.User
-		if err := tx.First(&user, targetUserID).Error; err != nil {
+	ext := filepath.Ext(name)
+	storagePath := newStoragePath(userID, ext)
+	h := sha256.New()
+	sniff := &headBuffer{limit: sniffSize}
+	counter := &countWriter{}
+	body := io.TeeReader(io.LimitReader(r, size), io.MultiWriter(h, sniff, counter))
+	if err := d.Put(storagePath, body, size); err != nil {
+		return nil, err
+	}
+	if counter.n != size {
+		_ = d.Delete(storagePath)
+		return nil, errors.New("文件数据不完整")
+	}
+
+	mimeType := utils.DetectMimeType(name, sniff.Bytes())
+	file := model.File{
+		Name:     name,
+		Size:     size,
+		Hash:     hex.EncodeToString(h.Sum(nil)),
+		Path:     storagePath,
+		Ext:      ext,
+		MimeType: mimeType,
+		Category: utils.CategoryOf(mimeType, ext),
+		ParentID: parentID,
+		UserID:   userID,
+		PolicyID: policy.ID,
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.User{}).Where("id = ? AND used_size + ? <= total_size", userID, size).
+			UpdateColumn("used_size", gorm.Expr("used_size + ?", size))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("存储空间不足")
+		}
+		if err := tx.Create(&file).Error; err != nil {
 			return err
 		}
+		return enqueueIndex(tx, []uint{file.ID}, true)
+	})
+	if err != nil {
+		_ = d.Delete(storagePath)
+		return nil, err
+	}
+	return &file, nil
+}
 
-		// 如果是文件夹，我们需要先计算总大小
-		var totalSize int64
-		if srcFile.IsFolder {
-			size, err := GetFolderSize(srcFile.UserID, srcFile.ID)
-			if err != nil {
-				return err
-			}
-			totalSize = size
+// countWriter 统计写入的字节数
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// sniffSize 类型嗅探读取的文件头长度
+const sniffSize = 3072
+
+// headBuffer 只保留写入数据的前 limit 个字节
+type headBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if remain := b.limit - b.Len(); remain > 0 {
+		if len(p) > remain {
+			b.Buffer.Write(p[:remain])
 		} else {
-			totalSize = srcFile.Size
+			b.Buffer.Write(p)
 		}
+	}
+	return len(p), nil
+}
 
-		if user.UsedSize+totalSize > user.TotalSize {
-			return errors.New("存储空间不足")
+// DeleteFile 删除文件/文件夹 (进入所有者的回收站)
+func DeleteFile(userID uint, fileID uint) error {
+	access, err := AuthorizeFile(userID, fileID, model.PermissionWrite)
+	if err != nil {
+		return err
+	}
+	if access.IsGrantRoot() {
+		return ErrPermissionDenied
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteFile(tx, access.File.UserID, fileID)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("文件不存在")
 		}
+		return err
+	}
+	return nil
+}
 
-		// 2. 执行复制
-		return copyRecursive(tx, srcFile, targetUserID, targetParentID)
-	})
+// deleteFile 逻辑删除整棵子树，子树内所有记录使用同一删除时间，便于还原时整体恢复
+func deleteFile(tx *gorm.DB, userID uint, fileID uint) error {
+	var file model.File
+	if err := tx.Where("id = ? AND user_id = ?", fileID, userID).First(&file).Error; err != nil {
+		return err
+	}
+	if file.TreePath == "" {
+		return model.ErrTreePathMissing
+	}
+	ids := subtreeFileIDs(tx, &file, false)
+	if err := tx.Where("user_id = ?", userID).Scopes(model.SubtreeScope(&file)).Delete(&model.File{}).Error; err != nil {
+		return err
+	}
+	// 回收站中的文件不参与搜索
+	return enqueueIndex(tx, ids, false)
 }
 
-func copyRecursive(tx *gorm.DB, srcFile *model.File, targetUserID uint, targetParentID uint) error {
-	newFile := model.File{
-		Name:     srcFile.Name,
-		Size:     srcFile.Size,
-		Hash:     srcFile.Hash,
-		Path:     srcFile.Path,
-		Ext:      srcFile.Ext,
-		IsFolder: srcFile.IsFolder,
-		ParentID: targetParentID,
-		UserID:   targetUserID,
-		PolicyID: srcFile.PolicyID,
+// RenameFile 重命名文件/文件夹
+func RenameFile(userID uint, fileID uint, newName string) error {
+	if err := validateFileName(newName); err != nil {
+		return err
 	}
 
-	if err := tx.Create(&newFile).Error; err != nil {
+	access, err := AuthorizeFile(userID, fileID, model.PermissionWrite)
+	if err != nil {
 		return err
 	}
+	if access.IsGrantRoot() {
+		return ErrPermissionDenied
+	}
+	file := access.File
+	if file.IsFolder {
+		return model.DB.Model(file).Update("name", newName).Error
+	}
 
-	// 更新用户空间
-	if !srcFile.IsFolder {
-		if err := tx.Model(&model.User{}).Where("id = ?", targetUserID).UpdateColumn("used_size", gorm.Expr("used_size + ?", srcFile.Size)).Error; err != nil {
+	// 扩展名变化时同步更新类别，无法嗅探出类型的文件以新扩展名为准
+	ext := filepath.Ext(newName)
+	mimeType := file.MimeType
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = utils.MimeTypeOfExt(ext)
+	}
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(file).Updates(map[string]interface{}{
+			"name":      newName,
+			"ext":       ext,
+			"mime_type": mimeType,
+			"category":  utils.CategoryOf(mimeType, ext),
+		}).Error
+		if err != nil {
 			return err
 		}
+		return enqueueIndex(tx, []uint{file.ID}, false)
+	})
+}
+
+// MoveFile 移动文件/文件夹
+// 共享给自己的文件夹中的文件只能在所有者的、自己有写权限的目录之间移动，授权的文件夹本身不能移动
+func MoveFile(userID uint, fileID uint, newParentID uint) error {
+	access, err := AuthorizeFile(userID, fileID, model.PermissionWrite)
+	if err != nil {
+		return err
+	}
+	if access.IsGrantRoot() {
+		return ErrPermissionDenied
 	}
+	file := *access.File
 
-	if srcFile.IsFolder {
-		var children []model.File
-		if err := tx.Where("parent_id = ? AND user_id = ?", srcFile.ID, srcFile.UserID).Find(&children).Error; err != nil {
+	ownerID, err := writableFolderOwner(userID, newParentID)
+	if err != nil {
+		return err
+	}
+	if ownerID != file.UserID {
+		return errors.New("不能在不同用户的文件夹之间移动")
+	}
+	parent, err := checkParentFolder(ownerID, newParentID)
+	if err != nil {
+		return err
+	}
+	parentPath := "/"
+	if parent != nil {
+		// 防止将文件夹移动到自身及其子目录下
+		if model.IsInTree(parent.TreePath, file.TreePath) {
+			return errors.New("不能将文件夹移动到自身或其子目录下")
+		}
+		parentPath = parent.TreePath
+	}
+
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.File{}).Where("id = ?", file.ID).Update("parent_id", newParentID).Error; err != nil {
 			return err
 		}
-		for _, child := range children {
-			if err := copyRecursive(tx, &child, targetUserID, newFile.ID); err != nil {
-				return err
-			}
+		if err := model.MoveSubtree(tx, &file, parentPath); err != nil {
+			return err
 		}
-	}
+		// 子树内文件的所在目录发生变化，刷新目录范围索引
+		return enqueueIndex(tx, subtreeFileIDs(tx, &file, false), false)
+	})
+}
 
-	return nil
+// ListRecycleBin 获取回收站文件列表
+func ListRecycleBin(userID uint, q ListQuery) ([]model.File, Page, error) {
+	// Unscoped() 可以查询到被软删除的数据
+	// 随父目录一同删除的子项不单独列出，只展示每批删除的顶层记录
+	db := model.DB.Unscoped().Model(&model.File{}).
+		Where("files.user_id = ? AND files.deleted_at IS NOT NULL", userID).
+		Where("NOT EXISTS (SELECT 1 FROM files p WHERE p.id = files.parent_id AND p.deleted_at = files.deleted_at)")
+	return listFiles(db, q, "files.deleted_at")
 }
 
 // CleanRecycleBin 清理回收站 (days: 清理多少天前的)
@@ -533,72 +804,181 @@ func CleanRecycleBin(days int) (int64, error) {
 		return 0, err
 	}
 
+	// 分批彻底删除，避免单个事务过大
 	var count int64
+	for start := 0; start < len(files); start += 500 {
+		end := start + 500
+		if end > len(files) {
+			end = len(files)
+		}
+		batch := files[start:end]
+		if err := model.DB.Transaction(func(tx *gorm.DB) error {
+			return purgeFiles(tx, batch)
+		}); err != nil {
+			return count, err
+		}
+		count += int64(len(batch))
+	}
+
+	return count, nil
+}
+
+// purgeFiles 彻底删除文件记录及其历史版本并归还占用空间
+// 只有当没有其他文件或版本引用同一存储路径时，才删除物理文件 (防止秒传引用的文件被误删)
+func purgeFiles(tx *gorm.DB, files []model.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(files))
+	var fileIDs []uint
 	for _, file := range files {
-		// 1. 获取存储策略和驱动
-		var policy model.StoragePolicy
-		if err := model.DB.First(&policy, file.PolicyID).Error; err != nil {
-			continue
+		ids = append(ids, file.ID)
+		if !file.IsFolder {
+			fileIDs = append(fileIDs, file.ID)
 		}
-		d, err := driver.GetDriver(&policy)
-		if err != nil {
+	}
+
+	// 待回收的存储对象：文件当前内容及其历史版本
+	type blob struct {
+		path     string
+		policyID uint
+	}
+	var blobs []blob
+	freed := make(map[uint]int64)
+	for _, file := range files {
+		if file.IsFolder {
 			continue
 		}
+		freed[file.UserID] += file.Size
+		if file.Path != "" {
+			blobs = append(blobs, blob{file.Path, file.PolicyID})
+		}
+	}
+	if len(fileIDs) > 0 {
+		var versions []model.FileVersion
+		if err := tx.Unscoped().Where("file_id IN ?", fileIDs).Find(&versions).Error; err != nil {
+			return err
+		}
+		for _, v := range versions {
+			if v.Path != "" {
+				blobs = append(blobs, blob{v.Path, v.PolicyID})
+			}
+		}
+	}
 
-		// 2. 只有当没有其他文件引用此路径时，才物理删除 (防止秒传引用的文件被误删)
-		var otherRefs int64
-		model.DB.Model(&model.File{}).Where("path = ? AND id != ?", file.Path, file.ID).Count(&otherRefs)
+	drivers := make(map[uint]driver.Driver)
+	deleted := make(map[blob]bool)
+	for _, b := range blobs {
+		if deleted[b] {
+			continue
+		}
+		// 仍被其他文件或其他文件的历史版本引用时保留
+		var otherRefs, versionRefs int64
+		tx.Unscoped().Model(&model.File{}).Where("path = ? AND id NOT IN ?", b.path, ids).Count(&otherRefs)
+		tx.Unscoped().Model(&model.FileVersion{}).Where("path = ? AND file_id NOT IN ?", b.path, ids).Count(&versionRefs)
+		if otherRefs > 0 || versionRefs > 0 {
+			continue
+		}
 
-		if otherRefs == 0 && file.Path != "" {
-			_ = d.Delete(file.Path)
+		d, ok := drivers[b.policyID]
+		if !ok {
+			var err error
+			if d, err = getPolicyDriver(b.policyID); err != nil {
+				continue
+			}
+			drivers[b.policyID] = d
 		}
+		_ = d.Delete(b.path)
+		deleted[b] = true
+	}
 
-		// 3. 彻底从数据库删除
-		if err := model.DB.Unscoped().Delete(&file).Error; err == nil {
-			count++
+	for userID, size := range freed {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).UpdateColumn("used_size", gorm.Expr("used_size - ?", size)).Error; err != nil {
+			return err
 		}
 	}
 
-	return count, nil
+	if err := tx.Where("file_id IN ?", ids).Delete(&model.FileTag{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("file_id IN ?", ids).Delete(&model.FileMeta{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("file_id IN ?", ids).Delete(&model.FileMedia{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("file_id IN ?", ids).Delete(&model.FileGrant{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("file_id IN ?", ids).Delete(&model.FileVersion{}).Error; err != nil {
+		return err
+	}
+	if err := invalidateThumbnails(tx, fileIDs); err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("id IN ?", ids).Delete(&model.File{}).Error; err != nil {
+		return err
+	}
+	return enqueueIndex(tx, fileIDs, false)
 }
 
 // RestoreFile 还原文件
 func RestoreFile(userID uint, fileID uint) error {
-	return model.DB.Unscoped().Model(&model.File{}).Where("id = ? AND user_id = ?", fileID, userID).Update("deleted_at", nil).Error
-}
-
-// PermanentDeleteFile 彻底删除文件
-func PermanentDeleteFile(userID uint, fileID uint) error {
 	var file model.File
-	if err := model.DB.Unscoped().Where("id = ? AND user_id = ?", fileID, userID).First(&file).Error; err != nil {
+	if err := model.DB.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", fileID, userID).First(&file).Error; err != nil {
 		return errors.New("文件不存在")
 	}
+	if file.TreePath == "" {
+		return model.ErrTreePathMissing
+	}
 
 	return model.DB.Transaction(func(tx *gorm.DB) error {
-		if !file.IsFolder {
-			// 1. 获取存储策略
-			var policy model.StoragePolicy
-			if err := tx.First(&policy, file.PolicyID).Error; err != nil {
-				return err
-			}
-
-			// 2. 获取驱动
-			d, err := driver.GetDriver(&policy)
-			if err != nil {
-				return err
-			}
+		// 与该文件同批删除的子项一并还原，更早单独删除的子项仍留在回收站
+		if err := tx.Unscoped().Model(&model.File{}).
+			Where("user_id = ? AND deleted_at = ?", userID, file.DeletedAt.Time).
+			Scopes(model.SubtreeScope(&file)).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
 
-			// 3. 删除物理文件
-			_ = d.Delete(file.Path)
+		// 删除时已移出索引，还原后重新建立
+		if err := enqueueIndex(tx, subtreeFileIDs(tx, &file, false), true); err != nil {
+			return err
+		}
 
-			// 4. 更新用户已用空间
-			if err := tx.Model(&model.User{}).Where("id = ?", userID).UpdateColumn("used_size", gorm.Expr("used_size - ?", file.Size)).Error; err != nil {
-				return err
+		// 原父目录已不存在或仍在回收站中时，还原到根目录
+		if file.ParentID != 0 {
+			var count int64
+			tx.Model(&model.File{}).Where("id = ? AND user_id = ?", file.ParentID, userID).Count(&count)
+			if count == 0 {
+				if err := tx.Model(&model.File{}).Where("id = ?", file.ID).Update("parent_id", 0).Error; err != nil {
+					return err
+				}
+				return model.MoveSubtree(tx, &file, "/")
 			}
 		}
+		return nil
+	})
+}
 
-		// 5. 彻底删除数据库记录
-		return tx.Unscoped().Delete(&file).Error
+// PermanentDeleteFile 彻底删除文件 (文件夹连同其子树一并删除)
+func PermanentDeleteFile(userID uint, fileID uint) error {
+	var file model.File
+	if err := model.DB.Unscoped().Where("id = ? AND user_id = ?", fileID, userID).First(&file).Error; err != nil {
+		return errors.New("文件不存在")
+	}
+	if file.TreePath == "" {
+		return model.ErrTreePathMissing
+	}
+
+	var files []model.File
+	if err := model.DB.Unscoped().Where("user_id = ?", userID).Scopes(model.SubtreeScope(&file)).Find(&files).Error; err != nil {
+		return err
+	}
+
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		return purgeFiles(tx, files)
 	})
 }
 
@@ -606,7 +986,8 @@ func PermanentDeleteFile(userID uint, fileID uint) error {
 func BatchDeleteFiles(userID uint, ids []uint) error {
 	return model.DB.Transaction(func(tx *gorm.DB) error {
 		for _, id := range ids {
-			if err := DeleteFile(userID, id); err != nil {
+			// 已随父目录一同删除的项直接跳过
+			if err := deleteFile(tx, userID, id); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 				return err
 			}
 		}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+)
+
+// GrantRequest 站内共享请求，授权对象为用户 (UserID 或 Username) 或用户组 (GroupID) 之一
+type GrantRequest struct {
+	FileID     uint
+	UserID     uint
+	Username   string
+	GroupID    uint
+	Permission string
+}
+
+// FileGrantItem 文件夹的授权记录
+type FileGrantItem struct {
+	ID         uint      `json:"id"`
+	TargetType string    `json:"targetType"`
+	TargetID   uint      `json:"targetId"`
+	TargetName string    `json:"targetName"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// SharedFolder "与我共享" 列表中的文件夹
+type SharedFolder struct {
+	model.File
+	Permission string    `json:"permission"`
+	OwnerName  string    `json:"ownerName"`
+	SharedAt   time.Time `json:"sharedAt"`
+}
+
+// GrantFolder 将文件夹共享给用户或用户组，已存在的授权更新权限
+// 共享给用户组时，所有者须是该组成员
+func GrantFolder(ownerID uint, req GrantRequest) (*model.FileGrant, error) {
+	if req.Permission == "" {
+		req.Permission = model.PermissionRead
+	}
+	if req.Permission != model.PermissionRead && req.Permission != model.PermissionWrite {
+		return nil, errors.New("不支持的权限")
+	}
+
+	var folder model.File
+	if err := model.DB.Where("id = ? AND user_id = ?", req.FileID, ownerID).First(&folder).Error; err != nil {
+		return nil, errors.New("文件夹不存在")
+	}
+	if !folder.IsFolder {
+		return nil, errors.New("只能共享文件夹")
+	}
+
+	grant := model.FileGrant{FileID: folder.ID, OwnerID: ownerID, Permission: req.Permission}
+	var notify []uint
+	switch {
+	case req.GroupID != 0:
+		var group model.UserGroup
+		if err := model.DB.First(&group, req.GroupID).Error; err != nil {
+			return nil, errors.New("用户组不存在")
+		}
+		var member int64
+		model.DB.Model(&model.UserGroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, ownerID).Count(&member)
+		if member == 0 {
+			return nil, errors.New("只能共享给自己所在的用户组")
+		}
+		grant.TargetType, grant.TargetID = model.GrantTargetGroup, group.ID
+		model.DB.Model(&model.UserGroupMember{}).Where("group_id = ? AND user_id <> ?", group.ID, ownerID).Pluck("user_id", &notify)
+	case req.UserID != 0 || req.Username != "":
+		var user model.User
+		query := model.DB.Where("id = ?", req.UserID)
+		if req.Username != "" {
+			query = model.DB.Where("username = ?", req.Username)
+		}
+		if err := query.First(&user).Error; err != nil {
+			return nil, errors.New("用户不存在")
+		}
+		if user.ID == ownerID {
+			return nil, errors.New("不能共享给自己")
+		}
+		grant.TargetType, grant.TargetID = model.GrantTargetUser, user.ID
+		notify = []uint{user.ID}
+	default:
+		return nil, errors.New("请指定共享对象")
+	}
+
+	var existing model.FileGrant
+	err := model.DB.Where("file_id = ? AND target_type = ? AND target_id = ?", grant.FileID, grant.TargetType, grant.TargetID).
+		First(&existing).Error
+	if err == nil {
+		if err := model.DB.Model(&existing).Update("permission", grant.Permission).Error; err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	if err := model.DB.Create(&grant).Error; err != nil {
+		return nil, err
+	}
+
+	var owner model.User
+	model.DB.First(&owner, ownerID)
+	perm := "只读"
+	if grant.Permission == model.PermissionWrite {
+		perm = "读写"
+	}
+	for _, id := range notify {
+		_ = SendMessage(id, "新的共享文件夹", fmt.Sprintf("%s 将文件夹「%s」共享给了你 (%s)，可在「与我共享」中查看。", owner.Username, folder.Name, perm), "success")
+	}
+	return &grant, nil
+}
+
+// ListFolderGrants 列出文件夹的授权记录
+func ListFolderGrants(ownerID uint, fileID uint) ([]FileGrantItem, error) {
+	var folder model.File
+	if err := model.DB.Where("id = ? AND user_id = ?", fileID, ownerID).First(&folder).Error; err != nil {
+		return nil, errors.New("文件夹不存在")
+	}
+	var grants []model.FileGrant
+	if err := model.DB.Where("file_id = ? AND owner_id = ?", folder.ID, ownerID).Order("id ASC").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+
+	var userIDs, groupIDs []uint
+	for _, g := range grants {
+		if g.TargetType == model.GrantTargetGroup {
+			groupIDs = append(groupIDs, g.TargetID)
+		} else {
+			userIDs = append(userIDs, g.TargetID)
+		}
+	}
+	names := map[string]string{}
+	if len(userIDs) > 0 {
+		var users []model.User
+		model.DB.Select("id, username").Where("id IN ?", userIDs).Find(&users)
+		for _, u := range users {
+			names[fmt.Sprintf("%s:%d", model.GrantTargetUser, u.ID)] = u.Username
+		}
+	}
+	if len(groupIDs) > 0 {
+		var groups []model.UserGroup
+		model.DB.Select("id, name").Where("id IN ?", groupIDs).Find(&groups)
+		for _, g := range groups {
+			names[fmt.Sprintf("%s:%d", model.GrantTargetGroup, g.ID)] = g.Name
+		}
+	}
+
+	items := make([]FileGrantItem, 0, len(grants))
+	for _, g := range grants {
+		items = append(items, FileGrantItem{
+			ID:         g.ID,
+			TargetType: g.TargetType,
+			TargetID:   g.TargetID,
+			TargetName: names[fmt.Sprintf("%s:%d", g.TargetType, g.TargetID)],
+			Permission: g.Permission,
+			CreatedAt:  g.CreatedAt,
+		})
+	}
+	return items, nil
+}
+
+// RevokeGrant 取消共享
+func RevokeGrant(ownerID uint, grantID uint) error {
+	result := model.DB.Where("id = ? AND owner_id = ?", grantID, ownerID).Delete(&model.FileGrant{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("共享记录不存在")
+	}
+	return nil
+}
+
+// ListSharedWithMe 列出共享给用户本人及其所在用户组的文件夹，同一文件夹取最高权限
+func ListSharedWithMe(userID uint) ([]SharedFolder, error) {
+	cond, args := grantTargetScope(userID)
+	var grants []model.FileGrant
+	if err := model.DB.Where(cond, args...).Where("owner_id <> ?", userID).Order("created_at DESC, id DESC").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return []SharedFolder{}, nil
+	}
+
+	fileIDs := make([]uint, 0, len(grants))
+	for _, g := range grants {
+		fileIDs = append(fileIDs, g.FileID)
+	}
+	var files []model.File
+	if err := model.DB.Where("id IN ? AND is_folder = ?", fileIDs, true).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	filesByID := make(map[uint]model.File, len(files))
+	ownerIDs := make([]uint, 0, len(files))
+	for _, f := range files {
+		filesByID[f.ID] = f
+		ownerIDs = append(ownerIDs, f.UserID)
+	}
+	var owners []model.User
+	model.DB.Select("id, username").Where("id IN ?", ownerIDs).Find(&owners)
+	ownerNames := make(map[uint]string, len(owners))
+	for _, u := range owners {
+		ownerNames[u.ID] = u.Username
+	}
+
+	result := []SharedFolder{}
+	index := map[uint]int{}
+	for _, g := range grants {
+		f, ok := filesByID[g.FileID]
+		if !ok || f.UserID != g.OwnerID {
+			continue
+		}
+		if i, seen := index[f.ID]; seen {
+			if g.Permission == model.PermissionWrite {
+				result[i].Permission = model.PermissionWrite
+			}
+			continue
+		}
+		index[f.ID] = len(result)
+		result = append(result, SharedFolder{File: f, Permission: g.Permission, OwnerName: ownerNames[f.UserID], SharedAt: g.CreatedAt})
+	}
+	return result, nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"gorm.io/gorm"
+)
+
+// GroupItem 用户组及成员数量
+type GroupItem struct {
+	model.UserGroup
+	MemberCount int64 `json:"memberCount"`
+}
+
+// GroupMember 用户组成员
+type GroupMember struct {
+	UserID   uint   `json:"userId"`
+	Username string `json:"username"`
+	Avatar   string `json:"avatar"`
+}
+
+// validateGroupName 校验用户组名称
+func validateGroupName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > 50 {
+		return "", errors.New("组名长度须为 1-50 个字符")
+	}
+	return name, nil
+}
+
+// ListGroups 列出所有用户组
+func ListGroups() ([]GroupItem, error) {
+	groups := []GroupItem{}
+	err := model.DB.Model(&model.UserGroup{}).
+		Select("user_groups.*, (SELECT COUNT(*) FROM user_group_members m WHERE m.group_id = user_groups.id) AS member_count").
+		Order("user_groups.id ASC").Scan(&groups).Error
+	return groups, err
+}
+
+// ListUserGroups 列出用户所在的用户组
+func ListUserGroups(userID uint) ([]model.UserGroup, error) {
+	groups := []model.UserGroup{}
+	err := model.DB.Where("id IN (?)", model.DB.Model(&model.UserGroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Order("id ASC").Find(&groups).Error
+	return groups, err
+}
+
+// CreateGroup 创建用户组
+func CreateGroup(name string, description string) (*model.UserGroup, error) {
+	name, err := validateGroupName(name)
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	model.DB.Model(&model.UserGroup{}).Where("name = ?", name).Count(&count)
+	if count > 0 {
+		return nil, errors.New("组名已存在")
+	}
+	group := model.UserGroup{Name: name, Description: description}
+	if err := model.DB.Create(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// UpdateGroup 修改用户组名称与描述
+func UpdateGroup(groupID uint, name string, description string) error {
+	name, err := validateGroupName(name)
+	if err != nil {
+		return err
+	}
+	var count int64
+	model.DB.Model(&model.UserGroup{}).Where("name = ? AND id <> ?", name, groupID).Count(&count)
+	if count > 0 {
+		return errors.New("组名已存在")
+	}
+	result := model.DB.Model(&model.UserGroup{}).Where("id = ?", groupID).
+		Updates(map[string]interface{}{"name": name, "description": description})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("用户组不存在")
+	}
+	return nil
+}
+
+// DeleteGroup 删除用户组，同时移除成员关系与共享给该组的授权
+func DeleteGroup(groupID uint) error {
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&model.UserGroup{}, groupID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户组不存在")
+		}
+		if err := tx.Where("group_id = ?", groupID).Delete(&model.UserGroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("target_type = ? AND target_id = ?", model.GrantTargetGroup, groupID).Delete(&model.FileGrant{}).Error
+	})
+}
+
+// ListGroupMembers 列出用户组成员
+func ListGroupMembers(groupID uint) ([]GroupMember, error) {
+	members := []GroupMember{}
+	err := model.DB.Table("user_group_members").
+		Select("users.id AS user_id, users.username, users.avatar").
+		Joins("JOIN users ON users.id = user_group_members.user_id AND users.deleted_at IS NULL").
+		Where("user_group_members.group_id = ?", groupID).
+		Order("user_group_members.id ASC").Scan(&members).Error
+	return members, err
+}
+
+// AddGroupMembers 向用户组添加成员，已是成员的用户忽略
+func AddGroupMembers(groupID uint, userIDs []uint) error {
+	var group model.UserGroup
+	if err := model.DB.First(&group, groupID).Error; err != nil {
+		return errors.New("用户组不存在")
+	}
+	unique := map[uint]bool{}
+	for _, id := range userIDs {
+		unique[id] = true
+	}
+	if len(unique) == 0 {
+		return errors.New("请选择用户")
+	}
+	var users []model.User
+	if err := model.DB.Select("id").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return err
+	}
+	if len(users) != len(unique) {
+		return errors.New("用户不存在")
+	}
+	return model.DB.Transaction(func(tx *gorm.DB) error {
+		for _, u := range users {
+			var count int64
+			tx.Model(&model.UserGroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, u.ID).Count(&count)
+			if count > 0 {
+				continue
+			}
+			if err := tx.Create(&model.UserGroupMember{GroupID: group.ID, UserID: u.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveGroupMember 将用户移出用户组
+func RemoveGroupMember(groupID uint, userID uint) error {
+	result := model.DB.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&model.UserGroupMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("该用户不在用户组中")
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	indexWorkerCount   = 2
+	indexBatchSize     = 50
+	indexMaxAttempts   = 5
+	indexPollInterval  = 5 * time.Second
+	defaultIndexMaxMB  = 20
+	indexRebuildChunks = 500
+)
+
+// indexWake 有新任务时唤醒调度协程，避免等待轮询间隔
+var indexWake = make(chan struct{}, 1)
+
+// contentProcessors 文件内容变化后随索引任务在后台执行的处理 (如生成缩略图)，出错时自行记录日志
+var contentProcessors []func(file *model.File)
+
+func registerContentProcessor(fn func(file *model.File)) {
+	contentProcessors = append(contentProcessors, fn)
+}
+
+func wakeIndexer() {
+	select {
+	case indexWake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueIndex 在 tx 中提交索引同步任务，与文件变更在同一事务内落库，保证不会丢失
+// content 为 true 时重新抽取正文，否则只刷新属性；已有待处理任务时合并
+func enqueueIndex(tx *gorm.DB, fileIDs []uint, content bool) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	jobs := make([]model.IndexJob, 0, len(fileIDs))
+	for _, id := range fileIDs {
+		jobs = append(jobs, model.IndexJob{FileID: id, Content: content, Status: model.IndexJobPending, RunAt: now})
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "file_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"content":    gorm.Expr("content OR " + model.UpsertValue(tx, "content")),
+			"status":     model.IndexJobPending,
+			"run_at":     now,
+			"attempts":   0,
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": now,
+		}),
+	}).CreateInBatches(jobs, indexRebuildChunks).Error
+	if err != nil {
+		return err
+	}
+	wakeIndexer()
+	return nil
+}
+
+// ReindexAttributes 文件属性 (名称、位置、收藏、标签等) 变化后刷新索引
+func ReindexAttributes(fileIDs ...uint) {
+	if err := enqueueIndex(model.DB, fileIDs, false); err != nil {
+		log.Printf("[Index] 提交索引任务失败: %v", err)
+	}
+}
+
+// subtreeFileIDs 获取子树内所有文件 (不含文件夹) 的 ID，unscoped 为 true 时包含回收站中的记录
+func subtreeFileIDs(tx *gorm.DB, root *model.File, unscoped bool) []uint {
+	db := tx.Model(&model.File{})
+	if unscoped {
+		db = db.Unscoped()
+	}
+	var ids []uint
+	db.Scopes(model.SubtreeScope(root)).Where("is_folder = ?", false).Pluck("id", &ids)
+	return ids
+}
+
+// startIndexWorkers 启动索引调度协程，按批取出到期任务交给工作协程处理
+func startIndexWorkers() {
+	// 任务保存在数据库中，重启后未完成的任务会继续执行
+	go func() {
+		for {
+			var jobs []model.IndexJob
+			model.DB.Where("status = ? AND run_at <= ?", model.IndexJobPending, time.Now()).
+				Order("run_at ASC, id ASC").Limit(indexBatchSize).Find(&jobs)
+			if len(jobs) == 0 {
+				select {
+				case <-indexWake:
+				case <-time.After(indexPollInterval):
+				}
+				continue
+			}
+
+			var wg sync.WaitGroup
+			ch := make(chan model.IndexJob)
+			for i := 0; i < indexWorkerCount; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for job := range ch {
+						runIndexJob(job)
+					}
+				}()
+			}
+			for _, job := range jobs {
+				ch <- job
+			}
+			close(ch)
+			wg.Wait()
+		}
+	}()
+}
+
+// runIndexJob 执行索引任务，成功后删除任务，失败时按指数退避重试，超过次数标记为失败
+func runIndexJob(job model.IndexJob) {
+	err := syncIndex(job.FileID, job.Content)
+	if err == nil {
+		// 处理期间被重新提交 (version 变化) 的任务保留，下一轮再处理
+		model.DB.Where("id = ? AND version = ?", job.ID, job.Version).Delete(&model.IndexJob{})
+		return
+	}
+
+	attempts := job.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts": attempts,
+		"error":    truncateError(err.Error()),
+		"run_at":   time.Now().Add(time.Duration(attempts*attempts) * 30 * time.Second),
+	}
+	if attempts >= indexMaxAttempts {
+		updates["status"] = model.IndexJobFailed
+		log.Printf("[Index] 文件 %d 建立索引失败，已放弃: %v", job.FileID, err)
+	}
+	model.DB.Model(&model.IndexJob{}).Where("id = ? AND version = ?", job.ID, job.Version).Updates(updates)
+}
+
+func truncateError(msg string) string {
+	if len(msg) > 500 {
+		return msg[:500]
+	}
+	return msg
+}
+
+// indexMaxFileSize 参与正文抽取的文件大小上限，超出时只索引文件名、标签与元数据
+func indexMaxFileSize() int64 {
+	mb, err := strconv.ParseInt(model.GetConfig("index_max_file_size", strconv.Itoa(defaultIndexMaxMB)), 10, 64)
+	if err != nil || mb < 0 {
+		mb = defaultIndexMaxMB
+	}
+	return mb * 1024 * 1024
+}
+
+// syncIndex 使索引与数据库中的文件保持一致：文件不存在 (已删除) 时移出索引，
+// 需要正文或索引中尚无该文件时完整建立索引，否则只刷新属性；内容变化时同时执行 contentProcessors
+func syncIndex(fileID uint, content bool) error {
+	var file model.File
+	if err := model.DB.First(&file, fileID).Error; err != nil || file.IsFolder {
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		return utils.RemoveFromIndex(fileID)
+	}
+
+	if content {
+		for _, process := range contentProcessors {
+			process(&file)
+		}
+	}
+
+	if !content && utils.IsIndexed(fileID) {
+		return utils.UpdateIndexAttributes(buildSearchDocument(&file, ""))
+	}
+
+	doc := buildSearchDocument(&file, "")
+	if file.Size <= indexMaxFileSize() && file.Path != "" {
+		data, err := readFileData(&file)
+		if err != nil {
+			return err
+		}
+		doc.Data = data
+	}
+	return utils.IndexFile(doc)
+}
+
+// readFileData 通过存储驱动读取文件全部内容
+func readFileData(file *model.File) ([]byte, error) {
+	d, err := getPolicyDriver(file.PolicyID)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := d.Get(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, file.Size))
+}
+
+// seekableFile 支持随机读取的文件内容
+type seekableFile interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// errSpoolTooLarge 文件需要缓存到本地但超过大小上限
+var errSpoolTooLarge = errors.New("文件过大，无法处理")
+
+// openSeekable 打开文件用于随机读取，驱动返回的数据流不支持时缓存到临时文件
+// 需要缓存且文件超过 maxSpool 时返回 errSpoolTooLarge
+func openSeekable(file *model.File, maxSpool int64) (seekableFile, func(), error) {
+	d, err := getPolicyDriver(file.PolicyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := d.Get(file.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sf, ok := rc.(seekableFile); ok {
+		return sf, func() { rc.Close() }, nil
+	}
+	defer rc.Close()
+
+	if file.Size > maxSpool {
+		return nil, nil, errSpoolTooLarge
+	}
+	tmp, err := os.CreateTemp("", "netdisk-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	if _, err := io.Copy(tmp, io.LimitReader(rc, file.Size)); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return tmp, cleanup, nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestEnqueueIndex(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:enqueue_index?mode=memory"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.IndexJob{}))
+
+	job := func(fileID uint) model.IndexJob {
+		var j model.IndexJob
+		require.NoError(t, db.Where("file_id = ?", fileID).First(&j).Error)
+		return j
+	}
+
+	require.NoError(t, enqueueIndex(db, []uint{1, 2}, true))
+	require.NoError(t, db.Model(&model.IndexJob{}).Where("file_id = ?", 1).
+		Updates(map[string]interface{}{"status": model.IndexJobFailed, "attempts": 3}).Error)
+
+	// 重复提交合并为同一条任务：保留正文抽取标记，重置状态并递增版本
+	require.NoError(t, enqueueIndex(db, []uint{1, 3}, false))
+	var count int64
+	db.Model(&model.IndexJob{}).Count(&count)
+	assert.EqualValues(t, 3, count)
+
+	merged := job(1)
+	assert.True(t, merged.Content)
+	assert.Equal(t, model.IndexJobPending, merged.Status)
+	assert.Equal(t, 0, merged.Attempts)
+	assert.Equal(t, 1, merged.Version)
+	assert.False(t, job(3).Content)
+
+	require.NoError(t, enqueueIndex(db, []uint{3}, true))
+	assert.True(t, job(3).Content)
+	assert.Equal(t, 0, job(2).Version)
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// ListQuery 列表分页、排序与筛选参数
+type ListQuery struct {
+	Cursor   string     // 上一页返回的游标
+	Limit    int        // 每页数量
+	SortBy   string     // 排序字段
+	Order    string     // asc / desc
+	Category string     // 文件类别筛选
+	Tag      string     // 标签筛选
+	From     *time.Time // 时间范围起点
+	To       *time.Time // 时间范围终点
+	Keyword  string     // 关键字筛选 (管理员列表)
+	Status   *int       // 状态筛选 (管理员列表)
+	Role     string     // 角色筛选 (用户列表)
+	UserID   uint       // 用户筛选 (分享列表)
+}
+
+// Page 分页信息
+type Page struct {
+	NextCursor string `json:"nextCursor"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// sortField 排序字段，Value 用于从最后一行取出游标值
+type sortField[T any] struct {
+	Column string
+	Desc   bool
+	Value  func(row *T) interface{}
+}
+
+func (q ListQuery) desc() bool {
+	return strings.EqualFold(q.Order, "desc")
+}
+
+// descOr 未指定排序方向时使用默认方向
+func (q ListQuery) descOr(def bool) bool {
+	if q.Order == "" {
+		return def
+	}
+	return q.desc()
+}
+
+func (q ListQuery) limit() int {
+	if q.Limit <= 0 {
+		return defaultPageSize
+	}
+	if q.Limit > maxPageSize {
+		return maxPageSize
+	}
+	return q.Limit
+}
+
+// encodeCursor 将最后一行的排序值编码为游标
+func encodeCursor(values []interface{}) string {
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor 解析游标
+func decodeCursor(cursor string, n int) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("游标无效")
+	}
+	var values []interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil || len(values) != n {
+		return nil, errors.New("游标无效")
+	}
+	for i, v := range values {
+		if num, ok := v.(json.Number); ok {
+			if iv, err := num.Int64(); err == nil {
+				values[i] = iv
+			} else if fv, err := num.Float64(); err == nil {
+				values[i] = fv
+			}
+		}
+	}
+	return values, nil
+}
+
+// cursorTime 游标中的时间统一使用数据库可直接比较的格式
+func cursorTime(t time.Time) interface{} {
+	return t.Format("2006-01-02 15:04:05.000")
+}
+
+func cursorBool(b bool) interface{} {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// paginate 基于游标 (keyset) 分页，按 fields 依次排序，最后一个字段须唯一
+func paginate[T any](db *gorm.DB, q ListQuery, fields []sortField[T]) ([]T, Page, error) {
+	if q.Cursor != "" {
+		values, err := decodeCursor(q.Cursor, len(fields))
+		if err != nil {
+			return nil, Page{}, err
+		}
+		// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+		var conds []string
+		var args []interface{}
+		for i, f := range fields {
+			var parts []string
+			for j := 0; j < i; j++ {
+				parts = append(parts, fields[j].Column+" = ?")
+				args = append(args, values[j])
+			}
+			op := " > ?"
+			if f.Desc {
+				op = " < ?"
+			}
+			parts = append(parts, f.Column+op)
+			args = append(args, values[i])
+			conds = append(conds, "("+strings.Join(parts, " AND ")+")")
+		}
+		db = db.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+
+	for _, f := range fields {
+		if f.Desc {
+			db = db.Order(f.Column + " DESC")
+		} else {
+			db = db.Order(f.Column + " ASC")
+		}
+	}
+
+	limit := q.limit()
+	var rows []T
+	if err := db.Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, Page{}, err
+	}
+
+	var page Page
+	if len(rows) > limit {
+		rows = rows[:limit]
+		page.HasMore = true
+		last := &rows[len(rows)-1]
+		values := make([]interface{}, 0, len(fields))
+		for _, f := range fields {
+			values = append(values, f.Value(last))
+		}
+		page.NextCursor = encodeCursor(values)
+	}
+	if rows == nil {
+		rows = []T{}
+	}
+	return rows, page, nil
+}
+
+// fileSortFields 文件列表排序字段：文件夹始终在前，ID 兜底保证顺序唯一
+// timeColumn 为按时间排序时使用的列 (回收站按删除时间)
+func fileSortFields(q ListQuery, timeColumn string) []sortField[model.File] {
+	desc := q.desc()
+	fields := []sortField[model.File]{
+		{Column: "files.is_folder", Desc: true, Value: func(f *model.File) interface{} { return cursorBool(f.IsFolder) }},
+	}
+
+	switch q.SortBy {
+	case "size":
+		fields = append(fields, sortField[model.File]{Column: "files.size", Desc: desc, Value: func(f *model.File) interface{} { return f.Size }})
+	case "time", "updatedAt", "modified":
+		if timeColumn == "files.deleted_at" {
+			fields = append(fields, sortField[model.File]{Column: timeColumn, Desc: desc, Value: func(f *model.File) interface{} { return cursorTime(f.DeletedAt.Time) }})
+		} else {
+			fields = append(fields, sortField[model.File]{Column: timeColumn, Desc: desc, Value: func(f *model.File) interface{} { return cursorTime(f.UpdatedAt) }})
+		}
+	case "type":
+		fields = append(fields,
+			sortField[model.File]{Column: "files.ext", Desc: desc, Value: func(f *model.File) interface{} { return f.Ext }},
+			sortField[model.File]{Column: "files.name", Desc: desc, Value: func(f *model.File) interface{} { return f.Name }},
+		)
+	default:
+		fields = append(fields, sortField[model.File]{Column: "files.name", Desc: desc, Value: func(f *model.File) interface{} { return f.Name }})
+	}
+
+	return append(fields, sortField[model.File]{Column: "files.id", Desc: desc, Value: func(f *model.File) interface{} { return f.ID }})
+}
+
+// applyFileFilters 追加文件类别、标签与时间范围筛选
+func applyFileFilters(db *gorm.DB, q ListQuery, timeColumn string) (*gorm.DB, error) {
+	if q.Category != "" {
+		if !utils.IsValidCategory(q.Category) {
+			return nil, errors.New("不支持的文件类别")
+		}
+		db = db.Where("files.is_folder = ? AND files.category = ?", false, q.Category)
+	}
+	if q.Tag != "" {
+		db = db.Where("EXISTS (SELECT 1 FROM file_tags t WHERE t.file_id = files.id AND t.name = ?)", normalizeTag(q.Tag))
+	}
+	if q.From != nil {
+		db = db.Where(timeColumn+" >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where(timeColumn+" <= ?", *q.To)
+	}
+	return db, nil
+}
+
+// listFiles 按统一的筛选、排序与分页规则查询文件
+func listFiles(db *gorm.DB, q ListQuery, timeColumn string) ([]model.File, Page, error) {
+	db, err := applyFileFilters(db, q, timeColumn)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	return paginate(db.Preload("Tags").Preload("Meta").Preload("Media"), q, fileSortFields(q, timeColumn))
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultMediaMaxMB   = 512
+	defaultPlaceRadius  = 1.0
+	maxPlaceRadius      = 500.0
+	timelineGroupDay    = "day"
+	timelineGroupMonth  = "month"
+	mediaTakenAtColumn  = "COALESCE(file_media.captured_at, files.created_at)"
+	mediaJoinFileMedias = "LEFT JOIN file_media ON file_media.file_id = files.id"
+)
+
+func init() {
+	registerContentProcessor(extractMedia)
+}
+
+// TimelineGroup 时间线中同一日期 (或月份) 的照片
+type TimelineGroup struct {
+	Date  string       `json:"date"`
+	Files []model.File `json:"files"`
+}
+
+// TimelineCount 时间线各日期的照片数量
+type TimelineCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// GeoBounds 经纬度范围
+type GeoBounds struct {
+	MinLat float64 `json:"minLat"`
+	MaxLat float64 `json:"maxLat"`
+	MinLng float64 `json:"minLng"`
+	MaxLng float64 `json:"maxLng"`
+}
+
+// PlaceAlbum 按拍摄地点聚合的相册
+type PlaceAlbum struct {
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Count     int       `json:"count"`
+	CoverID   uint      `json:"coverId"`
+	Bounds    GeoBounds `json:"bounds"`
+}
+
+// mediaMaxFileSize 远程存储中的文件需先缓存到本地临时文件再解析，超出上限时跳过
+func mediaMaxFileSize() int64 {
+	mb, err := strconv.ParseInt(model.GetConfig("media_max_file_size", strconv.Itoa(defaultMediaMaxMB)), 10, 64)
+	if err != nil || mb < 0 {
+		mb = defaultMediaMaxMB
+	}
+	return mb * 1024 * 1024
+}
+
+// hasMediaInfo 判断文件是否属于需要解析元数据的媒体类型
+func hasMediaInfo(file *model.File) bool {
+	if file.IsFolder || file.Path == "" {
+		return false
+	}
+	switch file.Category {
+	case utils.CategoryImage, utils.CategoryVideo, utils.CategoryAudio:
+		return true
+	}
+	return false
+}
+
+// extractMedia 文件内容变化后在后台解析媒体元数据，无法解析时清除旧记录
+func extractMedia(file *model.File) {
+	if !hasMediaInfo(file) {
+		model.DB.Where("file_id = ?", file.ID).Delete(&model.FileMedia{})
+		return
+	}
+
+	r, cleanup, err := openSeekable(file, mediaMaxFileSize())
+	if err != nil {
+		if err != errSpoolTooLarge {
+			log.Printf("[Media] 读取文件 %d 失败: %v", file.ID, err)
+		}
+		return
+	}
+	info, err := utils.ParseMedia(r, file.MimeType)
+	cleanup()
+	if err != nil {
+		model.DB.Where("file_id = ?", file.ID).Delete(&model.FileMedia{})
+		return
+	}
+
+	media := model.FileMedia{
+		FileID:      file.ID,
+		UserID:      file.UserID,
+		Width:       info.Width,
+		Height:      info.Height,
+		Duration:    info.Duration,
+		Codec:       truncateRunes(info.Codec, 50),
+		CapturedAt:  info.CapturedAt,
+		CameraMake:  truncateRunes(info.CameraMake, 100),
+		CameraModel: truncateRunes(info.CameraModel, 100),
+		Latitude:    info.Latitude,
+		Longitude:   info.Longitude,
+		Title:       truncateRunes(info.Title, 255),
+		Artist:      truncateRunes(info.Artist, 255),
+		Album:       truncateRunes(info.Album, 255),
+		Genre:       truncateRunes(info.Genre, 100),
+		Year:        info.Year,
+		Track:       info.Track,
+	}
+	err = model.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "file_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"user_id", "width", "height", "duration", "codec", "captured_at", "camera_make", "camera_model",
+			"latitude", "longitude", "title", "artist", "album", "genre", "year", "track", "updated_at",
+		}),
+	}).Create(&media).Error
+	if err != nil {
+		log.Printf("[Media] 保存文件 %d 的媒体信息失败: %v", file.ID, err)
+	}
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// photoQuery 用户的照片与视频，关联媒体信息
+func photoQuery(userID uint, category string) (*gorm.DB, error) {
+	db := model.DB.Model(&model.File{}).Select("files.*").Joins(mediaJoinFileMedias).
+		Where("files.user_id = ? AND files.is_folder = ?", userID, false)
+	switch category {
+	case "":
+		db = db.Where("files.category IN ?", []string{utils.CategoryImage, utils.CategoryVideo})
+	case utils.CategoryImage, utils.CategoryVideo:
+		db = db.Where("files.category = ?", category)
+	default:
+		return nil, errors.New("时间线只支持图片与视频")
+	}
+	return db, nil
+}
+
+// takenAt 拍摄时间，没有 EXIF 时以上传时间代替
+func takenAt(f *model.File) time.Time {
+	if f.Media != nil && f.Media.CapturedAt != nil {
+		return *f.Media.CapturedAt
+	}
+	return f.CreatedAt
+}
+
+func timelineLayout(group string) (string, string, error) {
+	switch group {
+	case "", timelineGroupDay:
+		return "2006-01-02", "%Y-%m-%d", nil
+	case timelineGroupMonth:
+		return "2006-01", "%Y-%m", nil
+	}
+	return "", "", errors.New("不支持的分组方式")
+}
+
+// PhotoTimeline 按拍摄时间倒序列出照片并按日期 (或月份) 分组
+// 同一日期的照片可能跨页，客户端按 date 合并相邻分组
+func PhotoTimeline(userID uint, group string, q ListQuery) ([]TimelineGroup, Page, error) {
+	layout, _, err := timelineLayout(group)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	db, err := photoQuery(userID, q.Category)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	if q.From != nil {
+		db = db.Where(mediaTakenAtColumn+" >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where(mediaTakenAtColumn+" <= ?", *q.To)
+	}
+
+	desc := q.descOr(true)
+	files, page, err := paginate(db.Preload("Media").Preload("Tags"), q, []sortField[model.File]{
+		{Column: mediaTakenAtColumn, Desc: desc, Value: func(f *model.File) interface{} { return cursorTime(takenAt(f)) }},
+		{Column: "files.id", Desc: desc, Value: func(f *model.File) interface{} { return f.ID }},
+	})
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	groups := []TimelineGroup{}
+	for _, f := range files {
+		date := takenAt(&f).Format(layout)
+		if n := len(groups); n > 0 && groups[n-1].Date == date {
+			groups[n-1].Files = append(groups[n-1].Files, f)
+			continue
+		}
+		groups = append(groups, TimelineGroup{Date: date, Files: []model.File{f}})
+	}
+	return groups, page, nil
+}
+
+// TimelineSummary 统计时间线各日期 (或月份) 的照片数量，用于时间轴导航
+func TimelineSummary(userID uint, group string, category string) ([]TimelineCount, error) {
+	_, format, err := timelineLayout(group)
+	if err != nil {
+		return nil, err
+	}
+	db, err := photoQuery(userID, category)
+	if err != nil {
+		return nil, err
+	}
+	expr := "DATE_FORMAT(" + mediaTakenAtColumn + ", '" + format + "')"
+	rows := []TimelineCount{}
+	err = db.Select(expr + " AS date, COUNT(*) AS count").Group(expr).Order("date DESC").Scan(&rows).Error
+	return rows, err
+}
+
+// ListPlaceAlbums 按拍摄地点聚合带 GPS 信息的照片，radiusKm 为聚合半径
+func ListPlaceAlbums(userID uint, radiusKm float64) ([]PlaceAlbum, error) {
+	if radiusKm <= 0 {
+		radiusKm = defaultPlaceRadius
+	}
+	if radiusKm > maxPlaceRadius {
+		radiusKm = maxPlaceRadius
+	}
+
+	var rows []struct {
+		ID        uint
+		Latitude  float64
+		Longitude float64
+	}
+	err := model.DB.Model(&model.File{}).
+		Select("files.id, file_media.latitude, file_media.longitude").
+		Joins("JOIN file_media ON file_media.file_id = files.id").
+		Where("files.user_id = ? AND file_media.latitude IS NOT NULL AND file_media.longitude IS NOT NULL", userID).
+		Order(mediaTakenAtColumn + " DESC, files.id DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]utils.GeoPoint, 0, len(rows))
+	coords := make(map[uint]utils.GeoPoint, len(rows))
+	for _, row := range rows {
+		p := utils.GeoPoint{ID: row.ID, Lat: row.Latitude, Lng: row.Longitude}
+		points = append(points, p)
+		coords[row.ID] = p
+	}
+
+	clusters := utils.ClusterPoints(points, radiusKm)
+	albums := make([]PlaceAlbum, 0, len(clusters))
+	for _, c := range clusters {
+		// 成员按拍摄时间倒序加入，第一张为最新的照片
+		album := PlaceAlbum{Latitude: c.Lat, Longitude: c.Lng, Count: len(c.IDs), CoverID: c.IDs[0]}
+		for i, id := range c.IDs {
+			p := coords[id]
+			if i == 0 {
+				album.Bounds = GeoBounds{MinLat: p.Lat, MaxLat: p.Lat, MinLng: p.Lng, MaxLng: p.Lng}
+				continue
+			}
+			album.Bounds.MinLat = min(album.Bounds.MinLat, p.Lat)
+			album.Bounds.MaxLat = max(album.Bounds.MaxLat, p.Lat)
+			album.Bounds.MinLng = min(album.Bounds.MinLng, p.Lng)
+			album.Bounds.MaxLng = max(album.Bounds.MaxLng, p.Lng)
+		}
+		albums = append(albums, album)
+	}
+	return albums, nil
+}
+
+// ListPlaceFiles 列出拍摄地点位于指定范围内的照片，按拍摄时间倒序
+func ListPlaceFiles(userID uint, bounds GeoBounds, q ListQuery) ([]model.File, Page, error) {
+	if bounds.MinLat > bounds.MaxLat || bounds.MinLng > bounds.MaxLng {
+		return nil, Page{}, errors.New("坐标范围不合法")
+	}
+	db := model.DB.Model(&model.File{}).Select("files.*").
+		Joins("JOIN file_media ON file_media.file_id = files.id").
+		Where("files.user_id = ?", userID).
+		Where("file_media.latitude BETWEEN ? AND ? AND file_media.longitude BETWEEN ? AND ?",
+			bounds.MinLat, bounds.MaxLat, bounds.MinLng, bounds.MaxLng)
+
+	desc := q.descOr(true)
+	return paginate(db.Preload("Media").Preload("Tags"), q, []sortField[model.File]{
+		{Column: mediaTakenAtColumn, Desc: desc, Value: func(f *model.File) interface{} { return cursorTime(takenAt(f)) }},
+		{Column: "files.id", Desc: desc, Value: func(f *model.File) interface{} { return f.ID }},
+	})
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+)
+
+// Breadcrumb 面包屑节点
+type Breadcrumb struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// splitPath 将斜杠分隔的路径拆分为各级名称，忽略空段和 "."，拒绝 ".."
+func splitPath(p string) ([]string, error) {
+	var parts []string
+	for _, part := range strings.Split(strings.ReplaceAll(p, "\\", "/"), "/") {
+		part = strings.TrimSpace(part)
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return nil, errors.New("路径不合法")
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// validateFileName 校验文件名，路径分隔符会导致无法按路径寻址
+func validateFileName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." {
+		return errors.New("文件名不合法")
+	}
+	if strings.ContainsAny(name, "/\\") {
+		return errors.New("文件名不能包含 / 或 \\")
+	}
+	return nil
+}
+
+// ResolvePath 将斜杠分隔的路径解析为文件记录，根目录返回 nil
+func ResolvePath(userID uint, p string) (*model.File, error) {
+	parts, err := splitPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var current *model.File
+	var parentID uint
+	for i, name := range parts {
+		query := model.DB.Where("user_id = ? AND parent_id = ? AND name = ?", userID, parentID, name)
+		// 中间段必须是文件夹，同名时优先匹配文件夹
+		if i < len(parts)-1 {
+			query = query.Where("is_folder = ?", true)
+		}
+		var f model.File
+		if err := query.Order("is_folder DESC, id ASC").First(&f).Error; err != nil {
+			return nil, errors.New("路径不存在")
+		}
+		current = &f
+		parentID = f.ID
+	}
+	return current, nil
+}
+
+// ResolveFolderPath 解析目录路径，返回目录 ID (根目录为 0)
+func ResolveFolderPath(userID uint, p string) (uint, error) {
+	folder, err := ResolvePath(userID, p)
+	if err != nil {
+		return 0, err
+	}
+	if folder == nil {
+		return 0, nil
+	}
+	if !folder.IsFolder {
+		return 0, errors.New("目标不是文件夹")
+	}
+	return folder.ID, nil
+}
+
+// GetBreadcrumbs 获取由根目录到指定文件或目录的面包屑，fileID 为 0 时只返回根目录
+// 共享给自己的文件由授权的文件夹开始，不包含所有者的根目录
+func GetBreadcrumbs(userID uint, fileID uint) ([]Breadcrumb, error) {
+	crumbs := []Breadcrumb{{ID: 0, Name: "/", Path: "/"}}
+	if fileID == 0 {
+		return crumbs, nil
+	}
+
+	access, err := AuthorizeFile(userID, fileID, model.PermissionRead)
+	if err != nil {
+		return nil, errors.New("目录不存在")
+	}
+	chain, err := model.GetBreadcrumbs(model.DB.Where("user_id = ?", access.File.UserID), access.File)
+	if err != nil {
+		return nil, err
+	}
+	if !access.IsOwner() {
+		crumbs = nil
+		for i, f := range chain {
+			if f.ID == access.GrantRoot {
+				chain = chain[i:]
+				break
+			}
+		}
+	}
+
+	p := ""
+	for _, f := range chain {
+		p += "/" + f.Name
+		crumbs = append(crumbs, Breadcrumb{ID: f.ID, Name: f.Name, Path: p})
+	}
+	return crumbs, nil
+}
+
+// GetFilePath 获取文件的完整路径及面包屑
+func GetFilePath(userID uint, fileID uint) (string, []Breadcrumb, error) {
+	crumbs, err := GetBreadcrumbs(userID, fileID)
+	if err != nil {
+		return "", nil, errors.New("文件不存在")
+	}
+	return crumbs[len(crumbs)-1].Path, crumbs, nil
+}
+
+// 同名冲突处理策略
+const (
+	ConflictRename    = "rename"    // 自动重命名为 "名称 (n).扩展名"
+	ConflictSkip      = "skip"      // 跳过
+	ConflictOverwrite = "overwrite" // 覆盖，原文件移入回收站
+)
+
+// parseConflictPolicy 校验冲突处理策略，未指定时自动重命名
+func parseConflictPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return ConflictRename, nil
+	case ConflictRename, ConflictSkip, ConflictOverwrite:
+		return policy, nil
+	}
+	return "", errors.New("不支持的冲突处理方式")
+}
+
+// uniqueName 在目录中为 name 生成不重名的名称，如 "报告 (1).docx"
+func uniqueName(userID uint, parentID uint, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base, ext = name, ""
+	}
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		var count int64
+		model.DB.Model(&model.File{}).Where("user_id = ? AND parent_id = ? AND name = ?", userID, parentID, candidate).Count(&count)
+		if count == 0 {
+			return candidate
+		}
+	}
+}
+
+// resolveNameConflict 按策略处理目标目录中的同名项
+// 文件夹与同名文件夹合并 (返回 existing)；skip 为 true 时调用方应跳过该项
+func resolveNameConflict(userID uint, parentID uint, name string, isFolder bool, policy string) (finalName string, existing *model.File, skip bool, err error) {
+	var same model.File
+	if err := model.DB.Where("user_id = ? AND parent_id = ? AND name = ?", userID, parentID, name).
+		Order("is_folder DESC, id ASC").First(&same).Error; err != nil {
+		return name, nil, false, nil
+	}
+	if isFolder && same.IsFolder {
+		return name, &same, false, nil
+	}
+
+	switch policy {
+	case ConflictSkip:
+		return "", nil, true, nil
+	case ConflictOverwrite:
+		// 只有文件可以覆盖文件，文件夹与文件之间的冲突仍然重命名
+		if !isFolder && !same.IsFolder {
+			if err := DeleteFile(userID, same.ID); err != nil {
+				return "", nil, false, err
+			}
+			return name, nil, false, nil
+		}
+	}
+	return uniqueName(userID, parentID, name), nil, false, nil
+}
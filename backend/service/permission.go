@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+)
+
+// ErrPermissionDenied 对共享给自己的文件没有所需的权限
+var ErrPermissionDenied = errors.New("没有操作权限")
+
+// FileAccess 用户对文件的访问权限
+type FileAccess struct {
+	File       *model.File
+	Permission string // 所有者视为 write
+	GrantRoot  uint   // 通过站内共享获得权限时为授权的文件夹 ID，所有者为 0
+}
+
+// IsOwner 是否为文件所有者
+func (a *FileAccess) IsOwner() bool {
+	return a.GrantRoot == 0
+}
+
+// IsGrantRoot 文件是否为授权的文件夹本身，被授权者不能重命名或删除它
+func (a *FileAccess) IsGrantRoot() bool {
+	return a.GrantRoot != 0 && a.GrantRoot == a.File.ID
+}
+
+// liveChain 检查由 rootID (含) 到 target 父级之间的每一级目录都未被删除且属于 ownerID
+// rootID 为 target 自身时只要求 target 存在
+func liveChain(ownerID uint, rootID uint, target *model.File) bool {
+	if rootID == target.ID {
+		return true
+	}
+	ids := target.AncestorIDs()
+	var chain []uint
+	for i, id := range ids {
+		if id == rootID {
+			chain = ids[i:]
+			break
+		}
+	}
+	if len(chain) == 0 {
+		return false
+	}
+	var alive int64
+	model.DB.Model(&model.File{}).Where("id IN ? AND user_id = ? AND is_folder = ?", chain, ownerID, true).Count(&alive)
+	return alive == int64(len(chain))
+}
+
+// userGroupIDs 用户所属的用户组
+func userGroupIDs(userID uint) []uint {
+	var ids []uint
+	model.DB.Model(&model.UserGroupMember{}).Where("user_id = ?", userID).Pluck("group_id", &ids)
+	return ids
+}
+
+// grantTargetScope 限定授权对象为用户本人或其所属的用户组
+func grantTargetScope(userID uint) (string, []interface{}) {
+	groups := userGroupIDs(userID)
+	if len(groups) == 0 {
+		return "(file_grants.target_type = ? AND file_grants.target_id = ?)", []interface{}{model.GrantTargetUser, userID}
+	}
+	return "((file_grants.target_type = ? AND file_grants.target_id = ?) OR (file_grants.target_type = ? AND file_grants.target_id IN ?))",
+		[]interface{}{model.GrantTargetUser, userID, model.GrantTargetGroup, groups}
+}
+
+// AuthorizeFile 校验用户对文件的权限 (need 为 read 或 write)
+// 所有者拥有全部权限；其他用户须被授权访问该文件或其某一级祖先文件夹，
+// 且授权的文件夹到目标之间没有被删除的目录。无权访问的文件一律视为不存在
+func AuthorizeFile(userID uint, fileID uint, need string) (*FileAccess, error) {
+	var file model.File
+	if err := model.DB.First(&file, fileID).Error; err != nil {
+		return nil, ErrFileNotFound
+	}
+	if file.UserID == userID {
+		return &FileAccess{File: &file, Permission: model.PermissionWrite}, nil
+	}
+
+	cond, args := grantTargetScope(userID)
+	var grants []model.FileGrant
+	model.DB.Where("file_id IN ? AND owner_id = ?", append(file.AncestorIDs(), file.ID), file.UserID).
+		Where(cond, args...).Find(&grants)
+
+	var access *FileAccess
+	for _, g := range grants {
+		if !liveChain(file.UserID, g.FileID, &file) {
+			continue
+		}
+		// 同时存在多个授权时取最高权限
+		if access == nil || (access.Permission == model.PermissionRead && g.Permission == model.PermissionWrite) {
+			access = &FileAccess{File: &file, Permission: g.Permission, GrantRoot: g.FileID}
+		}
+	}
+	if access == nil {
+		return nil, ErrFileNotFound
+	}
+	if need == model.PermissionWrite && access.Permission != model.PermissionWrite {
+		return nil, ErrPermissionDenied
+	}
+	return access, nil
+}
+
+// writableFolderOwner 校验用户可以向目标目录写入，返回目录所有者 (0 表示用户自己的根目录)
+// 写入共享给自己的文件夹时，新文件归属并占用文件夹所有者的空间
+func writableFolderOwner(userID uint, parentID uint) (uint, error) {
+	if parentID == 0 {
+		return userID, nil
+	}
+	access, err := AuthorizeFile(userID, parentID, model.PermissionWrite)
+	if errors.Is(err, ErrPermissionDenied) {
+		return 0, err
+	}
+	if err != nil || !access.File.IsFolder {
+		return 0, errors.New("目标文件夹不存在")
+	}
+	return access.File.UserID, nil
+}
+
+// authorizeFiles 逐项校验用户对所选文件的权限，不存在或无权查看的文件 ID 记入 missing
+// 缺少所需权限 (如只读授权下修改) 时直接返回 ErrPermissionDenied
+func authorizeFiles(userID uint, fileIDs []uint, need string) ([]*model.File, []uint, error) {
+	var files []*model.File
+	var missing []uint
+	for _, id := range fileIDs {
+		access, err := AuthorizeFile(userID, id, need)
+		if errors.Is(err, ErrFileNotFound) {
+			missing = append(missing, id)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, access.File)
+	}
+	return files, missing, nil
+}
+
+// selectionOwner 所选文件的共同所有者，没有文件时为用户自己
+// 打包、压缩等操作按所有者展开文件夹，所选文件须属于同一所有者 (同一目录中的文件总是如此)
+func selectionOwner(userID uint, files []*model.File) (uint, error) {
+	if len(files) == 0 {
+		return userID, nil
+	}
+	ownerID := files[0].UserID
+	for _, f := range files[1:] {
+		if f.UserID != ownerID {
+			return 0, errors.New("所选文件须位于同一位置")
+		}
+	}
+	return ownerID, nil
+}
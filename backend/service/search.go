@@ -0,0 +1,311 @@
+package service
+
+import (
+	"errors"
+	"log"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+	"gorm.io/gorm"
+)
+
+// SearchResult 搜索结果，Score 为相关度 (降级为数据库搜索时为 0)
+type SearchResult struct {
+	model.File
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// maxSearchWindow 全文检索可翻页的结果数上限
+const maxSearchWindow = 10000
+
+// SearchPage 一页搜索结果，Total 为命中总数，Facets 为按类别 (type) 与年份 (year) 的分面统计
+type SearchPage struct {
+	Data   []SearchResult                `json:"data"`
+	Total  int64                         `json:"total"`
+	Facets map[string][]utils.FacetCount `json:"facets"`
+	Page
+}
+
+// Search 按搜索语句检索用户的文件，folderID 不为 0 时限定在该目录内
+// 索引不可用时降级为数据库模糊搜索 (无分面统计)
+func Search(userID uint, keyword string, folderID uint, q ListQuery) (*SearchPage, error) {
+	sq, err := utils.ParseSearchQuery(keyword)
+	if err != nil {
+		return nil, err
+	}
+	if sq.Folder != "" {
+		if folderID, err = ResolveFolderPath(userID, sq.Folder); err != nil {
+			return nil, err
+		}
+	}
+	if folderID != 0 {
+		if _, err := checkParentFolder(userID, folderID); err != nil {
+			return nil, err
+		}
+	}
+	sq.FolderID = folderID
+
+	offset := 0
+	if q.Cursor != "" {
+		values, err := decodeCursor(q.Cursor, 1)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := values[0].(int64)
+		if !ok || n < 0 {
+			return nil, errors.New("游标无效")
+		}
+		offset = int(n)
+	}
+	limit := q.limit()
+	if offset+limit > maxSearchWindow {
+		return nil, errors.New("结果过多，请缩小搜索范围")
+	}
+
+	sort := utils.SearchSort{Desc: q.descOr(true)}
+	switch q.SortBy {
+	case "size":
+		sort.By = "size"
+	case "time", "updatedAt", "modified":
+		sort.By = "time"
+	}
+
+	results, err := utils.Search(userID, sq, sort, offset, limit)
+	if err != nil {
+		log.Printf("[Search] 全文检索失败，降级为数据库搜索: %v", err)
+		return searchDatabase(userID, sq, q)
+	}
+
+	ids := make([]uint, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		ids = append(ids, hit.FileID)
+	}
+	var files []model.File
+	if len(ids) > 0 {
+		if err := model.DB.Preload("Tags").Preload("Meta").Where("id IN ? AND user_id = ?", ids, userID).Find(&files).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]model.File, len(files))
+	for _, f := range files {
+		byID[f.ID] = f
+	}
+
+	page := &SearchPage{Data: []SearchResult{}, Total: int64(results.Total), Facets: results.Facets}
+	// 保持索引返回的顺序，跳过索引中残留的已删除文件
+	for _, hit := range results.Hits {
+		if f, ok := byID[hit.FileID]; ok {
+			page.Data = append(page.Data, SearchResult{File: f, Score: hit.Score, Highlights: hit.Highlights})
+		}
+	}
+	if next := offset + limit; uint64(next) < results.Total && next < maxSearchWindow {
+		page.HasMore = true
+		page.NextCursor = encodeCursor([]interface{}{next})
+	}
+	return page, nil
+}
+
+// searchDatabase 索引不可用时按文件名模糊匹配，并尽量应用其余筛选条件
+func searchDatabase(userID uint, sq *utils.SearchQuery, q ListQuery) (*SearchPage, error) {
+	db := model.DB.Model(&model.File{}).Where("files.user_id = ? AND files.is_folder = ?", userID, false)
+	for _, c := range sq.Clauses {
+		var cond string
+		var arg interface{}
+		switch c.Field {
+		case "", "name":
+			cond, arg = "files.name LIKE ?", "%"+c.Value+"%"
+		case "ext":
+			cond, arg = "files.ext = ?", c.Value
+		case "category":
+			cond, arg = "files.category = ?", c.Value
+		case "tag":
+			cond, arg = "EXISTS (SELECT 1 FROM file_tags t WHERE t.file_id = files.id AND t.name = ?)", c.Value
+		default:
+			// 正文与元数据只能通过索引检索
+			continue
+		}
+		if c.Negate {
+			db = db.Where("NOT ("+cond+")", arg)
+		} else {
+			db = db.Where(cond, arg)
+		}
+	}
+	if sq.SizeMin != nil {
+		db = db.Where("files.size >= ?", *sq.SizeMin)
+	}
+	if sq.SizeMax != nil {
+		db = db.Where("files.size <= ?", *sq.SizeMax)
+	}
+	if sq.CreatedFrom != nil {
+		db = db.Where("files.created_at >= ?", *sq.CreatedFrom)
+	}
+	if sq.CreatedTo != nil {
+		db = db.Where("files.created_at <= ?", *sq.CreatedTo)
+	}
+	if sq.ModifiedFrom != nil {
+		db = db.Where("files.updated_at >= ?", *sq.ModifiedFrom)
+	}
+	if sq.ModifiedTo != nil {
+		db = db.Where("files.updated_at <= ?", *sq.ModifiedTo)
+	}
+	if sq.Favorite != nil {
+		db = db.Where("files.is_favorite = ?", *sq.Favorite)
+	}
+	if sq.FolderID != 0 {
+		var folder model.File
+		if err := model.DB.First(&folder, sq.FolderID).Error; err != nil {
+			return nil, errors.New("目标文件夹不存在")
+		}
+		db = db.Scopes(model.DescendantScope(&folder))
+	}
+
+	var total int64
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+	files, page, err := listFiles(db, q, "files.updated_at")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SearchPage{Data: make([]SearchResult, 0, len(files)), Total: total, Facets: map[string][]utils.FacetCount{}, Page: page}
+	for _, f := range files {
+		result.Data = append(result.Data, SearchResult{File: f})
+	}
+	return result, nil
+}
+
+// IndexHealth 索引健康报告
+type IndexHealth struct {
+	Available     bool             `json:"available"`
+	IndexedDocs   uint64           `json:"indexedDocs"`
+	DatabaseFiles int64            `json:"databaseFiles"`
+	Missing       int              `json:"missing"`  // 数据库中存在但未建立索引
+	Orphaned      int              `json:"orphaned"` // 索引中存在但数据库中已删除
+	PendingJobs   int64            `json:"pendingJobs"`
+	FailedJobs    int64            `json:"failedJobs"`
+	RecentErrors  []model.IndexJob `json:"recentErrors"`
+	Healthy       bool             `json:"healthy"`
+}
+
+// databaseFileIDs 获取数据库中需要建立索引的文件 ID，userID 为 0 时获取全部
+func databaseFileIDs(userID uint) ([]uint, error) {
+	db := model.DB.Model(&model.File{}).Where("is_folder = ?", false)
+	if userID != 0 {
+		db = db.Where("user_id = ?", userID)
+	}
+	var ids []uint
+	err := db.Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// RebuildSearchIndex 重建全部或指定用户的索引：所有文件重新抽取正文，索引中残留的已删除文件被移除
+// 返回提交的任务数
+func RebuildSearchIndex(userID uint) (int, error) {
+	ids, err := databaseFileIDs(userID)
+	if err != nil {
+		return 0, err
+	}
+	exists := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		exists[id] = true
+	}
+	// 残留文档同样提交任务，执行时发现文件不存在即从索引中移除
+	if indexed, err := utils.IndexedFileIDs(userID); err == nil {
+		for _, id := range indexed {
+			if !exists[id] {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	for start := 0; start < len(ids); start += indexRebuildChunks {
+		end := start + indexRebuildChunks
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := enqueueIndex(model.DB, ids[start:end], true); err != nil {
+			return start, err
+		}
+	}
+	log.Printf("[Index] 已提交 %d 个索引重建任务", len(ids))
+	return len(ids), nil
+}
+
+// GetIndexHealth 比较索引与数据库，生成全部或指定用户的索引健康报告
+func GetIndexHealth(userID uint) (*IndexHealth, error) {
+	ids, err := databaseFileIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	health := &IndexHealth{DatabaseFiles: int64(len(ids)), RecentErrors: []model.IndexJob{}}
+
+	jobs := model.DB.Model(&model.IndexJob{})
+	if userID != 0 {
+		jobs = jobs.Where("file_id IN (?)", model.DB.Model(&model.File{}).Unscoped().Select("id").Where("user_id = ?", userID))
+	}
+	jobs.Session(&gorm.Session{}).Where("status = ?", model.IndexJobPending).Count(&health.PendingJobs)
+	jobs.Session(&gorm.Session{}).Where("status = ?", model.IndexJobFailed).Count(&health.FailedJobs)
+	jobs.Session(&gorm.Session{}).Where("error <> ''").Order("updated_at DESC").Limit(20).Find(&health.RecentErrors)
+
+	indexed, err := utils.IndexedFileIDs(userID)
+	if err != nil {
+		// 索引不可用时只返回数据库侧的统计
+		health.Missing = len(ids)
+		return health, nil
+	}
+	health.Available = true
+	health.IndexedDocs = uint64(len(indexed))
+
+	inIndex := make(map[uint]bool, len(indexed))
+	for _, id := range indexed {
+		inIndex[id] = true
+	}
+	inDB := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		inDB[id] = true
+		if !inIndex[id] {
+			health.Missing++
+		}
+	}
+	for _, id := range indexed {
+		if !inDB[id] {
+			health.Orphaned++
+		}
+	}
+	health.Healthy = health.Missing == 0 && health.Orphaned == 0 && health.FailedJobs == 0
+	return health, nil
+}
+
+// buildSearchDocument 组装文件的索引文档，标签与元数据从数据库读取
+func buildSearchDocument(file *model.File, content string) *utils.SearchDocument {
+	doc := &utils.SearchDocument{
+		FileID:    file.ID,
+		UserID:    file.UserID,
+		Name:      file.Name,
+		Ext:       file.Ext,
+		Category:  file.Category,
+		MimeType:  file.MimeType,
+		Size:      file.Size,
+		Favorite:  file.IsFavorite,
+		FolderIDs: file.AncestorIDs(),
+		CreatedAt: file.CreatedAt,
+		UpdatedAt: file.UpdatedAt,
+		Content:   content,
+		Meta:      map[string]string{},
+	}
+
+	var tags []model.FileTag
+	model.DB.Where("file_id = ?", file.ID).Find(&tags)
+	for _, tag := range tags {
+		doc.Tags = append(doc.Tags, tag.Name)
+	}
+
+	var meta []model.FileMeta
+	model.DB.Where("file_id = ?", file.ID).Find(&meta)
+	for _, m := range meta {
+		doc.Meta[m.Key] = m.Value
+	}
+	return doc
+}
@@ -1,47 +1,211 @@
 package service
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/stfreya/stfreyanetdisk/model"
 	"github.com/stfreya/stfreyanetdisk/utils"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+const (
+	shareAccessTTL         = 2 * time.Hour
+	shareVerifyMaxAttempts = 5
+	shareVerifyWindow      = 15 * time.Minute
+	maxSharePasswordLen    = 32
+	defaultShareUploadMB   = 100
+	defaultShareArchiveMB  = 4096
+)
+
+var (
+	// ErrShareNotFound 分享不存在或不属于当前用户
+	ErrShareNotFound = errors.New("分享不存在")
+	// ErrSharePassword 提取码错误
+	ErrSharePassword = errors.New("提取码错误")
+	// ErrShareAccessRequired 缺少或无效的分享访问令牌
+	ErrShareAccessRequired = errors.New("请先输入提取码")
+	// ErrShareExhausted 访问或下载次数已用尽
+	ErrShareExhausted = errors.New("分享的访问或下载次数已用尽")
+	// ErrSharePreviewOnly 仅预览的分享禁止下载与转存
+	ErrSharePreviewOnly = errors.New("该分享仅允许在线预览")
+	// ErrShareUploadOnly 收集文件的分享只能上传
+	ErrShareUploadOnly = errors.New("该分享仅用于收集文件")
+	// ErrShareUploadDisabled 分享未开启收集文件
+	ErrShareUploadDisabled = errors.New("该分享不允许上传")
+	// ErrShareUploadTooLarge 上传的文件超过分享允许的大小
+	ErrShareUploadTooLarge = errors.New("文件超过分享允许的大小上限")
+	// ErrShareUploadType 上传的文件类型不在分享允许的范围内
+	ErrShareUploadType = errors.New("分享不允许上传该类型的文件")
+)
+
+// shareVerifyLimiter 按 IP 与分享统计提取码错误次数
+var shareVerifyLimiter = utils.NewAttemptLimiter(shareVerifyMaxAttempts, shareVerifyWindow)
+
+// RateLimitError 尝试过于频繁
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("尝试次数过多，请 %d 分钟后再试", int(e.RetryAfter.Minutes())+1)
+}
+
+// ShareAccess 校验提取码后签发的访问令牌
+type ShareAccess struct {
+	AccessToken string    `json:"accessToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// ShareOptions 创建分享时的设置
+type ShareOptions struct {
+	Password       string
+	ExpireDays     int
+	Mode           string
+	MaxViews       int
+	MaxDownloads   int
+	UploadMaxSize  int64  // 收集文件的单个文件大小上限 (字节)，0 使用系统配置
+	UploadExts     string // 收集文件允许的扩展名，逗号分隔
+	ArchiveMaxSize int64  // 打包下载文件夹的大小上限 (字节)，0 使用系统配置
+	Alias          string // 自定义短链接
+	ShortAlias     bool   // 未指定 Alias 时随机生成短链接
+}
+
+// normalizeShareOptions 校验分享设置
+func normalizeShareOptions(file *model.File, opts *ShareOptions) error {
+	switch opts.Mode {
+	case model.ShareModeNormal, model.ShareModePreview:
+	case model.ShareModeUpload:
+		if !file.IsFolder {
+			return errors.New("只能为文件夹创建收集文件分享")
+		}
+	default:
+		return errors.New("不支持的分享方式")
+	}
+	if opts.ExpireDays < 0 || opts.MaxViews < 0 || opts.MaxDownloads < 0 || opts.UploadMaxSize < 0 || opts.ArchiveMaxSize < 0 {
+		return errors.New("分享设置不合法")
+	}
+	if limit := shareUploadMaxFileSize(); opts.UploadMaxSize > limit {
+		return fmt.Errorf("单个文件大小上限不能超过 %d MB", limit/1024/1024)
+	}
+	if limit := shareArchiveMaxSize(); opts.ArchiveMaxSize > limit {
+		return fmt.Errorf("打包下载大小上限不能超过 %d MB", limit/1024/1024)
+	}
+	exts, err := normalizeUploadExts(opts.UploadExts)
+	if err != nil {
+		return err
+	}
+	opts.UploadExts = exts
+	return nil
+}
+
+// normalizeUploadExts 将 ".JPG, png" 规范为 "jpg,png"
+func normalizeUploadExts(raw string) (string, error) {
+	var exts []string
+	seen := map[string]bool{}
+	for _, ext := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ' ' || r == ';' }) {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext == "" || seen[ext] {
+			continue
+		}
+		if strings.ContainsAny(ext, "/\\.") {
+			return "", errors.New("扩展名不合法")
+		}
+		seen[ext] = true
+		exts = append(exts, ext)
+	}
+	joined := strings.Join(exts, ",")
+	if len(joined) > 255 {
+		return "", errors.New("允许的扩展名过多")
+	}
+	return joined, nil
+}
+
 // CreateShare 创建分享
-func CreateShare(userID uint, fileID uint, password string, expireDays int) (string, error) {
+func CreateShare(userID uint, fileID uint, opts ShareOptions) (*model.Share, error) {
 	// 检查文件是否存在且属于该用户
 	var file model.File
 	if err := model.DB.Where("id = ? AND user_id = ?", fileID, userID).First(&file).Error; err != nil {
-		return "", errors.New("文件不存在或无权分享")
+		return nil, errors.New("文件不存在或无权分享")
+	}
+	if err := normalizeShareOptions(&file, &opts); err != nil {
+		return nil, err
+	}
+
+	hashed, err := hashSharePassword(opts.Password)
+	if err != nil {
+		return nil, err
 	}
 
-	token := utils.RandomString(32)
+	alias, err := resolveShareAlias(opts.Alias, opts.ShortAlias, 0)
+	if err != nil {
+		return nil, err
+	}
 	var expireTime *time.Time
-	if expireDays > 0 {
-		t := time.Now().AddDate(0, 0, expireDays)
+	if opts.ExpireDays > 0 {
+		t := time.Now().AddDate(0, 0, opts.ExpireDays)
 		expireTime = &t
 	}
 
 	share := model.Share{
-		FileID:     fileID,
-		UserID:     userID,
-		Password:   password,
-		ExpireTime: expireTime,
-		Token:      token,
+		FileID:         fileID,
+		UserID:         userID,
+		Password:       hashed,
+		ExpireTime:     expireTime,
+		Token:          newShareToken(),
+		Alias:          alias,
+		Mode:           opts.Mode,
+		MaxViews:       opts.MaxViews,
+		MaxDownloads:   opts.MaxDownloads,
+		UploadMaxSize:  opts.UploadMaxSize,
+		UploadExts:     opts.UploadExts,
+		ArchiveMaxSize: opts.ArchiveMaxSize,
 	}
 
 	if err := model.DB.Create(&share).Error; err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return token, nil
+	return &share, nil
 }
 
-// GetShare 获取分享信息
+// GetShare 打开分享页面：获取分享信息并计入一次访问，访问次数用尽后分享失效
 func GetShare(token string) (*model.Share, *model.File, error) {
+	share, file, err := FindShare(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 条件更新保证并发访问不会超出上限
+	result := model.DB.Model(&model.Share{}).Where("id = ? AND (max_views = 0 OR views < max_views)", share.ID).
+		UpdateColumn("views", gorm.Expr("views + 1"))
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrShareExhausted
+	}
+	share.Views++
+	if share.MaxViews > 0 && share.Views >= share.MaxViews {
+		// 最后一位访客仍可在访问令牌有效期内浏览，之后分享自动过期
+		expireShare(share, time.Now().Add(shareAccessTTL))
+	}
+	return share, file, nil
+}
+
+// FindShare 按令牌或短链接查找未过期的分享及其根文件，不计入访问次数
+func FindShare(token string) (*model.Share, *model.File, error) {
 	var share model.Share
-	if err := model.DB.Where("token = ?", token).First(&share).Error; err != nil {
+	if err := model.DB.Where("token = ? OR alias = ?", token, strings.ToLower(token)).First(&share).Error; err != nil {
 		return nil, nil, errors.New("分享不存在")
 	}
 
@@ -55,8 +219,242 @@ func GetShare(token string) (*model.Share, *model.File, error) {
 		return nil, nil, errors.New("文件已丢失")
 	}
 
-	// 增加访问次数
-	model.DB.Model(&share).Update("views", share.Views+1)
-
 	return &share, &file, nil
 }
+
+// expireShare 将分享的过期时间提前到 at
+func expireShare(share *model.Share, at time.Time) {
+	model.DB.Model(&model.Share{}).Where("id = ? AND (expire_time IS NULL OR expire_time > ?)", share.ID, at).
+		UpdateColumn("expire_time", at)
+}
+
+// CheckShareDownload 校验分享是否允许下载或转存
+func CheckShareDownload(share *model.Share) error {
+	switch share.Mode {
+	case model.ShareModePreview:
+		return ErrSharePreviewOnly
+	case model.ShareModeUpload:
+		return ErrShareUploadOnly
+	}
+	return nil
+}
+
+// CheckSharePreview 校验文件能否在分享中在线预览，在线预览不计入下载次数
+func CheckSharePreview(share *model.Share, file *model.File) error {
+	if share.Mode == model.ShareModeUpload {
+		return ErrShareUploadOnly
+	}
+	switch file.Category {
+	case utils.CategoryImage, utils.CategoryVideo, utils.CategoryAudio, utils.CategoryDocument:
+		return nil
+	}
+	return errors.New("该文件不支持在线预览")
+}
+
+// ConsumeShareDownload 计入一次下载 (转存同样计入)，下载次数用尽后分享立即过期
+func ConsumeShareDownload(share *model.Share) error {
+	if err := CheckShareDownload(share); err != nil {
+		return err
+	}
+	result := model.DB.Model(&model.Share{}).Where("id = ? AND (max_downloads = 0 OR downloads < max_downloads)", share.ID).
+		UpdateColumn("downloads", gorm.Expr("downloads + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareExhausted
+	}
+	share.Downloads++
+	if share.MaxDownloads > 0 && share.Downloads >= share.MaxDownloads {
+		expireShare(share, time.Now())
+	}
+	return nil
+}
+
+// hashSharePassword 提取码以 bcrypt 哈希保存，空提取码表示无需验证
+func hashSharePassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) > maxSharePasswordLen {
+		return "", fmt.Errorf("提取码不能超过 %d 个字符", maxSharePasswordLen)
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hashed), err
+}
+
+// isPasswordHash 早期版本以明文保存提取码
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2")
+}
+
+// checkSharePassword 校验提取码
+func checkSharePassword(share *model.Share, password string) bool {
+	if share.Password == "" {
+		return true
+	}
+	if isPasswordHash(share.Password) {
+		return bcrypt.CompareHashAndPassword([]byte(share.Password), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(share.Password), []byte(password)) == 1
+}
+
+// shareStamp 由提取码哈希派生的标记，写入访问令牌
+func shareStamp(share *model.Share) string {
+	sum := sha256.Sum256([]byte(share.Password))
+	return hex.EncodeToString(sum[:8])
+}
+
+// VerifySharePassword 校验提取码并签发访问令牌，同一 IP 对同一分享的错误尝试受频率限制
+// 提取码错误时仍返回分享，便于记录访问日志
+func VerifySharePassword(token string, password string, clientIP string) (*model.Share, *ShareAccess, error) {
+	share, _, err := FindShare(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := fmt.Sprintf("%s|%d", clientIP, share.ID)
+	if ok, wait := shareVerifyLimiter.Allow(key); !ok {
+		return nil, nil, &RateLimitError{RetryAfter: wait}
+	}
+	if !checkSharePassword(share, password) {
+		shareVerifyLimiter.Fail(key)
+		return share, nil, ErrSharePassword
+	}
+	shareVerifyLimiter.Reset(key)
+
+	accessToken, expiresAt, err := utils.GenerateShareToken(share.ID, shareStamp(share), shareAccessTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return share, &ShareAccess{AccessToken: accessToken, ExpiresAt: expiresAt}, nil
+}
+
+// CheckShareAccess 校验访问令牌，无提取码的分享无需令牌
+func CheckShareAccess(share *model.Share, accessToken string) error {
+	if share.Password == "" {
+		return nil
+	}
+	if accessToken == "" {
+		return ErrShareAccessRequired
+	}
+	claims, err := utils.ParseShareToken(accessToken)
+	if err != nil || claims.ShareID != share.ID || claims.Stamp != shareStamp(share) {
+		return ErrShareAccessRequired
+	}
+	return nil
+}
+
+// hashLegacySharePasswords 将早期明文保存的提取码改为哈希
+func hashLegacySharePasswords() {
+	var shares []model.Share
+	if err := model.DB.Unscoped().Where("password <> '' AND password NOT LIKE ?", "$2%").Find(&shares).Error; err != nil {
+		log.Printf("[Share] 查询明文提取码失败: %v", err)
+		return
+	}
+	for _, share := range shares {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(share.Password), bcrypt.DefaultCost)
+		if err != nil {
+			continue
+		}
+		model.DB.Unscoped().Model(&model.Share{}).Where("id = ? AND password = ?", share.ID, share.Password).
+			UpdateColumn("password", string(hashed))
+	}
+	if len(shares) > 0 {
+		log.Printf("[Share] 已将 %d 个分享的提取码改为哈希保存", len(shares))
+	}
+}
+
+// ResolveShareFile 在分享范围内查找文件，fileID 为 0 时返回分享根
+// 目标必须是分享根自身或其真实后代：属于分享者、物化路径位于分享根之下，
+// 且目标与其到分享根之间的每一级目录都未被删除。范围外的文件一律视为不存在
+func ResolveShareFile(share *model.Share, root *model.File, fileID uint) (*model.File, error) {
+	if fileID == 0 || fileID == root.ID {
+		return root, nil
+	}
+
+	var target model.File
+	if err := model.DB.Where("id = ? AND user_id = ?", fileID, share.UserID).First(&target).Error; err != nil {
+		return nil, ErrFileNotFound
+	}
+	if !model.IsInTree(target.TreePath, root.TreePath) || !liveChain(share.UserID, root.ID, &target) {
+		return nil, ErrFileNotFound
+	}
+	return &target, nil
+}
+
+// ListShareFolder 列出分享范围内某个文件夹的子项，parentID 为 0 时列出分享根
+func ListShareFolder(share *model.Share, root *model.File, parentID uint) ([]model.File, error) {
+	if share.Mode == model.ShareModeUpload {
+		return nil, ErrShareUploadOnly
+	}
+	parent, err := ResolveShareFile(share, root, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if !parent.IsFolder {
+		return nil, errors.New("目录不存在")
+	}
+
+	files := []model.File{}
+	err = model.DB.Where("parent_id = ? AND user_id = ?", parent.ID, share.UserID).
+		Order("is_folder DESC, name ASC").Find(&files).Error
+	return files, err
+}
+
+// shareUploadMaxFileSize 收集文件分享中访客上传单个文件的系统上限
+func shareUploadMaxFileSize() int64 {
+	mb, err := strconv.ParseInt(model.GetConfig("share_upload_max_file_size", strconv.Itoa(defaultShareUploadMB)), 10, 64)
+	if err != nil || mb <= 0 {
+		mb = defaultShareUploadMB
+	}
+	return mb * 1024 * 1024
+}
+
+// ShareUploadLimit 分享允许上传的单个文件大小上限
+func ShareUploadLimit(share *model.Share) int64 {
+	limit := shareUploadMaxFileSize()
+	if share.UploadMaxSize > 0 && share.UploadMaxSize < limit {
+		limit = share.UploadMaxSize
+	}
+	return limit
+}
+
+// UploadToShare 访客向收集文件的分享上传文件，文件保存在分享的文件夹中并占用分享者的空间
+func UploadToShare(share *model.Share, root *model.File, name string, size int64, r io.Reader) (*model.File, error) {
+	if share.Mode != model.ShareModeUpload || !root.IsFolder {
+		return nil, ErrShareUploadDisabled
+	}
+	if err := validateFileName(name); err != nil {
+		return nil, err
+	}
+	if size > ShareUploadLimit(share) {
+		return nil, ErrShareUploadTooLarge
+	}
+	if share.UploadExts != "" {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+		allowed := false
+		for _, e := range strings.Split(share.UploadExts, ",") {
+			if e == ext {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, ErrShareUploadType
+		}
+	}
+
+	// 访客无法看到文件夹内容，同名时一律重命名，不能覆盖已有文件
+	finalName, _, _, err := resolveNameConflict(share.UserID, root.ID, name, false, ConflictRename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := storeFile(share.UserID, root.ID, finalName, size, r)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = SendMessage(share.UserID, "收到新文件", fmt.Sprintf("有访客通过收集文件分享向「%s」上传了 %s。", root.Name, file.Name), "success")
+	return file, nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+	"gorm.io/gorm"
+)
+
+// ErrShareArchiveTooLarge 打包下载的文件总大小超过上限
+var ErrShareArchiveTooLarge = errors.New("所选文件总大小超过分享允许的打包下载上限")
+
+// ShareArchive 待打包下载的分享内容
+type ShareArchive struct {
+	Name  string        // 压缩包文件名
+	Size  int64         // 文件总大小 (未压缩)
+	Files []*model.File // 所选的顶层文件与文件夹
+	items []archiveItem
+	fails []ArchiveFailure
+}
+
+// shareArchiveMaxSize 分享打包下载的系统上限
+func shareArchiveMaxSize() int64 {
+	mb, err := strconv.ParseInt(model.GetConfig("share_archive_max_size", strconv.Itoa(defaultShareArchiveMB)), 10, 64)
+	if err != nil || mb <= 0 {
+		mb = defaultShareArchiveMB
+	}
+	return mb * 1024 * 1024
+}
+
+// ShareArchiveLimit 分享允许打包下载的总大小上限，分享者设置的上限不超过系统上限
+func ShareArchiveLimit(share *model.Share) int64 {
+	limit := shareArchiveMaxSize()
+	if share.ArchiveMaxSize > 0 && share.ArchiveMaxSize < limit {
+		limit = share.ArchiveMaxSize
+	}
+	return limit
+}
+
+// shareFileScope 分享根的子树，打包时展开的后代不会超出分享范围
+func shareFileScope(share *model.Share, root *model.File) func() *gorm.DB {
+	return func() *gorm.DB {
+		return model.DB.Model(&model.File{}).Where("files.user_id = ?", share.UserID).Scopes(model.SubtreeScope(root))
+	}
+}
+
+// PrepareShareArchive 校验并展开分享中要打包下载的文件，fileIDs 为空时打包整个分享
+// 每个所选项都须位于分享范围内，总大小不能超过分享的打包上限
+func PrepareShareArchive(share *model.Share, root *model.File, fileIDs []uint) (*ShareArchive, error) {
+	if err := CheckShareDownload(share); err != nil {
+		return nil, err
+	}
+	if !root.IsFolder {
+		return nil, errors.New("只能打包下载文件夹中的文件")
+	}
+	if len(fileIDs) == 0 {
+		fileIDs = []uint{root.ID}
+	}
+
+	archive := &ShareArchive{}
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0, len(fileIDs))
+	for _, id := range fileIDs {
+		file, err := ResolveShareFile(share, root, id)
+		if err != nil {
+			return nil, err
+		}
+		if seen[file.ID] {
+			continue
+		}
+		seen[file.ID] = true
+		ids = append(ids, file.ID)
+		archive.Files = append(archive.Files, file)
+	}
+
+	items, failed, total, err := collectArchiveItems(shareFileScope(share, root), ids)
+	if err != nil {
+		return nil, err
+	}
+	if limit := ShareArchiveLimit(share); total > limit {
+		return nil, fmt.Errorf("%w (%d MB)", ErrShareArchiveTooLarge, limit/1024/1024)
+	}
+
+	archive.Size, archive.items, archive.fails = total, items, failed
+	archive.Name = root.Name + ".zip"
+	if len(archive.Files) == 1 {
+		archive.Name = archive.Files[0].Name + ".zip"
+	}
+	return archive, nil
+}
+
+// Write 以 zip 格式流式输出压缩包，读取失败的文件记入压缩包中的失败清单
+func (a *ShareArchive) Write(w io.Writer) error {
+	aw, err := utils.NewArchiveWriter(utils.ArchiveZip, w)
+	if err != nil {
+		return err
+	}
+	if _, _, err := writeArchiveItems(aw, a.items, a.fails, nil); err != nil {
+		return err
+	}
+	return aw.Close()
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+)
+
+const (
+	shareTokenLen = 32
+	// shortAliasLen 随机短链接的长度，约 50 位熵，分享接口无需登录，过短的随机短链接可被枚举
+	shortAliasLen = 10
+)
+
+// ErrShareAliasTaken 短链接已被占用
+var ErrShareAliasTaken = errors.New("该短链接已被占用")
+
+// shareAliasPattern 短链接由 3-24 位小写字母、数字、- 与 _ 组成，以字母或数字开头
+// 长度不超过 24 位，不会与 32 位的分享令牌相同
+var shareAliasPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{2,23}$`)
+
+// reservedShareAliases 保留的短链接，避免与页面路由和接口混淆
+var reservedShareAliases = map[string]bool{
+	"admin": true, "api": true, "app": true, "assets": true, "static": true,
+	"login": true, "logout": true, "register": true, "user": true, "users": true,
+	"s": true, "share": true, "shares": true, "public": true, "explore": true,
+	"info": true, "list": true, "verify": true, "download": true, "preview": true,
+	"upload": true, "save": true, "cover": true, "qrcode": true, "new": true,
+	"help": true, "about": true, "settings": true, "webdav": true, "null": true,
+}
+
+// normalizeShareAlias 校验自定义短链接，统一为小写
+func normalizeShareAlias(alias string) (string, error) {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	if !shareAliasPattern.MatchString(alias) {
+		return "", errors.New("短链接须为 3-24 位小写字母、数字、- 或 _，且以字母或数字开头")
+	}
+	if reservedShareAliases[alias] {
+		return "", errors.New("该短链接为系统保留，请换一个")
+	}
+	return alias, nil
+}
+
+// shareKeyTaken 令牌或短链接是否已被任一分享 (含已删除的分享) 使用
+func shareKeyTaken(key string, exceptID uint) bool {
+	var count int64
+	model.DB.Unscoped().Model(&model.Share{}).Where("(token = ? OR alias = ?) AND id <> ?", key, key, exceptID).Count(&count)
+	return count > 0
+}
+
+// newShareToken 生成新的分享令牌
+func newShareToken() string {
+	for {
+		token := utils.RandomString(shareTokenLen)
+		if !shareKeyTaken(token, 0) {
+			return token
+		}
+	}
+}
+
+// resolveShareAlias 确定分享的短链接：alias 非空时使用自定义短链接，否则 random 为 true 时随机生成
+// 两者都未指定时返回 nil，分享只能通过令牌访问
+func resolveShareAlias(alias string, random bool, shareID uint) (*string, error) {
+	if alias != "" {
+		alias, err := normalizeShareAlias(alias)
+		if err != nil {
+			return nil, err
+		}
+		if shareKeyTaken(alias, shareID) {
+			return nil, ErrShareAliasTaken
+		}
+		return &alias, nil
+	}
+	if !random {
+		return nil, nil
+	}
+	for i := 0; i < 5; i++ {
+		code := utils.RandomShortCode(shortAliasLen)
+		if !reservedShareAliases[code] && !shareKeyTaken(code, shareID) {
+			return &code, nil
+		}
+	}
+	return nil, errors.New("短链接生成失败，请重试")
+}
+
+// SetShareAlias 设置、更换或清除分享的短链接 (alias 与 random 都为空时清除)
+// 更换后旧的短链接立即失效
+func SetShareAlias(userID uint, shareID uint, alias string, random bool) (*model.Share, error) {
+	share, err := ownedShare(userID, shareID)
+	if err != nil {
+		return nil, err
+	}
+	value, err := resolveShareAlias(alias, random, share.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.DB.Model(share).Update("alias", value).Error; err != nil {
+		// 并发设置同一短链接时由唯一索引兜底
+		return nil, ErrShareAliasTaken
+	}
+	share.Alias = value
+	return share, nil
+}
+
+// ShareLinkKey 分享链接中使用的标识，设置了短链接时优先使用短链接
+func ShareLinkKey(share *model.Share) string {
+	if share.Alias != nil && *share.Alias != "" {
+		return *share.Alias
+	}
+	return share.Token
+}
+
+// ShareURL 分享页面的地址，siteURL 为站点地址 (不以 / 结尾)
+func ShareURL(share *model.Share, siteURL string) string {
+	return siteURL + "/s/" + ShareLinkKey(share)
+}
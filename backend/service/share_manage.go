@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+)
+
+const (
+	// maxShareRenewDays 单次续期的最大天数
+	maxShareRenewDays = 3650
+	// expiringNoticeNames 即将过期提醒中最多列出的分享数
+	expiringNoticeNames = 5
+)
+
+// ShareUpdate 修改分享设置，为 nil 的字段保持不变
+type ShareUpdate struct {
+	Password       *string // 空字符串表示取消提取码
+	ExpireDays     *int    // 自现在起的有效天数，0 表示永久有效
+	Mode           *string
+	MaxViews       *int
+	MaxDownloads   *int
+	UploadMaxSize  *int64
+	UploadExts     *string
+	ArchiveMaxSize *int64
+}
+
+// RevokeFilter 批量取消分享的条件，多个条件同时满足的分享才会取消
+type RevokeFilter struct {
+	FileID        uint // 分享的是该文件，或该文件夹中的文件
+	OlderThanDays int  // 创建超过指定天数
+	All           bool // 未指定其他条件时须显式确认取消全部分享
+}
+
+// UpdateShare 修改分享的提取码、有效期与其他设置
+// 修改提取码后已签发的访问令牌随之失效；设置提取码或改为收集文件时分享同时移出公开目录
+func UpdateShare(userID uint, shareID uint, upd ShareUpdate) (*model.Share, error) {
+	share, err := ownedShare(userID, shareID)
+	if err != nil {
+		return nil, err
+	}
+	var file model.File
+	if err := model.DB.First(&file, share.FileID).Error; err != nil {
+		return nil, errors.New("文件已丢失")
+	}
+
+	opts := ShareOptions{
+		Mode:           share.Mode,
+		MaxViews:       share.MaxViews,
+		MaxDownloads:   share.MaxDownloads,
+		UploadMaxSize:  share.UploadMaxSize,
+		UploadExts:     share.UploadExts,
+		ArchiveMaxSize: share.ArchiveMaxSize,
+	}
+	if upd.ExpireDays != nil {
+		opts.ExpireDays = *upd.ExpireDays
+	}
+	if upd.Mode != nil {
+		opts.Mode = *upd.Mode
+	}
+	if upd.MaxViews != nil {
+		opts.MaxViews = *upd.MaxViews
+	}
+	if upd.MaxDownloads != nil {
+		opts.MaxDownloads = *upd.MaxDownloads
+	}
+	if upd.UploadMaxSize != nil {
+		opts.UploadMaxSize = *upd.UploadMaxSize
+	}
+	if upd.UploadExts != nil {
+		opts.UploadExts = *upd.UploadExts
+	}
+	if upd.ArchiveMaxSize != nil {
+		opts.ArchiveMaxSize = *upd.ArchiveMaxSize
+	}
+	if err := normalizeShareOptions(&file, &opts); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"mode":             opts.Mode,
+		"max_views":        opts.MaxViews,
+		"max_downloads":    opts.MaxDownloads,
+		"upload_max_size":  opts.UploadMaxSize,
+		"upload_exts":      opts.UploadExts,
+		"archive_max_size": opts.ArchiveMaxSize,
+	}
+	password := share.Password
+	if upd.Password != nil {
+		if password, err = hashSharePassword(*upd.Password); err != nil {
+			return nil, err
+		}
+		updates["password"] = password
+	}
+	if upd.ExpireDays != nil {
+		var expireTime *time.Time
+		if opts.ExpireDays > 0 {
+			t := time.Now().AddDate(0, 0, opts.ExpireDays)
+			expireTime = &t
+		}
+		updates["expire_time"] = expireTime
+		updates["expire_notified"] = false
+	}
+	if share.IsPublic && (password != "" || opts.Mode == model.ShareModeUpload) {
+		updates["is_public"] = false
+		updates["review_status"] = ""
+	}
+
+	if err := model.DB.Model(share).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return ownedShare(userID, shareID)
+}
+
+// RenewShare 将分享的有效期延长 days 天，已过期的分享自现在起重新计算
+func RenewShare(userID uint, shareID uint, days int) (*model.Share, error) {
+	if days <= 0 || days > maxShareRenewDays {
+		return nil, fmt.Errorf("续期天数须为 1-%d 天", maxShareRenewDays)
+	}
+	share, err := ownedShare(userID, shareID)
+	if err != nil {
+		return nil, err
+	}
+	if share.ExpireTime == nil {
+		return nil, errors.New("分享永久有效，无需续期")
+	}
+
+	base := time.Now()
+	if share.ExpireTime.After(base) {
+		base = *share.ExpireTime
+	}
+	expireTime := base.AddDate(0, 0, days)
+	err = model.DB.Model(share).Updates(map[string]interface{}{"expire_time": expireTime, "expire_notified": false}).Error
+	if err != nil {
+		return nil, err
+	}
+	share.ExpireTime, share.ExpireNotified = &expireTime, false
+	return share, nil
+}
+
+// RevokeShares 按条件批量取消用户的分享，返回取消的数量
+func RevokeShares(userID uint, filter RevokeFilter) (int64, error) {
+	if filter.OlderThanDays < 0 {
+		return 0, errors.New("参数错误")
+	}
+	if filter.FileID == 0 && filter.OlderThanDays == 0 && !filter.All {
+		return 0, errors.New("请指定要取消的分享")
+	}
+
+	db := model.DB.Where("user_id = ?", userID)
+
+	if filter.FileID != 0 {
+		var file model.File
+		if err := model.DB.Where("id = ? AND user_id = ?", filter.FileID, userID).First(&file).Error; err != nil {
+			return 0, ErrFileNotFound
+		}
+		if file.IsFolder {
+			subtree := model.DB.Model(&model.File{}).Unscoped().Select("files.id").
+				Where("files.user_id = ?", userID).Scopes(model.SubtreeScope(&file))
+			db = db.Where("file_id IN (?)", subtree)
+		} else {
+			db = db.Where("file_id = ?", file.ID)
+		}
+	}
+	if filter.OlderThanDays > 0 {
+		db = db.Where("created_at < ?", time.Now().AddDate(0, 0, -filter.OlderThanDays))
+	}
+
+	result := db.Delete(&model.Share{})
+	return result.RowsAffected, result.Error
+}
+
+// NotifyExpiringShares 提醒分享者将在 within 内过期的分享，每个分享只提醒一次
+// 访问或下载次数已用尽的分享不再提醒；返回提醒的分享数
+func NotifyExpiringShares(within time.Duration) (int64, error) {
+	now := time.Now()
+	var rows []struct {
+		ID         uint
+		UserID     uint
+		ExpireTime time.Time
+		Title      string
+		FileName   string
+	}
+	err := model.DB.Table("shares").
+		Select("shares.id, shares.user_id, shares.expire_time, shares.title, files.name AS file_name").
+		Joins("LEFT JOIN files ON files.id = shares.file_id").
+		Where("shares.deleted_at IS NULL AND shares.expire_notified = ?", false).
+		Where("shares.expire_time > ? AND shares.expire_time <= ?", now, now.Add(within)).
+		Where("(shares.max_views = 0 OR shares.views < shares.max_views) AND (shares.max_downloads = 0 OR shares.downloads < shares.max_downloads)").
+		Order("shares.user_id ASC, shares.expire_time ASC").
+		Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+
+	// 同一用户的多个分享合并为一条消息
+	var ids []uint
+	names := map[uint][]string{}
+	first := map[uint]time.Time{}
+	var users []uint
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+		if _, ok := names[r.UserID]; !ok {
+			users = append(users, r.UserID)
+			first[r.UserID] = r.ExpireTime
+		}
+		name := r.Title
+		if name == "" {
+			name = r.FileName
+		}
+		names[r.UserID] = append(names[r.UserID], name)
+	}
+	for _, userID := range users {
+		list := names[userID]
+		var content string
+		if len(list) == 1 {
+			content = fmt.Sprintf("你分享的「%s」将于 %s 过期，如需继续分享请及时续期。", list[0], first[userID].Format("2006-01-02 15:04"))
+		} else {
+			shown := list
+			if len(shown) > expiringNoticeNames {
+				shown = shown[:expiringNoticeNames]
+			}
+			content = fmt.Sprintf("你有 %d 个分享即将过期 (最早于 %s)：「%s」", len(list), first[userID].Format("2006-01-02 15:04"), strings.Join(shown, "」「"))
+			if len(list) > len(shown) {
+				content += " 等"
+			}
+			content += "，如需继续分享请及时续期。"
+		}
+		_ = SendMessage(userID, "分享即将过期", content, "warning")
+	}
+
+	result := model.DB.Model(&model.Share{}).Where("id IN ?", ids).UpdateColumn("expire_notified", true)
+	return result.RowsAffected, result.Error
+}
+
+// CleanExpiredShares 删除过期超过 retention 的分享，返回删除的数量
+func CleanExpiredShares(retention time.Duration) (int64, error) {
+	result := model.DB.Where("expire_time IS NOT NULL AND expire_time < ?", time.Now().Add(-retention)).
+		Delete(&model.Share{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	maxShareTitleLen       = 100
+	maxShareDescriptionLen = 500
+)
+
+// PublicShareItem 公开目录中的分享
+type PublicShareItem struct {
+	ID          uint      `json:"-"`
+	Token       string    `json:"token"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	CoverFileID uint      `json:"-"`
+	HasCover    bool      `json:"hasCover"`
+	FileName    string    `json:"fileName"`
+	IsFolder    bool      `json:"isFolder"`
+	FileSize    int64     `json:"fileSize"`
+	Views       int       `json:"views"`
+	Downloads   int       `json:"downloads"`
+	Username    string    `json:"username"`
+	PublishedAt time.Time `json:"publishedAt"`
+}
+
+// OpenGraph 分享页面的链接预览信息
+type OpenGraph struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image,omitempty"`
+	URL         string `json:"url"`
+	Type        string `json:"type"`
+	SiteName    string `json:"siteName"`
+}
+
+// PublishOptions 发布到公开目录的展示信息
+type PublishOptions struct {
+	Title       string
+	Description string
+	CoverFileID uint
+}
+
+// publicShareScope 公开目录的可见范围：已审核通过、无提取码、未过期且次数未用尽
+func publicShareScope(db *gorm.DB) *gorm.DB {
+	return db.Where("shares.is_public = ? AND shares.review_status = ? AND shares.password = '' AND shares.mode <> ?",
+		true, model.ReviewApproved, model.ShareModeUpload).
+		Where("shares.expire_time IS NULL OR shares.expire_time > ?", time.Now()).
+		Where("shares.max_views = 0 OR shares.views < shares.max_views").
+		Where("shares.deleted_at IS NULL")
+}
+
+// ListPublicShares 浏览与搜索公开目录 (sortBy: views/downloads，默认按发布时间)
+func ListPublicShares(q ListQuery) ([]PublicShareItem, Page, error) {
+	db := model.DB.Table("shares").
+		Select("shares.id, shares.token, shares.title, shares.description, shares.cover_file_id, shares.views, shares.downloads, shares.published_at, " +
+			"files.name AS file_name, files.is_folder, files.size AS file_size, users.username").
+		Joins("JOIN files ON files.id = shares.file_id AND files.deleted_at IS NULL").
+		Joins("LEFT JOIN users ON users.id = shares.user_id").
+		Scopes(publicShareScope)
+	if q.Keyword != "" {
+		like := "%" + q.Keyword + "%"
+		db = db.Where("shares.title LIKE ? OR shares.description LIKE ? OR files.name LIKE ?", like, like, like)
+	}
+
+	desc := q.descOr(true)
+	var fields []sortField[PublicShareItem]
+	switch q.SortBy {
+	case "views":
+		fields = append(fields, sortField[PublicShareItem]{Column: "shares.views", Desc: desc, Value: func(s *PublicShareItem) interface{} { return s.Views }})
+	case "downloads":
+		fields = append(fields, sortField[PublicShareItem]{Column: "shares.downloads", Desc: desc, Value: func(s *PublicShareItem) interface{} { return s.Downloads }})
+	default:
+		fields = append(fields, sortField[PublicShareItem]{Column: "shares.published_at", Desc: desc, Value: func(s *PublicShareItem) interface{} { return cursorTime(s.PublishedAt) }})
+	}
+	fields = append(fields, sortField[PublicShareItem]{Column: "shares.id", Desc: desc, Value: func(s *PublicShareItem) interface{} { return s.ID }})
+
+	items, page, err := paginate(db, q, fields)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	for i := range items {
+		items[i].HasCover = items[i].CoverFileID != 0
+		if items[i].Title == "" {
+			items[i].Title = items[i].FileName
+		}
+	}
+	return items, page, nil
+}
+
+// PublishShare 将分享发布到公开目录，需要审核时进入待审核状态
+// 修改已发布分享的展示信息同样需要重新审核
+func PublishShare(userID uint, shareID uint, opts PublishOptions) (*model.Share, error) {
+	share, err := ownedShare(userID, shareID)
+	if err != nil {
+		return nil, err
+	}
+	if share.Password != "" {
+		return nil, errors.New("设置了提取码的分享不能公开")
+	}
+	if share.Mode == model.ShareModeUpload {
+		return nil, errors.New("收集文件的分享不能公开")
+	}
+	if share.ExpireTime != nil && share.ExpireTime.Before(time.Now()) {
+		return nil, errors.New("分享已过期")
+	}
+
+	title := strings.TrimSpace(opts.Title)
+	description := strings.TrimSpace(opts.Description)
+	if len([]rune(title)) > maxShareTitleLen {
+		return nil, fmt.Errorf("标题不能超过 %d 个字符", maxShareTitleLen)
+	}
+	if len([]rune(description)) > maxShareDescriptionLen {
+		return nil, fmt.Errorf("简介不能超过 %d 个字符", maxShareDescriptionLen)
+	}
+
+	var root model.File
+	if err := model.DB.First(&root, share.FileID).Error; err != nil {
+		return nil, errors.New("文件已丢失")
+	}
+	if opts.CoverFileID != 0 {
+		// 封面须是分享范围内的图片，访客才能看到
+		cover, err := ResolveShareFile(share, &root, opts.CoverFileID)
+		if err != nil || cover.IsFolder || cover.Category != utils.CategoryImage {
+			return nil, errors.New("封面须是分享中的图片")
+		}
+	}
+
+	status := model.ReviewApproved
+	if model.GetConfig("share_public_review", "true") == "true" {
+		status = model.ReviewPending
+	}
+	now := time.Now()
+	err = model.DB.Model(share).Updates(map[string]interface{}{
+		"is_public":     true,
+		"title":         title,
+		"description":   description,
+		"cover_file_id": opts.CoverFileID,
+		"review_status": status,
+		"review_note":   "",
+		"published_at":  now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	share.IsPublic, share.Title, share.Description, share.CoverFileID = true, title, description, opts.CoverFileID
+	share.ReviewStatus, share.ReviewNote, share.PublishedAt = status, "", &now
+	return share, nil
+}
+
+// UnpublishShare 将分享移出公开目录
+func UnpublishShare(userID uint, shareID uint) error {
+	share, err := ownedShare(userID, shareID)
+	if err != nil {
+		return err
+	}
+	return model.DB.Model(share).Updates(map[string]interface{}{"is_public": false, "review_status": ""}).Error
+}
+
+// ListShareReviews 管理员按审核状态列出公开分享，默认列出待审核的分享
+func ListShareReviews(status string, q ListQuery) ([]ShareListItem, Page, error) {
+	switch status {
+	case "":
+		status = model.ReviewPending
+	case model.ReviewPending, model.ReviewApproved, model.ReviewRejected:
+	default:
+		return nil, Page{}, errors.New("不支持的审核状态")
+	}
+	db := model.DB.Table("shares").
+		Select("shares.*, files.name as file_name, users.username").
+		Joins("left join files on files.id = shares.file_id").
+		Joins("left join users on users.id = shares.user_id").
+		Where("shares.deleted_at IS NULL AND shares.is_public = ? AND shares.review_status = ?", true, status)
+
+	// 待审核的分享先提交的先处理
+	desc := q.descOr(status != model.ReviewPending)
+	return paginate(db, q, []sortField[ShareListItem]{
+		{Column: "shares.published_at", Desc: desc, Value: func(s *ShareListItem) interface{} { return cursorTime(publishedAt(s)) }},
+		{Column: "shares.id", Desc: desc, Value: func(s *ShareListItem) interface{} { return s.ID }},
+	})
+}
+
+// publishedAt 发布时间，未发布时为零值
+func publishedAt(s *ShareListItem) time.Time {
+	if s.PublishedAt == nil {
+		return time.Time{}
+	}
+	return *s.PublishedAt
+}
+
+// ReviewShare 管理员审核公开分享，并通知分享者
+func ReviewShare(shareID uint, approve bool, note string) error {
+	var share model.Share
+	if err := model.DB.Where("id = ? AND is_public = ?", shareID, true).First(&share).Error; err != nil {
+		return ErrShareNotFound
+	}
+	status := model.ReviewRejected
+	if approve {
+		status = model.ReviewApproved
+	}
+	note = strings.TrimSpace(note)
+	if len([]rune(note)) > 255 {
+		return errors.New("审核意见不能超过 255 个字符")
+	}
+	if err := model.DB.Model(&share).Updates(map[string]interface{}{"review_status": status, "review_note": note}).Error; err != nil {
+		return err
+	}
+
+	var file model.File
+	model.DB.Unscoped().First(&file, share.FileID)
+	title := share.Title
+	if title == "" {
+		title = file.Name
+	}
+	if approve {
+		_ = SendMessage(share.UserID, "公开分享已通过审核", fmt.Sprintf("你的分享「%s」已发布到公开目录。", title), "success")
+	} else {
+		content := fmt.Sprintf("你的分享「%s」未通过审核。", title)
+		if note != "" {
+			content += "原因：" + note
+		}
+		_ = SendMessage(share.UserID, "公开分享未通过审核", content, "error")
+	}
+	return nil
+}
+
+// ShareCover 获取分享封面的缩略图，设置了提取码的分享不提供封面
+func ShareCover(token string) (*model.Thumbnail, error) {
+	share, root, err := FindShare(token)
+	if err != nil {
+		return nil, err
+	}
+	if share.CoverFileID == 0 || share.Password != "" {
+		return nil, ErrFileNotFound
+	}
+	cover, err := ResolveShareFile(share, root, share.CoverFileID)
+	if err != nil || cover.IsFolder {
+		return nil, ErrFileNotFound
+	}
+	return ensureThumbnail(cover, "medium", utils.ThumbJPEG)
+}
+
+// ShareOpenGraph 生成分享页面的 Open Graph 信息，siteURL 为站点地址 (不以 / 结尾)
+// 设置了提取码的分享不暴露文件名与封面
+func ShareOpenGraph(share *model.Share, root *model.File, siteURL string) OpenGraph {
+	og := OpenGraph{
+		URL:      ShareURL(share, siteURL),
+		Type:     "website",
+		SiteName: model.GetConfig("site_name", "Stfreya Netdisk"),
+	}
+	if share.Password != "" {
+		og.Title = "加密分享"
+		og.Description = "输入提取码后即可查看分享的内容"
+		return og
+	}
+
+	og.Title = share.Title
+	if og.Title == "" {
+		og.Title = root.Name
+	}
+	og.Description = share.Description
+	if og.Description == "" {
+		if root.IsFolder {
+			og.Description = fmt.Sprintf("分享了文件夹「%s」", root.Name)
+		} else {
+			og.Description = fmt.Sprintf("分享了文件「%s」", root.Name)
+		}
+	}
+	if share.CoverFileID != 0 {
+		og.Image = siteURL + "/api/v1/share/cover/" + ShareLinkKey(share)
+	}
+	return og
+}
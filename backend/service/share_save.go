@@ -0,0 +1,242 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"gorm.io/gorm"
+)
+
+const (
+	taskShareSave = "share_save"
+	// shareSaveIndexBatch 转存时每创建多少个文件提交一次索引任务
+	shareSaveIndexBatch = 200
+)
+
+func init() {
+	registerTaskHandler(taskShareSave, "转存", runShareSaveTask)
+}
+
+// ShareSavePayload 转存任务参数
+type ShareSavePayload struct {
+	ShareID  uint   `json:"shareId"`
+	FileID   uint   `json:"fileId"`
+	ParentID uint   `json:"parentId"`
+	Conflict string `json:"conflict"`
+}
+
+// ShareSaveResult 转存任务结果
+type ShareSaveResult struct {
+	Files   int      `json:"files"`   // 转存的文件数
+	Folders int      `json:"folders"` // 新建的文件夹数
+	Size    int64    `json:"size"`    // 转存的文件总大小
+	Skipped []string `json:"skipped"` // 因同名跳过的项
+}
+
+// SaveShareFiles 提交转存任务，将分享中的 file 复制到自己的 parentID 目录
+// 目标目录须属于自己；相同的转存任务进行中时直接返回该任务，不重复提交也不重复计入下载次数
+func SaveShareFiles(userID uint, share *model.Share, file *model.File, parentID uint, conflict string) (*TaskInfo, error) {
+	if err := CheckShareDownload(share); err != nil {
+		return nil, err
+	}
+	policy, err := parseConflictPolicy(conflict)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkParentFolder(userID, parentID); err != nil {
+		return nil, err
+	}
+
+	payload := ShareSavePayload{ShareID: share.ID, FileID: file.ID, ParentID: parentID, Conflict: policy}
+	var active []model.Task
+	model.DB.Where("user_id = ? AND type = ? AND status IN ?", userID, taskShareSave, []string{model.TaskPending, model.TaskRunning}).
+		Find(&active)
+	for i := range active {
+		var p ShareSavePayload
+		if err := json.Unmarshal([]byte(active[i].Payload), &p); err == nil && p == payload {
+			return toTaskInfo(&active[i]), nil
+		}
+	}
+
+	size, err := shareSaveSize(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuota(userID, size); err != nil {
+		return nil, err
+	}
+
+	// 转存同样计入下载次数
+	if err := ConsumeShareDownload(share); err != nil {
+		return nil, err
+	}
+	return submitTask(userID, taskShareSave, payload)
+}
+
+// shareSaveSize 要转存的文件总大小
+func shareSaveSize(file *model.File) (int64, error) {
+	if !file.IsFolder {
+		return file.Size, nil
+	}
+	return GetFolderSize(file.UserID, file.ID)
+}
+
+// checkQuota 校验用户剩余空间能否容纳 size 字节
+func checkQuota(userID uint, size int64) error {
+	var user model.User
+	if err := model.DB.First(&user, userID).Error; err != nil {
+		return errors.New("用户不存在")
+	}
+	if user.UsedSize+size > user.TotalSize {
+		return errors.New("存储空间不足")
+	}
+	return nil
+}
+
+// runShareSaveTask 执行转存：按层级由浅到深复制文件记录 (不复制存储中的数据)，进度以文件数计
+// 分享在任务执行前被取消时任务失败；取消任务时已转存的文件保留
+func runShareSaveTask(tc *TaskContext) (interface{}, error) {
+	var p ShareSavePayload
+	if err := tc.Bind(&p); err != nil {
+		return nil, err
+	}
+	userID := tc.Task.UserID
+	if _, err := checkParentFolder(userID, p.ParentID); err != nil {
+		return nil, err
+	}
+
+	// 最后一次下载会使分享立即过期，这里只要求分享未被取消
+	var share model.Share
+	if err := model.DB.First(&share, p.ShareID).Error; err != nil {
+		return nil, errors.New("分享已被取消")
+	}
+	var root model.File
+	if err := model.DB.First(&root, share.FileID).Error; err != nil {
+		return nil, errors.New("文件已丢失")
+	}
+	src, err := ResolveShareFile(&share, &root, p.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []model.File{*src}
+	if src.IsFolder {
+		descendants, err := model.GetDescendants(model.DB.Where("user_id = ?", src.UserID), src)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, descendants...)
+	}
+	var total int64
+	for _, f := range files {
+		total += f.Size
+	}
+	if err := checkQuota(userID, total); err != nil {
+		return nil, err
+	}
+	tc.SetTotal(int64(len(files)))
+
+	s := &shareSaver{
+		userID:   userID,
+		conflict: p.Conflict,
+		result:   &ShareSaveResult{Skipped: []string{}},
+		folders:  map[uint]uint{src.ParentID: p.ParentID},
+		paths:    map[uint]string{src.ParentID: ""},
+	}
+	for i := range files {
+		if err := tc.Err(); err != nil {
+			s.flushIndex()
+			return s.result, err
+		}
+		if err := s.save(&files[i]); err != nil {
+			s.flushIndex()
+			return s.result, err
+		}
+		tc.Advance(1)
+	}
+	return s.result, s.flushIndex()
+}
+
+// shareSaver 转存过程中源目录到目标目录的映射与冲突处理状态
+type shareSaver struct {
+	userID   uint
+	conflict string
+	result   *ShareSaveResult
+	folders  map[uint]uint   // 源目录 ID -> 目标目录 ID
+	paths    map[uint]string // 源目录 ID -> 相对路径，用于记录跳过的项
+	indexIDs []uint
+}
+
+func (s *shareSaver) save(f *model.File) error {
+	parentID, ok := s.folders[f.ParentID]
+	if !ok {
+		// 父目录被跳过，或位于已删除的目录中
+		return nil
+	}
+	p := path.Join(s.paths[f.ParentID], f.Name)
+
+	name, existing, skip, err := resolveNameConflict(s.userID, parentID, f.Name, f.IsFolder, s.conflict)
+	if err != nil {
+		return err
+	}
+	if skip {
+		s.result.Skipped = append(s.result.Skipped, p)
+		return nil
+	}
+	if existing != nil {
+		// 同名文件夹合并
+		s.folders[f.ID], s.paths[f.ID] = existing.ID, p
+		return nil
+	}
+
+	newFile := model.File{
+		Name:     name,
+		Size:     f.Size,
+		Hash:     f.Hash,
+		Path:     f.Path,
+		Ext:      f.Ext,
+		MimeType: f.MimeType,
+		Category: f.Category,
+		IsFolder: f.IsFolder,
+		ParentID: parentID,
+		UserID:   s.userID,
+		PolicyID: f.PolicyID,
+	}
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newFile).Error; err != nil {
+			return err
+		}
+		if f.IsFolder {
+			return nil
+		}
+		return tx.Model(&model.User{}).Where("id = ?", s.userID).UpdateColumn("used_size", gorm.Expr("used_size + ?", f.Size)).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if f.IsFolder {
+		s.folders[f.ID], s.paths[f.ID] = newFile.ID, p
+		s.result.Folders++
+		return nil
+	}
+	s.result.Files++
+	s.result.Size += f.Size
+	s.indexIDs = append(s.indexIDs, newFile.ID)
+	if len(s.indexIDs) >= shareSaveIndexBatch {
+		return s.flushIndex()
+	}
+	return nil
+}
+
+// flushIndex 为已转存的文件提交索引任务
+func (s *shareSaver) flushIndex() error {
+	if len(s.indexIDs) == 0 {
+		return nil
+	}
+	err := enqueueIndex(model.DB, s.indexIDs, true)
+	s.indexIDs = nil
+	return err
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"gorm.io/gorm"
+)
+
+const (
+	maxShareStatBuckets  = 400
+	defaultShareTopFiles = 10
+	maxShareTopFiles     = 100
+)
+
+// ShareVisitor 访问分享的访客
+type ShareVisitor struct {
+	UserID    uint // 已登录访客，匿名为 0
+	IP        string
+	UserAgent string
+}
+
+// ShareSummary 时间范围内各类访问的次数
+type ShareSummary struct {
+	Views          int64 `json:"views"`
+	Visitors       int64 `json:"visitors"` // 按 IP 去重的访客数
+	Verifies       int64 `json:"verifies"`
+	VerifyFailures int64 `json:"verifyFailures"`
+	Downloads      int64 `json:"downloads"`
+	Previews       int64 `json:"previews"`
+	Saves          int64 `json:"saves"`
+	Uploads        int64 `json:"uploads"`
+}
+
+// ShareSeriesPoint 按日期 (或月份) 统计的访问次数
+type ShareSeriesPoint struct {
+	Date      string `json:"date"`
+	Views     int64  `json:"views"`
+	Downloads int64  `json:"downloads"`
+	Previews  int64  `json:"previews"`
+	Saves     int64  `json:"saves"`
+	Uploads   int64  `json:"uploads"`
+}
+
+// ShareStats 分享的访问统计
+type ShareStats struct {
+	ShareID        uint               `json:"shareId"`
+	TotalViews     int                `json:"totalViews"`
+	TotalDownloads int                `json:"totalDownloads"`
+	From           time.Time          `json:"from"`
+	To             time.Time          `json:"to"`
+	Summary        ShareSummary       `json:"summary"`
+	Series         []ShareSeriesPoint `json:"series"`
+}
+
+// ShareFileStat 分享中单个文件的访问次数
+type ShareFileStat struct {
+	FileID    uint   `json:"fileId"`
+	Name      string `json:"name"` // 文件已被彻底删除时为空
+	Downloads int64  `json:"downloads"`
+	Previews  int64  `json:"previews"`
+	Saves     int64  `json:"saves"`
+	Total     int64  `json:"total"`
+}
+
+// truncateUTF8 按字节截断字符串，不截断多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// RecordShareAccess 记录一次分享访问，日志写入失败不影响访问本身
+func RecordShareAccess(shareID uint, action string, fileID uint, v ShareVisitor) {
+	model.DB.Create(&model.ShareAccessLog{
+		ShareID:   shareID,
+		Action:    action,
+		FileID:    fileID,
+		UserID:    v.UserID,
+		IP:        truncateUTF8(v.IP, 45),
+		UserAgent: truncateUTF8(v.UserAgent, 255),
+	})
+}
+
+// ownedShare 查找用户自己的分享 (包括已过期的分享)
+func ownedShare(userID uint, shareID uint) (*model.Share, error) {
+	var share model.Share
+	if err := model.DB.Where("id = ? AND user_id = ?", shareID, userID).First(&share).Error; err != nil {
+		return nil, ErrShareNotFound
+	}
+	return &share, nil
+}
+
+// statRange 统计的时间范围，默认按天统计最近 30 天、按月统计最近 12 个月
+func statRange(group string, from *time.Time, to *time.Time) (time.Time, time.Time) {
+	end := time.Now()
+	if to != nil {
+		end = *to
+	}
+	var start time.Time
+	switch {
+	case from != nil:
+		start = *from
+	case group == timelineGroupMonth:
+		start = time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, end.Location()).AddDate(0, -11, 0)
+	default:
+		start = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, end.Location()).AddDate(0, 0, -29)
+	}
+	return start, end
+}
+
+// GetShareStats 统计分享在时间范围内的访问情况，series 中没有访问的日期补 0
+func GetShareStats(userID uint, shareID uint, group string, from *time.Time, to *time.Time) (*ShareStats, error) {
+	layout, format, err := timelineLayout(group)
+	if err != nil {
+		return nil, err
+	}
+	share, err := ownedShare(userID, shareID)
+	if err != nil {
+		return nil, err
+	}
+	start, end := statRange(group, from, to)
+	if start.After(end) {
+		return nil, errors.New("时间范围不合法")
+	}
+
+	// 补全范围内的每个日期
+	step := func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	cursor := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	if group == timelineGroupMonth {
+		step = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+		cursor = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+	}
+	series := []ShareSeriesPoint{}
+	index := map[string]int{}
+	for ; !cursor.After(end); cursor = step(cursor) {
+		if len(series) >= maxShareStatBuckets {
+			return nil, errors.New("时间范围过大")
+		}
+		date := cursor.Format(layout)
+		index[date] = len(series)
+		series = append(series, ShareSeriesPoint{Date: date})
+	}
+
+	scope := model.DB.Model(&model.ShareAccessLog{}).Where("share_id = ? AND created_at >= ? AND created_at <= ?", share.ID, start, end)
+
+	stats := &ShareStats{ShareID: share.ID, TotalViews: share.Views, TotalDownloads: share.Downloads, From: start, To: end}
+	var counts []struct {
+		Action string
+		Count  int64
+	}
+	if err := scope.Session(&gorm.Session{}).Select("action, COUNT(*) AS count").Group("action").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range counts {
+		switch row.Action {
+		case model.ShareActionView:
+			stats.Summary.Views = row.Count
+		case model.ShareActionVerify:
+			stats.Summary.Verifies = row.Count
+		case model.ShareActionVerifyFailed:
+			stats.Summary.VerifyFailures = row.Count
+		case model.ShareActionDownload:
+			stats.Summary.Downloads = row.Count
+		case model.ShareActionPreview:
+			stats.Summary.Previews = row.Count
+		case model.ShareActionSave:
+			stats.Summary.Saves = row.Count
+		case model.ShareActionUpload:
+			stats.Summary.Uploads = row.Count
+		}
+	}
+	if err := scope.Session(&gorm.Session{}).Where("action = ?", model.ShareActionView).
+		Distinct("ip").Count(&stats.Summary.Visitors).Error; err != nil {
+		return nil, err
+	}
+
+	expr := "DATE_FORMAT(created_at, '" + format + "')"
+	var rows []struct {
+		Date   string
+		Action string
+		Count  int64
+	}
+	if err := scope.Session(&gorm.Session{}).Select(expr + " AS date, action, COUNT(*) AS count").
+		Group(expr + ", action").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		i, ok := index[row.Date]
+		if !ok {
+			continue
+		}
+		switch row.Action {
+		case model.ShareActionView:
+			series[i].Views = row.Count
+		case model.ShareActionDownload:
+			series[i].Downloads = row.Count
+		case model.ShareActionPreview:
+			series[i].Previews = row.Count
+		case model.ShareActionSave:
+			series[i].Saves = row.Count
+		case model.ShareActionUpload:
+			series[i].Uploads = row.Count
+		}
+	}
+	stats.Series = series
+	return stats, nil
+}
+
+// TopShareFiles 统计分享中下载、预览与转存次数最多的文件
+func TopShareFiles(userID uint, shareID uint, limit int, from *time.Time, to *time.Time) ([]ShareFileStat, error) {
+	share, err := ownedShare(userID, shareID)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultShareTopFiles
+	}
+	if limit > maxShareTopFiles {
+		limit = maxShareTopFiles
+	}
+
+	db := model.DB.Model(&model.ShareAccessLog{}).
+		Where("share_id = ? AND file_id <> 0 AND action IN ?", share.ID,
+			[]string{model.ShareActionDownload, model.ShareActionPreview, model.ShareActionSave})
+	if from != nil {
+		db = db.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		db = db.Where("created_at <= ?", *to)
+	}
+
+	stats := []ShareFileStat{}
+	err = db.Select("file_id, "+
+		"SUM(CASE WHEN action = ? THEN 1 ELSE 0 END) AS downloads, "+
+		"SUM(CASE WHEN action = ? THEN 1 ELSE 0 END) AS previews, "+
+		"SUM(CASE WHEN action = ? THEN 1 ELSE 0 END) AS saves, "+
+		"COUNT(*) AS total",
+		model.ShareActionDownload, model.ShareActionPreview, model.ShareActionSave).
+		Group("file_id").Order("total DESC, file_id ASC").Limit(limit).Scan(&stats).Error
+	if err != nil || len(stats) == 0 {
+		return stats, err
+	}
+
+	ids := make([]uint, 0, len(stats))
+	for _, s := range stats {
+		ids = append(ids, s.FileID)
+	}
+	var files []model.File
+	model.DB.Unscoped().Select("id, name").Where("id IN ? AND user_id = ?", ids, share.UserID).Find(&files)
+	names := make(map[uint]string, len(files))
+	for _, f := range files {
+		names[f.ID] = f.Name
+	}
+	for i := range stats {
+		stats[i].Name = names[stats[i].FileID]
+	}
+	return stats, nil
+}
+
+// ListShareAccessLogs 按时间倒序列出分享的访问日志，action 为空时列出全部
+func ListShareAccessLogs(userID uint, shareID uint, action string, q ListQuery) ([]model.ShareAccessLog, Page, error) {
+	share, err := ownedShare(userID, shareID)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	db := model.DB.Model(&model.ShareAccessLog{}).Where("share_id = ?", share.ID)
+	if action != "" {
+		db = db.Where("action = ?", action)
+	}
+	if q.From != nil {
+		db = db.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("created_at <= ?", *q.To)
+	}
+	desc := q.descOr(true)
+	return paginate(db, q, []sortField[model.ShareAccessLog]{
+		{Column: "created_at", Desc: desc, Value: func(l *model.ShareAccessLog) interface{} { return cursorTime(l.CreatedAt) }},
+		{Column: "id", Desc: desc, Value: func(l *model.ShareAccessLog) interface{} { return l.ID }},
+	})
+}
+
+// cleanShareAccessLogs 删除超过保留天数的分享访问日志
+func cleanShareAccessLogs(days int) (int64, error) {
+	result := model.DB.Where("created_at < ?", time.Now().AddDate(0, 0, -days)).Delete(&model.ShareAccessLog{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxTagLength       = 50
+	maxMetaValueLength = 255
+)
+
+// TagStat 标签及其使用次数
+type TagStat struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+var metaKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,50}$`)
+
+// 元数据键不能与检索语法中的内置字段重名
+var reservedMetaKeys = map[string]bool{"name": true, "content": true, "tag": true, "meta": true}
+
+// normalizeTag 标签不区分大小写，统一转为小写存储
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// validateTags 校验并去重标签
+func validateTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, errors.New("标签长度不能超过 50 个字符")
+		}
+		if strings.ContainsAny(tag, ":\"") || strings.IndexFunc(tag, unicode.IsSpace) >= 0 {
+			return nil, errors.New("标签不能包含空白字符、冒号或引号")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("标签不能为空")
+	}
+	return result, nil
+}
+
+// validateMetaKey 校验元数据键
+func validateMetaKey(key string) (string, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if !metaKeyPattern.MatchString(key) {
+		return "", errors.New("元数据键只能包含字母、数字、下划线、点和短横线")
+	}
+	if reservedMetaKeys[key] {
+		return "", errors.New("元数据键为保留字段")
+	}
+	return key, nil
+}
+
+// getWritableFiles 获取用户可以修改的文件 (含共享给自己且有写权限的文件)，任意一个不存在即返回错误
+// 标签与元数据属于文件本身，归属文件所有者
+func getWritableFiles(userID uint, fileIDs []uint) ([]*model.File, error) {
+	if len(fileIDs) == 0 {
+		return nil, errors.New("请选择文件")
+	}
+	files, missing, err := authorizeFiles(userID, fileIDs, model.PermissionWrite)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, ErrFileNotFound
+	}
+	return files, nil
+}
+
+// AddTags 为多个文件批量添加标签
+func AddTags(userID uint, fileIDs []uint, tags []string) error {
+	tags, err := validateTags(tags)
+	if err != nil {
+		return err
+	}
+	files, err := getWritableFiles(userID, fileIDs)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]model.FileTag, 0, len(files)*len(tags))
+	for _, f := range files {
+		for _, tag := range tags {
+			rows = append(rows, model.FileTag{FileID: f.ID, UserID: f.UserID, Name: tag})
+		}
+	}
+	if err := model.DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, 500).Error; err != nil {
+		return err
+	}
+
+	ReindexAttributes(fileIDs...)
+	return nil
+}
+
+// RemoveTags 批量移除多个文件的标签
+func RemoveTags(userID uint, fileIDs []uint, tags []string) error {
+	tags, err := validateTags(tags)
+	if err != nil {
+		return err
+	}
+	if _, err := getWritableFiles(userID, fileIDs); err != nil {
+		return err
+	}
+
+	if err := model.DB.Where("file_id IN ? AND name IN ?", fileIDs, tags).Delete(&model.FileTag{}).Error; err != nil {
+		return err
+	}
+
+	ReindexAttributes(fileIDs...)
+	return nil
+}
+
+// ListTags 列出用户使用过的标签及其文件数
+func ListTags(userID uint) ([]TagStat, error) {
+	stats := []TagStat{}
+	err := model.DB.Model(&model.FileTag{}).
+		Select("file_tags.name, COUNT(*) AS count").
+		Joins("JOIN files ON files.id = file_tags.file_id AND files.deleted_at IS NULL").
+		Where("file_tags.user_id = ?", userID).
+		Group("file_tags.name").
+		Order("count DESC, file_tags.name ASC").
+		Scan(&stats).Error
+	return stats, err
+}
+
+// ListTagged 跨目录列出带有指定标签的文件
+func ListTagged(userID uint, tag string, q ListQuery) ([]model.File, Page, error) {
+	q.Tag = tag
+	db := model.DB.Model(&model.File{}).Where("files.user_id = ?", userID)
+	return listFiles(db, q, "files.updated_at")
+}
+
+// SetMeta 为多个文件批量设置元数据，已存在的键覆盖其值
+func SetMeta(userID uint, fileIDs []uint, meta map[string]string) error {
+	if len(meta) == 0 {
+		return errors.New("元数据不能为空")
+	}
+	values := make(map[string]string, len(meta))
+	for k, v := range meta {
+		key, err := validateMetaKey(k)
+		if err != nil {
+			return err
+		}
+		v = strings.TrimSpace(v)
+		if utf8.RuneCountInString(v) > maxMetaValueLength {
+			return errors.New("元数据值长度不能超过 255 个字符")
+		}
+		values[key] = v
+	}
+
+	files, err := getWritableFiles(userID, fileIDs)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]model.FileMeta, 0, len(files)*len(values))
+	for _, f := range files {
+		for k, v := range values {
+			rows = append(rows, model.FileMeta{FileID: f.ID, UserID: f.UserID, Key: k, Value: v})
+		}
+	}
+	err = model.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).CreateInBatches(rows, 500).Error
+	if err != nil {
+		return err
+	}
+
+	ReindexAttributes(fileIDs...)
+	return nil
+}
+
+// RemoveMeta 批量移除多个文件的元数据键
+func RemoveMeta(userID uint, fileIDs []uint, keys []string) error {
+	var normalized []string
+	for _, k := range keys {
+		key, err := validateMetaKey(k)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, key)
+	}
+	if len(normalized) == 0 {
+		return errors.New("元数据键不能为空")
+	}
+
+	if _, err := getWritableFiles(userID, fileIDs); err != nil {
+		return err
+	}
+
+	if err := model.DB.Where("file_id IN ? AND `key` IN ?", fileIDs, normalized).Delete(&model.FileMeta{}).Error; err != nil {
+		return err
+	}
+
+	ReindexAttributes(fileIDs...)
+	return nil
+}
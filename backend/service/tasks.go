@@ -2,6 +2,7 @@ package service
 
 import (
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/stfreya/stfreyanetdisk/model"
@@ -34,8 +35,56 @@ func StartBackgroundTasks() {
 		}
 	}()
 
+	// 早期明文保存的分享提取码改为哈希
+	go hashLegacySharePasswords()
+
+	// 定期清理过期的分享访问日志
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			days, err := strconv.Atoi(model.GetConfig("share_log_retention_days", "180"))
+			if err == nil && days > 0 {
+				if count, err := cleanShareAccessLogs(days); err != nil {
+					log.Printf("[Task] 清理分享访问日志失败: %v", err)
+				} else if count > 0 {
+					log.Printf("[Task] 已清理 %d 条过期的分享访问日志", count)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+
+	// 定期提醒即将过期的分享，并删除过期较久的分享
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			hours, err := strconv.Atoi(model.GetConfig("share_expire_notice_hours", "24"))
+			if err == nil && hours > 0 {
+				if _, err := NotifyExpiringShares(time.Duration(hours) * time.Hour); err != nil {
+					log.Printf("[Task] 发送分享过期提醒失败: %v", err)
+				}
+			}
+			days, err := strconv.Atoi(model.GetConfig("share_expired_retention_days", "7"))
+			if err == nil && days >= 0 {
+				if count, err := CleanExpiredShares(time.Duration(days) * 24 * time.Hour); err != nil {
+					log.Printf("[Task] 清理过期分享失败: %v", err)
+				} else if count > 0 {
+					log.Printf("[Task] 已清理 %d 个过期的分享", count)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+
+	// 2. 搜索索引队列 (抽取正文并建立索引)
+	startIndexWorkers()
+
+	// 3. 用户发起的后台任务 (解压等)
+	startTaskWorkers()
+
 	// 可以在这里添加更多后台任务，例如：
-	// - 清理过期的分享链接
 	// - 清理孤立的文件块
 	// - 统计系统资源使用情况
 }
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+	"github.com/stfreya/stfreyanetdisk/utils"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultThumbMaxMB = 30
+
+// 上传或内容变化后在后台预先生成的缩略图，其余尺寸在首次访问时生成
+var pregeneratedThumbs = []string{"small", "medium"}
+
+// ErrThumbUnsupported 文件类型不支持生成缩略图
+var ErrThumbUnsupported = errors.New("该文件不支持缩略图")
+
+// ErrFileNotFound 文件不存在或不属于当前用户
+var ErrFileNotFound = errors.New("文件不存在")
+
+// 同一缩略图的并发请求只生成一次
+var thumbGroup singleflight.Group
+
+func init() {
+	registerContentProcessor(pregenerateThumbnails)
+}
+
+// thumbMaxSourceSize 生成缩略图的原图大小上限
+func thumbMaxSourceSize() int64 {
+	mb, err := strconv.ParseInt(model.GetConfig("thumb_max_source_size", strconv.Itoa(defaultThumbMaxMB)), 10, 64)
+	if err != nil || mb <= 0 {
+		mb = defaultThumbMaxMB
+	}
+	return mb * 1024 * 1024
+}
+
+// thumbPolicyID 缩略图使用的存储策略，未配置时与原文件相同
+func thumbPolicyID(file *model.File) uint {
+	id, err := strconv.ParseUint(model.GetConfig("thumb_policy_id", "0"), 10, 32)
+	if err != nil || id == 0 {
+		return file.PolicyID
+	}
+	return uint(id)
+}
+
+// thumbnailable 判断文件是否可生成缩略图 (SVG 等矢量图直接预览原图即可)
+func thumbnailable(file *model.File) bool {
+	if file.IsFolder || file.Path == "" || file.Category != utils.CategoryImage {
+		return false
+	}
+	switch file.MimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp", "image/tiff":
+		return true
+	}
+	return false
+}
+
+// GetThumbnail 获取文件缩略图，尚未生成时立即生成
+func GetThumbnail(userID uint, fileID uint, size string, format string) (*model.Thumbnail, error) {
+	if _, ok := utils.ThumbSizes[size]; !ok {
+		return nil, errors.New("不支持的缩略图尺寸")
+	}
+	if format != utils.ThumbJPEG && format != utils.ThumbWebP {
+		return nil, errors.New("不支持的缩略图格式")
+	}
+
+	access, err := AuthorizeFile(userID, fileID, model.PermissionRead)
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+	return ensureThumbnail(access.File, size, format)
+}
+
+// OpenThumbnail 读取缩略图内容
+func OpenThumbnail(thumb *model.Thumbnail) (io.ReadCloser, error) {
+	d, err := getPolicyDriver(thumb.PolicyID)
+	if err != nil {
+		return nil, err
+	}
+	return d.Get(thumb.Path)
+}
+
+// ensureThumbnail 返回已缓存的缩略图，不存在时生成
+func ensureThumbnail(file *model.File, size string, format string) (*model.Thumbnail, error) {
+	if !thumbnailable(file) {
+		return nil, ErrThumbUnsupported
+	}
+
+	var thumb model.Thumbnail
+	if err := model.DB.Where("file_id = ? AND size = ? AND format = ?", file.ID, size, format).First(&thumb).Error; err == nil {
+		return &thumb, nil
+	}
+
+	key := fmt.Sprintf("%d/%s/%s", file.ID, size, format)
+	v, err, _ := thumbGroup.Do(key, func() (interface{}, error) {
+		data, err := readThumbSource(file)
+		if err != nil {
+			return nil, err
+		}
+		return createThumbnail(file, data, size, format)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*model.Thumbnail), nil
+}
+
+// readThumbSource 读取原图，超出大小上限时不生成缩略图
+func readThumbSource(file *model.File) ([]byte, error) {
+	if file.Size > thumbMaxSourceSize() {
+		return nil, ErrThumbUnsupported
+	}
+	return readFileData(file)
+}
+
+// createThumbnail 生成缩略图，写入存储并记录
+func createThumbnail(file *model.File, data []byte, size string, format string) (*model.Thumbnail, error) {
+	out, width, height, err := utils.MakeThumbnail(data, utils.ThumbSizes[size], format)
+	if err != nil {
+		if errors.Is(err, utils.ErrImageTooLarge) {
+			return nil, ErrThumbUnsupported
+		}
+		return nil, fmt.Errorf("缩略图生成失败: %w", err)
+	}
+
+	policyID := thumbPolicyID(file)
+	d, err := getPolicyDriver(policyID)
+	if err != nil {
+		return nil, err
+	}
+	thumb := model.Thumbnail{
+		FileID:   file.ID,
+		Size:     size,
+		Format:   format,
+		Path:     fmt.Sprintf("thumbs/%d/%d_%s.%s", file.UserID, file.ID, size, format),
+		PolicyID: policyID,
+		Width:    width,
+		Height:   height,
+		Bytes:    int64(len(out)),
+	}
+	if err := d.Put(thumb.Path, bytes.NewReader(out), thumb.Bytes); err != nil {
+		return nil, err
+	}
+
+	err = model.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "size"}, {Name: "format"}},
+		DoUpdates: clause.AssignmentColumns([]string{"path", "policy_id", "width", "height", "bytes", "created_at"}),
+	}).Create(&thumb).Error
+	if err != nil {
+		return nil, err
+	}
+	// 冲突更新时 ID 不会回填，重新读取
+	if err := model.DB.Where("file_id = ? AND size = ? AND format = ?", file.ID, size, format).First(&thumb).Error; err != nil {
+		return nil, err
+	}
+	return &thumb, nil
+}
+
+// pregenerateThumbnails 文件内容变化后在后台生成常用尺寸的缩略图
+func pregenerateThumbnails(file *model.File) {
+	if !thumbnailable(file) {
+		return
+	}
+	data, err := readThumbSource(file)
+	if err != nil {
+		if err != ErrThumbUnsupported {
+			log.Printf("[Thumb] 读取文件 %d 失败: %v", file.ID, err)
+		}
+		return
+	}
+	for _, size := range pregeneratedThumbs {
+		if _, err := createThumbnail(file, data, size, utils.ThumbJPEG); err != nil {
+			log.Printf("[Thumb] 文件 %d 生成 %s 缩略图失败: %v", file.ID, size, err)
+			return
+		}
+	}
+}
+
+// invalidateThumbnails 文件内容变化或删除后清除已生成的缩略图
+func invalidateThumbnails(tx *gorm.DB, fileIDs []uint) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	var thumbs []model.Thumbnail
+	if err := tx.Where("file_id IN ?", fileIDs).Find(&thumbs).Error; err != nil {
+		return err
+	}
+	if len(thumbs) == 0 {
+		return nil
+	}
+	if err := tx.Where("file_id IN ?", fileIDs).Delete(&model.Thumbnail{}).Error; err != nil {
+		return err
+	}
+	for _, thumb := range thumbs {
+		if d, err := getPolicyDriver(thumb.PolicyID); err == nil {
+			_ = d.Delete(thumb.Path)
+		}
+	}
+	return nil
+}
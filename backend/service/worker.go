@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/stfreya/stfreyanetdisk/model"
+)
+
+const (
+	taskWorkerCount      = 2
+	taskPollInterval     = 5 * time.Second
+	taskProgressInterval = time.Second
+	maxActiveTasks       = 10
+)
+
+// TaskInfo 后台任务信息
+type TaskInfo struct {
+	ID         uint            `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Payload    json.RawMessage `json:"payload"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Done       int64           `json:"done"`
+	Total      int64           `json:"total"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// TaskContext 任务执行上下文，用于读取参数、汇报进度与响应取消
+type TaskContext struct {
+	context.Context
+	Task *model.Task
+
+	mu         sync.Mutex
+	done       int64
+	total      int64
+	lastReport time.Time
+}
+
+// Bind 解析任务参数
+func (tc *TaskContext) Bind(v interface{}) error {
+	return json.Unmarshal([]byte(tc.Task.Payload), v)
+}
+
+// SetTotal 设置任务总量
+func (tc *TaskContext) SetTotal(total int64) {
+	tc.mu.Lock()
+	tc.total = total
+	tc.mu.Unlock()
+	tc.flush(true)
+}
+
+// Advance 增加已完成量，进度按固定间隔写入数据库
+func (tc *TaskContext) Advance(n int64) {
+	tc.mu.Lock()
+	tc.done += n
+	tc.mu.Unlock()
+	tc.flush(false)
+}
+
+// Reader 包装数据流：读取的字节数计入进度，任务取消后读取立即失败
+func (tc *TaskContext) Reader(r io.Reader) io.Reader {
+	return &taskReader{tc: tc, r: r}
+}
+
+type taskReader struct {
+	tc *TaskContext
+	r  io.Reader
+}
+
+func (t *taskReader) Read(p []byte) (int, error) {
+	if err := t.tc.Err(); err != nil {
+		return 0, err
+	}
+	n, err := t.r.Read(p)
+	t.tc.Advance(int64(n))
+	return n, err
+}
+
+func (tc *TaskContext) flush(force bool) {
+	tc.mu.Lock()
+	if !force && time.Since(tc.lastReport) < taskProgressInterval {
+		tc.mu.Unlock()
+		return
+	}
+	tc.lastReport = time.Now()
+	done, total := tc.done, tc.total
+	tc.mu.Unlock()
+	model.DB.Model(&model.Task{}).Where("id = ?", tc.Task.ID).Updates(map[string]interface{}{"done": done, "total": total})
+}
+
+// taskHandler 任务处理函数，返回值序列化后保存为任务结果
+type taskHandler func(tc *TaskContext) (interface{}, error)
+
+type taskKind struct {
+	name    string // 用于通知消息的任务名称
+	handler taskHandler
+}
+
+var (
+	taskKinds   = make(map[string]taskKind)
+	taskWake    = make(chan struct{}, 1)
+	runningMu   sync.Mutex
+	runningTask = make(map[uint]context.CancelFunc)
+)
+
+// registerTaskHandler 注册任务类型
+func registerTaskHandler(typ string, name string, handler taskHandler) {
+	taskKinds[typ] = taskKind{name: name, handler: handler}
+}
+
+// submitTask 提交后台任务
+func submitTask(userID uint, typ string, payload interface{}) (*TaskInfo, error) {
+	if _, ok := taskKinds[typ]; !ok {
+		return nil, errors.New("不支持的任务类型")
+	}
+	var active int64
+	model.DB.Model(&model.Task{}).Where("user_id = ? AND status IN ?", userID, []string{model.TaskPending, model.TaskRunning}).Count(&active)
+	if active >= maxActiveTasks {
+		return nil, fmt.Errorf("进行中的任务过多 (最多 %d 个)，请稍后再试", maxActiveTasks)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	task := model.Task{UserID: userID, Type: typ, Status: model.TaskPending, Payload: string(data)}
+	if err := model.DB.Create(&task).Error; err != nil {
+		return nil, err
+	}
+	select {
+	case taskWake <- struct{}{}:
+	default:
+	}
+	return toTaskInfo(&task), nil
+}
+
+func toTaskInfo(t *model.Task) *TaskInfo {
+	info := &TaskInfo{
+		ID:         t.ID,
+		Type:       t.Type,
+		Status:     t.Status,
+		Payload:    json.RawMessage(t.Payload),
+		Error:      t.Error,
+		Done:       t.Done,
+		Total:      t.Total,
+		CreatedAt:  t.CreatedAt,
+		UpdatedAt:  t.UpdatedAt,
+		FinishedAt: t.FinishedAt,
+	}
+	if t.Result != "" {
+		info.Result = json.RawMessage(t.Result)
+	}
+	if t.Payload == "" {
+		info.Payload = json.RawMessage("null")
+	}
+	return info
+}
+
+// GetTask 获取任务详情
+func GetTask(userID uint, taskID uint) (*TaskInfo, error) {
+	var task model.Task
+	if err := model.DB.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
+		return nil, errors.New("任务不存在")
+	}
+	return toTaskInfo(&task), nil
+}
+
+// ListTasks 获取用户的任务列表，按创建时间倒序
+func ListTasks(userID uint, q ListQuery) ([]TaskInfo, Page, error) {
+	db := model.DB.Model(&model.Task{}).Where("user_id = ?", userID)
+	if q.Keyword != "" {
+		db = db.Where("type = ?", q.Keyword)
+	}
+	tasks, page, err := paginate(db, q, []sortField[model.Task]{
+		{Column: "id", Desc: q.descOr(true), Value: func(t *model.Task) interface{} { return t.ID }},
+	})
+	if err != nil {
+		return nil, Page{}, err
+	}
+	infos := make([]TaskInfo, 0, len(tasks))
+	for i := range tasks {
+		infos = append(infos, *toTaskInfo(&tasks[i]))
+	}
+	return infos, page, nil
+}
+
+// CancelTask 取消任务：排队中的任务直接取消，执行中的任务在下一个检查点停止
+func CancelTask(userID uint, taskID uint) error {
+	var task model.Task
+	if err := model.DB.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
+		return errors.New("任务不存在")
+	}
+
+	result := model.DB.Model(&model.Task{}).Where("id = ? AND status = ?", task.ID, model.TaskPending).
+		Updates(map[string]interface{}{"status": model.TaskCanceled, "finished_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	runningMu.Lock()
+	cancel, ok := runningTask[task.ID]
+	runningMu.Unlock()
+	if !ok {
+		return errors.New("任务已结束")
+	}
+	cancel()
+	return nil
+}
+
+// DeleteTask 删除已结束的任务记录
+func DeleteTask(userID uint, taskID uint) error {
+	result := model.DB.Where("id = ? AND user_id = ? AND status NOT IN ?", taskID, userID, []string{model.TaskPending, model.TaskRunning}).
+		Delete(&model.Task{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("任务不存在或尚未结束")
+	}
+	return nil
+}
+
+// startTaskWorkers 启动后台任务调度，服务重启前未完成的任务标记为失败
+func startTaskWorkers() {
+	model.DB.Model(&model.Task{}).Where("status = ?", model.TaskRunning).
+		Updates(map[string]interface{}{"status": model.TaskFailed, "error": "服务重启，任务中断", "finished_at": time.Now()})
+
+	sem := make(chan struct{}, taskWorkerCount)
+	go func() {
+		for {
+			sem <- struct{}{}
+			task, ok := claimTask()
+			if !ok {
+				<-sem
+				select {
+				case <-taskWake:
+				case <-time.After(taskPollInterval):
+				}
+				continue
+			}
+			go func() {
+				defer func() { <-sem }()
+				runTask(task)
+			}()
+		}
+	}()
+}
+
+// claimTask 取出最早的待执行任务并标记为执行中
+func claimTask() (*model.Task, bool) {
+	for {
+		var task model.Task
+		if err := model.DB.Where("status = ?", model.TaskPending).Order("id ASC").First(&task).Error; err != nil {
+			return nil, false
+		}
+		result := model.DB.Model(&model.Task{}).Where("id = ? AND status = ?", task.ID, model.TaskPending).
+			Update("status", model.TaskRunning)
+		if result.Error != nil {
+			return nil, false
+		}
+		if result.RowsAffected == 1 {
+			task.Status = model.TaskRunning
+			return &task, true
+		}
+	}
+}
+
+// runTask 执行任务并保存结果，完成或失败时通知用户
+func runTask(task *model.Task) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runningMu.Lock()
+	runningTask[task.ID] = cancel
+	runningMu.Unlock()
+	defer func() {
+		runningMu.Lock()
+		delete(runningTask, task.ID)
+		runningMu.Unlock()
+	}()
+
+	kind := taskKinds[task.Type]
+	tc := &TaskContext{Context: ctx, Task: task, lastReport: time.Now()}
+	result, err := func() (result interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("任务异常: %v", p)
+			}
+		}()
+		if kind.handler == nil {
+			return nil, errors.New("不支持的任务类型")
+		}
+		return kind.handler(tc)
+	}()
+
+	updates := map[string]interface{}{"finished_at": time.Now()}
+	if result != nil {
+		if data, e := json.Marshal(result); e == nil {
+			updates["result"] = string(data)
+		}
+	}
+	tc.mu.Lock()
+	updates["done"], updates["total"] = tc.done, tc.total
+	tc.mu.Unlock()
+
+	switch {
+	case err == nil:
+		updates["status"] = model.TaskSucceeded
+		_ = SendMessage(task.UserID, kind.name+"完成", fmt.Sprintf("%s任务 #%d 已完成。", kind.name, task.ID), "success")
+	case errors.Is(err, context.Canceled):
+		updates["status"] = model.TaskCanceled
+	default:
+		updates["status"] = model.TaskFailed
+		updates["error"] = truncateError(err.Error())
+		_ = SendMessage(task.UserID, kind.name+"失败", fmt.Sprintf("%s任务 #%d 失败：%s", kind.name, task.ID, err.Error()), "error")
+		log.Printf("[Task] 任务 %d (%s) 失败: %v", task.ID, task.Type, err)
+	}
+	model.DB.Model(&model.Task{}).Where("id = ?", task.ID).Updates(updates)
+}
@@ -0,0 +1,353 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 支持在线浏览与解压的压缩包格式
+const (
+	ArchiveZip   = "zip"
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+)
+
+// MaxArchiveEntries 单个压缩包最多处理的成员数量
+var MaxArchiveEntries = 50000
+
+var (
+	// ErrNotArchive 不支持的压缩包格式
+	ErrNotArchive = errors.New("不支持的压缩包格式")
+	// ErrUnsafePath 成员路径越出解压目录 (zip slip) 或不合法
+	ErrUnsafePath = errors.New("压缩包成员路径不安全")
+	// ErrStopWalk 在回调中返回以提前结束遍历
+	ErrStopWalk = errors.New("stop walk")
+)
+
+// ArchiveEntry 压缩包成员
+type ArchiveEntry struct {
+	Name    string    `json:"name"` // 成员名称 (不含目录)
+	Path    string    `json:"path"` // 成员在压缩包中的完整路径
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	IsDir   bool      `json:"isDir"`
+}
+
+// ArchiveSource 压缩包数据源，ZIP 需要随机访问中央目录
+type ArchiveSource interface {
+	io.ReaderAt
+	io.ReadSeeker
+}
+
+// ArchiveVisitor 遍历回调，open 仅在回调期间有效
+type ArchiveVisitor func(entry ArchiveEntry, open func() (io.ReadCloser, error)) error
+
+// ArchiveFormat 根据文件名与 MIME 类型判断压缩包格式，不支持时返回空串
+func ArchiveFormat(name string, mimeType string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz
+	case strings.HasSuffix(lower, ".tar"):
+		return ArchiveTar
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip
+	}
+	switch {
+	case strings.HasPrefix(mimeType, "application/zip"):
+		return ArchiveZip
+	case strings.HasPrefix(mimeType, "application/x-tar"):
+		return ArchiveTar
+	}
+	return ""
+}
+
+// DecodeArchiveName 未设置 UTF-8 标志的旧压缩包文件名通常为 GBK 编码
+func DecodeArchiveName(name string) string {
+	if utf8.ValidString(name) {
+		return name
+	}
+	if decoded, err := simplifiedchinese.GB18030.NewDecoder().String(name); err == nil {
+		return decoded
+	}
+	return name
+}
+
+// SafeArchivePath 规范化成员路径，拒绝绝对路径、盘符与 ".." 等可能越出解压目录的路径
+func SafeArchivePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.ContainsRune(name, 0) || strings.HasPrefix(name, "/") {
+		return "", ErrUnsafePath
+	}
+	if len(name) >= 2 && name[1] == ':' {
+		return "", ErrUnsafePath
+	}
+
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		switch strings.TrimSpace(part) {
+		case "", ".":
+			continue
+		case "..":
+			return "", ErrUnsafePath
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "", ErrUnsafePath
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// WalkArchive 依次访问压缩包中的目录与普通文件，符号链接等特殊成员被忽略
+// 成员路径已解码为 UTF-8 并经过 SafeArchivePath 校验，不安全的路径不会访问，改为回调 onUnsafe
+func WalkArchive(format string, src ArchiveSource, size int64, visit ArchiveVisitor, onUnsafe func(name string)) error {
+	count := 0
+	emit := func(raw string, entry ArchiveEntry, open func() (io.ReadCloser, error)) error {
+		name := DecodeArchiveName(raw)
+		clean, err := SafeArchivePath(name)
+		if err != nil {
+			if onUnsafe != nil {
+				onUnsafe(name)
+			}
+			return nil
+		}
+		if count++; count > MaxArchiveEntries {
+			return errors.New("压缩包成员数量过多")
+		}
+		entry.Path = clean
+		entry.Name = path.Base(clean)
+		return visit(entry, open)
+	}
+
+	var err error
+	switch format {
+	case ArchiveZip:
+		err = walkZip(src, size, emit)
+	case ArchiveTar, ArchiveTarGz:
+		err = walkTar(format, src, emit)
+	default:
+		return ErrNotArchive
+	}
+	if errors.Is(err, ErrStopWalk) {
+		return nil
+	}
+	return err
+}
+
+type archiveEmitter func(raw string, entry ArchiveEntry, open func() (io.ReadCloser, error)) error
+
+func walkZip(src ArchiveSource, size int64, emit archiveEmitter) error {
+	zr, err := zip.NewReader(src, size)
+	if err != nil {
+		return ErrNotArchive
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if mode&fs.ModeSymlink != 0 || (!mode.IsDir() && !mode.IsRegular()) {
+			continue
+		}
+		isDir := mode.IsDir() || strings.HasSuffix(f.Name, "/")
+		entry := ArchiveEntry{Size: int64(f.UncompressedSize64), ModTime: f.Modified, IsDir: isDir}
+		if isDir {
+			entry.Size = 0
+		}
+		if err := emit(f.Name, entry, f.Open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(format string, src io.ReadSeeker, emit archiveEmitter) error {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var r io.Reader = src
+	if format == ArchiveTarGz {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return ErrNotArchive
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for first := true; ; first = false {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if first {
+				return ErrNotArchive
+			}
+			return err
+		}
+
+		var entry ArchiveEntry
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			entry = ArchiveEntry{ModTime: hdr.ModTime, IsDir: true}
+		case tar.TypeReg, tar.TypeRegA:
+			entry = ArchiveEntry{Size: hdr.Size, ModTime: hdr.ModTime}
+		default:
+			// 符号链接、硬链接与设备文件一律忽略
+			continue
+		}
+		open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		if err := emit(hdr.Name, entry, open); err != nil {
+			return err
+		}
+	}
+}
+
+// ArchiveChildren 由完整的成员列表得到 dir 目录下的直接子项，目录在前、按名称排序
+// 压缩包中常省略目录成员，此处根据文件路径补全；目录大小为其下文件大小之和
+func ArchiveChildren(entries []ArchiveEntry, dir string) []ArchiveEntry {
+	dir = strings.Trim(dir, "/")
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	children := make(map[string]*ArchiveEntry)
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Path, prefix) || e.Path == dir {
+			continue
+		}
+		rest := e.Path[len(prefix):]
+		name, _, nested := strings.Cut(rest, "/")
+		child, ok := children[name]
+		if !ok {
+			child = &ArchiveEntry{Name: name, Path: prefix + name, IsDir: nested || e.IsDir}
+			children[name] = child
+		}
+		if nested || e.IsDir {
+			child.IsDir = true
+			child.Size += e.Size
+		} else {
+			child.Size = e.Size
+		}
+		if e.ModTime.After(child.ModTime) {
+			child.ModTime = e.ModTime
+		}
+	}
+
+	result := make([]ArchiveEntry, 0, len(children))
+	for _, c := range children {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].IsDir != result[j].IsDir {
+			return result[i].IsDir
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// ArchiveWriter 打包写入器，成员路径使用 "/" 分隔
+type ArchiveWriter interface {
+	AddDir(name string, modTime time.Time) error
+	// AddFile 写入 size 字节的文件内容，r 提前结束时该成员按已读取的内容截断 (TAR 以零补齐)，
+	// 压缩包本身仍保持完整，返回读取错误由调用方记录
+	AddFile(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+// NewArchiveWriter 创建指定格式的打包写入器，支持 zip 与 tar.gz
+func NewArchiveWriter(format string, w io.Writer) (ArchiveWriter, error) {
+	switch format {
+	case ArchiveZip:
+		return &zipArchiveWriter{zw: zip.NewWriter(w)}, nil
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarArchiveWriter{tw: tar.NewWriter(gz), gz: gz}, nil
+	}
+	return nil, ErrNotArchive
+}
+
+// zipUTF8Flag 通用标志位 11：文件名使用 UTF-8 编码，避免解压软件按本地代码页显示乱码
+const zipUTF8Flag = 0x800
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchiveWriter) AddDir(name string, modTime time.Time) error {
+	_, err := a.zw.CreateHeader(&zip.FileHeader{Name: name + "/", Flags: zipUTF8Flag, Modified: modTime})
+	return err
+}
+
+func (a *zipArchiveWriter) AddFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	hdr := &zip.FileHeader{Name: name, Flags: zipUTF8Flag, Method: zip.Deflate, Modified: modTime}
+	hdr.SetMode(0644)
+	w, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, io.LimitReader(r, size))
+	if err == nil && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (a *zipArchiveWriter) Close() error {
+	return a.zw.Close()
+}
+
+type tarArchiveWriter struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (a *tarArchiveWriter) AddDir(name string, modTime time.Time) error {
+	return a.tw.WriteHeader(&tar.Header{Name: name + "/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime, Format: tar.FormatPAX})
+}
+
+func (a *tarArchiveWriter) AddFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	// PAX 格式以 UTF-8 记录长文件名与非 ASCII 文件名
+	err := a.tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: size, ModTime: modTime, Format: tar.FormatPAX})
+	if err != nil {
+		return err
+	}
+	n, readErr := io.Copy(a.tw, io.LimitReader(r, size))
+	if n < size {
+		// 头部已声明大小，不足部分补零以保证后续成员可以正常读取
+		if _, err := io.CopyN(a.tw, zeroReader{}, size-n); err != nil {
+			return err
+		}
+		if readErr == nil {
+			readErr = io.ErrUnexpectedEOF
+		}
+	}
+	return readErr
+}
+
+func (a *tarArchiveWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// walkAll 遍历压缩包，返回成员路径到内容的映射 (目录内容为 "/") 与不安全的成员
+func walkAll(t *testing.T, format string, data []byte) (map[string]string, []string) {
+	members := make(map[string]string)
+	var unsafe []string
+	err := WalkArchive(format, bytes.NewReader(data), int64(len(data)), func(entry ArchiveEntry, open func() (io.ReadCloser, error)) error {
+		if entry.IsDir {
+			members[entry.Path] = "/"
+			return nil
+		}
+		rc, err := open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		content, err := io.ReadAll(rc)
+		members[entry.Path] = string(content)
+		return err
+	}, func(name string) {
+		unsafe = append(unsafe, name)
+	})
+	assert.NoError(t, err)
+	return members, unsafe
+}
+
+func TestSafeArchivePath(t *testing.T) {
+	for _, name := range []string{"../x", "/etc/passwd", "C:\\Windows\\x", "a/../../b", "..\\evil", "", "./"} {
+		_, err := SafeArchivePath(name)
+		assert.ErrorIs(t, err, ErrUnsafePath, name)
+	}
+
+	clean, err := SafeArchivePath("./a//b\\c.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "a/b/c.txt", clean)
+}
+
+func TestArchiveFormat(t *testing.T) {
+	assert.Equal(t, ArchiveZip, ArchiveFormat("资料.ZIP", ""))
+	assert.Equal(t, ArchiveTarGz, ArchiveFormat("backup.tgz", ""))
+	assert.Equal(t, ArchiveTarGz, ArchiveFormat("backup.tar.gz", "application/gzip"))
+	assert.Equal(t, ArchiveTar, ArchiveFormat("noext", "application/x-tar"))
+	assert.Equal(t, "", ArchiveFormat("photo.jpg", "image/jpeg"))
+}
+
+func TestWalkArchive(t *testing.T) {
+	t.Run("Zip With GBK Names And Zip Slip", func(t *testing.T) {
+		gbkName, _ := simplifiedchinese.GBK.NewEncoder().String("文档/报告.txt")
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range map[string]string{
+			gbkName:          "季度报告",
+			"docs/":          "",
+			"docs/readme.md": "hello",
+			"../evil.sh":     "rm -rf /",
+		} {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+			assert.NoError(t, err)
+			_, _ = w.Write([]byte(content))
+		}
+		assert.NoError(t, zw.Close())
+
+		members, unsafe := walkAll(t, ArchiveZip, buf.Bytes())
+		assert.Equal(t, "季度报告", members["文档/报告.txt"])
+		assert.Equal(t, "hello", members["docs/readme.md"])
+		assert.Equal(t, "/", members["docs"])
+		assert.NotContains(t, members, "evil.sh")
+		assert.Equal(t, []string{"../evil.sh"}, unsafe)
+	})
+
+	t.Run("Tar Gz Skips Links", func(t *testing.T) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "src/", Typeflag: tar.TypeDir, Mode: 0755}))
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "src/main.go", Typeflag: tar.TypeReg, Mode: 0644, Size: 12}))
+		_, _ = tw.Write([]byte("package main"))
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "src/passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}))
+		assert.NoError(t, tw.Close())
+		assert.NoError(t, gz.Close())
+
+		members, unsafe := walkAll(t, ArchiveTarGz, buf.Bytes())
+		assert.Equal(t, map[string]string{"src": "/", "src/main.go": "package main"}, members)
+		assert.Empty(t, unsafe)
+	})
+
+	t.Run("Not An Archive", func(t *testing.T) {
+		data := []byte("just some text")
+		err := WalkArchive(ArchiveZip, bytes.NewReader(data), int64(len(data)), func(ArchiveEntry, func() (io.ReadCloser, error)) error { return nil }, nil)
+		assert.ErrorIs(t, err, ErrNotArchive)
+	})
+}
+
+func TestArchiveChildren(t *testing.T) {
+	entries := []ArchiveEntry{
+		{Name: "b.txt", Path: "b.txt", Size: 1},
+		{Name: "x.txt", Path: "a/x.txt", Size: 2},
+		{Name: "y.txt", Path: "a/c/y.txt", Size: 3},
+	}
+
+	root := ArchiveChildren(entries, "")
+	assert.Len(t, root, 2)
+	assert.Equal(t, ArchiveEntry{Name: "a", Path: "a", Size: 5, IsDir: true}, root[0])
+	assert.Equal(t, "b.txt", root[1].Name)
+
+	sub := ArchiveChildren(entries, "/a/")
+	assert.Len(t, sub, 2)
+	assert.Equal(t, "a/c", sub[0].Path)
+	assert.True(t, sub[0].IsDir)
+	assert.Equal(t, "a/x.txt", sub[1].Path)
+}
+
+// brokenReader 读取部分数据后返回错误
+type brokenReader struct {
+	data []byte
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if len(b.data) == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func TestArchiveWriter(t *testing.T) {
+	now := time.Now()
+	for _, format := range []string{ArchiveZip, ArchiveTarGz} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			aw, err := NewArchiveWriter(format, &buf)
+			assert.NoError(t, err)
+			assert.NoError(t, aw.AddDir("资料", now))
+			assert.NoError(t, aw.AddFile("资料/报告.txt", 12, now, strings.NewReader("季度报告")))
+			assert.Error(t, aw.AddFile("资料/损坏.bin", 10, now, &brokenReader{data: []byte("abc")}))
+			assert.NoError(t, aw.AddFile("after.txt", 2, now, strings.NewReader("ok")))
+			assert.NoError(t, aw.Close())
+
+			members, _ := walkAll(t, format, buf.Bytes())
+			assert.Equal(t, "/", members["资料"])
+			assert.Equal(t, "季度报告", members["资料/报告.txt"])
+			assert.Equal(t, "ok", members["after.txt"])
+		})
+	}
+
+	t.Run("Zip UTF-8 Flag", func(t *testing.T) {
+		var buf bytes.Buffer
+		aw, _ := NewArchiveWriter(ArchiveZip, &buf)
+		assert.NoError(t, aw.AddFile("报告.txt", 2, now, strings.NewReader("ok")))
+		assert.NoError(t, aw.Close())
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(zipUTF8Flag), zr.File[0].Flags&zipUTF8Flag)
+		assert.False(t, zr.File[0].NonUTF8)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := NewArchiveWriter(ArchiveTar, io.Discard)
+		assert.ErrorIs(t, err, ErrNotArchive)
+	})
+}
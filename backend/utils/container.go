@@ -0,0 +1,555 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// 音视频容器的轻量解析：只读取头部结构，跳过媒体数据本身
+
+var errBadContainer = errors.New("媒体文件结构损坏")
+
+// containerMaxDepth 容器结构允许的最大嵌套层数，所需信息都位于前几层，
+// 限制层数避免构造的深层嵌套文件耗尽调用栈
+const containerMaxDepth = 8
+
+// mp4Epoch MP4 时间戳以 1904-01-01 为起点
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mp4Track 轨道信息
+type mp4Track struct {
+	handler string
+	codec   string
+	width   int
+	height  int
+}
+
+// parseMP4 解析 MP4 / MOV 的 moov 结构 (mvhd 时长与创建时间，tkhd 画面尺寸，stsd 编码)
+func parseMP4(r io.ReadSeeker) (*MediaInfo, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	info := &MediaInfo{}
+	var tracks []mp4Track
+	found := false
+
+	err = walkMP4Boxes(r, 0, end, 0, func(typ string, start, size int64) (bool, error) {
+		switch typ {
+		case "moov", "mdia", "minf", "stbl":
+			found = true
+			return true, nil
+		case "trak":
+			tracks = append(tracks, mp4Track{})
+			return true, nil
+		case "mvhd":
+			buf, err := readBox(r, start, size, 32)
+			if err != nil {
+				return false, err
+			}
+			var created, timescale, duration uint64
+			if buf[0] == 1 {
+				created = binary.BigEndian.Uint64(buf[4:12])
+				timescale = uint64(binary.BigEndian.Uint32(buf[20:24]))
+				duration = binary.BigEndian.Uint64(buf[24:32])
+			} else {
+				created = uint64(binary.BigEndian.Uint32(buf[4:8]))
+				timescale = uint64(binary.BigEndian.Uint32(buf[12:16]))
+				duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+			}
+			if timescale > 0 {
+				info.Duration = float64(duration) / float64(timescale)
+			}
+			// 多数设备写入 0 或 1904 年附近的无效值
+			if t := mp4Epoch.Add(time.Duration(created) * time.Second); created > 0 && t.Year() > 1970 && t.Before(time.Now().Add(24*time.Hour)) {
+				info.CapturedAt = &t
+			}
+		case "tkhd":
+			if len(tracks) == 0 {
+				return false, nil
+			}
+			buf, err := readBox(r, start, size, 96)
+			if err != nil {
+				return false, err
+			}
+			// 宽高为 16.16 定点数，位于 tkhd 末尾
+			off := 76
+			if buf[0] == 1 {
+				off = 88
+			}
+			t := &tracks[len(tracks)-1]
+			t.width = int(binary.BigEndian.Uint32(buf[off:off+4]) >> 16)
+			t.height = int(binary.BigEndian.Uint32(buf[off+4:off+8]) >> 16)
+		case "hdlr":
+			if len(tracks) == 0 {
+				return false, nil
+			}
+			buf, err := readBox(r, start, size, 12)
+			if err != nil {
+				return false, err
+			}
+			tracks[len(tracks)-1].handler = string(buf[8:12])
+		case "stsd":
+			if len(tracks) == 0 {
+				return false, nil
+			}
+			buf, err := readBox(r, start, size, 16)
+			if err != nil {
+				return false, err
+			}
+			tracks[len(tracks)-1].codec = strings.TrimSpace(string(buf[12:16]))
+		}
+		return false, nil
+	})
+	if err != nil && !found {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUnsupportedMedia
+	}
+
+	// 有视频轨时以视频轨为准，否则取音频轨的编码
+	for _, t := range tracks {
+		if t.handler == "vide" {
+			info.Width, info.Height, info.Codec = t.width, t.height, t.codec
+			return info, nil
+		}
+	}
+	for _, t := range tracks {
+		if t.handler == "soun" {
+			info.Codec = t.codec
+			break
+		}
+	}
+	return info, nil
+}
+
+// walkMP4Boxes 遍历 [start, end) 内的 box，visit 返回 true 时进入其子 box，depth 为当前层数
+func walkMP4Boxes(r io.ReadSeeker, start, end int64, depth int, visit func(typ string, start, size int64) (bool, error)) error {
+	if depth >= containerMaxDepth {
+		return errBadContainer
+	}
+	var header [16]byte
+	for pos := start; pos+8 <= end; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		headerLen := int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+		if size < headerLen || pos+size > end {
+			return errBadContainer
+		}
+
+		descend, err := visit(typ, pos+headerLen, size-headerLen)
+		if err != nil {
+			return err
+		}
+		if descend {
+			if err := walkMP4Boxes(r, pos+headerLen, pos+size, depth+1, visit); err != nil {
+				return err
+			}
+		}
+		pos += size
+	}
+	return nil
+}
+
+// readBox 读取 box 内容开头的至多 max 字节，内容不足时以 0 补齐
+func readBox(r io.ReadSeeker, start, size int64, max int) ([]byte, error) {
+	n := int64(max)
+	if size < n {
+		n = size
+	}
+	if n < 4 {
+		return nil, errBadContainer
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, max)
+	if _, err := io.ReadFull(r, buf[:n]); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Matroska / WebM 使用的 EBML 元素 ID
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+	ebmlDateUTC       = 0x4461
+	ebmlTracks        = 0x1654AE6B
+	ebmlTrackEntry    = 0xAE
+	ebmlTrackType     = 0x83
+	ebmlCodecID       = 0x86
+	ebmlVideo         = 0xE0
+	ebmlPixelWidth    = 0xB0
+	ebmlPixelHeight   = 0xBA
+	ebmlCluster       = 0x1F43B675
+)
+
+// mkvParents 需要进入的主元素及其所在的父元素，其余主元素整体跳过 (0 表示文件顶层)
+var mkvParents = map[uint64]uint64{
+	ebmlSegment:    0,
+	ebmlInfo:       ebmlSegment,
+	ebmlTracks:     ebmlSegment,
+	ebmlTrackEntry: ebmlTracks,
+	ebmlVideo:      ebmlTrackEntry,
+}
+
+// mkvEpoch Matroska DateUTC 以 2001-01-01 为起点 (纳秒)
+var mkvEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// parseMatroska 解析 Matroska / WebM 的 Info 与 Tracks，遇到第一个 Cluster 即停止
+func parseMatroska(r io.ReadSeeker) (*MediaInfo, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	info := &MediaInfo{}
+	scale := uint64(1000000)
+	var duration float64
+	found := false
+
+	var trackType uint64
+	var codec string
+	var width, height uint64
+
+	// walk 遍历 parent 元素 [start, end) 内的子元素，depth 为当前层数
+	var walk func(start, end int64, parent uint64, depth int) (bool, error)
+	walk = func(start, end int64, parent uint64, depth int) (bool, error) {
+		if depth >= containerMaxDepth {
+			return false, errBadContainer
+		}
+		for pos := start; pos < end; {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				return false, err
+			}
+			id, idLen, err := readEBMLVint(r, true)
+			if err != nil {
+				return false, err
+			}
+			size, sizeLen, err := readEBMLVint(r, false)
+			if err != nil {
+				return false, err
+			}
+			dataStart := pos + int64(idLen+sizeLen)
+			dataEnd := dataStart + int64(size)
+			// 未知长度 (直播流) 或越界时截断到父元素末尾
+			if size == math.MaxUint64 || dataEnd > end || dataEnd < dataStart {
+				dataEnd = end
+			}
+
+			if p, ok := mkvParents[id]; ok && p != parent {
+				pos = dataEnd
+				continue
+			}
+			switch id {
+			case ebmlSegment, ebmlInfo, ebmlTracks, ebmlVideo:
+				found = found || id == ebmlSegment
+				if stop, err := walk(dataStart, dataEnd, id, depth+1); err != nil || stop {
+					return stop, err
+				}
+			case ebmlTrackEntry:
+				trackType, codec, width, height = 0, "", 0, 0
+				if stop, err := walk(dataStart, dataEnd, id, depth+1); err != nil || stop {
+					return stop, err
+				}
+				// 取第一个视频轨 (TrackType 1)
+				if trackType == 1 && info.Codec == "" {
+					info.Codec = strings.TrimPrefix(codec, "V_")
+					info.Width, info.Height = int(width), int(height)
+				}
+			case ebmlCluster:
+				return true, nil
+			case ebmlTimecodeScale, ebmlTrackType, ebmlPixelWidth, ebmlPixelHeight, ebmlDateUTC:
+				v, err := readEBMLUint(r, dataEnd-dataStart)
+				if err != nil {
+					return false, err
+				}
+				switch id {
+				case ebmlTimecodeScale:
+					scale = v
+				case ebmlTrackType:
+					trackType = v
+				case ebmlPixelWidth:
+					width = v
+				case ebmlPixelHeight:
+					height = v
+				case ebmlDateUTC:
+					t := mkvEpoch.Add(time.Duration(int64(v)))
+					info.CapturedAt = &t
+				}
+			case ebmlDuration:
+				duration, err = readEBMLFloat(r, dataEnd-dataStart)
+				if err != nil {
+					return false, err
+				}
+			case ebmlCodecID:
+				buf, err := readEBMLBytes(r, dataEnd-dataStart)
+				if err != nil {
+					return false, err
+				}
+				codec = string(bytes.TrimRight(buf, "\x00"))
+			}
+			pos = dataEnd
+		}
+		return false, nil
+	}
+
+	if _, err := walk(0, end, 0, 0); err != nil && !found {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUnsupportedMedia
+	}
+	info.Duration = duration * float64(scale) / 1e9
+	return info, nil
+}
+
+// readEBMLVint 读取 EBML 变长整数，id 为 true 时保留长度标记位
+func readEBMLVint(r io.Reader, id bool) (uint64, int, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, errBadContainer
+	}
+
+	value := uint64(first[0])
+	if !id {
+		value &= uint64(0xFF >> length)
+	}
+	allOnes := value == uint64(0xFF>>length)
+	rest := make([]byte, length-1)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return 0, 0, err
+	}
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	if !id && allOnes {
+		return math.MaxUint64, length, nil
+	}
+	return value, length, nil
+}
+
+func readEBMLBytes(r io.Reader, n int64) ([]byte, error) {
+	if n < 0 || n > 1024 {
+		return nil, errBadContainer
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+func readEBMLUint(r io.Reader, n int64) (uint64, error) {
+	if n > 8 {
+		return 0, errBadContainer
+	}
+	buf, err := readEBMLBytes(r, n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, b := range buf {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func readEBMLFloat(r io.Reader, n int64) (float64, error) {
+	buf, err := readEBMLBytes(r, n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(buf))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+	}
+	return 0, errBadContainer
+}
+
+// MPEG 音频 Layer III 的比特率 (kbps) 与采样率表
+var (
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3SampleRate = [3]int{44100, 48000, 32000}
+)
+
+// parseMP3 计算 MP3 时长：VBR 文件读取 Xing/Info 头中的帧数，CBR 文件按比特率估算
+func parseMP3(r io.ReadSeeker) (*MediaInfo, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// 跳过 ID3v2 标签
+	var start int64
+	var id3 [10]byte
+	if _, err := io.ReadFull(r, id3[:]); err == nil && string(id3[:3]) == "ID3" {
+		start = 10 + (int64(id3[6]&0x7F)<<21 | int64(id3[7]&0x7F)<<14 | int64(id3[8]&0x7F)<<7 | int64(id3[9]&0x7F))
+	}
+
+	// 在标签之后的一段数据中寻找第一个帧同步字
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 64*1024)
+	n, _ := io.ReadFull(r, buf)
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		version := (buf[i+1] >> 3) & 0x03 // 3: MPEG1, 2: MPEG2, 0: MPEG2.5
+		layer := (buf[i+1] >> 1) & 0x03   // 1: Layer III
+		bitrateIdx := buf[i+2] >> 4
+		rateIdx := (buf[i+2] >> 2) & 0x03
+		if version == 1 || layer != 1 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+			continue
+		}
+
+		sampleRate := mp3SampleRate[rateIdx]
+		bitrate := mp3BitratesV1[bitrateIdx]
+		samplesPerFrame := 1152
+		if version != 3 {
+			sampleRate /= 2
+			if version == 0 {
+				sampleRate /= 2
+			}
+			bitrate = mp3BitratesV2[bitrateIdx]
+			samplesPerFrame = 576
+		}
+		info := &MediaInfo{Codec: "mp3"}
+
+		// Xing/Info 头位于帧头与 side information 之后
+		mono := buf[i+3]>>6 == 3
+		side := 32
+		switch {
+		case version == 3 && mono:
+			side = 17
+		case version != 3 && !mono:
+			side = 17
+		case version != 3 && mono:
+			side = 9
+		}
+		if x := i + 4 + side; x+12 <= len(buf) {
+			tag := string(buf[x : x+4])
+			if (tag == "Xing" || tag == "Info") && buf[x+7]&0x01 != 0 {
+				frames := binary.BigEndian.Uint32(buf[x+8 : x+12])
+				info.Duration = float64(frames) * float64(samplesPerFrame) / float64(sampleRate)
+				return info, nil
+			}
+		}
+
+		audioBytes := end - start - int64(i)
+		info.Duration = float64(audioBytes) * 8 / float64(bitrate*1000)
+		return info, nil
+	}
+	return nil, ErrUnsupportedMedia
+}
+
+// parseFLAC 读取 STREAMINFO 中的采样率与总采样数
+func parseFLAC(r io.ReadSeeker) (*MediaInfo, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var head [4 + 4 + 18]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	// "fLaC" 之后的第一个元数据块必须是 STREAMINFO (类型 0)
+	if string(head[:4]) != "fLaC" || head[4]&0x7F != 0 {
+		return nil, ErrUnsupportedMedia
+	}
+	si := head[8:]
+	sampleRate := uint64(si[10])<<12 | uint64(si[11])<<4 | uint64(si[12])>>4
+	samples := uint64(si[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(si[14:18]))
+	info := &MediaInfo{Codec: "flac"}
+	if sampleRate > 0 {
+		info.Duration = float64(samples) / float64(sampleRate)
+	}
+	return info, nil
+}
+
+// parseWAV 读取 fmt 与 data 块计算时长
+func parseWAV(r io.ReadSeeker) (*MediaInfo, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, err
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, ErrUnsupportedMedia
+	}
+
+	info := &MediaInfo{}
+	var byteRate uint32
+	var chunk [8]byte
+	for {
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			break
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch string(chunk[:4]) {
+		case "fmt ":
+			var fmtChunk [16]byte
+			if size < 16 {
+				return nil, errBadContainer
+			}
+			if _, err := io.ReadFull(r, fmtChunk[:]); err != nil {
+				return nil, err
+			}
+			if binary.LittleEndian.Uint16(fmtChunk[:2]) == 1 {
+				info.Codec = "pcm"
+			}
+			byteRate = binary.LittleEndian.Uint32(fmtChunk[8:12])
+			size -= 16
+		case "data":
+			if byteRate > 0 {
+				info.Duration = float64(size) / float64(byteRate)
+			}
+			return info, nil
+		}
+		// 块长度为奇数时有一个填充字节
+		if _, err := r.Seek(size+size%2, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
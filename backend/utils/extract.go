@@ -0,0 +1,328 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// MaxExtractedText 单个文件抽取出的正文上限 (字节)，超出部分不再索引
+var MaxExtractedText = 2 * 1024 * 1024
+
+// ErrNoExtractor 没有可处理该类型的抽取器
+var ErrNoExtractor = errors.New("不支持抽取该类型的文件")
+
+// Extractor 从文件内容中抽取可索引的纯文本
+// mimeType 为上传时嗅探出的类型，可能携带 charset 参数
+type Extractor interface {
+	Extract(data []byte, mimeType string) (string, error)
+}
+
+// ExtractorFunc 函数形式的抽取器
+type ExtractorFunc func(data []byte, mimeType string) (string, error)
+
+// Extract 实现 Extractor
+func (f ExtractorFunc) Extract(data []byte, mimeType string) (string, error) {
+	return f(data, mimeType)
+}
+
+var (
+	extractorMu sync.RWMutex
+	extractors  = make(map[string]Extractor)
+)
+
+// RegisterExtractor 注册抽取器，key 可以是扩展名 (".pdf")、MIME 类型 ("application/pdf")
+// 或 MIME 大类 ("text/*")，后注册的覆盖先注册的
+func RegisterExtractor(e Extractor, keys ...string) {
+	extractorMu.Lock()
+	defer extractorMu.Unlock()
+	for _, key := range keys {
+		extractors[strings.ToLower(key)] = e
+	}
+}
+
+// lookupExtractor 依次按扩展名、MIME 类型、MIME 大类查找抽取器
+func lookupExtractor(name string, mimeType string) Extractor {
+	extractorMu.RLock()
+	defer extractorMu.RUnlock()
+
+	if e, ok := extractors[strings.ToLower(filepath.Ext(name))]; ok {
+		return e
+	}
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	if e, ok := extractors[mediaType]; ok {
+		return e
+	}
+	if i := strings.Index(mediaType, "/"); i > 0 {
+		if e, ok := extractors[mediaType[:i]+"/*"]; ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// ExtractText 使用已注册的抽取器抽取文件正文
+func ExtractText(name string, mimeType string, data []byte) (text string, err error) {
+	e := lookupExtractor(name, mimeType)
+	if e == nil {
+		return "", ErrNoExtractor
+	}
+
+	// 第三方解析库遇到损坏的文件可能 panic，不能影响索引队列
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("抽取文件内容失败: %v", r)
+		}
+	}()
+
+	text, err = e.Extract(data, mimeType)
+	if err != nil {
+		return "", err
+	}
+	return truncateText(text, MaxExtractedText), nil
+}
+
+// truncateText 按字节上限截断文本，不截断多字节字符
+func truncateText(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
+
+func init() {
+	RegisterExtractor(ExtractorFunc(extractPlainText), "text/*", ".txt", ".csv", ".log", ".json", ".xml", ".yaml", ".yml", ".ini", ".conf", ".go", ".py", ".js", ".ts", ".java", ".c", ".cpp", ".h", ".sql", ".sh")
+	RegisterExtractor(ExtractorFunc(extractMarkdown), ".md", ".markdown", "text/markdown")
+	RegisterExtractor(ExtractorFunc(extractHTML), ".html", ".htm", "text/html")
+	RegisterExtractor(ExtractorFunc(extractPDF), ".pdf", "application/pdf")
+	RegisterExtractor(ExtractorFunc(extractDocx), ".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+	RegisterExtractor(ExtractorFunc(extractXlsx), ".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	RegisterExtractor(ExtractorFunc(extractPptx), ".pptx", "application/vnd.openxmlformats-officedocument.presentationml.presentation")
+	RegisterExtractor(ExtractorFunc(extractZipListing), ".zip", "application/zip")
+}
+
+// DecodeText 将任意编码的文本转换为 UTF-8，编码识别规则见 DetectTextEncoding
+func DecodeText(data []byte, mimeType string) (string, error) {
+	return DecodeTextAs(data, DetectTextEncoding(data, mimeType))
+}
+
+// extractPlainText 纯文本
+func extractPlainText(data []byte, mimeType string) (string, error) {
+	return DecodeText(data, mimeType)
+}
+
+var markdownPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile("(?m)^\\s*(```|~~~).*$"), ""},                  // 代码块围栏
+	{regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`), "$1"},               // 图片
+	{regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`), "$1"},                // 链接
+	{regexp.MustCompile(`(?m)^\s{0,3}(#{1,6}|>+|[-*+]|\d+\.)\s+`), ""}, // 标题、引用、列表标记
+	{regexp.MustCompile(`(?m)^\s*([-*_]\s*){3,}$`), ""},                // 分隔线
+	{regexp.MustCompile("[*_~`]+"), ""},                                // 强调与行内代码
+	{regexp.MustCompile(`<[^>]+>`), ""},                                // 内嵌 HTML 标签
+}
+
+// extractMarkdown 去除 Markdown 标记，仅保留文字
+func extractMarkdown(data []byte, mimeType string) (string, error) {
+	text, err := DecodeText(data, mimeType)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range markdownPatterns {
+		text = p.re.ReplaceAllString(text, p.repl)
+	}
+	return text, nil
+}
+
+// extractHTML 抽取 HTML 中的可见文字，忽略脚本与样式
+func extractHTML(data []byte, mimeType string) (string, error) {
+	enc, _, _ := charset.DetermineEncoding(data, mimeType)
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		decoded = data
+	}
+
+	var sb strings.Builder
+	z := html.NewTokenizer(bytes.NewReader(decoded))
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return sb.String(), nil
+			}
+			return sb.String(), z.Err()
+		case html.StartTagToken:
+			if name, _ := z.TagName(); isHiddenTag(string(name)) {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); isHiddenTag(string(name)) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				if text := strings.TrimSpace(string(z.Text())); text != "" {
+					sb.WriteString(text)
+					sb.WriteByte('\n')
+				}
+			}
+		}
+	}
+}
+
+func isHiddenTag(name string) bool {
+	return name == "script" || name == "style" || name == "noscript" || name == "template"
+}
+
+// extractPDF 抽取 PDF 文本层，扫描件没有文本层时结果为空
+func extractPDF(data []byte, _ string) (string, error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	plain, err := r.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if _, err := io.Copy(&sb, io.LimitReader(plain, int64(MaxExtractedText))); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// openZip 以 ZIP 方式打开文件内容
+func openZip(data []byte) (*zip.Reader, error) {
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// xmlText 收集 OOXML 部件中名为 textElem 的元素文字，遇到 breakElem 结束时换行
+func xmlText(f *zip.File, textElem string, breakElem string, sb *strings.Builder) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	dec := xml.NewDecoder(io.LimitReader(rc, int64(MaxExtractedText)*4))
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == textElem {
+				inText = true
+			}
+		case xml.EndElement:
+			if t.Name.Local == textElem {
+				inText = false
+			} else if t.Name.Local == breakElem {
+				sb.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+		if sb.Len() >= MaxExtractedText {
+			return nil
+		}
+	}
+}
+
+// ooxmlText 按部件名称顺序抽取匹配 pattern 的部件文字
+func ooxmlText(data []byte, pattern *regexp.Regexp, textElem string, breakElem string) (string, error) {
+	zr, err := openZip(data)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []*zip.File
+	for _, f := range zr.File {
+		if pattern.MatchString(f.Name) {
+			parts = append(parts, f)
+		}
+	}
+	// slide10.xml 应排在 slide2.xml 之后
+	sort.Slice(parts, func(i, j int) bool {
+		if len(parts[i].Name) != len(parts[j].Name) {
+			return len(parts[i].Name) < len(parts[j].Name)
+		}
+		return parts[i].Name < parts[j].Name
+	})
+
+	var sb strings.Builder
+	for _, f := range parts {
+		if err := xmlText(f, textElem, breakElem, &sb); err != nil {
+			return "", err
+		}
+		if sb.Len() >= MaxExtractedText {
+			break
+		}
+	}
+	return sb.String(), nil
+}
+
+var (
+	docxParts = regexp.MustCompile(`^word/(document|header\d*|footer\d*|footnotes|endnotes)\.xml$`)
+	xlsxParts = regexp.MustCompile(`^xl/(sharedStrings|worksheets/sheet\d+)\.xml$`)
+	pptxParts = regexp.MustCompile(`^ppt/(slides/slide\d+|notesSlides/notesSlide\d+)\.xml$`)
+)
+
+// extractDocx Word 文档
+func extractDocx(data []byte, _ string) (string, error) {
+	return ooxmlText(data, docxParts, "t", "p")
+}
+
+// extractXlsx Excel 表格：共享字符串与单元格内联字符串
+func extractXlsx(data []byte, _ string) (string, error) {
+	return ooxmlText(data, xlsxParts, "t", "si")
+}
+
+// extractPptx PowerPoint 演示文稿：幻灯片与备注
+func extractPptx(data []byte, _ string) (string, error) {
+	return ooxmlText(data, pptxParts, "t", "p")
+}
+
+// extractZipListing ZIP 压缩包只索引成员文件名
+func extractZipListing(data []byte, _ string) (string, error) {
+	zr, err := openZip(data)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, f := range zr.File {
+		sb.WriteString(DecodeArchiveName(f.Name))
+		sb.WriteByte('\n')
+		if sb.Len() >= MaxExtractedText {
+			break
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// buildZip 构造内存中的 ZIP 文件
+func buildZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		_, _ = w.Write([]byte(content))
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestExtractText(t *testing.T) {
+	t.Run("Plain Text Encodings", func(t *testing.T) {
+		gbk, _ := simplifiedchinese.GBK.NewEncoder().Bytes([]byte("季度报告"))
+		text, err := ExtractText("report.txt", "text/plain; charset=gbk", gbk)
+		assert.NoError(t, err)
+		assert.Equal(t, "季度报告", text)
+
+		// 没有 charset 且不是合法 UTF-8 时按 GB18030 解码
+		text, err = ExtractText("report.txt", "text/plain", gbk)
+		assert.NoError(t, err)
+		assert.Equal(t, "季度报告", text)
+
+		utf16 := []byte{0xFF, 0xFE, 'h', 0, 'i', 0}
+		text, err = ExtractText("a.txt", "", utf16)
+		assert.NoError(t, err)
+		assert.Equal(t, "hi", text)
+	})
+
+	t.Run("Markdown and HTML", func(t *testing.T) {
+		text, err := ExtractText("README.md", "", []byte("# 标题\n\n**加粗** [链接](http://example.com)"))
+		assert.NoError(t, err)
+		assert.Contains(t, text, "标题")
+		assert.Contains(t, text, "加粗 链接")
+		assert.NotContains(t, text, "example.com")
+
+		text, err = ExtractText("page.html", "text/html", []byte("<html><script>var x;</script><body><p>正文</p></body></html>"))
+		assert.NoError(t, err)
+		assert.Equal(t, "正文\n", text)
+	})
+
+	t.Run("Office Documents", func(t *testing.T) {
+		docx := buildZip(t, map[string]string{
+			"word/document.xml": `<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>发票</w:t></w:r></w:p><w:p><w:r><w:t>金额</w:t></w:r></w:p></w:body></w:document>`,
+		})
+		text, err := ExtractText("a.docx", "", docx)
+		assert.NoError(t, err)
+		assert.Equal(t, "发票\n金额\n", text)
+
+		pptx := buildZip(t, map[string]string{
+			"ppt/slides/slide10.xml": `<p:sld xmlns:a="a" xmlns:p="p"><a:p><a:r><a:t>第十页</a:t></a:r></a:p></p:sld>`,
+			"ppt/slides/slide2.xml":  `<p:sld xmlns:a="a" xmlns:p="p"><a:p><a:r><a:t>第二页</a:t></a:r></a:p></p:sld>`,
+		})
+		text, err = ExtractText("a.pptx", "", pptx)
+		assert.NoError(t, err)
+		assert.Equal(t, "第二页\n第十页\n", text)
+	})
+
+	t.Run("Zip Listing", func(t *testing.T) {
+		data := buildZip(t, map[string]string{"docs/合同.pdf": "x"})
+		text, err := ExtractText("a.zip", "application/zip", data)
+		assert.NoError(t, err)
+		assert.Equal(t, "docs/合同.pdf\n", text)
+	})
+
+	t.Run("Unsupported And Registry", func(t *testing.T) {
+		_, err := ExtractText("a.bin", "application/octet-stream", []byte{0, 1})
+		assert.ErrorIs(t, err, ErrNoExtractor)
+
+		RegisterExtractor(ExtractorFunc(func(data []byte, _ string) (string, error) {
+			return "custom", nil
+		}), ".custom")
+		text, err := ExtractText("a.custom", "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "custom", text)
+	})
+
+	t.Run("Truncate", func(t *testing.T) {
+		assert.Equal(t, "中", truncateText("中文", 4))
+	})
+}
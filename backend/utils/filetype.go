@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// 文件类别
+const (
+	CategoryImage    = "image"
+	CategoryVideo    = "video"
+	CategoryAudio    = "audio"
+	CategoryDocument = "document"
+	CategoryArchive  = "archive"
+	CategoryOther    = "other"
+)
+
+// CategoryExts 各类别包含的扩展名
+var CategoryExts = map[string][]string{
+	CategoryImage:    {".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".svg", ".ico", ".tif", ".tiff", ".heic", ".heif"},
+	CategoryVideo:    {".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".webm", ".m4v", ".3gp", ".ts"},
+	CategoryAudio:    {".mp3", ".wav", ".flac", ".aac", ".ogg", ".m4a", ".wma", ".ape", ".opus"},
+	CategoryDocument: {".txt", ".md", ".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".csv", ".rtf", ".odt", ".ods", ".odp", ".epub", ".html", ".htm", ".json", ".xml"},
+	CategoryArchive:  {".zip", ".rar", ".7z", ".tar", ".gz", ".tgz", ".bz2", ".xz"},
+}
+
+// IsValidCategory 判断类别名称是否合法
+func IsValidCategory(category string) bool {
+	if category == CategoryOther {
+		return true
+	}
+	_, ok := CategoryExts[category]
+	return ok
+}
+
+// CategoryOfExt 根据扩展名判断文件类别
+func CategoryOfExt(ext string) string {
+	ext = strings.ToLower(ext)
+	for category, exts := range CategoryExts {
+		for _, e := range exts {
+			if e == ext {
+				return category
+			}
+		}
+	}
+	return CategoryOther
+}
+
+// 部分扩展名在系统 MIME 表中缺失，单独补充
+var extraMimeTypes = map[string]string{
+	".md":   "text/markdown; charset=utf-8",
+	".mkv":  "video/x-matroska",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".7z":   "application/x-7z-compressed",
+	".rar":  "application/vnd.rar",
+}
+
+// MimeTypeOfExt 根据扩展名推断 MIME 类型，未知时返回 application/octet-stream
+func MimeTypeOfExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if t, ok := extraMimeTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// DetectMimeType 结合内容嗅探与扩展名判断 MIME 类型
+// head 为文件开头的若干字节 (建议不少于 3072 字节)
+func DetectMimeType(name string, head []byte) string {
+	byExt := MimeTypeOfExt(filepath.Ext(name))
+	if len(head) == 0 {
+		return byExt
+	}
+
+	sniffed := mimetype.Detect(head)
+	switch {
+	case sniffed.Is("application/octet-stream"):
+		// 无法识别内容时以扩展名为准
+		return byExt
+	case sniffed.Is("text/plain") && byExt != "application/octet-stream":
+		// 纯文本格式 (Markdown、CSV、源码等) 嗅探结果过于笼统，保留扩展名给出的类型，字符集以嗅探为准
+		if charset := sniffed.String()[len("text/plain"):]; charset != "" && !strings.Contains(byExt, "charset") {
+			return byExt + charset
+		}
+		return byExt
+	case sniffed.Is("application/zip") && byExt != "application/octet-stream":
+		// 以 ZIP 为容器的格式 (jar、apk 等) 以扩展名为准
+		return byExt
+	}
+	return sniffed.String()
+}
+
+// CategoryOf 根据 MIME 类型与扩展名判断文件类别
+// 媒体类型以嗅探出的 MIME 为准，其余优先按扩展名归类
+func CategoryOf(mimeType string, ext string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return CategoryImage
+	case strings.HasPrefix(mimeType, "video/"):
+		return CategoryVideo
+	case strings.HasPrefix(mimeType, "audio/"):
+		return CategoryAudio
+	}
+	if category := CategoryOfExt(ext); category != CategoryOther {
+		return category
+	}
+	switch {
+	case strings.HasPrefix(mimeType, "text/"),
+		strings.HasPrefix(mimeType, "application/pdf"),
+		strings.HasPrefix(mimeType, "application/msword"),
+		strings.HasPrefix(mimeType, "application/vnd.openxmlformats-officedocument"),
+		strings.HasPrefix(mimeType, "application/vnd.ms-"),
+		strings.HasPrefix(mimeType, "application/vnd.oasis.opendocument"):
+		return CategoryDocument
+	case strings.HasPrefix(mimeType, "application/zip"),
+		strings.HasPrefix(mimeType, "application/x-tar"),
+		strings.HasPrefix(mimeType, "application/gzip"),
+		strings.HasPrefix(mimeType, "application/x-7z-compressed"),
+		strings.HasPrefix(mimeType, "application/vnd.rar"):
+		return CategoryArchive
+	}
+	return CategoryOther
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectMimeType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+	t.Run("Sniff Content", func(t *testing.T) {
+		// 扩展名错误时以内容为准
+		mimeType := DetectMimeType("photo.txt", png)
+		assert.Equal(t, "image/png", mimeType)
+		assert.Equal(t, CategoryImage, CategoryOf(mimeType, ".txt"))
+	})
+
+	t.Run("Text Keeps Extension", func(t *testing.T) {
+		mimeType := DetectMimeType("README.md", []byte("# 标题\n\n正文"))
+		assert.Contains(t, mimeType, "text/markdown")
+		assert.Equal(t, CategoryDocument, CategoryOf(mimeType, ".md"))
+	})
+
+	t.Run("Fallback To Extension", func(t *testing.T) {
+		assert.Equal(t, "video/mp4", DetectMimeType("movie.mp4", nil))
+		assert.Equal(t, "application/octet-stream", DetectMimeType("data.unknownext", []byte{0x00, 0x01, 0x02}))
+		assert.Equal(t, CategoryOther, CategoryOf("application/octet-stream", ".unknownext"))
+	})
+}
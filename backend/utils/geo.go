@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"math"
+	"sort"
+)
+
+const earthRadiusKm = 6371.0
+
+// GeoPoint 带坐标的文件
+type GeoPoint struct {
+	ID  uint
+	Lat float64
+	Lng float64
+}
+
+// GeoCluster 地理聚类结果，Lat/Lng 为成员坐标的中心
+type GeoCluster struct {
+	Lat float64
+	Lng float64
+	IDs []uint
+}
+
+// HaversineKm 计算两点间的球面距离 (千米)
+func HaversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ClusterPoints 将距离在 radiusKm 以内的点归为一组，结果按成员数量由多到少排序
+// 按网格分桶，每个点只需与相邻网格中的聚类比较
+func ClusterPoints(points []GeoPoint, radiusKm float64) []GeoCluster {
+	if radiusKm <= 0 {
+		radiusKm = 1
+	}
+	// 纬度 1° 约 111km，网格边长取半径对应的度数
+	cell := radiusKm / 111.0
+	type cellKey struct{ x, y int }
+	keyOf := func(lat, lng float64) cellKey {
+		return cellKey{int(math.Floor(lng / cell)), int(math.Floor(lat / cell))}
+	}
+
+	var clusters []GeoCluster
+	grid := make(map[cellKey][]int)
+	for _, p := range points {
+		key := keyOf(p.Lat, p.Lng)
+		best, bestDist := -1, radiusKm
+		// 高纬度地区经度方向的网格更窄，多看一圈
+		span := 1
+		if c := math.Cos(p.Lat * math.Pi / 180); c > 0 && c < 0.5 {
+			span = int(math.Ceil(1 / c))
+		}
+		for dx := -span; dx <= span; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				for _, idx := range grid[cellKey{key.x + dx, key.y + dy}] {
+					c := &clusters[idx]
+					if d := HaversineKm(p.Lat, p.Lng, c.Lat, c.Lng); d <= bestDist {
+						best, bestDist = idx, d
+					}
+				}
+			}
+		}
+
+		if best < 0 {
+			clusters = append(clusters, GeoCluster{Lat: p.Lat, Lng: p.Lng, IDs: []uint{p.ID}})
+			grid[key] = append(grid[key], len(clusters)-1)
+			continue
+		}
+		// 中心取成员坐标的平均值，聚类仍登记在初始网格中
+		c := &clusters[best]
+		n := float64(len(c.IDs))
+		c.Lat = (c.Lat*n + p.Lat) / (n + 1)
+		c.Lng = (c.Lng*n + p.Lng) / (n + 1)
+		c.IDs = append(c.IDs, p.ID)
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return len(clusters[i].IDs) > len(clusters[j].IDs)
+	})
+	return clusters
+}
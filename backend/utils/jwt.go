@@ -1,24 +1,48 @@
 package utils
 
 import (
+	"crypto/rand"
 	"errors"
-	"math/rand"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stfreya/stfreyanetdisk/config"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
+const (
+	// randomLetters RandomString 使用的字符集
+	randomLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// shortCodeLetters 短码字符集：小写字母与数字，去掉易混淆的 0/o、1/l/i
+	shortCodeLetters = "abcdefghjkmnpqrstuvwxyz23456789"
+)
 
-// RandomString 生成随机字符串
+// RandomString 生成密码学安全的随机字符串，用于分享链接、兑换码等不可猜测的令牌
 func RandomString(n int) string {
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+	return randomFrom(randomLetters, n)
+}
+
+// RandomShortCode 生成便于手动输入的随机短码
+func RandomShortCode(n int) string {
+	return randomFrom(shortCodeLetters, n)
+}
+
+// randomFrom 从字符集中均匀地随机选取 n 个字符 (字符集不超过 256 个)
+func randomFrom(letters string, n int) string {
+	// 丢弃超出字符集整数倍的字节，避免取模带来的偏差
+	limit := byte(256 - 256%len(letters))
+	b := make([]byte, 0, n)
+	buf := make([]byte, n+n/2+8)
+	for len(b) < n {
+		rand.Read(buf)
+		for _, c := range buf {
+			if c >= limit && limit != 0 {
+				continue
+			}
+			b = append(b, letters[int(c)%len(letters)])
+			if len(b) == n {
+				break
+			}
+		}
 	}
 	return string(b)
 }
@@ -61,3 +85,47 @@ func ParseToken(tokenString string) (*Claims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// ShareClaims 分享访问令牌，校验提取码后签发，只对单个分享有效
+// Stamp 由提取码哈希派生，修改提取码后已签发的令牌随之失效
+type ShareClaims struct {
+	ShareID uint   `json:"share_id"`
+	Stamp   string `json:"stamp"`
+	jwt.RegisteredClaims
+}
+
+// shareSigningKey 分享令牌使用独立派生的密钥，不能当作登录令牌使用，反之亦然
+func shareSigningKey() []byte {
+	return []byte(config.GlobalConfig.JWTSecret + ":share")
+}
+
+// GenerateShareToken 生成分享访问令牌
+func GenerateShareToken(shareID uint, stamp string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := ShareClaims{
+		ShareID: shareID,
+		Stamp:   stamp,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(shareSigningKey())
+	return token, expiresAt, err
+}
+
+// ParseShareToken 解析分享访问令牌
+func ParseShareToken(tokenString string) (*ShareClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ShareClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return shareSigningKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := token.Claims.(*ShareClaims); ok && token.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
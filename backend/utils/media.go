@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"errors"
+	"image"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dhowden/tag"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ErrUnsupportedMedia 无法解析的媒体格式
+var ErrUnsupportedMedia = errors.New("不支持的媒体格式")
+
+// MediaInfo 图片、音频与视频的技术元数据
+type MediaInfo struct {
+	Width       int
+	Height      int
+	Duration    float64 // 时长 (秒)
+	Codec       string
+	CapturedAt  *time.Time // 拍摄时间
+	CameraMake  string
+	CameraModel string
+	Latitude    *float64
+	Longitude   *float64
+	Title       string
+	Artist      string
+	Album       string
+	Genre       string
+	Year        int
+	Track       int
+}
+
+// IsEmpty 未解析出任何信息
+func (m *MediaInfo) IsEmpty() bool {
+	return *m == MediaInfo{}
+}
+
+// ParseMedia 按 MIME 类型解析媒体文件的元数据，r 需支持随机访问以跳过大块的音视频数据
+func ParseMedia(r io.ReadSeeker, mimeType string) (info *MediaInfo, err error) {
+	// 第三方解析库遇到损坏的文件可能 panic
+	defer func() {
+		if p := recover(); p != nil {
+			info, err = nil, ErrUnsupportedMedia
+		}
+	}()
+
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		info, err = parseImageMeta(r)
+	case strings.HasPrefix(mimeType, "audio/"):
+		info, err = parseAudioMeta(r, mimeType)
+	case strings.HasPrefix(mimeType, "video/"):
+		info, err = parseVideoMeta(r, mimeType)
+	default:
+		return nil, ErrUnsupportedMedia
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsEmpty() {
+		return nil, ErrUnsupportedMedia
+	}
+	return info, nil
+}
+
+// parseImageMeta 解析图片尺寸与 EXIF (拍摄时间、相机、GPS)
+func parseImageMeta(r io.ReadSeeker) (*MediaInfo, error) {
+	info := &MediaInfo{}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if cfg, format, err := image.DecodeConfig(r); err == nil {
+		info.Width, info.Height, info.Codec = cfg.Width, cfg.Height, format
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	x, err := exif.Decode(r)
+	if err != nil {
+		// 没有 EXIF 的图片只记录尺寸
+		return info, nil
+	}
+
+	if t, err := x.DateTime(); err == nil && t.Year() > 1900 {
+		info.CapturedAt = &t
+	}
+	info.CameraMake = exifString(x, exif.Make)
+	info.CameraModel = exifString(x, exif.Model)
+	if lat, lng, err := x.LatLong(); err == nil && validLatLng(lat, lng) {
+		info.Latitude, info.Longitude = &lat, &lng
+	}
+
+	// 旋转 90° 的照片按显示方向记录宽高
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		if o, err := tag.Int(0); err == nil && o >= 5 && o <= 8 {
+			info.Width, info.Height = info.Height, info.Width
+		}
+	}
+	return info, nil
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+}
+
+// validLatLng 过滤越界及 (0, 0) 这类未定位时写入的坐标
+func validLatLng(lat, lng float64) bool {
+	if lat == 0 && lng == 0 {
+		return false
+	}
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// parseAudioMeta 解析音频标签 (ID3、Vorbis Comment、MP4) 与时长
+func parseAudioMeta(r io.ReadSeeker, mimeType string) (*MediaInfo, error) {
+	info := &MediaInfo{}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if m, err := tag.ReadFrom(r); err == nil {
+		info.Title = fixTagText(m.Title())
+		info.Artist = fixTagText(m.Artist())
+		info.Album = fixTagText(m.Album())
+		info.Genre = fixTagText(m.Genre())
+		info.Year = m.Year()
+		info.Track, _ = m.Track()
+		info.Codec = strings.ToLower(string(m.FileType()))
+	}
+
+	var stream *MediaInfo
+	var err error
+	switch mimeType {
+	case "audio/mpeg", "audio/mp3":
+		stream, err = parseMP3(r)
+	case "audio/flac", "audio/x-flac":
+		stream, err = parseFLAC(r)
+	case "audio/wav", "audio/x-wav", "audio/wave", "audio/vnd.wave":
+		stream, err = parseWAV(r)
+	case "audio/mp4", "audio/x-m4a", "audio/m4a", "audio/aac":
+		stream, err = parseMP4(r)
+	}
+	if err == nil && stream != nil {
+		info.Duration = stream.Duration
+		if stream.Codec != "" {
+			info.Codec = stream.Codec
+		}
+	}
+	return info, nil
+}
+
+// fixTagText 修正标签文本的编码
+// 许多中文音乐文件把 GBK 文本写在声明为 ISO-8859-1 的 ID3 帧中，解码后全部落在 Latin-1 范围内，
+// 此时还原为原始字节重新识别编码，结果中出现非中文字符时 (如 "Beyoncé") 保留原文
+func fixTagText(s string) string {
+	s = strings.TrimSpace(strings.TrimRight(s, "\x00"))
+	raw := make([]byte, 0, len(s))
+	high := false
+	for _, r := range s {
+		if r > 0xFF {
+			return s
+		}
+		high = high || r >= 0x80
+		raw = append(raw, byte(r))
+	}
+	if !high {
+		return s
+	}
+	text, err := DecodeText(raw, "")
+	if err != nil {
+		return s
+	}
+	for _, r := range text {
+		if r >= 0x80 && !unicode.Is(unicode.Han, r) && !(r >= 0x3000 && r <= 0x303F) && !(r >= 0xFF00 && r <= 0xFFEF) {
+			return s
+		}
+	}
+	return text
+}
+
+// parseVideoMeta 解析视频容器中的时长、画面尺寸与编码
+func parseVideoMeta(r io.ReadSeeker, mimeType string) (*MediaInfo, error) {
+	switch mimeType {
+	case "video/mp4", "video/quicktime", "video/x-m4v", "video/3gpp", "video/3gpp2":
+		return parseMP4(r)
+	case "video/webm", "video/x-matroska":
+		return parseMatroska(r)
+	}
+	return nil, ErrUnsupportedMedia
+}
@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"math"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// box 构造 MP4 box
+func box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	return append(boxHeader(typ, len(body)), body...)
+}
+
+// boxHeader 构造内容长度为 size 的 MP4 box 头部
+func boxHeader(typ string, size int) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint32(buf, uint32(8+size))
+	copy(buf[4:], typ)
+	return buf
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func buildMP4() []byte {
+	mvhd := make([]byte, 100)
+	copy(mvhd[12:], u32(1000)) // timescale
+	copy(mvhd[16:], u32(5500)) // duration
+
+	tkhd := make([]byte, 84)
+	copy(tkhd[76:], u32(1920<<16))
+	copy(tkhd[80:], u32(1080<<16))
+
+	hdlr := make([]byte, 24)
+	copy(hdlr[8:], "vide")
+
+	stsd := make([]byte, 24)
+	copy(stsd[4:], u32(1))
+	copy(stsd[12:], "avc1")
+
+	trak := box("trak", box("tkhd", tkhd), box("mdia", box("hdlr", hdlr), box("minf", box("stbl", box("stsd", stsd)))))
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("isom")),
+		box("mdat", make([]byte, 1024)),
+		box("moov", box("mvhd", mvhd), trak),
+	}, nil)
+}
+
+// ebml 构造 EBML 元素 (长度固定使用 8 字节编码)
+func ebml(id uint32, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	return append(ebmlHeader(id, len(body)), body...)
+}
+
+// ebmlHeader 构造内容长度为 size 的 EBML 元素头部
+func ebmlHeader(id uint32, size int) []byte {
+	var idBytes []byte
+	for v := id; v > 0; v >>= 8 {
+		idBytes = append([]byte{byte(v)}, idBytes...)
+	}
+	sizeBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(sizeBytes, uint64(size))
+	sizeBytes[0] = 0x01
+	return append(idBytes, sizeBytes...)
+}
+
+func buildMatroska() []byte {
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(12000))
+	info := ebml(ebmlInfo, ebml(ebmlTimecodeScale, []byte{0x0F, 0x42, 0x40}), ebml(ebmlDuration, duration))
+	track := ebml(ebmlTrackEntry,
+		ebml(ebmlTrackType, []byte{1}),
+		ebml(ebmlCodecID, []byte("V_VP9")),
+		ebml(ebmlVideo, ebml(ebmlPixelWidth, []byte{0x05, 0x00}), ebml(ebmlPixelHeight, []byte{0x02, 0xD0})),
+	)
+	segment := ebml(ebmlSegment, info, ebml(ebmlTracks, track), ebml(ebmlCluster, make([]byte, 64)))
+	return append(ebml(0x1A45DFA3, []byte("webm")), segment...)
+}
+
+// nested 将 inner 包进 depth 层由 header 构造头部的嵌套结构，直接计算各层长度以避免反复复制
+func nested(depth int, inner []byte, header func(size int) []byte) []byte {
+	headerLen := len(header(0))
+	buf := make([]byte, 0, depth*headerLen+len(inner))
+	for i := 0; i < depth; i++ {
+		buf = append(buf, header((depth-i-1)*headerLen+len(inner))...)
+	}
+	return append(buf, inner...)
+}
+
+func buildWAV(seconds int) []byte {
+	le := func(v uint32) []byte { b := make([]byte, 4); binary.LittleEndian.PutUint32(b, v); return b }
+	fmtChunk := []byte{1, 0, 1, 0}            // PCM 单声道
+	fmtChunk = append(fmtChunk, le(8000)...)  // 采样率
+	fmtChunk = append(fmtChunk, le(16000)...) // 字节率
+	fmtChunk = append(fmtChunk, 2, 0, 16, 0)  // 块对齐、位深
+	data := make([]byte, 16000*seconds)
+	body := append([]byte("WAVE"), append(append([]byte("fmt "), le(16)...), fmtChunk...)...)
+	body = append(body, append(append([]byte("data"), le(uint32(len(data)))...), data...)...)
+	return append(append([]byte("RIFF"), le(uint32(len(body)))...), body...)
+}
+
+func buildMP3(frames int, title []byte, encoding byte) []byte {
+	// ID3v2.3 标签，包含一个 TIT2 帧
+	text := append([]byte{encoding}, title...)
+	frame := append([]byte("TIT2"), u32(uint32(len(text)))...)
+	frame = append(append(frame, 0, 0), text...)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frame))}, frame...)
+
+	// MPEG1 Layer III 128kbps 44.1kHz，每帧 417 字节
+	header := []byte{0xFF, 0xFB, 0x90, 0x00}
+	var audio []byte
+	for i := 0; i < frames; i++ {
+		f := make([]byte, 417)
+		copy(f, header)
+		audio = append(audio, f...)
+	}
+	return append(tag, audio...)
+}
+
+func TestParseMedia(t *testing.T) {
+	t.Run("MP4", func(t *testing.T) {
+		info, err := ParseMedia(bytes.NewReader(buildMP4()), "video/mp4")
+		assert.NoError(t, err)
+		assert.InDelta(t, 5.5, info.Duration, 0.001)
+		assert.Equal(t, 1920, info.Width)
+		assert.Equal(t, 1080, info.Height)
+		assert.Equal(t, "avc1", info.Codec)
+		assert.Nil(t, info.CapturedAt)
+	})
+
+	t.Run("Matroska", func(t *testing.T) {
+		info, err := ParseMedia(bytes.NewReader(buildMatroska()), "video/webm")
+		assert.NoError(t, err)
+		assert.InDelta(t, 12.0, info.Duration, 0.001)
+		assert.Equal(t, 1280, info.Width)
+		assert.Equal(t, 720, info.Height)
+		assert.Equal(t, "VP9", info.Codec)
+	})
+
+	t.Run("Deeply Nested", func(t *testing.T) {
+		// 构造的深层嵌套文件不会耗尽调用栈 (栈溢出无法被 recover)，只进入预期父元素下的子元素
+		defer debug.SetMaxStack(debug.SetMaxStack(16 << 20))
+		const depth = 500000
+		video := func(size int) []byte { return ebmlHeader(ebmlVideo, size) }
+		track := ebml(ebmlTrackEntry,
+			ebml(ebmlTrackType, []byte{1}),
+			ebml(ebmlCodecID, []byte("V_VP9")),
+			ebml(ebmlVideo, ebml(ebmlPixelWidth, []byte{0x05, 0x00}), ebml(ebmlPixelHeight, []byte{0x02, 0xD0}),
+				nested(depth, ebml(ebmlPixelWidth, []byte{0x01}), video)),
+		)
+		webm := append(ebml(0x1A45DFA3, []byte("webm")), ebml(ebmlSegment, ebml(ebmlTracks, track))...)
+		info, err := ParseMedia(bytes.NewReader(webm), "video/webm")
+		assert.NoError(t, err)
+		assert.Equal(t, 1280, info.Width)
+		assert.Equal(t, "VP9", info.Codec)
+
+		segment := func(size int) []byte { return ebmlHeader(ebmlSegment, size) }
+		_, err = ParseMedia(bytes.NewReader(nested(depth, nil, segment)), "video/webm")
+		assert.ErrorIs(t, err, ErrUnsupportedMedia)
+
+		mvhd := make([]byte, 100)
+		copy(mvhd[12:], u32(1000))
+		copy(mvhd[16:], u32(2000))
+		moov := func(size int) []byte { return boxHeader("moov", size) }
+		info, err = ParseMedia(bytes.NewReader(box("moov", box("mvhd", mvhd), nested(depth, nil, moov))), "video/mp4")
+		assert.NoError(t, err)
+		assert.InDelta(t, 2.0, info.Duration, 0.001)
+	})
+
+	t.Run("WAV", func(t *testing.T) {
+		info, err := ParseMedia(bytes.NewReader(buildWAV(3)), "audio/wav")
+		assert.NoError(t, err)
+		assert.InDelta(t, 3.0, info.Duration, 0.001)
+		assert.Equal(t, "pcm", info.Codec)
+	})
+
+	t.Run("MP3 with ID3", func(t *testing.T) {
+		info, err := ParseMedia(bytes.NewReader(buildMP3(100, []byte("晴天"), 3)), "audio/mpeg")
+		assert.NoError(t, err)
+		assert.Equal(t, "晴天", info.Title)
+		assert.Equal(t, "mp3", info.Codec)
+		// 100 帧 × 1152 采样 / 44100Hz
+		assert.InDelta(t, 2.61, info.Duration, 0.02)
+
+		// 声明为 ISO-8859-1 实为 GBK 的标签
+		info, err = ParseMedia(bytes.NewReader(buildMP3(10, []byte{0xC7, 0xE7, 0xCC, 0xEC}, 0)), "audio/mpeg")
+		assert.NoError(t, err)
+		assert.Equal(t, "晴天", info.Title)
+
+		// 真正的 Latin-1 文本保持不变
+		info, err = ParseMedia(bytes.NewReader(buildMP3(10, []byte("Beyonc\xe9"), 0)), "audio/mpeg")
+		assert.NoError(t, err)
+		assert.Equal(t, "Beyoncé", info.Title)
+	})
+
+	t.Run("Image without EXIF", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 48))))
+		info, err := ParseMedia(bytes.NewReader(buf.Bytes()), "image/png")
+		assert.NoError(t, err)
+		assert.Equal(t, 64, info.Width)
+		assert.Equal(t, 48, info.Height)
+		assert.Nil(t, info.CapturedAt)
+		assert.Nil(t, info.Latitude)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := ParseMedia(bytes.NewReader([]byte("hello")), "text/plain")
+		assert.ErrorIs(t, err, ErrUnsupportedMedia)
+
+		// 损坏的文件不会 panic
+		_, err = ParseMedia(bytes.NewReader(buildMP4()[:40]), "video/mp4")
+		assert.Error(t, err)
+	})
+}
+
+func TestClusterPoints(t *testing.T) {
+	points := []GeoPoint{
+		{ID: 1, Lat: 39.9042, Lng: 116.4074}, // 北京
+		{ID: 2, Lat: 31.2304, Lng: 121.4737}, // 上海
+		{ID: 3, Lat: 39.9100, Lng: 116.4000},
+		{ID: 4, Lat: 39.9060, Lng: 116.4100},
+	}
+	clusters := ClusterPoints(points, 5)
+	assert.Len(t, clusters, 2)
+	assert.ElementsMatch(t, []uint{1, 3, 4}, clusters[0].IDs)
+	assert.Equal(t, []uint{2}, clusters[1].IDs)
+
+	assert.InDelta(t, 1068, HaversineKm(39.9042, 116.4074, 31.2304, 121.4737), 10)
+}
@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrOperationMismatch 操作与文档 (或另一操作) 的长度不匹配
+var ErrOperationMismatch = errors.New("编辑操作与文档版本不匹配")
+
+// opComponent 操作分量，三者只有一个有效
+type opComponent struct {
+	retain int
+	insert string
+	delete int
+}
+
+// TextOperation 纯文本的 OT (Operational Transformation) 操作，格式与 ot.js 相同：
+// 正整数表示保留若干字符、负整数表示删除若干字符、字符串表示插入
+// 长度与位置均按 Unicode 码点 (而非 UTF-16 码元或字节) 计算
+type TextOperation struct {
+	ops       []opComponent
+	BaseLen   int // 操作作用的文档长度
+	TargetLen int // 操作后的文档长度
+}
+
+// Retain 保留 n 个字符
+func (o *TextOperation) Retain(n int) *TextOperation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	o.TargetLen += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].retain > 0 {
+		o.ops[last].retain += n
+		return o
+	}
+	o.ops = append(o.ops, opComponent{retain: n})
+	return o
+}
+
+// Insert 插入文本
+func (o *TextOperation) Insert(s string) *TextOperation {
+	if s == "" {
+		return o
+	}
+	o.TargetLen += utf8.RuneCountInString(s)
+	last := len(o.ops) - 1
+	switch {
+	case last >= 0 && o.ops[last].insert != "":
+		o.ops[last].insert += s
+	case last >= 0 && o.ops[last].delete > 0:
+		// 相邻的删除与插入统一为先插入后删除，保证等价操作的表示唯一
+		if last > 0 && o.ops[last-1].insert != "" {
+			o.ops[last-1].insert += s
+		} else {
+			o.ops = append(o.ops, o.ops[last])
+			o.ops[last] = opComponent{insert: s}
+		}
+	default:
+		o.ops = append(o.ops, opComponent{insert: s})
+	}
+	return o
+}
+
+// Delete 删除 n 个字符
+func (o *TextOperation) Delete(n int) *TextOperation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].delete > 0 {
+		o.ops[last].delete += n
+		return o
+	}
+	o.ops = append(o.ops, opComponent{delete: n})
+	return o
+}
+
+// IsNoop 操作不改变文档
+func (o *TextOperation) IsNoop() bool {
+	return len(o.ops) == 0 || (len(o.ops) == 1 && o.ops[0].retain > 0)
+}
+
+// Inserts 操作中插入的所有文本
+func (o *TextOperation) Inserts() []string {
+	var inserts []string
+	for _, c := range o.ops {
+		if c.insert != "" {
+			inserts = append(inserts, c.insert)
+		}
+	}
+	return inserts
+}
+
+// MarshalJSON 序列化为 ot.js 格式的数组
+func (o TextOperation) MarshalJSON() ([]byte, error) {
+	items := make([]interface{}, 0, len(o.ops))
+	for _, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			items = append(items, c.retain)
+		case c.delete > 0:
+			items = append(items, -c.delete)
+		default:
+			items = append(items, c.insert)
+		}
+	}
+	return json.Marshal(items)
+}
+
+// UnmarshalJSON 解析 ot.js 格式的数组
+func (o *TextOperation) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	*o = TextOperation{}
+	for _, item := range items {
+		if bytes.HasPrefix(bytes.TrimSpace(item), []byte(`"`)) {
+			var s string
+			if err := json.Unmarshal(item, &s); err != nil {
+				return err
+			}
+			o.Insert(s)
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(item, &n); err != nil || n == 0 {
+			return fmt.Errorf("无效的编辑操作: %s", item)
+		}
+		if n > 0 {
+			o.Retain(n)
+		} else {
+			o.Delete(-n)
+		}
+	}
+	return nil
+}
+
+// Apply 将操作应用到文档
+func (o *TextOperation) Apply(doc []rune) ([]rune, error) {
+	if len(doc) != o.BaseLen {
+		return nil, ErrOperationMismatch
+	}
+	out := make([]rune, 0, o.TargetLen)
+	pos := 0
+	for _, c := range o.ops {
+		if c.retain > len(doc)-pos || c.delete > len(doc)-pos {
+			return nil, ErrOperationMismatch
+		}
+		switch {
+		case c.retain > 0:
+			out = append(out, doc[pos:pos+c.retain]...)
+			pos += c.retain
+		case c.delete > 0:
+			pos += c.delete
+		default:
+			out = append(out, []rune(c.insert)...)
+		}
+	}
+	return out, nil
+}
+
+// TransformIndex 计算文档中的位置 (如光标) 在操作之后的新位置
+func (o *TextOperation) TransformIndex(index int) int {
+	newIndex, pos := index, 0
+	for _, c := range o.ops {
+		if pos > index {
+			break
+		}
+		switch {
+		case c.retain > 0:
+			pos += c.retain
+		case c.delete > 0:
+			newIndex -= min(c.delete, index-pos)
+			pos += c.delete
+		default:
+			newIndex += utf8.RuneCountInString(c.insert)
+		}
+	}
+	return max(newIndex, 0)
+}
+
+// TransformOperations 对基于同一文档的并发操作 a、b 做变换，返回 a'、b'，
+// 满足 apply(apply(doc, a), b') == apply(apply(doc, b), a')；同一位置的插入 a 在前
+func TransformOperations(a, b *TextOperation) (*TextOperation, *TextOperation, error) {
+	if a.BaseLen != b.BaseLen {
+		return nil, nil, ErrOperationMismatch
+	}
+	a1, b1 := &TextOperation{}, &TextOperation{}
+	ops1 := append([]opComponent(nil), a.ops...)
+	ops2 := append([]opComponent(nil), b.ops...)
+	i, j := 0, 0
+	for i < len(ops1) || j < len(ops2) {
+		if i < len(ops1) && ops1[i].insert != "" {
+			a1.Insert(ops1[i].insert)
+			b1.Retain(utf8.RuneCountInString(ops1[i].insert))
+			i++
+			continue
+		}
+		if j < len(ops2) && ops2[j].insert != "" {
+			a1.Retain(utf8.RuneCountInString(ops2[j].insert))
+			b1.Insert(ops2[j].insert)
+			j++
+			continue
+		}
+		if i >= len(ops1) || j >= len(ops2) {
+			return nil, nil, ErrOperationMismatch
+		}
+
+		op1, op2 := &ops1[i], &ops2[j]
+		n1, n2 := op1.retain+op1.delete, op2.retain+op2.delete
+		n := min(n1, n2)
+		switch {
+		case op1.retain > 0 && op2.retain > 0:
+			a1.Retain(n)
+			b1.Retain(n)
+		case op1.delete > 0 && op2.retain > 0:
+			a1.Delete(n)
+		case op1.retain > 0 && op2.delete > 0:
+			b1.Delete(n)
+		}
+		// 双方删除同一段文字时无需输出
+		consume(op1, n)
+		consume(op2, n)
+		if n1 == n {
+			i++
+		}
+		if n2 == n {
+			j++
+		}
+	}
+	return a1, b1, nil
+}
+
+// consume 消耗保留或删除分量的前 n 个字符
+func consume(c *opComponent, n int) {
+	if c.retain > 0 {
+		c.retain -= n
+	} else {
+		c.delete -= n
+	}
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// randomOperation 生成作用于 doc 的随机操作
+func randomOperation(r *rand.Rand, doc []rune) *TextOperation {
+	op := &TextOperation{}
+	words := []string{"a", "文", "😀", "xy", "\n"}
+	for left := len(doc); left > 0; {
+		n := 1 + r.Intn(left)
+		switch r.Intn(3) {
+		case 0:
+			op.Retain(n)
+		case 1:
+			op.Delete(n)
+		default:
+			op.Insert(words[r.Intn(len(words))])
+			continue
+		}
+		left -= n
+	}
+	if r.Intn(2) == 0 {
+		op.Insert(words[r.Intn(len(words))])
+	}
+	return op
+}
+
+func TestTextOperationJSON(t *testing.T) {
+	var op TextOperation
+	assert.NoError(t, json.Unmarshal([]byte(`[2, -1, "你好", 3]`), &op))
+	assert.Equal(t, 6, op.BaseLen)
+	assert.Equal(t, 7, op.TargetLen)
+
+	// 删除后紧跟的插入被规范化为先插入后删除
+	data, err := json.Marshal(op)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[2, "你好", -1, 3]`, string(data))
+
+	doc, err := op.Apply([]rune("ab-cde"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ab你好cde", string(doc))
+
+	_, err = op.Apply([]rune("short"))
+	assert.ErrorIs(t, err, ErrOperationMismatch)
+	assert.Error(t, json.Unmarshal([]byte(`[0]`), &op))
+	assert.Error(t, json.Unmarshal([]byte(`[1.5]`), &op))
+}
+
+func TestTransformOperations(t *testing.T) {
+	t.Run("Concurrent Inserts At Same Position", func(t *testing.T) {
+		doc := []rune("ac")
+		a := (&TextOperation{}).Retain(1).Insert("B").Retain(1)
+		b := (&TextOperation{}).Retain(1).Insert("X").Retain(1)
+		a1, b1, err := TransformOperations(a, b)
+		assert.NoError(t, err)
+
+		left, _ := a.Apply(doc)
+		left, _ = b1.Apply(left)
+		right, _ := b.Apply(doc)
+		right, _ = a1.Apply(right)
+		assert.Equal(t, "aBXc", string(left))
+		assert.Equal(t, string(left), string(right))
+	})
+
+	t.Run("Overlapping Deletes", func(t *testing.T) {
+		doc := []rune("abcdef")
+		a := (&TextOperation{}).Retain(1).Delete(3).Retain(2)
+		b := (&TextOperation{}).Retain(2).Delete(3).Retain(1)
+		a1, b1, err := TransformOperations(a, b)
+		assert.NoError(t, err)
+
+		left, _ := a.Apply(doc)
+		left, _ = b1.Apply(left)
+		right, _ := b.Apply(doc)
+		right, _ = a1.Apply(right)
+		assert.Equal(t, "af", string(left))
+		assert.Equal(t, string(left), string(right))
+	})
+
+	t.Run("Random Convergence", func(t *testing.T) {
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 500; i++ {
+			doc := []rune("协同编辑 collaborative 😀 text")
+			a, b := randomOperation(r, doc), randomOperation(r, doc)
+			a1, b1, err := TransformOperations(a, b)
+			assert.NoError(t, err)
+
+			left, err := a.Apply(doc)
+			assert.NoError(t, err)
+			left, err = b1.Apply(left)
+			assert.NoError(t, err)
+			right, err := b.Apply(doc)
+			assert.NoError(t, err)
+			right, err = a1.Apply(right)
+			assert.NoError(t, err)
+			assert.Equal(t, string(left), string(right))
+		}
+	})
+
+	t.Run("Base Length Mismatch", func(t *testing.T) {
+		_, _, err := TransformOperations((&TextOperation{}).Retain(1), (&TextOperation{}).Retain(2))
+		assert.ErrorIs(t, err, ErrOperationMismatch)
+	})
+}
+
+func TestTransformIndex(t *testing.T) {
+	// "hello world" -> "hi world"：删除 "ello"，插入 "i"
+	op := (&TextOperation{}).Retain(1).Insert("i").Delete(4).Retain(6)
+	assert.Equal(t, 0, op.TransformIndex(0))
+	assert.Equal(t, 2, op.TransformIndex(3))
+	assert.Equal(t, 4, op.TransformIndex(7))
+	assert.True(t, (&TextOperation{}).Retain(3).IsNoop())
+}
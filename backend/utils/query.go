@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 搜索语法:
+//   关键字           匹配文件名或正文
+//   "精确短语"        短语匹配
+//   -关键字          排除
+//   name:报告        仅匹配文件名      content:合同  仅匹配正文
+//   ext:pdf          扩展名            type:image    文件类别
+//   tag:invoice      标签              year:2026     自定义元数据 (未知字段均视为元数据)
+//   size:>10mb       大小范围，支持 > >= < <= 与 1mb..5mb
+//   modified:2026-01 修改时间范围，支持年/月/日与 2026-01-01..2026-03-31 (date: 为别名)
+//   created:>2025    上传时间范围
+//   in:/文档/合同     限定在某个目录内
+//   is:favorite      仅收藏的文件
+
+// SearchClause 文本类查询条件，Field 为空时匹配文件名或正文
+type SearchClause struct {
+	Field  string
+	Value  string
+	Phrase bool
+	Negate bool
+}
+
+// SearchQuery 解析后的结构化查询
+type SearchQuery struct {
+	Clauses      []SearchClause
+	SizeMin      *int64
+	SizeMax      *int64
+	CreatedFrom  *time.Time
+	CreatedTo    *time.Time
+	ModifiedFrom *time.Time
+	ModifiedTo   *time.Time
+	Folder       string // in: 指定的目录路径
+	FolderID     uint   // 目录 ID，由调用方解析 Folder 后填入
+	Favorite     *bool
+}
+
+// HasText 是否包含需要匹配文件名或正文的关键字
+func (q *SearchQuery) HasText() bool {
+	for _, c := range q.Clauses {
+		if !c.Negate {
+			return true
+		}
+	}
+	return false
+}
+
+// Keywords 返回所有非排除的关键字，用于降级到数据库搜索
+func (q *SearchQuery) Keywords() []string {
+	var words []string
+	for _, c := range q.Clauses {
+		if !c.Negate && (c.Field == "" || c.Field == "name") {
+			words = append(words, c.Value)
+		}
+	}
+	return words
+}
+
+// tokenizeQuery 按空白拆分查询语句，引号内的空白保留
+func tokenizeQuery(s string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			cur.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuote:
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, errors.New("搜索语句中的引号未闭合")
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+// unquote 去除值两端的引号，返回是否为短语
+func unquote(v string) (string, bool) {
+	if len(v) >= 2 && strings.HasPrefix(v, `"`) && strings.HasSuffix(v, `"`) {
+		return v[1 : len(v)-1], true
+	}
+	return v, false
+}
+
+// isFieldName 判断冒号前的部分是否为字段名
+func isFieldName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case i > 0 && (r >= '0' && r <= '9' || r == '.' || r == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSearchQuery 解析搜索语句
+func ParseSearchQuery(s string) (*SearchQuery, error) {
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &SearchQuery{}
+	for _, tok := range tokens {
+		negate := false
+		if len(tok) > 1 && tok[0] == '-' {
+			negate = true
+			tok = tok[1:]
+		}
+
+		field, value := "", tok
+		if i := strings.Index(tok, ":"); i > 0 && !strings.HasPrefix(tok, `"`) && isFieldName(tok[:i]) {
+			field, value = strings.ToLower(tok[:i]), tok[i+1:]
+		}
+		value, phrase := unquote(value)
+		if value == "" {
+			continue
+		}
+
+		switch field {
+		case "", "name", "content":
+			q.Clauses = append(q.Clauses, SearchClause{Field: field, Value: value, Phrase: phrase, Negate: negate})
+		case "ext":
+			value = strings.ToLower(value)
+			if !strings.HasPrefix(value, ".") {
+				value = "." + value
+			}
+			q.Clauses = append(q.Clauses, SearchClause{Field: "ext", Value: value, Negate: negate})
+		case "type":
+			if !IsValidCategory(value) {
+				return nil, errors.New("不支持的文件类别: " + value)
+			}
+			q.Clauses = append(q.Clauses, SearchClause{Field: "category", Value: value, Negate: negate})
+		case "tag":
+			q.Clauses = append(q.Clauses, SearchClause{Field: "tag", Value: strings.ToLower(value), Negate: negate})
+		case "size":
+			if q.SizeMin, q.SizeMax, err = parseSizeRange(value); err != nil {
+				return nil, err
+			}
+		case "modified", "date":
+			if q.ModifiedFrom, q.ModifiedTo, err = parseDateRange(value); err != nil {
+				return nil, err
+			}
+		case "created":
+			if q.CreatedFrom, q.CreatedTo, err = parseDateRange(value); err != nil {
+				return nil, err
+			}
+		case "in":
+			q.Folder = value
+		case "is":
+			if strings.ToLower(value) != "favorite" {
+				return nil, errors.New("不支持的筛选条件: is:" + value)
+			}
+			favorite := !negate
+			q.Favorite = &favorite
+		default:
+			q.Clauses = append(q.Clauses, SearchClause{Field: "meta." + field, Value: value, Phrase: phrase, Negate: negate})
+		}
+	}
+	return q, nil
+}
+
+// splitRange 拆分范围表达式，返回下界、上界及是否包含边界
+// 支持 a..b、>a、>=a、<b、<=b，单个值表示精确范围
+func splitRange(v string) (lo string, hi string, exact bool) {
+	switch {
+	case strings.Contains(v, ".."):
+		parts := strings.SplitN(v, "..", 2)
+		return parts[0], parts[1], false
+	case strings.HasPrefix(v, ">="):
+		return v[2:], "", false
+	case strings.HasPrefix(v, ">"):
+		return v[1:], "", false
+	case strings.HasPrefix(v, "<="):
+		return "", v[2:], false
+	case strings.HasPrefix(v, "<"):
+		return "", v[1:], false
+	}
+	return v, v, true
+}
+
+// ParseSize 解析带单位的大小，如 10mb、1.5g、512k
+func ParseSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"tb", 1 << 40}, {"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"t", 1 << 40}, {"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10}, {"b", 1},
+	}
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, factor = strings.TrimSuffix(s, u.suffix), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("文件大小格式错误")
+	}
+	return int64(n * factor), nil
+}
+
+func parseSizeRange(v string) (*int64, *int64, error) {
+	lo, hi, _ := splitRange(v)
+	var min, max *int64
+	if lo != "" {
+		n, err := ParseSize(lo)
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.HasPrefix(v, ">") && !strings.HasPrefix(v, ">=") {
+			n++
+		}
+		min = &n
+	}
+	if hi != "" {
+		n, err := ParseSize(hi)
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.HasPrefix(v, "<") && !strings.HasPrefix(v, "<=") {
+			n--
+		}
+		max = &n
+	}
+	return min, max, nil
+}
+
+// parseDate 解析年、年-月或年-月-日，返回该时间段的起止时间
+func parseDate(s string) (time.Time, time.Time, error) {
+	for _, layout := range []struct {
+		format string
+		years  int
+		months int
+		days   int
+	}{
+		{"2006-01-02", 0, 0, 1},
+		{"2006-01", 0, 1, 0},
+		{"2006", 1, 0, 0},
+	} {
+		if t, err := time.ParseInLocation(layout.format, s, time.Local); err == nil {
+			end := t.AddDate(layout.years, layout.months, layout.days).Add(-time.Millisecond)
+			return t, end, nil
+		}
+	}
+	return time.Time{}, time.Time{}, errors.New("日期格式错误: " + s)
+}
+
+func parseDateRange(v string) (*time.Time, *time.Time, error) {
+	lo, hi, exact := splitRange(v)
+	var from, to *time.Time
+	if lo != "" {
+		start, end, err := parseDate(lo)
+		if err != nil {
+			return nil, nil, err
+		}
+		// >2026 表示 2026 年之后
+		if strings.HasPrefix(v, ">") && !strings.HasPrefix(v, ">=") {
+			start = end.Add(time.Millisecond)
+		}
+		from = &start
+		if exact {
+			to = &end
+		}
+	}
+	if hi != "" && !exact {
+		start, end, err := parseDate(hi)
+		if err != nil {
+			return nil, nil, err
+		}
+		// <2026 表示 2026 年之前
+		if strings.HasPrefix(v, "<") && !strings.HasPrefix(v, "<=") {
+			end = start.Add(-time.Millisecond)
+		}
+		to = &end
+	}
+	return from, to, nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	t.Run("Clauses", func(t *testing.T) {
+		q, err := ParseSearchQuery(`报告 "年度 总结" -草稿 name:合同 content:发票 ext:PDF type:image tag:Invoice year:2026`)
+		assert.NoError(t, err)
+		assert.Equal(t, []SearchClause{
+			{Value: "报告"},
+			{Value: "年度 总结", Phrase: true},
+			{Value: "草稿", Negate: true},
+			{Field: "name", Value: "合同"},
+			{Field: "content", Value: "发票"},
+			{Field: "ext", Value: ".pdf"},
+			{Field: "category", Value: "image"},
+			{Field: "tag", Value: "invoice"},
+			{Field: "meta.year", Value: "2026"},
+		}, q.Clauses)
+		assert.Equal(t, []string{"报告", "年度 总结", "合同"}, q.Keywords())
+	})
+
+	t.Run("Ranges", func(t *testing.T) {
+		q, err := ParseSearchQuery("size:1mb..5mb modified:2026-03 created:>2025")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1<<20), *q.SizeMin)
+		assert.Equal(t, int64(5<<20), *q.SizeMax)
+		assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local), *q.ModifiedFrom)
+		assert.Equal(t, time.Date(2026, 3, 31, 23, 59, 59, 999e6, time.Local), *q.ModifiedTo)
+		assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local), *q.CreatedFrom)
+		assert.Nil(t, q.CreatedTo)
+
+		q, err = ParseSearchQuery("size:<1k date:<=2025-06-30")
+		assert.NoError(t, err)
+		assert.Nil(t, q.SizeMin)
+		assert.Equal(t, int64(1023), *q.SizeMax)
+		assert.Nil(t, q.ModifiedFrom)
+		assert.Equal(t, time.Date(2025, 6, 30, 23, 59, 59, 999e6, time.Local), *q.ModifiedTo)
+	})
+
+	t.Run("Scope", func(t *testing.T) {
+		q, err := ParseSearchQuery(`in:"/文档/合同 2026" is:favorite`)
+		assert.NoError(t, err)
+		assert.Equal(t, "/文档/合同 2026", q.Folder)
+		assert.True(t, *q.Favorite)
+		assert.False(t, q.HasText())
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, s := range []string{`"未闭合`, "type:unknown", "size:abc", "modified:2026/01", "is:shared"} {
+			_, err := ParseSearchQuery(s)
+			assert.Error(t, err, s)
+		}
+	})
+
+	t.Run("Colon In Keyword", func(t *testing.T) {
+		q, err := ParseSearchQuery(`"a:b" 12:30`)
+		assert.NoError(t, err)
+		assert.Equal(t, []SearchClause{{Value: "a:b", Phrase: true}, {Value: "12:30"}}, q.Clauses)
+	})
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiterSweep 记录数超过该值时清理已过期的记录
+const attemptLimiterSweep = 4096
+
+// AttemptLimiter 按键统计失败次数 (如 IP + 分享)，窗口内失败达到上限后拒绝尝试直到窗口结束
+type AttemptLimiter struct {
+	mu      sync.Mutex
+	max     int
+	window  time.Duration
+	entries map[string]*attemptEntry
+	now     func() time.Time
+}
+
+type attemptEntry struct {
+	failures int
+	start    time.Time
+}
+
+// NewAttemptLimiter 创建限制器：window 时间内最多失败 max 次
+func NewAttemptLimiter(max int, window time.Duration) *AttemptLimiter {
+	return &AttemptLimiter{max: max, window: window, entries: make(map[string]*attemptEntry), now: time.Now}
+}
+
+// Allow 判断是否允许尝试，不允许时返回需要等待的时间
+func (l *AttemptLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok {
+		return true, 0
+	}
+	elapsed := l.now().Sub(e.start)
+	if elapsed >= l.window {
+		delete(l.entries, key)
+		return true, 0
+	}
+	if e.failures >= l.max {
+		return false, l.window - elapsed
+	}
+	return true, 0
+}
+
+// Fail 记录一次失败
+func (l *AttemptLimiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.entries) >= attemptLimiterSweep {
+		for k, e := range l.entries {
+			if now.Sub(e.start) >= l.window {
+				delete(l.entries, k)
+			}
+		}
+	}
+	e, ok := l.entries[key]
+	if !ok || now.Sub(e.start) >= l.window {
+		l.entries[key] = &attemptEntry{failures: 1, start: now}
+		return
+	}
+	e.failures++
+}
+
+// Reset 成功后清除失败记录
+func (l *AttemptLimiter) Reset(key string) {
+	l.mu.Lock()
+	delete(l.entries, key)
+	l.mu.Unlock()
+}
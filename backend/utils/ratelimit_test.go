@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewAttemptLimiter(3, 10*time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("1.2.3.4|7")
+		assert.True(t, ok)
+		l.Fail("1.2.3.4|7")
+	}
+	ok, wait := l.Allow("1.2.3.4|7")
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Minute, wait)
+
+	// 其他 IP 或其他分享不受影响
+	ok, _ = l.Allow("1.2.3.4|8")
+	assert.True(t, ok)
+	ok, _ = l.Allow("5.6.7.8|7")
+	assert.True(t, ok)
+
+	// 窗口结束后解除限制
+	now = now.Add(10 * time.Minute)
+	ok, _ = l.Allow("1.2.3.4|7")
+	assert.True(t, ok)
+
+	// 成功后清除失败记录
+	l.Fail("5.6.7.8|7")
+	l.Fail("5.6.7.8|7")
+	l.Reset("5.6.7.8|7")
+	l.Fail("5.6.7.8|7")
+	l.Fail("5.6.7.8|7")
+	ok, _ = l.Allow("5.6.7.8|7")
+	assert.True(t, ok)
+}
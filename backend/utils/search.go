@@ -1,112 +1,520 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
+	"github.com/blevesearch/bleve/v2/search/query"
+	indexapi "github.com/blevesearch/bleve_index_api"
+	"github.com/mozillazg/go-pinyin"
 )
 
+// 索引映射版本，分析器或字段发生变化时递增，启动时发现版本不一致会重建索引
+const indexMappingVersion = "3"
+
+var mappingVersionKey = []byte("mapping_version")
+
+// ErrIndexUnavailable 搜索索引未初始化或打开失败
+var ErrIndexUnavailable = errors.New("搜索索引不可用")
+
 var (
-	index     bleve.Index
-	indexOnce sync.Once
+	index        bleve.Index
+	indexOnce    sync.Once
+	indexRebuilt bool
 )
 
+// buildIndexMapping 构造文件索引映射
+// 文件名与正文使用 CJK 二元分词，文件名额外索引拼音，ID、用户与标签等筛选字段不分词
+func buildIndexMapping() *mapping.IndexMappingImpl {
+	// 文件名与正文使用 CJK 分词，并保存原文用于高亮
+	textFieldMapping := bleve.NewTextFieldMapping()
+	textFieldMapping.Analyzer = cjk.AnalyzerName
+	textFieldMapping.Store = true
+	textFieldMapping.IncludeTermVectors = true
+
+	// 拼音使用标准分词，不参与高亮
+	pinyinFieldMapping := bleve.NewTextFieldMapping()
+	pinyinFieldMapping.Analyzer = standard.Name
+	pinyinFieldMapping.Store = false
+
+	// ID 和 UserID 使用关键字分词（不分词）
+	keywordFieldMapping := bleve.NewTextFieldMapping()
+	keywordFieldMapping.Analyzer = keyword.Name
+
+	documentMapping := bleve.NewDocumentMapping()
+	documentMapping.AddFieldMappingsAt("name", textFieldMapping)
+	documentMapping.AddFieldMappingsAt("content", textFieldMapping)
+	documentMapping.AddFieldMappingsAt("name_pinyin", pinyinFieldMapping)
+	documentMapping.AddFieldMappingsAt("user_id", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("file_id", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("tag", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("ext", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("category", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("year", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("folders", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("size", bleve.NewNumericFieldMapping())
+	documentMapping.AddFieldMappingsAt("created", bleve.NewDateTimeFieldMapping())
+	documentMapping.AddFieldMappingsAt("modified", bleve.NewDateTimeFieldMapping())
+	documentMapping.AddFieldMappingsAt("favorite", bleve.NewBooleanFieldMapping())
+
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.TypeField = "type"
+	indexMapping.DefaultAnalyzer = cjk.AnalyzerName
+	indexMapping.AddDocumentMapping("file", documentMapping)
+	return indexMapping
+}
+
 // InitSearch 初始化搜索索引
 func InitSearch(indexPath string) error {
 	var err error
 	indexOnce.Do(func() {
 		if _, err = os.Stat(indexPath); os.IsNotExist(err) {
-			// 创建新的索引
-			mapping := bleve.NewIndexMapping()
-
-			// 文件名使用标准分词
-			nameFieldMapping := bleve.NewTextFieldMapping()
-			nameFieldMapping.Analyzer = standard.Name
+			index, err = createIndex(indexPath)
+			return
+		}
 
-			// 内容使用标准分词
-			contentFieldMapping := bleve.NewTextFieldMapping()
-			contentFieldMapping.Analyzer = standard.Name
+		// 打开现有索引，映射版本过旧时删除后重建
+		if index, err = bleve.Open(indexPath); err != nil {
+			return
+		}
+		version, _ := index.GetInternal(mappingVersionKey)
+		if string(version) == indexMappingVersion {
+			return
+		}
+		log.Printf("搜索索引版本 %q 已过期，正在重建索引", version)
+		_ = index.Close()
+		if err = os.RemoveAll(indexPath); err != nil {
+			index = nil
+			return
+		}
+		index, err = createIndex(indexPath)
+		indexRebuilt = err == nil
+	})
+	return err
+}
 
-			// ID 和 UserID 使用关键字分词（不分词）
-			keywordFieldMapping := bleve.NewTextFieldMapping()
-			keywordFieldMapping.Analyzer = keyword.Name
+// createIndex 创建新的索引并记录映射版本
+func createIndex(indexPath string) (bleve.Index, error) {
+	idx, err := bleve.New(indexPath, buildIndexMapping())
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.SetInternal(mappingVersionKey, []byte(indexMappingVersion)); err != nil {
+		_ = idx.Close()
+		return nil, err
+	}
+	return idx, nil
+}
 
-			documentMapping := bleve.NewDocumentMapping()
-			documentMapping.AddFieldMappingsAt("name", nameFieldMapping)
-			documentMapping.AddFieldMappingsAt("content", contentFieldMapping)
-			documentMapping.AddFieldMappingsAt("user_id", keywordFieldMapping)
-			documentMapping.AddFieldMappingsAt("file_id", keywordFieldMapping)
+// SearchIndexRebuilt 本次启动是否因版本变化重建了索引，重建后需要重新索引全部文件
+func SearchIndexRebuilt() bool {
+	return indexRebuilt
+}
 
-			mapping.AddDocumentMapping("file", documentMapping)
+// SearchDocument 索引中的文件文档
+// 提供 Data 时由已注册的抽取器从原始内容中抽取正文，否则直接使用 Content
+type SearchDocument struct {
+	FileID    uint
+	UserID    uint
+	Name      string
+	Ext       string
+	Category  string
+	MimeType  string
+	Size      int64
+	Favorite  bool
+	FolderIDs []uint // 所有祖先目录 ID，用于限定目录范围
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Content   string
+	Data      []byte
+	Tags      []string
+	Meta      map[string]string
+}
 
-			index, err = bleve.New(indexPath, mapping)
-		} else {
-			// 打开现有索引
-			index, err = bleve.Open(indexPath)
-		}
-	})
-	return err
+func docID(fileID uint) string {
+	return fmt.Sprintf("file_%d", fileID)
 }
 
 // IndexFile 对文件内容建立索引
-func IndexFile(fileID uint, userID uint, name string, content string) error {
+func IndexFile(d *SearchDocument) error {
 	if index == nil {
-		return nil
+		return ErrIndexUnavailable
+	}
+
+	content := d.Content
+	if d.Data != nil {
+		text, err := ExtractText(d.Name, d.MimeType, d.Data)
+		if err != nil && !errors.Is(err, ErrNoExtractor) {
+			return err
+		}
+		content = text
+	}
+	content = truncateText(content, MaxExtractedText)
+
+	tags := make([]string, 0, len(d.Tags))
+	for _, tag := range d.Tags {
+		tags = append(tags, strings.ToLower(tag))
+	}
+	meta := make(map[string]string, len(d.Meta))
+	for k, v := range d.Meta {
+		meta[strings.ToLower(k)] = v
+	}
+
+	folders := make([]string, 0, len(d.FolderIDs))
+	for _, id := range d.FolderIDs {
+		folders = append(folders, strconv.FormatUint(uint64(id), 10))
 	}
 
 	doc := map[string]interface{}{
-		"file_id": fmt.Sprintf("%d", fileID),
-		"user_id": fmt.Sprintf("%d", userID),
-		"name":    name,
-		"content": content,
-		"type":    "file",
+		"file_id":     fmt.Sprintf("%d", d.FileID),
+		"user_id":     fmt.Sprintf("%d", d.UserID),
+		"name":        d.Name,
+		"name_pinyin": NamePinyin(d.Name),
+		"content":     content,
+		"ext":         strings.ToLower(d.Ext),
+		"category":    d.Category,
+		"size":        d.Size,
+		"favorite":    d.Favorite,
+		"folders":     folders,
+		"created":     d.CreatedAt,
+		"modified":    d.UpdatedAt,
+		"year":        strconv.Itoa(d.UpdatedAt.Year()),
+		"tag":         tags,
+		"meta":        meta,
+		"type":        "file",
 	}
 
-	return index.Index(fmt.Sprintf("file_%d", fileID), doc)
+	return index.Index(docID(d.FileID), doc)
 }
 
-// SearchFiles 搜索文件
-func SearchFiles(userID uint, keywordStr string) ([]uint, error) {
+// UpdateIndexAttributes 更新文件名、标签与元数据，保留索引中已有的正文
+func UpdateIndexAttributes(d *SearchDocument) error {
 	if index == nil {
-		return nil, nil
+		return ErrIndexUnavailable
+	}
+
+	d.Data = nil
+	stored, err := index.Document(docID(d.FileID))
+	if err == nil && stored != nil {
+		stored.VisitFields(func(f indexapi.Field) {
+			if f.Name() == "content" {
+				d.Content = string(f.Value())
+			}
+		})
+	}
+	return IndexFile(d)
+}
+
+// maxPinyinSyllables 文件名参与拼音索引的汉字数上限
+const maxPinyinSyllables = 32
+
+// NamePinyin 生成文件名的拼音索引文本，包含逐字全拼，以及从每个字开始的连写全拼与首字母，
+// 以便按拼音前缀匹配文件名中任意位置的词。例如 "报告" -> "bao gao baogao bg g"，不含汉字时返回空串
+func NamePinyin(name string) string {
+	readings := pinyin.LazyPinyin(name, pinyin.NewArgs())
+	if len(readings) == 0 {
+		return ""
+	}
+	if len(readings) > maxPinyinSyllables {
+		readings = readings[:maxPinyinSyllables]
+	}
+
+	terms := append([]string{}, readings...)
+	for i := range readings {
+		var initials strings.Builder
+		for _, r := range readings[i:] {
+			initials.WriteByte(r[0])
+		}
+		if i < len(readings)-1 {
+			terms = append(terms, strings.Join(readings[i:], ""))
+		}
+		terms = append(terms, initials.String())
+	}
+	return strings.Join(terms, " ")
+}
+
+// isPinyinQuery 判断关键字是否可能是拼音输入 (仅包含字母)
+func isPinyinQuery(q string) bool {
+	if q == "" {
+		return false
+	}
+	for _, r := range q {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchHit 检索命中结果
+type SearchHit struct {
+	FileID     uint
+	Score      float64
+	Highlights map[string][]string // 字段名 -> 高亮片段 (HTML，命中词以 <mark> 包裹)
+}
+
+// FacetCount 分面统计项
+type FacetCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// SearchResults 一页检索结果
+type SearchResults struct {
+	Hits   []SearchHit
+	Total  uint64
+	Facets map[string][]FacetCount // type: 按文件类别，year: 按修改年份
+}
+
+// SearchSort 检索结果排序方式
+type SearchSort struct {
+	By   string // 空为相关度，可选 size、time
+	Desc bool
+}
+
+// textQuery 构造匹配单个字段的文本查询，多个词之间为 AND 关系
+func textQuery(field string, c SearchClause) query.Query {
+	if c.Phrase {
+		q := bleve.NewMatchPhraseQuery(c.Value)
+		q.SetField(field)
+		return q
 	}
+	q := bleve.NewMatchQuery(c.Value)
+	q.SetField(field)
+	q.SetOperator(query.MatchQueryOperatorAnd)
+	return q
+}
 
-	// 构造查询：匹配文件名或内容，且属于当前用户
+// clauseQuery 将文本类条件转换为 bleve 查询
+func clauseQuery(c SearchClause) query.Query {
+	switch c.Field {
+	case "", "name":
+		queries := []query.Query{textQuery("name", c)}
+		if c.Field == "" {
+			queries = append(queries, textQuery("content", c))
+		}
+		// 纯字母关键字同时按拼音前缀匹配文件名
+		if v := strings.ToLower(c.Value); !c.Phrase && isPinyinQuery(v) {
+			pinyinQuery := bleve.NewPrefixQuery(v)
+			pinyinQuery.SetField("name_pinyin")
+			queries = append(queries, pinyinQuery)
+		}
+		return bleve.NewDisjunctionQuery(queries...)
+	case "content":
+		return textQuery("content", c)
+	case "ext", "category", "tag":
+		q := bleve.NewTermQuery(c.Value)
+		q.SetField(c.Field)
+		return q
+	}
+	// 自定义元数据
+	return textQuery(c.Field, c)
+}
+
+// buildSearchQuery 将结构化查询转换为 bleve 查询，始终限定在用户自己的文件内
+func buildSearchQuery(userID uint, sq *SearchQuery) query.Query {
 	userQuery := bleve.NewTermQuery(fmt.Sprintf("%d", userID))
 	userQuery.SetField("user_id")
 
-	matchQuery := bleve.NewMatchQuery(keywordStr)
-	// 默认匹配 name 和 content 字段
+	must := []query.Query{userQuery}
+	var mustNot []query.Query
+	for _, c := range sq.Clauses {
+		if c.Negate {
+			mustNot = append(mustNot, clauseQuery(c))
+		} else {
+			must = append(must, clauseQuery(c))
+		}
+	}
+
+	inclusive := true
+	if sq.SizeMin != nil || sq.SizeMax != nil {
+		var min, max *float64
+		if sq.SizeMin != nil {
+			v := float64(*sq.SizeMin)
+			min = &v
+		}
+		if sq.SizeMax != nil {
+			v := float64(*sq.SizeMax)
+			max = &v
+		}
+		q := bleve.NewNumericRangeInclusiveQuery(min, max, &inclusive, &inclusive)
+		q.SetField("size")
+		must = append(must, q)
+	}
+	for field, r := range map[string][2]*time.Time{
+		"created":  {sq.CreatedFrom, sq.CreatedTo},
+		"modified": {sq.ModifiedFrom, sq.ModifiedTo},
+	} {
+		if r[0] == nil && r[1] == nil {
+			continue
+		}
+		var start, end time.Time
+		if r[0] != nil {
+			start = *r[0]
+		}
+		if r[1] != nil {
+			end = *r[1]
+		}
+		q := bleve.NewDateRangeInclusiveQuery(start, end, &inclusive, &inclusive)
+		q.SetField(field)
+		must = append(must, q)
+	}
+	if sq.FolderID != 0 {
+		q := bleve.NewTermQuery(strconv.FormatUint(uint64(sq.FolderID), 10))
+		q.SetField("folders")
+		must = append(must, q)
+	}
+	if sq.Favorite != nil {
+		q := bleve.NewBoolFieldQuery(*sq.Favorite)
+		q.SetField("favorite")
+		must = append(must, q)
+	}
+
+	bq := bleve.NewBooleanQuery()
+	bq.AddMust(must...)
+	if len(mustNot) > 0 {
+		bq.AddMustNot(mustNot...)
+	}
+	return bq
+}
+
+// Search 按结构化查询检索用户的文件，返回命中结果、高亮片段与分面统计
+func Search(userID uint, sq *SearchQuery, sort SearchSort, from int, size int) (*SearchResults, error) {
+	if index == nil {
+		return nil, ErrIndexUnavailable
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(buildSearchQuery(userID, sq), size, from, false)
+	searchRequest.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	searchRequest.Highlight.AddField("name")
+	searchRequest.Highlight.AddField("content")
+	searchRequest.AddFacet("type", bleve.NewFacetRequest("category", len(CategoryExts)+1))
+	searchRequest.AddFacet("year", bleve.NewFacetRequest("year", 50))
 
-	query := bleve.NewConjunctionQuery(userQuery, matchQuery)
+	prefix := ""
+	if sort.Desc {
+		prefix = "-"
+	}
+	switch sort.By {
+	case "size":
+		searchRequest.SortBy([]string{prefix + "size", "-_score", "_id"})
+	case "time":
+		searchRequest.SortBy([]string{prefix + "modified", "-_score", "_id"})
+	default:
+		searchRequest.SortBy([]string{"-_score", "_id"})
+	}
 
-	searchRequest := bleve.NewSearchRequest(query)
-	searchRequest.Fields = []string{"file_id"}
 	searchResult, err := index.Search(searchRequest)
 	if err != nil {
 		return nil, err
 	}
 
-	var fileIDs []uint
+	results := &SearchResults{
+		Hits:   make([]SearchHit, 0, len(searchResult.Hits)),
+		Total:  searchResult.Total,
+		Facets: map[string][]FacetCount{},
+	}
 	for _, hit := range searchResult.Hits {
 		var id uint
 		fmt.Sscanf(hit.ID, "file_%d", &id)
 		if id > 0 {
-			fileIDs = append(fileIDs, id)
+			results.Hits = append(results.Hits, SearchHit{FileID: id, Score: hit.Score, Highlights: hit.Fragments})
 		}
 	}
-
-	return fileIDs, nil
+	for name, facet := range searchResult.Facets {
+		counts := []FacetCount{}
+		for _, term := range facet.Terms.Terms() {
+			counts = append(counts, FacetCount{Term: term.Term, Count: term.Count})
+		}
+		results.Facets[name] = counts
+	}
+	return results, nil
 }
 
 // RemoveFromIndex 从索引中移除
 func RemoveFromIndex(fileID uint) error {
 	if index == nil {
-		return nil
+		return ErrIndexUnavailable
+	}
+	return index.Delete(docID(fileID))
+}
+
+// IsIndexed 判断文件是否已在索引中
+func IsIndexed(fileID uint) bool {
+	if index == nil {
+		return false
+	}
+	doc, err := index.Document(docID(fileID))
+	return err == nil && doc != nil
+}
+
+// userScopeQuery 限定用户范围的查询，userID 为 0 时匹配全部文档
+func userScopeQuery(userID uint) query.Query {
+	if userID == 0 {
+		return bleve.NewMatchAllQuery()
+	}
+	q := bleve.NewTermQuery(fmt.Sprintf("%d", userID))
+	q.SetField("user_id")
+	return q
+}
+
+// CountIndexed 统计索引中的文档数，userID 为 0 时统计全部
+func CountIndexed(userID uint) (uint64, error) {
+	if index == nil {
+		return 0, ErrIndexUnavailable
+	}
+	if userID == 0 {
+		return index.DocCount()
+	}
+	result, err := index.Search(bleve.NewSearchRequestOptions(userScopeQuery(userID), 0, 0, false))
+	if err != nil {
+		return 0, err
+	}
+	return result.Total, nil
+}
+
+// IndexedFileIDs 列出索引中的全部文件 ID，userID 为 0 时列出全部用户
+func IndexedFileIDs(userID uint) ([]uint, error) {
+	if index == nil {
+		return nil, ErrIndexUnavailable
+	}
+
+	const batch = 1000
+	var ids []uint
+	var after []string
+	for {
+		req := bleve.NewSearchRequestOptions(userScopeQuery(userID), batch, 0, false)
+		req.SortBy([]string{"_id"})
+		if after != nil {
+			req.SearchAfter = after
+		}
+		result, err := index.Search(req)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range result.Hits {
+			var id uint
+			fmt.Sscanf(hit.ID, "file_%d", &id)
+			if id > 0 {
+				ids = append(ids, id)
+			}
+		}
+		if len(result.Hits) < batch {
+			return ids, nil
+		}
+		after = []string{result.Hits[len(result.Hits)-1].ID}
 	}
-	return index.Delete(fmt.Sprintf("file_%d", fileID))
 }
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamePinyin(t *testing.T) {
+	assert.Equal(t, "bao gao baogao bg g", NamePinyin("报告.pdf"))
+	assert.Equal(t, "", NamePinyin("report.pdf"))
+}
+
+// search 解析查询语句并检索，返回命中的文件 ID
+func search(t *testing.T, userID uint, q string) []uint {
+	sq, err := ParseSearchQuery(q)
+	assert.NoError(t, err)
+	results, err := Search(userID, sq, SearchSort{}, 0, 20)
+	assert.NoError(t, err)
+	var ids []uint
+	for _, hit := range results.Hits {
+		ids = append(ids, hit.FileID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	idx, err := createIndex(t.TempDir() + "/index.bleve")
+	assert.NoError(t, err)
+	index = idx
+	defer func() {
+		_ = idx.Close()
+		index = nil
+	}()
+
+	march := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local)
+	docs := []*SearchDocument{
+		{FileID: 1, UserID: 7, Name: "2026年第一季度报告.docx", Ext: ".docx", Category: CategoryDocument, Size: 20 << 20,
+			FolderIDs: []uint{3}, UpdatedAt: march, Content: "本季度营业收入同比增长", Tags: []string{"Invoice"}, Meta: map[string]string{"year": "2026"}},
+		{FileID: 2, UserID: 7, Name: "旅行照片.zip", Ext: ".zip", Category: CategoryArchive, Size: 1 << 20,
+			UpdatedAt: march.AddDate(-1, 0, 0), Favorite: true},
+		{FileID: 3, UserID: 8, Name: "季度报告.docx", Ext: ".docx", Category: CategoryDocument, UpdatedAt: march},
+	}
+	for _, d := range docs {
+		assert.NoError(t, IndexFile(d))
+	}
+
+	t.Run("CJK Terms And Highlights", func(t *testing.T) {
+		sq, _ := ParseSearchQuery("营业收入")
+		results, err := Search(7, sq, SearchSort{}, 0, 20)
+		assert.NoError(t, err)
+		if assert.Len(t, results.Hits, 1) {
+			assert.Equal(t, uint(1), results.Hits[0].FileID)
+			assert.Greater(t, results.Hits[0].Score, 0.0)
+			assert.Contains(t, results.Hits[0].Highlights["content"][0], "<mark>")
+		}
+	})
+
+	t.Run("Pinyin", func(t *testing.T) {
+		assert.Equal(t, []uint{2}, search(t, 7, "lvxing"))
+		// 其他用户的文件不会命中
+		assert.Equal(t, []uint{1}, search(t, 7, "jdbg"))
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		assert.Equal(t, []uint{1}, search(t, 7, "tag:invoice year:2026"))
+		assert.Equal(t, []uint{1}, search(t, 7, "ext:docx"))
+		assert.Equal(t, []uint{2}, search(t, 7, "type:archive"))
+		assert.Equal(t, []uint{1}, search(t, 7, "size:>10mb"))
+		assert.Equal(t, []uint{2}, search(t, 7, "modified:2025"))
+		assert.Equal(t, []uint{2}, search(t, 7, "is:favorite"))
+		assert.Equal(t, []uint{1}, search(t, 7, "-is:favorite"))
+		assert.Equal(t, []uint{2}, search(t, 7, "-ext:docx"))
+		assert.Equal(t, []uint{1}, search(t, 7, `name:"季度报告"`))
+		assert.Empty(t, search(t, 7, "content:照片"))
+	})
+
+	t.Run("Folder Scope", func(t *testing.T) {
+		sq, _ := ParseSearchQuery("")
+		sq.FolderID = 3
+		results, err := Search(7, sq, SearchSort{}, 0, 20)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), results.Total)
+	})
+
+	t.Run("Facets And Paging", func(t *testing.T) {
+		sq, _ := ParseSearchQuery("")
+		results, err := Search(7, sq, SearchSort{By: "size", Desc: true}, 0, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), results.Total)
+		if assert.Len(t, results.Hits, 1) {
+			assert.Equal(t, uint(1), results.Hits[0].FileID)
+		}
+		assert.ElementsMatch(t, []FacetCount{{Term: "2026", Count: 1}, {Term: "2025", Count: 1}}, results.Facets["year"])
+		assert.ElementsMatch(t, []FacetCount{{Term: CategoryDocument, Count: 1}, {Term: CategoryArchive, Count: 1}}, results.Facets["type"])
+
+		results, err = Search(7, sq, SearchSort{By: "size", Desc: true}, 1, 1)
+		assert.NoError(t, err)
+		if assert.Len(t, results.Hits, 1) {
+			assert.Equal(t, uint(2), results.Hits[0].FileID)
+		}
+	})
+}
+
+func TestIndexedFileIDs(t *testing.T) {
+	idx, err := createIndex(t.TempDir() + "/index.bleve")
+	assert.NoError(t, err)
+	index = idx
+	defer func() {
+		_ = idx.Close()
+		index = nil
+	}()
+
+	for i := uint(1); i <= 5; i++ {
+		assert.NoError(t, IndexFile(&SearchDocument{FileID: i, UserID: 1 + i%2, Name: "a.txt"}))
+	}
+	assert.NoError(t, RemoveFromIndex(5))
+
+	ids, err := IndexedFileIDs(0)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uint{1, 2, 3, 4}, ids)
+
+	ids, err = IndexedFileIDs(2)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uint{1, 3}, ids)
+
+	count, err := CountIndexed(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), count)
+	assert.True(t, IsIndexed(4))
+	assert.False(t, IsIndexed(5))
+}
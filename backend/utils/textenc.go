@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// 常用的文本编码名称 (WHATWG 规范名称)
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingGB18030 = "gb18030"
+)
+
+var (
+	// ErrUnknownEncoding 不支持的文本编码
+	ErrUnknownEncoding = errors.New("不支持的文本编码")
+	// ErrUnencodable 文本中包含目标编码无法表示的字符
+	ErrUnencodable = errors.New("文本包含当前编码无法表示的字符")
+)
+
+var textBOMs = map[string][]byte{
+	EncodingUTF8:    {0xEF, 0xBB, 0xBF},
+	EncodingUTF16LE: {0xFF, 0xFE},
+	EncodingUTF16BE: {0xFE, 0xFF},
+}
+
+// TextEncoding 文本文件的编码，在线编辑时按原编码 (及 BOM) 写回
+type TextEncoding struct {
+	Name string `json:"encoding"`
+	BOM  bool   `json:"bom"`
+}
+
+// DetectTextEncoding 识别文本编码
+// 优先识别 BOM，其次使用 MIME 中的 charset，都没有时按 UTF-8 校验，不合法则视为 GB18030
+func DetectTextEncoding(data []byte, mimeType string) TextEncoding {
+	for _, name := range []string{EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE} {
+		if bytes.HasPrefix(data, textBOMs[name]) {
+			return TextEncoding{Name: name, BOM: true}
+		}
+	}
+
+	if _, params, err := mime.ParseMediaType(mimeType); err == nil && params["charset"] != "" {
+		if e, err := htmlindex.Get(params["charset"]); err == nil {
+			if name, err := htmlindex.Name(e); err == nil && name != EncodingUTF8 {
+				return TextEncoding{Name: name}
+			}
+		}
+	}
+	if utf8.Valid(data) {
+		return TextEncoding{Name: EncodingUTF8}
+	}
+	return TextEncoding{Name: EncodingGB18030}
+}
+
+// NormalizeTextEncoding 规范化编码名称，如 "GBK" -> "gbk"、"utf8" -> "utf-8"
+func NormalizeTextEncoding(name string) (string, error) {
+	e, err := htmlindex.Get(strings.TrimSpace(name))
+	if err != nil {
+		return "", ErrUnknownEncoding
+	}
+	canonical, err := htmlindex.Name(e)
+	if err != nil || canonical == "replacement" || canonical == "x-user-defined" {
+		return "", ErrUnknownEncoding
+	}
+	return canonical, nil
+}
+
+// textEncoder 返回编码实现，UTF-8 返回 nil
+func textEncoder(name string) (encoding.Encoding, error) {
+	canonical, err := NormalizeTextEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+	if canonical == EncodingUTF8 {
+		return nil, nil
+	}
+	// 经 htmlindex 得到的 UTF-16 编码忽略 BOM，BOM 统一由调用方处理
+	return htmlindex.Get(canonical)
+}
+
+// DecodeTextAs 按指定编码将文本转换为 UTF-8，开头的 BOM 被去除
+func DecodeTextAs(data []byte, te TextEncoding) (string, error) {
+	if bom, ok := textBOMs[te.Name]; ok {
+		data = bytes.TrimPrefix(data, bom)
+	}
+	enc, err := textEncoder(te.Name)
+	if err != nil {
+		return "", err
+	}
+	if enc == nil {
+		return string(data), nil
+	}
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// EncodeText 将 UTF-8 文本按指定编码写出，te.BOM 为 true 时在开头写入 BOM
+// 存在无法表示的字符时返回 ErrUnencodable，并指出第一个这样的字符
+func EncodeText(text string, te TextEncoding) ([]byte, error) {
+	enc, err := textEncoder(te.Name)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	if enc == nil {
+		if !utf8.ValidString(text) {
+			return nil, ErrUnencodable
+		}
+		out = []byte(text)
+	} else if out, err = enc.NewEncoder().Bytes([]byte(text)); err != nil {
+		for _, r := range text {
+			if _, e := enc.NewEncoder().String(string(r)); e != nil {
+				return nil, fmt.Errorf("%w: %q", ErrUnencodable, r)
+			}
+		}
+		return nil, ErrUnencodable
+	}
+
+	if bom, ok := textBOMs[te.Name]; ok && te.BOM {
+		out = append(append([]byte{}, bom...), out...)
+	}
+	return out, nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestTextEncodingRoundTrip(t *testing.T) {
+	t.Run("GBK Without Charset", func(t *testing.T) {
+		original, _ := simplifiedchinese.GBK.NewEncoder().Bytes([]byte("季度报告\r\n第二行"))
+		te := DetectTextEncoding(original, "text/plain")
+		assert.Equal(t, TextEncoding{Name: EncodingGB18030}, te)
+
+		text, err := DecodeTextAs(original, te)
+		assert.NoError(t, err)
+		assert.Equal(t, "季度报告\r\n第二行", text)
+
+		saved, err := EncodeText(text, te)
+		assert.NoError(t, err)
+		assert.Equal(t, original, saved)
+	})
+
+	t.Run("Charset From MIME", func(t *testing.T) {
+		te := DetectTextEncoding([]byte("abc"), "text/plain; charset=GBK")
+		assert.Equal(t, "gbk", te.Name)
+	})
+
+	t.Run("UTF-8 BOM", func(t *testing.T) {
+		original := []byte("\xEF\xBB\xBF你好")
+		te := DetectTextEncoding(original, "")
+		assert.Equal(t, TextEncoding{Name: EncodingUTF8, BOM: true}, te)
+
+		text, err := DecodeTextAs(original, te)
+		assert.NoError(t, err)
+		assert.Equal(t, "你好", text)
+
+		saved, err := EncodeText(text, te)
+		assert.NoError(t, err)
+		assert.Equal(t, original, saved)
+	})
+
+	t.Run("UTF-16LE BOM", func(t *testing.T) {
+		original := []byte{0xFF, 0xFE, 'h', 0, 'i', 0}
+		te := DetectTextEncoding(original, "")
+		assert.Equal(t, TextEncoding{Name: EncodingUTF16LE, BOM: true}, te)
+
+		text, err := DecodeTextAs(original, te)
+		assert.NoError(t, err)
+		assert.Equal(t, "hi", text)
+
+		saved, err := EncodeText(text, te)
+		assert.NoError(t, err)
+		assert.Equal(t, original, saved)
+	})
+
+	t.Run("Unencodable", func(t *testing.T) {
+		_, err := EncodeText("表情😀", TextEncoding{Name: "gbk"})
+		assert.ErrorIs(t, err, ErrUnencodable)
+
+		// GB18030 可以表示所有 Unicode 字符
+		_, err = EncodeText("表情😀", TextEncoding{Name: EncodingGB18030})
+		assert.NoError(t, err)
+	})
+}
+
+func TestNormalizeTextEncoding(t *testing.T) {
+	name, err := NormalizeTextEncoding("GBK")
+	assert.NoError(t, err)
+	assert.Equal(t, "gbk", name)
+
+	name, err = NormalizeTextEncoding("utf8")
+	assert.NoError(t, err)
+	assert.Equal(t, EncodingUTF8, name)
+
+	_, err = NormalizeTextEncoding("klingon")
+	assert.ErrorIs(t, err, ErrUnknownEncoding)
+}
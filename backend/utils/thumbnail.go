@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// 注册可解码的图片格式
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/image/draw"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// 缩略图格式
+const (
+	ThumbJPEG = "jpeg"
+	ThumbWebP = "webp"
+)
+
+// ThumbSizes 缩略图尺寸名称及最长边像素
+var ThumbSizes = map[string]int{
+	"small":  200,
+	"medium": 480,
+	"large":  1280,
+}
+
+// MaxThumbPixels 原图像素上限，防止超大图片 (解压炸弹) 耗尽内存
+var MaxThumbPixels = 50 * 1000 * 1000
+
+// ErrImageTooLarge 原图尺寸超过上限
+var ErrImageTooLarge = errors.New("图片尺寸过大")
+
+// ThumbContentType 缩略图格式对应的 MIME 类型
+func ThumbContentType(format string) string {
+	if format == ThumbWebP {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+// DecodeImage 解码图片并按 EXIF 方向信息校正
+func DecodeImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxThumbPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return applyOrientation(img, exifOrientation(data)), nil
+}
+
+// exifOrientation 读取 EXIF 方向 (1-8)，没有 EXIF 时返回 1
+func exifOrientation(data []byte) int {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 1
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	o, err := tag.Int(0)
+	if err != nil || o < 1 || o > 8 {
+		return 1
+	}
+	return o
+}
+
+// applyOrientation 按 EXIF 方向旋转或翻转图片，使其以正确朝向显示
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// 5-8 需要交换宽高
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 旋转 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿左上-右下对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转 90°
+				dx, dy = h-1-y, x
+			case 7: // 沿右上-左下对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针旋转 90°
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// ResizeToFit 等比缩放图片使最长边不超过 max，小图保持原尺寸
+func ResizeToFit(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+	if w >= h {
+		h = h * max / w
+		w = max
+	} else {
+		w = w * max / h
+		h = max
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// EncodeThumbnail 将图片编码为指定格式，JPEG 不支持透明，透明区域以白色填充
+func EncodeThumbnail(w io.Writer, img image.Image, format string) error {
+	if format == ThumbWebP {
+		return nativewebp.Encode(w, img, nil)
+	}
+
+	b := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(canvas, canvas.Bounds(), img, b.Min, draw.Over)
+	return jpeg.Encode(w, canvas, &jpeg.Options{Quality: 82})
+}
+
+// MakeThumbnail 由原图数据生成缩略图，返回编码后的数据与尺寸
+func MakeThumbnail(data []byte, max int, format string) ([]byte, int, int, error) {
+	img, err := DecodeImage(data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	thumb := ResizeToFit(img, max)
+
+	var buf bytes.Buffer
+	if err := EncodeThumbnail(&buf, thumb, format); err != nil {
+		return nil, 0, 0, err
+	}
+	b := thumb.Bounds()
+	return buf.Bytes(), b.Dx(), b.Dy(), nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnail(t *testing.T) {
+	t.Run("Orientation", func(t *testing.T) {
+		// 2x1 图片：左红右蓝
+		src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+		src.Set(0, 0, color.RGBA{R: 255, A: 255})
+		src.Set(1, 0, color.RGBA{B: 255, A: 255})
+
+		// 顺时针旋转 90° 后变为 1x2，红色在上
+		rotated := applyOrientation(src, 6)
+		assert.Equal(t, image.Rect(0, 0, 1, 2), rotated.Bounds())
+		r, _, _, _ := rotated.At(0, 0).RGBA()
+		assert.Equal(t, uint32(0xffff), r)
+
+		// 水平翻转后蓝色在左
+		flipped := applyOrientation(src, 2)
+		_, _, b, _ := flipped.At(0, 0).RGBA()
+		assert.Equal(t, uint32(0xffff), b)
+
+		// 方向 1 原样返回
+		assert.Equal(t, image.Image(src), applyOrientation(src, 1))
+	})
+
+	t.Run("ResizeToFit", func(t *testing.T) {
+		src := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+		assert.Equal(t, image.Rect(0, 0, 200, 100), ResizeToFit(src, 200).Bounds())
+
+		tall := image.NewRGBA(image.Rect(0, 0, 300, 900))
+		assert.Equal(t, image.Rect(0, 0, 100, 300), ResizeToFit(tall, 300).Bounds())
+
+		// 小图不放大
+		small := image.NewRGBA(image.Rect(0, 0, 50, 40))
+		assert.Equal(t, image.Rect(0, 0, 50, 40), ResizeToFit(small, 200).Bounds())
+	})
+
+	t.Run("MakeThumbnail", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 800, 600))))
+
+		for _, format := range []string{ThumbJPEG, ThumbWebP} {
+			out, w, h, err := MakeThumbnail(buf.Bytes(), 200, format)
+			assert.NoError(t, err)
+			assert.Equal(t, 200, w)
+			assert.Equal(t, 150, h)
+
+			img, name, err := image.Decode(bytes.NewReader(out))
+			assert.NoError(t, err)
+			assert.Equal(t, format, name)
+			assert.Equal(t, image.Rect(0, 0, 200, 150), img.Bounds())
+		}
+
+		_, _, _, err := MakeThumbnail([]byte("not an image"), 200, ThumbJPEG)
+		assert.Error(t, err)
+	})
+}
@@ -87,9 +87,9 @@ const AllShares: React.FC = () => {
     },
     {
       title: '提取码',
-      dataIndex: 'password',
-      key: 'password',
-      render: (pwd: string) => pwd ? <Tag color="blue">{pwd}</Tag> : <Tag>无</Tag>,
+      dataIndex: 'hasPassword',
+      key: 'hasPassword',
+      render: (hasPassword: boolean) => hasPassword ? <Tag color="blue">已设置</Tag> : <Tag>无</Tag>,
     },
     {
       title: '到期时间',
@@ -30,20 +30,23 @@ const ShareView: React.FC = () => {
   const [currentPath, setCurrentPath] = useState<any[]>([]);
   const [currentFolderId, setCurrentFolderId] = useState<number | null>(null);
 
-  const fetchShareData = async (pwd?: string) => {
+  // 分享接口通过 Cookie 携带提取码校验后签发的访问令牌
+  const shareRequest = { withCredentials: true };
+
+  const fetchShareData = async (verified = false) => {
     setLoading(true);
     try {
-      const res: any = await request.get(`/share/${token}${pwd ? `?password=${pwd}` : ''}`);
+      const res: any = await request.get(`/share/info/${token}`, shareRequest);
       setShareInfo(res.share);
       setFileInfo(res.file);
       
-      if (res.share.hasPassword && !pwd) {
+      if (res.share.hasPassword && !verified) {
         setIsLocked(true);
       } else {
         setIsLocked(false);
         // 如果是文件夹，获取列表
-        if (res.file.is_dir || res.file.IsFolder) {
-          fetchFolderList(null, pwd);
+        if (res.file.isFolder) {
+          fetchFolderList(null);
         }
       }
     } catch (err: any) {
@@ -57,11 +60,11 @@ const ShareView: React.FC = () => {
     }
   };
 
-  const fetchFolderList = async (parentId: number | null, pwd?: string) => {
+  const fetchFolderList = async (parentId: number | null) => {
     try {
-      const res: any = await request.get(`/share/${token}/list`, {
+      const res: any = await request.get(`/share/list/${token}`, {
+        ...shareRequest,
         params: {
-          password: pwd || password,
           parentId: parentId || undefined
         }
       });
@@ -78,12 +81,19 @@ const ShareView: React.FC = () => {
     fetchShareData();
   }, [token]);
 
-  const handleVerify = () => {
+  const handleVerify = async () => {
     if (!password) {
       antdGlobal.message.warning('请输入提取码');
       return;
     }
-    fetchShareData(password);
+    try {
+      // 校验通过后服务端写入访问 Cookie，后续请求与下载不再携带提取码
+      await request.post(`/share/verify/${token}`, { password }, shareRequest);
+      setPassword('');
+      fetchShareData(true);
+    } catch {
+      // 错误提示由请求拦截器统一处理
+    }
   };
 
   const handleFolderClick = (record: any) => {
@@ -110,7 +120,7 @@ const ShareView: React.FC = () => {
 
   const handleDownload = (record?: any) => {
     const targetFile = record || fileInfo;
-    const url = `${import.meta.env.VITE_API_BASE_URL}/share/${token}/download?password=${password}&fileId=${targetFile.ID || ''}`;
+    const url = `${request.defaults.baseURL}/share/download/${token}?fileId=${targetFile.ID || ''}`;
     window.open(url);
   };
 
@@ -122,12 +132,11 @@ const ShareView: React.FC = () => {
     }
     try {
       const targetFile = record || fileInfo;
-      await request.post(`/share/${token}/save`, {
-        password,
+      await request.post(`/share/save/${token}`, {
         fileId: targetFile.ID,
-        targetParentId: 0 // 默认保存到根目录
-      });
-      antdGlobal.message.success('保存成功！已存入您的网盘根目录');
+        parentId: 0 // 默认保存到根目录
+      }, shareRequest);
+      antdGlobal.message.success('已提交转存任务，完成后将出现在您的网盘根目录');
     } catch (err) {
       antdGlobal.message.error('保存失败');
     }
@@ -75,9 +75,9 @@ const Shares: React.FC = () => {
     },
     {
       title: '提取码',
-      dataIndex: 'password',
-      key: 'password',
-      render: (pwd: string) => pwd ? <Tag color="blue">{pwd}</Tag> : <Tag>无</Tag>,
+      dataIndex: 'hasPassword',
+      key: 'hasPassword',
+      render: (hasPassword: boolean) => hasPassword ? <Tag color="blue">已设置</Tag> : <Tag>无</Tag>,
     },
     {
       title: '浏览/下载',